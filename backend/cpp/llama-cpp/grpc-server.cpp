@@ -124,6 +124,11 @@ json parse_options(bool streaming, const backend::PredictOptions* predict)
     // Add the correlationid to json data
     data["correlation_id"] = predict->correlationid();
 
+    // Pin the prediction to a slot, e.g. the one holding the longest prefix of the prompt
+    if (predict->has_slotid()) {
+        data["id_slot"] = predict->slotid();
+    }
+
     // for each image in the request, add the image data
     //
     for (int i = 0; i < predict->images_size(); i++) {
@@ -537,6 +542,7 @@ public:
                         reply.set_timing_prompt_processing(timing_prompt_processing);
                         double timing_token_generation = res.at("timings").value("predicted_ms", 0.0);
                         reply.set_timing_token_generation(timing_token_generation);
+                        reply.set_prompt_tokens_cached(res.at("timings").value("cache_n", 0));
                     }
 
                     // Log Request Correlation Id
@@ -559,6 +565,7 @@ public:
                     reply.set_timing_prompt_processing(timing_prompt_processing);
                     double timing_token_generation = res_json.at("timings").value("predicted_ms", 0.0);
                     reply.set_timing_token_generation(timing_token_generation);
+                    reply.set_prompt_tokens_cached(res_json.at("timings").value("cache_n", 0));
                 }
 
                 
@@ -731,6 +738,7 @@ public:
                     reply->set_timing_prompt_processing(timing_prompt_processing);
                     double timing_token_generation = results[0]->to_json().at("timings").value("predicted_ms", 0.0);
                     reply->set_timing_token_generation(timing_token_generation);
+                    reply->set_prompt_tokens_cached(results[0]->to_json().at("timings").value("cache_n", 0));
                 }
 
             } else {
@@ -0,0 +1,265 @@
+package main
+
+// Filters on the metadata of the keys. A filter is a JSON object whose fields are conditions that must all hold:
+//
+//	{"type": "article"}                               the field equals the value
+//	{"year": {"$gte": 2020, "$lt": 2024}}             range, on numbers or strings
+//	{"lang": {"$in": ["en", "fr"]}}                   the field is one of the values, $nin for none of them
+//	{"draft": {"$ne": true}}                          the field does not equal the value
+//	{"author": {"$exists": true}}                     the field is set, or not
+//	{"$or": [{"type": "article"}, {"pinned": true}]}  any of the filters holds, $and for all of them
+//
+// Fields of nested objects are addressed with dots, e.g. "author.name". A condition on a field holding an array
+// holds if it holds for one of its elements.
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+type metadataFilter func(fields map[string]any) bool
+
+// entryMetadata is the metadata of a key, as given and parsed
+type entryMetadata struct {
+	raw    []byte
+	fields map[string]any
+}
+
+// parseMetadata parses the metadata of a key, a key without metadata has empty or null metadata
+func parseMetadata(raw []byte) (entryMetadata, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return entryMetadata{}, nil
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(raw, &fields); err != nil || fields == nil {
+		return entryMetadata{}, fmt.Errorf("the metadata must be a JSON object: %s", raw)
+	}
+	return entryMetadata{raw: raw, fields: fields}, nil
+}
+
+func parseFilter(raw []byte) (metadataFilter, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	var expr map[string]any
+	if err := json.Unmarshal(raw, &expr); err != nil || expr == nil {
+		return nil, fmt.Errorf("the filter must be a JSON object: %s", raw)
+	}
+	return compileFilter(expr)
+}
+
+func compileFilter(expr map[string]any) (metadataFilter, error) {
+	conditions := make([]metadataFilter, 0, len(expr))
+	for key, operand := range expr {
+		var condition metadataFilter
+		var err error
+		switch {
+		case key == "$and" || key == "$or":
+			condition, err = compileLogical(key, operand)
+		case strings.HasPrefix(key, "$"):
+			err = fmt.Errorf("unknown filter operator %s", key)
+		default:
+			condition, err = compileField(key, operand)
+		}
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, condition)
+	}
+
+	return func(fields map[string]any) bool {
+		for _, c := range conditions {
+			if !c(fields) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+func compileLogical(op string, operand any) (metadataFilter, error) {
+	exprs, ok := operand.([]any)
+	if !ok || len(exprs) == 0 {
+		return nil, fmt.Errorf("%s expects a non empty array of filters", op)
+	}
+	filters := make([]metadataFilter, len(exprs))
+	for i, e := range exprs {
+		expr, ok := e.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%s expects a non empty array of filters", op)
+		}
+		f, err := compileFilter(expr)
+		if err != nil {
+			return nil, err
+		}
+		filters[i] = f
+	}
+
+	or := op == "$or"
+	return func(fields map[string]any) bool {
+		for _, f := range filters {
+			if f(fields) == or {
+				return or
+			}
+		}
+		return !or
+	}, nil
+}
+
+// compileField compiles the conditions on a field: a value to compare it with, or an object of operators
+func compileField(path string, operand any) (metadataFilter, error) {
+	operators, ok := operand.(map[string]any)
+	if !ok || len(operators) == 0 || !isOperatorObject(operators) {
+		return fieldMatches(path, func(v any) bool { return equalValues(v, operand) }), nil
+	}
+
+	conditions := make([]metadataFilter, 0, len(operators))
+	for op, value := range operators {
+		var condition metadataFilter
+		switch op {
+		case "$eq":
+			condition = fieldMatches(path, func(v any) bool { return equalValues(v, value) })
+		case "$ne":
+			eq := fieldMatches(path, func(v any) bool { return equalValues(v, value) })
+			condition = func(fields map[string]any) bool { return !eq(fields) }
+		case "$gt", "$gte", "$lt", "$lte":
+			if !isOrdered(value) {
+				return nil, fmt.Errorf("%s expects a number or a string for the field %s", op, path)
+			}
+			condition = fieldMatches(path, rangeCondition(op, value))
+		case "$in", "$nin":
+			values, ok := value.([]any)
+			if !ok {
+				return nil, fmt.Errorf("%s expects an array for the field %s", op, path)
+			}
+			in := fieldMatches(path, func(v any) bool {
+				for _, candidate := range values {
+					if equalValues(v, candidate) {
+						return true
+					}
+				}
+				return false
+			})
+			if op == "$in" {
+				condition = in
+			} else {
+				condition = func(fields map[string]any) bool { return !in(fields) }
+			}
+		case "$exists":
+			exists, ok := value.(bool)
+			if !ok {
+				return nil, fmt.Errorf("$exists expects a boolean for the field %s", path)
+			}
+			condition = func(fields map[string]any) bool {
+				_, found := lookupField(fields, path)
+				return found == exists
+			}
+		default:
+			return nil, fmt.Errorf("unknown filter operator %s for the field %s", op, path)
+		}
+		conditions = append(conditions, condition)
+	}
+
+	return func(fields map[string]any) bool {
+		for _, c := range conditions {
+			if !c(fields) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+func isOperatorObject(m map[string]any) bool {
+	for k := range m {
+		if !strings.HasPrefix(k, "$") {
+			return false
+		}
+	}
+	return true
+}
+
+// fieldMatches holds if the field is set and matches, or one of its elements if it is an array
+func fieldMatches(path string, match func(any) bool) metadataFilter {
+	return func(fields map[string]any) bool {
+		v, found := lookupField(fields, path)
+		if !found {
+			return false
+		}
+		if match(v) {
+			return true
+		}
+		if elements, ok := v.([]any); ok {
+			for _, e := range elements {
+				if match(e) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
+
+func lookupField(fields map[string]any, path string) (any, bool) {
+	var current any = fields
+	for _, name := range strings.Split(path, ".") {
+		object, ok := current.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		current, ok = object[name]
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func equalValues(a, b any) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+func isOrdered(v any) bool {
+	switch v.(type) {
+	case float64, string:
+		return true
+	}
+	return false
+}
+
+func rangeCondition(op string, bound any) func(any) bool {
+	return func(v any) bool {
+		var c int
+		switch b := bound.(type) {
+		case float64:
+			f, ok := v.(float64)
+			if !ok {
+				return false
+			}
+			switch {
+			case f < b:
+				c = -1
+			case f > b:
+				c = 1
+			}
+		case string:
+			s, ok := v.(string)
+			if !ok {
+				return false
+			}
+			c = strings.Compare(s, b)
+		}
+
+		switch op {
+		case "$gt":
+			return c > 0
+		case "$gte":
+			return c >= 0
+		case "$lt":
+			return c < 0
+		}
+		return c <= 0
+	}
+}
@@ -0,0 +1,383 @@
+package main
+
+// Hierarchical Navigable Small World graph (Malkov & Yashunin, https://arxiv.org/abs/1603.09320)
+// indexing the keys of the store for approximate nearest neighbour search. The index only holds
+// the keys, the values are looked up in the sorted keys of the store.
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand"
+	"slices"
+	"strconv"
+)
+
+const (
+	defaultHNSWM              = 16
+	defaultHNSWEfConstruction = 200
+	defaultHNSWEfSearch       = 64
+	// Stores smaller than this are scanned exactly, it is as fast and exact
+	defaultHNSWExactBelow = 1000
+)
+
+type hnswConfig struct {
+	// M is the number of neighbours of the nodes, twice that on the bottom layer
+	M int
+	// EfConstruction and EfSearch are the number of candidates considered when inserting and searching,
+	// the higher the better the recall and the slower
+	EfConstruction int
+	EfSearch       int
+	// ExactBelow is the number of keys under which the store is scanned exactly
+	ExactBelow int
+}
+
+func defaultHNSWConfig() hnswConfig {
+	return hnswConfig{
+		M:              defaultHNSWM,
+		EfConstruction: defaultHNSWEfConstruction,
+		EfSearch:       defaultHNSWEfSearch,
+		ExactBelow:     defaultHNSWExactBelow,
+	}
+}
+
+// setOption sets the hnsw_* option key, it returns false for the other options
+func (c *hnswConfig) setOption(key, value string) (bool, error) {
+	var field *int
+	switch key {
+	case "hnsw_m":
+		field = &c.M
+	case "hnsw_ef_construction":
+		field = &c.EfConstruction
+	case "hnsw_ef_search":
+		field = &c.EfSearch
+	case "hnsw_exact_below":
+		field = &c.ExactBelow
+	default:
+		return false, nil
+	}
+
+	v, err := strconv.Atoi(value)
+	if err != nil || v < 0 || (v == 0 && field != &c.ExactBelow) {
+		return true, fmt.Errorf("invalid value %q for the option %s", value, key)
+	}
+	*field = v
+
+	return true, nil
+}
+
+type hnswNode struct {
+	key     []float32
+	invNorm float32
+	// The neighbours of the node on each of its layers
+	neighbors [][]int32
+	deleted   bool
+}
+
+type hnswIndex struct {
+	config hnswConfig
+	nodes  []hnswNode
+	ids    map[string]int32
+	entry  int32
+	// The number of deleted nodes still in the graph
+	deleted int
+
+	levelMult float64
+	rnd       *rand.Rand
+
+	// visited marks the nodes visited by the current search with visitTag
+	visited  []uint32
+	visitTag uint32
+}
+
+func newHNSWIndex(config hnswConfig) *hnswIndex {
+	return &hnswIndex{
+		config:    config,
+		ids:       make(map[string]int32),
+		entry:     -1,
+		levelMult: 1 / math.Log(float64(max(config.M, 2))),
+		rnd:       rand.New(rand.NewSource(1)),
+	}
+}
+
+func hnswID(key []float32) string {
+	b := make([]byte, 0, len(key)*4)
+	for _, v := range key {
+		b = binary.LittleEndian.AppendUint32(b, math.Float32bits(v))
+	}
+	return string(b)
+}
+
+func inverseNorm(key []float32) float32 {
+	var sum float64
+	for _, v := range key {
+		sum += float64(v) * float64(v)
+	}
+	if sum == 0 {
+		return 0
+	}
+	return float32(1 / math.Sqrt(sum))
+}
+
+// similarity is the cosine similarity of the query with the node
+func (h *hnswIndex) similarity(q []float32, qInvNorm float32, id int32) float32 {
+	n := &h.nodes[id]
+	var dot float32
+	for i, v := range n.key {
+		dot += q[i] * v
+	}
+	return dot * qInvNorm * n.invNorm
+}
+
+func (h *hnswIndex) maxNeighbors(level int) int {
+	if level == 0 {
+		return h.config.M * 2
+	}
+	return h.config.M
+}
+
+// insert adds the key to the index, keys already in the index are ignored
+func (h *hnswIndex) insert(key []float32) {
+	id := hnswID(key)
+	if _, ok := h.ids[id]; ok {
+		return
+	}
+
+	level := int(-math.Log(1-h.rnd.Float64()) * h.levelMult)
+	n := int32(len(h.nodes))
+	h.nodes = append(h.nodes, hnswNode{
+		key:       key,
+		invNorm:   inverseNorm(key),
+		neighbors: make([][]int32, level+1),
+	})
+	h.ids[id] = n
+
+	if h.entry == -1 {
+		h.entry = n
+		return
+	}
+
+	qInvNorm := h.nodes[n].invNorm
+	top := len(h.nodes[h.entry].neighbors) - 1
+	ep := []simItem{{id: h.entry, sim: h.similarity(key, qInvNorm, h.entry)}}
+	for l := top; l > level; l-- {
+		ep = h.searchLayer(key, qInvNorm, ep, 1, l)
+	}
+
+	for l := min(top, level); l >= 0; l-- {
+		candidates := h.searchLayer(key, qInvNorm, ep, h.config.EfConstruction, l)
+		neighbors := h.selectNeighbors(candidates, h.config.M)
+		h.nodes[n].neighbors[l] = neighbors
+
+		for _, nb := range neighbors {
+			links := append(h.nodes[nb].neighbors[l], n)
+			if len(links) > h.maxNeighbors(l) {
+				links = h.shrink(nb, links, h.maxNeighbors(l))
+			}
+			h.nodes[nb].neighbors[l] = links
+		}
+		ep = candidates
+	}
+
+	if level > top {
+		h.entry = n
+	}
+}
+
+// remove marks the key as deleted: it is still used to navigate the graph but is not returned anymore.
+// The graph is rebuilt from the remaining keys once most of it is deleted.
+func (h *hnswIndex) remove(key []float32) {
+	id := hnswID(key)
+	n, ok := h.ids[id]
+	if !ok {
+		return
+	}
+	delete(h.ids, id)
+	h.nodes[n].deleted = true
+	h.deleted++
+
+	if h.deleted > len(h.nodes)/2 {
+		keys := make([][]float32, 0, len(h.ids))
+		for _, node := range h.nodes {
+			if !node.deleted {
+				keys = append(keys, node.key)
+			}
+		}
+		h.rebuild(keys)
+	}
+}
+
+func (h *hnswIndex) rebuild(keys [][]float32) {
+	*h = *newHNSWIndex(h.config)
+	for _, k := range keys {
+		h.insert(k)
+	}
+}
+
+// search returns the keys of the index approximately the most similar to the query, best first.
+// Only the keys accepted by accept are returned, if it is set.
+func (h *hnswIndex) search(q []float32, k int, accept func([]float32) bool) [][]float32 {
+	if h.entry == -1 {
+		return nil
+	}
+
+	qInvNorm := inverseNorm(q)
+	ep := []simItem{{id: h.entry, sim: h.similarity(q, qInvNorm, h.entry)}}
+	for l := len(h.nodes[h.entry].neighbors) - 1; l > 0; l-- {
+		ep = h.searchLayer(q, qInvNorm, ep, 1, l)
+	}
+	candidates := h.searchLayer(q, qInvNorm, ep, max(h.config.EfSearch, k), 0)
+
+	keys := make([][]float32, 0, k)
+	for _, c := range candidates {
+		if len(keys) == k {
+			break
+		}
+		if !h.nodes[c.id].deleted && (accept == nil || accept(h.nodes[c.id].key)) {
+			keys = append(keys, h.nodes[c.id].key)
+		}
+	}
+
+	return keys
+}
+
+// searchLayer returns the ef nodes of the layer the most similar to the query found from the entry points, best first
+func (h *hnswIndex) searchLayer(q []float32, qInvNorm float32, entryPoints []simItem, ef int, level int) []simItem {
+	if len(h.visited) < len(h.nodes) {
+		h.visited = append(h.visited, make([]uint32, max(len(h.nodes)-len(h.visited), len(h.visited)))...)
+	}
+	h.visitTag++
+	if h.visitTag == 0 {
+		clear(h.visited)
+		h.visitTag = 1
+	}
+
+	candidates := make(maxSimHeap, 0, ef)
+	results := make(minSimHeap, 0, ef+1)
+	for _, e := range entryPoints {
+		h.visited[e.id] = h.visitTag
+		heap.Push(&candidates, e)
+		heap.Push(&results, e)
+		if results.Len() > ef {
+			heap.Pop(&results)
+		}
+	}
+
+	for candidates.Len() > 0 {
+		c := heap.Pop(&candidates).(simItem)
+		if results.Len() >= ef && c.sim < results[0].sim {
+			break
+		}
+
+		for _, nb := range h.nodes[c.id].neighbors[level] {
+			if h.visited[nb] == h.visitTag {
+				continue
+			}
+			h.visited[nb] = h.visitTag
+
+			sim := h.similarity(q, qInvNorm, nb)
+			if results.Len() < ef || sim > results[0].sim {
+				heap.Push(&candidates, simItem{id: nb, sim: sim})
+				heap.Push(&results, simItem{id: nb, sim: sim})
+				if results.Len() > ef {
+					heap.Pop(&results)
+				}
+			}
+		}
+	}
+
+	found := make([]simItem, results.Len())
+	for i := len(found) - 1; i >= 0; i-- {
+		found[i] = heap.Pop(&results).(simItem)
+	}
+
+	return found
+}
+
+// selectNeighbors picks up to m neighbours among the candidates sorted best first, preferring the candidates
+// more similar to the node than to the neighbours already picked so that the links span the graph (heuristic
+// of the paper), then the most similar ones
+func (h *hnswIndex) selectNeighbors(candidates []simItem, m int) []int32 {
+	selected := make([]int32, 0, m)
+	pruned := make([]int32, 0, len(candidates))
+
+	for _, c := range candidates {
+		if len(selected) == m {
+			break
+		}
+		keep := true
+		for _, s := range selected {
+			if h.similarity(h.nodes[c.id].key, h.nodes[c.id].invNorm, s) > c.sim {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			selected = append(selected, c.id)
+		} else {
+			pruned = append(pruned, c.id)
+		}
+	}
+	for _, p := range pruned {
+		if len(selected) == m {
+			break
+		}
+		selected = append(selected, p)
+	}
+
+	return selected
+}
+
+// shrink reduces the links of the node to m
+func (h *hnswIndex) shrink(n int32, links []int32, m int) []int32 {
+	node := &h.nodes[n]
+	candidates := make([]simItem, len(links))
+	for i, l := range links {
+		candidates[i] = simItem{id: l, sim: h.similarity(node.key, node.invNorm, l)}
+	}
+	slices.SortFunc(candidates, func(a, b simItem) int {
+		switch {
+		case a.sim > b.sim:
+			return -1
+		case a.sim < b.sim:
+			return 1
+		}
+		return 0
+	})
+
+	return h.selectNeighbors(candidates, m)
+}
+
+type simItem struct {
+	id  int32
+	sim float32
+}
+
+// maxSimHeap pops the most similar item first
+type maxSimHeap []simItem
+
+func (h maxSimHeap) Len() int           { return len(h) }
+func (h maxSimHeap) Less(i, j int) bool { return h[i].sim > h[j].sim }
+func (h maxSimHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *maxSimHeap) Push(x any)        { *h = append(*h, x.(simItem)) }
+func (h *maxSimHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// minSimHeap pops the least similar item first
+type minSimHeap []simItem
+
+func (h minSimHeap) Len() int           { return len(h) }
+func (h minSimHeap) Less(i, j int) bool { return h[i].sim < h[j].sim }
+func (h minSimHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *minSimHeap) Push(x any)        { *h = append(*h, x.(simItem)) }
+func (h *minSimHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
@@ -20,7 +20,7 @@ func main() {
 
 	flag.Parse()
 
-	if err := grpc.StartServer(*addr, NewStore()); err != nil {
+	if err := grpc.StartServer(*addr, NewNamespaces()); err != nil {
 		panic(err)
 	}
 }
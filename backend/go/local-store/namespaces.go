@@ -0,0 +1,157 @@
+package main
+
+// Namespaces split a store into independent stores sharing the options of the model, so that a single
+// backend serves many logical indexes, e.g. one per tenant. The default namespace is the empty one.
+// Each namespace is persisted in its own directory under the persistence path of the store.
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/mudler/LocalAI/pkg/grpc/base"
+	pb "github.com/mudler/LocalAI/pkg/grpc/proto"
+)
+
+const namespacesDir = "namespaces"
+
+// A namespace starts with a letter or a digit, so that "." and ".." can't point to the directory of another store
+var validNamespace = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+type Namespaces struct {
+	base.SingleThread
+
+	options    *pb.ModelOptions
+	persisted  string
+	namespaces map[string]*Store
+}
+
+func NewNamespaces() *Namespaces {
+	return &Namespaces{
+		namespaces: make(map[string]*Store),
+	}
+}
+
+// Load loads the default namespace and the namespaces persisted with it
+func (n *Namespaces) Load(opts *pb.ModelOptions) error {
+	if n.options != nil {
+		return fmt.Errorf("the store is already loaded")
+	}
+	n.options = opts
+	for _, o := range opts.Options {
+		if key, value, _ := strings.Cut(o, ":"); key == "persistence_path" {
+			n.persisted = value
+		}
+	}
+
+	if _, err := n.namespace("", true); err != nil {
+		return err
+	}
+
+	if n.persisted == "" {
+		return nil
+	}
+	entries, err := os.ReadDir(filepath.Join(n.persisted, namespacesDir))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, e := range entries {
+		if e.IsDir() && validNamespace.MatchString(e.Name()) {
+			if _, err := n.namespace(e.Name(), true); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// namespace returns the store of the namespace, it is created if create is set and nil otherwise
+func (n *Namespaces) namespace(name string, create bool) (*Store, error) {
+	if s, ok := n.namespaces[name]; ok {
+		return s, nil
+	}
+	if name != "" && !validNamespace.MatchString(name) {
+		return nil, fmt.Errorf("invalid namespace %q, only letters, digits, '_', '-' and '.' are allowed, starting with a letter or a digit", name)
+	}
+	if !create {
+		return nil, nil
+	}
+	if n.options == nil {
+		return nil, fmt.Errorf("the store is not loaded")
+	}
+
+	opts := n.options
+	if name != "" && n.persisted != "" {
+		options := make([]string, 0, len(opts.Options))
+		for _, o := range opts.Options {
+			if !strings.HasPrefix(o, "persistence_path:") {
+				options = append(options, o)
+			}
+		}
+		options = append(options, "persistence_path:"+filepath.Join(n.persisted, namespacesDir, name))
+		opts = &pb.ModelOptions{Options: options}
+	}
+
+	s := NewStore()
+	if err := s.Load(opts); err != nil {
+		return nil, fmt.Errorf("unable to load the namespace %q: %w", name, err)
+	}
+	n.namespaces[name] = s
+
+	return s, nil
+}
+
+func (n *Namespaces) StoresSet(opts *pb.StoresSetOptions) error {
+	s, err := n.namespace(opts.Namespace, true)
+	if err != nil {
+		return err
+	}
+	return s.StoresSet(opts)
+}
+
+func (n *Namespaces) StoresDelete(opts *pb.StoresDeleteOptions) error {
+	s, err := n.namespace(opts.Namespace, false)
+	if err != nil || s == nil {
+		return err
+	}
+	return s.StoresDelete(opts)
+}
+
+func (n *Namespaces) StoresGet(opts *pb.StoresGetOptions) (pb.StoresGetResult, error) {
+	s, err := n.namespace(opts.Namespace, false)
+	if err != nil || s == nil {
+		return pb.StoresGetResult{}, err
+	}
+	return s.StoresGet(opts)
+}
+
+// StoresFind finds nothing in a namespace without keys
+func (n *Namespaces) StoresFind(opts *pb.StoresFindOptions) (pb.StoresFindResult, error) {
+	s, err := n.namespace(opts.Namespace, false)
+	if err != nil || s == nil {
+		return pb.StoresFindResult{}, err
+	}
+	return s.StoresFind(opts)
+}
+
+func (n *Namespaces) StoresSnapshot(opts *pb.StoresSnapshotOptions) (pb.StoresSnapshotResult, error) {
+	s, err := n.namespace(opts.Namespace, false)
+	if err != nil {
+		return pb.StoresSnapshotResult{}, err
+	}
+	if s == nil {
+		return pb.StoresSnapshotResult{}, fmt.Errorf("unknown namespace %q", opts.Namespace)
+	}
+	return s.StoresSnapshot(opts)
+}
+
+func (n *Namespaces) StoresRestore(opts *pb.StoresSnapshotOptions) (pb.StoresSnapshotResult, error) {
+	s, err := n.namespace(opts.Namespace, true)
+	if err != nil {
+		return pb.StoresSnapshotResult{}, err
+	}
+	return s.StoresRestore(opts)
+}
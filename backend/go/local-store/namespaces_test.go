@@ -0,0 +1,25 @@
+package main
+
+import (
+	"testing"
+
+	pb "github.com/mudler/LocalAI/pkg/grpc/proto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNamespaceNames(t *testing.T) {
+	n := NewNamespaces()
+	require.NoError(t, n.Load(&pb.ModelOptions{Options: []string{"persistence_path:" + t.TempDir()}}))
+
+	for _, name := range []string{"tenant-1", "docs.v2", "a_b"} {
+		s, err := n.namespace(name, true)
+		require.NoError(t, err, name)
+		require.NotNil(t, s, name)
+	}
+
+	// These would share the files of the default store, or of the stores of other paths
+	for _, name := range []string{".", "..", "../other", ".hidden", "-x", "a/b"} {
+		_, err := n.namespace(name, true)
+		require.Error(t, err, name)
+	}
+}
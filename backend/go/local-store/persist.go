@@ -0,0 +1,516 @@
+package main
+
+// Durable storage of the store: every change is appended to a write-ahead log before being applied in memory,
+// and the log is compacted into a snapshot of the whole store once it grows larger than the snapshot.
+// Load() restores the snapshot and replays the log on top of it.
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+
+	pb "github.com/mudler/LocalAI/pkg/grpc/proto"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	snapshotFile = "snapshot.bin"
+	walFile      = "wal.log"
+
+	// Snapshots with the metadata of the keys, the ones without are still read
+	snapshotMagic       = "LSTORE02"
+	snapshotMagicNoMeta = "LSTORE01"
+
+	walOpSet    byte = 1
+	walOpDelete byte = 2
+	// walOpSetMetadata is walOpSet followed by the metadata of the keys
+	walOpSetMetadata byte = 3
+
+	// The log is not compacted before it reaches this size, whatever the size of the snapshot
+	minCompactionSize = 16 << 20
+)
+
+var errCorruptRecord = errors.New("corrupt record")
+
+type persistence struct {
+	dir          string
+	wal          *os.File
+	walSize      int64
+	snapshotSize int64
+}
+
+// openPersistence restores the store persisted in dir into s and opens its log for appending
+func openPersistence(dir string, s *Store) (*persistence, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("unable to create the store directory: %w", err)
+	}
+
+	p := &persistence{dir: dir}
+
+	snapshot := filepath.Join(dir, snapshotFile)
+	if st, err := os.Stat(snapshot); err == nil {
+		if err := readSnapshot(snapshot, s); err != nil {
+			return nil, fmt.Errorf("unable to read the snapshot of the store: %w", err)
+		}
+		p.snapshotSize = st.Size()
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	wal, err := os.OpenFile(filepath.Join(dir, walFile), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	size, err := replayWAL(wal, s)
+	if err != nil {
+		wal.Close()
+		return nil, fmt.Errorf("unable to replay the log of the store: %w", err)
+	}
+	p.wal = wal
+	p.walSize = size
+
+	log.Debug().Str("dir", dir).Int("entries", len(s.keys)).Int64("log", size).Msg("Restored the store")
+
+	return p, nil
+}
+
+// StoresSnapshot writes the content of the store to opts.Path or, when it is empty, compacts the persisted store
+func (s *Store) StoresSnapshot(opts *pb.StoresSnapshotOptions) (pb.StoresSnapshotResult, error) {
+	path := opts.Path
+	if path == "" {
+		if s.persistence == nil {
+			return pb.StoresSnapshotResult{}, errors.New("the store is not persisted, a snapshot path is required")
+		}
+		if err := s.persistence.compact(s); err != nil {
+			return pb.StoresSnapshotResult{}, err
+		}
+		path = filepath.Join(s.persistence.dir, snapshotFile)
+	} else if _, err := writeSnapshot(path, s); err != nil {
+		return pb.StoresSnapshotResult{}, err
+	}
+
+	return pb.StoresSnapshotResult{Path: path, Entries: int64(len(s.keys))}, nil
+}
+
+// StoresRestore replaces the content of the store with the snapshot at opts.Path or, when it is empty, with its
+// persisted state. A restored snapshot is persisted with the store.
+func (s *Store) StoresRestore(opts *pb.StoresSnapshotOptions) (pb.StoresSnapshotResult, error) {
+	restored := NewStore()
+	path := opts.Path
+	if path == "" {
+		if s.persistence == nil {
+			return pb.StoresSnapshotResult{}, errors.New("the store is not persisted, a snapshot path is required")
+		}
+		p, err := openPersistence(s.persistence.dir, restored)
+		if err != nil {
+			return pb.StoresSnapshotResult{}, err
+		}
+		s.persistence.close()
+		restored.persistence = p
+		path = filepath.Join(p.dir, snapshotFile)
+	} else {
+		if err := readSnapshot(path, restored); err != nil {
+			return pb.StoresSnapshotResult{}, err
+		}
+		restored.persistence = s.persistence
+	}
+
+	s.keys, s.values, s.metadata = restored.keys, restored.values, restored.metadata
+	s.keyLen, s.keysAreNormalized = restored.keyLen, restored.keysAreNormalized
+	s.persistence = restored.persistence
+	s.reindex()
+
+	if opts.Path != "" && s.persistence != nil {
+		if err := s.persistence.compact(s); err != nil {
+			return pb.StoresSnapshotResult{}, fmt.Errorf("the snapshot was restored but could not be persisted: %w", err)
+		}
+	}
+
+	return pb.StoresSnapshotResult{Path: path, Entries: int64(len(s.keys))}, nil
+}
+
+// maybeCompact compacts the log once it grew too large. The changes are already in the log, so
+// a failure is only logged and compaction is retried on the next change.
+func (s *Store) maybeCompact() {
+	if s.persistence == nil || !s.persistence.needsCompaction() {
+		return
+	}
+	if err := s.persistence.compact(s); err != nil {
+		log.Error().Err(err).Str("dir", s.persistence.dir).Msg("unable to compact the log of the store")
+	}
+}
+
+func (p *persistence) logSet(opts *pb.StoresSetOptions) error {
+	op := walOpSet
+	if len(opts.Metadata) > 0 {
+		op = walOpSetMetadata
+	}
+	payload := appendKeys([]byte{op}, opts.Keys)
+	for _, v := range opts.Values {
+		payload = appendBytes(payload, v.Bytes)
+	}
+	for _, m := range opts.Metadata {
+		payload = appendBytes(payload, m)
+	}
+
+	return p.append(payload)
+}
+
+func (p *persistence) logDelete(opts *pb.StoresDeleteOptions) error {
+	return p.append(appendKeys([]byte{walOpDelete}, opts.Keys))
+}
+
+// append writes a record to the log and syncs it. A record is the length and the checksum of its payload,
+// followed by the payload
+func (p *persistence) append(payload []byte) error {
+	record := make([]byte, 8, 8+len(payload))
+	binary.LittleEndian.PutUint32(record, uint32(len(payload)))
+	binary.LittleEndian.PutUint32(record[4:], crc32.ChecksumIEEE(payload))
+	record = append(record, payload...)
+
+	if _, err := p.wal.Write(record); err != nil {
+		// Drop what could have been written of the record, so that the next ones are not lost behind it
+		if terr := p.wal.Truncate(p.walSize); terr != nil {
+			log.Error().Err(terr).Msg("unable to truncate the log of the store")
+		}
+		if _, serr := p.wal.Seek(p.walSize, io.SeekStart); serr != nil {
+			log.Error().Err(serr).Msg("unable to seek the log of the store")
+		}
+		return err
+	}
+	if err := p.wal.Sync(); err != nil {
+		return err
+	}
+	p.walSize += int64(len(record))
+
+	return nil
+}
+
+func (p *persistence) needsCompaction() bool {
+	return p.walSize > max(p.snapshotSize, minCompactionSize)
+}
+
+// compact writes a snapshot of s and empties the log. Changes being idempotent, a crash before
+// the log is truncated only replays changes the snapshot already contains.
+func (p *persistence) compact(s *Store) error {
+	path := filepath.Join(p.dir, snapshotFile)
+	size, err := writeSnapshot(path, s)
+	if err != nil {
+		return err
+	}
+	p.snapshotSize = size
+
+	if err := p.wal.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := p.wal.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	p.walSize = 0
+
+	return p.wal.Sync()
+}
+
+func (p *persistence) close() error {
+	return p.wal.Close()
+}
+
+func appendKeys(payload []byte, keys []*pb.StoresKey) []byte {
+	payload = binary.LittleEndian.AppendUint32(payload, uint32(len(keys)))
+	keyLen := 0
+	if len(keys) > 0 {
+		keyLen = len(keys[0].Floats)
+	}
+	payload = binary.LittleEndian.AppendUint32(payload, uint32(keyLen))
+	for _, k := range keys {
+		for _, f := range k.Floats {
+			payload = binary.LittleEndian.AppendUint32(payload, math.Float32bits(f))
+		}
+	}
+
+	return payload
+}
+
+func appendBytes(payload []byte, b []byte) []byte {
+	payload = binary.LittleEndian.AppendUint32(payload, uint32(len(b)))
+	return append(payload, b...)
+}
+
+// replayWAL applies the records of the log to s and returns the size of the valid part of the log.
+// A torn or corrupted record ends the log: it is the last write, interrupted by a crash, and is dropped.
+func replayWAL(wal *os.File, s *Store) (int64, error) {
+	r := bufio.NewReader(wal)
+	var offset int64
+	header := make([]byte, 8)
+
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err != io.EOF {
+				log.Warn().Int64("offset", offset).Msg("Dropping a torn record at the end of the log of the store")
+			}
+			break
+		}
+		payload := make([]byte, binary.LittleEndian.Uint32(header))
+		if _, err := io.ReadFull(r, payload); err != nil {
+			log.Warn().Int64("offset", offset).Msg("Dropping a torn record at the end of the log of the store")
+			break
+		}
+		if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(header[4:]) {
+			log.Warn().Int64("offset", offset).Msg("Dropping a corrupted record at the end of the log of the store")
+			break
+		}
+		if err := applyRecord(payload, s); err != nil {
+			return 0, fmt.Errorf("record at offset %d: %w", offset, err)
+		}
+		offset += int64(len(header) + len(payload))
+	}
+
+	if err := wal.Truncate(offset); err != nil {
+		return 0, err
+	}
+	if _, err := wal.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	return offset, nil
+}
+
+func applyRecord(payload []byte, s *Store) error {
+	if len(payload) < 9 {
+		return errCorruptRecord
+	}
+	op := payload[0]
+	n := int(binary.LittleEndian.Uint32(payload[1:]))
+	keyLen := int(binary.LittleEndian.Uint32(payload[5:]))
+	payload = payload[9:]
+
+	if len(payload) < n*keyLen*4 {
+		return errCorruptRecord
+	}
+	keys := make([]*pb.StoresKey, n)
+	for i := range keys {
+		keys[i] = &pb.StoresKey{Floats: decodeFloats(payload[:keyLen*4])}
+		payload = payload[keyLen*4:]
+	}
+
+	switch op {
+	case walOpSet, walOpSetMetadata:
+		opts := &pb.StoresSetOptions{Keys: keys, Values: make([]*pb.StoresValue, n)}
+		for i := range opts.Values {
+			var b []byte
+			if b, payload = readBytes(payload); b == nil {
+				return errCorruptRecord
+			}
+			opts.Values[i] = &pb.StoresValue{Bytes: b}
+		}
+		if op == walOpSetMetadata {
+			opts.Metadata = make([][]byte, n)
+			for i := range opts.Metadata {
+				if opts.Metadata[i], payload = readBytes(payload); opts.Metadata[i] == nil {
+					return errCorruptRecord
+				}
+			}
+		}
+		metadata, err := setMetadata(opts)
+		if err != nil {
+			return err
+		}
+		return s.set(opts, metadata)
+	case walOpDelete:
+		return s.delete(&pb.StoresDeleteOptions{Keys: keys})
+	}
+
+	return fmt.Errorf("%w: unknown operation %d", errCorruptRecord, op)
+}
+
+// readBytes reads the length prefixed bytes at the start of payload and returns them with the rest of
+// the payload, the bytes are nil if the payload is too short
+func readBytes(payload []byte) ([]byte, []byte) {
+	if len(payload) < 4 {
+		return nil, payload
+	}
+	l := int(binary.LittleEndian.Uint32(payload))
+	if len(payload) < 4+l {
+		return nil, payload
+	}
+	return payload[4 : 4+l], payload[4+l:]
+}
+
+func decodeFloats(b []byte) []float32 {
+	floats := make([]float32, len(b)/4)
+	for i := range floats {
+		floats[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[i*4:]))
+	}
+
+	return floats
+}
+
+// writeSnapshot atomically replaces the file at path with the content of s and returns its size.
+// The snapshot is the magic, the key length, the number of entries and the entries with their
+// metadata, followed by the checksum of all of it.
+func writeSnapshot(path string, s *Store) (int64, error) {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return 0, err
+	}
+	f, err := os.CreateTemp(dir, filepath.Base(path)+".tmp*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	crc := crc32.NewIEEE()
+	w := bufio.NewWriter(io.MultiWriter(f, crc))
+
+	buf := []byte(snapshotMagic)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(int32(s.keyLen)))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(len(s.keys)))
+	if _, err := w.Write(buf); err != nil {
+		return 0, err
+	}
+	for i, k := range s.keys {
+		buf = buf[:0]
+		for _, v := range k {
+			buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(v))
+		}
+		buf = appendBytes(buf, s.values[i])
+		buf = appendBytes(buf, s.metadata[i].raw)
+		if _, err := w.Write(buf); err != nil {
+			return 0, err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return 0, err
+	}
+	if _, err := f.Write(binary.LittleEndian.AppendUint32(nil, crc.Sum32())); err != nil {
+		return 0, err
+	}
+	if err := f.Sync(); err != nil {
+		return 0, err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if err := f.Close(); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return 0, err
+	}
+	// Make the rename durable
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+
+	return st.Size(), nil
+}
+
+// readSnapshot replaces the content of s with the snapshot at path
+func readSnapshot(path string, s *Store) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	st, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if st.Size() < int64(len(snapshotMagic))+16 {
+		return fmt.Errorf("%s is not a store snapshot", path)
+	}
+
+	crc := crc32.NewIEEE()
+	r := bufio.NewReader(io.TeeReader(io.LimitReader(f, st.Size()-4), crc))
+
+	header := make([]byte, len(snapshotMagic)+12)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return err
+	}
+	magic := string(header[:len(snapshotMagic)])
+	if magic != snapshotMagic && magic != snapshotMagicNoMeta {
+		return fmt.Errorf("%s is not a store snapshot", path)
+	}
+	hasMetadata := magic == snapshotMagic
+	keyLen := int(int32(binary.LittleEndian.Uint32(header[len(snapshotMagic):])))
+	n := binary.LittleEndian.Uint64(header[len(snapshotMagic)+4:])
+
+	keys := make([][]float32, 0, min(n, 1<<20))
+	values := make([][]byte, 0, min(n, 1<<20))
+	metadata := make([]entryMetadata, 0, min(n, 1<<20))
+	key := make([]byte, max(keyLen, 0)*4)
+	for range n {
+		if _, err := io.ReadFull(r, key); err != nil {
+			return fmt.Errorf("truncated snapshot: %w", err)
+		}
+		value, err := readSnapshotBytes(r)
+		if err != nil {
+			return fmt.Errorf("truncated snapshot: %w", err)
+		}
+		var m entryMetadata
+		if hasMetadata {
+			raw, err := readSnapshotBytes(r)
+			if err != nil {
+				return fmt.Errorf("truncated snapshot: %w", err)
+			}
+			if m, err = parseMetadata(raw); err != nil {
+				return fmt.Errorf("invalid snapshot %s: %w", path, err)
+			}
+		}
+		keys = append(keys, decodeFloats(key))
+		values = append(values, value)
+		metadata = append(metadata, m)
+	}
+	if _, err := r.ReadByte(); err != io.EOF {
+		return fmt.Errorf("trailing data in the snapshot %s", path)
+	}
+
+	sum := make([]byte, 4)
+	if _, err := io.ReadFull(f, sum); err != nil {
+		return err
+	}
+	if binary.LittleEndian.Uint32(sum) != crc.Sum32() {
+		return fmt.Errorf("checksum mismatch in the snapshot %s", path)
+	}
+	if !isSortedKeys(keys) {
+		return fmt.Errorf("keys of the snapshot %s are not sorted", path)
+	}
+
+	s.keys = keys
+	s.values = values
+	s.metadata = metadata
+	s.keyLen = keyLen
+	s.keysAreNormalized = true
+	for _, k := range keys {
+		if !isNormalized(k) {
+			s.keysAreNormalized = false
+			break
+		}
+	}
+	s.reindex()
+
+	return nil
+}
+
+func readSnapshotBytes(r io.Reader) ([]byte, error) {
+	length := make([]byte, 4)
+	if _, err := io.ReadFull(r, length); err != nil {
+		return nil, err
+	}
+	b := make([]byte, binary.LittleEndian.Uint32(length))
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"math"
 	"slices"
+	"strings"
 
 	"github.com/mudler/LocalAI/pkg/grpc/base"
 	pb "github.com/mudler/LocalAI/pkg/grpc/proto"
@@ -22,25 +23,34 @@ type Store struct {
 	keys [][]float32
 	// The sorted values
 	values [][]byte
+	// The metadata of the sorted keys, to filter them
+	metadata []entryMetadata
 
 	// If for every K it holds that ||k||^2 = 1, then we can use the normalized distance functions
 	// TODO: Should we normalize incoming keys if they are not instead?
 	keysAreNormalized bool
 	// The first key decides the length of the keys
 	keyLen int
+
+	// Set when the store is persisted on disk, see persist.go
+	persistence *persistence
+	// Set when the keys are indexed for approximate search, see hnsw.go
+	index *hnswIndex
 }
 
 // TODO: Only used for sorting using Go's builtin implementation. The interfaces are columnar because
 // that's theoretically best for memory layout and cache locality, but this isn't optimized yet.
 type Pair struct {
-	Key   []float32
-	Value []byte
+	Key      []float32
+	Value    []byte
+	Metadata entryMetadata
 }
 
 func NewStore() *Store {
 	return &Store{
 		keys:              make([][]float32, 0),
 		values:            make([][]byte, 0),
+		metadata:          make([]entryMetadata, 0),
 		keysAreNormalized: true,
 		keyLen:            -1,
 	}
@@ -99,14 +109,77 @@ func sortIntoKeySlicese(keys []*pb.StoresKey) [][]float32 {
 	return ks
 }
 
+// Load configures the store with the options of the model, and restores it from the directory given by the
+// persistence_path option, if any. The model name is the name of the store.
+//
+// The index option selects how StoresFind searches the keys: "flat" (default) scans all the keys, "hnsw" uses
+// an approximate nearest neighbour graph tuned with the hnsw_m, hnsw_ef_construction, hnsw_ef_search and
+// hnsw_exact_below options.
 func (s *Store) Load(opts *pb.ModelOptions) error {
-	if opts.Model != "" {
-		return errors.New("not implemented")
+	if s.persistence != nil || s.index != nil {
+		return errors.New("the store is already loaded")
+	}
+
+	persistencePath := ""
+	index := ""
+	hnsw := defaultHNSWConfig()
+	for _, o := range opts.Options {
+		key, value, _ := strings.Cut(o, ":")
+		switch key {
+		case "persistence_path":
+			persistencePath = value
+		case "index":
+			index = value
+		default:
+			if _, err := hnsw.setOption(key, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	switch index {
+	case "", "flat":
+	case "hnsw":
+		s.index = newHNSWIndex(hnsw)
+		s.reindex()
+	default:
+		return fmt.Errorf("unknown index %q, expected flat or hnsw", index)
 	}
+
+	if persistencePath != "" {
+		p, err := openPersistence(persistencePath, s)
+		if err != nil {
+			return err
+		}
+		s.persistence = p
+	}
+
 	return nil
 }
 
-// Sort the incoming kvs and merge them with the existing sorted kvs
+// reindex rebuilds the index from the keys of the store
+func (s *Store) reindex() {
+	if s.index != nil {
+		s.index.rebuild(s.keys)
+	}
+}
+
+// checkKeys verifies that all the keys have the length of the keys of the store
+func (s *Store) checkKeys(keys []*pb.StoresKey) error {
+	keyLen := s.keyLen
+	if keyLen == -1 {
+		keyLen = len(keys[0].Floats)
+	}
+	for _, k := range keys {
+		if len(k.Floats) != keyLen {
+			return fmt.Errorf("Try to use a key with length %d when existing length is %d", len(k.Floats), keyLen)
+		}
+	}
+
+	return nil
+}
+
+// StoresSet logs the change when the store is persisted, then applies it
 func (s *Store) StoresSet(opts *pb.StoresSetOptions) error {
 	if len(opts.Keys) == 0 {
 		return fmt.Errorf("no keys to add")
@@ -116,6 +189,60 @@ func (s *Store) StoresSet(opts *pb.StoresSetOptions) error {
 		return fmt.Errorf("len(keys) = %d, len(values) = %d", len(opts.Keys), len(opts.Values))
 	}
 
+	if err := s.checkKeys(opts.Keys); err != nil {
+		return err
+	}
+
+	metadata, err := setMetadata(opts)
+	if err != nil {
+		return err
+	}
+
+	if s.persistence != nil {
+		if err := s.persistence.logSet(opts); err != nil {
+			return fmt.Errorf("unable to persist the keys: %w", err)
+		}
+	}
+
+	if err := s.set(opts, metadata); err != nil {
+		return err
+	}
+	s.maybeCompact()
+
+	return nil
+}
+
+// setMetadata parses the metadata of the keys to set, the keys have no metadata if it is empty
+func setMetadata(opts *pb.StoresSetOptions) ([]entryMetadata, error) {
+	metadata := make([]entryMetadata, len(opts.Keys))
+	if len(opts.Metadata) == 0 {
+		return metadata, nil
+	}
+
+	if len(opts.Metadata) != len(opts.Keys) {
+		return nil, fmt.Errorf("len(keys) = %d, len(metadata) = %d", len(opts.Keys), len(opts.Metadata))
+	}
+
+	for i, m := range opts.Metadata {
+		var err error
+		if metadata[i], err = parseMetadata(m); err != nil {
+			return nil, err
+		}
+	}
+
+	return metadata, nil
+}
+
+// Sort the incoming kvs and merge them with the existing sorted kvs
+func (s *Store) set(opts *pb.StoresSetOptions, metadata []entryMetadata) error {
+	if len(opts.Keys) == 0 {
+		return fmt.Errorf("no keys to add")
+	}
+
+	if len(opts.Keys) != len(opts.Values) {
+		return fmt.Errorf("len(keys) = %d, len(values) = %d", len(opts.Keys), len(opts.Values))
+	}
+
 	if s.keyLen == -1 {
 		s.keyLen = len(opts.Keys[0].Floats)
 	} else {
@@ -139,8 +266,9 @@ func (s *Store) StoresSet(opts *pb.StoresSetOptions) error {
 		}
 
 		kvs[i] = Pair{
-			Key:   k.Floats,
-			Value: opts.Values[i].Bytes,
+			Key:      k.Floats,
+			Value:    opts.Values[i].Bytes,
+			Metadata: metadata[i],
 		}
 	}
 
@@ -154,6 +282,7 @@ func (s *Store) StoresSet(opts *pb.StoresSetOptions) error {
 	l := len(kvs) + len(s.keys)
 	merge_ks := make([][]float32, 0, l)
 	merge_vs := make([][]byte, 0, l)
+	merge_ms := make([]entryMetadata, 0, l)
 
 	i, j := 0, 0
 	for {
@@ -164,6 +293,7 @@ func (s *Store) StoresSet(opts *pb.StoresSetOptions) error {
 		if i >= len(kvs) {
 			merge_ks = append(merge_ks, s.keys[j])
 			merge_vs = append(merge_vs, s.values[j])
+			merge_ms = append(merge_ms, s.metadata[j])
 			j++
 			continue
 		}
@@ -171,6 +301,7 @@ func (s *Store) StoresSet(opts *pb.StoresSetOptions) error {
 		if j >= len(s.keys) {
 			merge_ks = append(merge_ks, kvs[i].Key)
 			merge_vs = append(merge_vs, kvs[i].Value)
+			merge_ms = append(merge_ms, kvs[i].Metadata)
 			i++
 			continue
 		}
@@ -179,14 +310,17 @@ func (s *Store) StoresSet(opts *pb.StoresSetOptions) error {
 		if c < 0 {
 			merge_ks = append(merge_ks, kvs[i].Key)
 			merge_vs = append(merge_vs, kvs[i].Value)
+			merge_ms = append(merge_ms, kvs[i].Metadata)
 			i++
 		} else if c > 0 {
 			merge_ks = append(merge_ks, s.keys[j])
 			merge_vs = append(merge_vs, s.values[j])
+			merge_ms = append(merge_ms, s.metadata[j])
 			j++
 		} else {
 			merge_ks = append(merge_ks, kvs[i].Key)
 			merge_vs = append(merge_vs, kvs[i].Value)
+			merge_ms = append(merge_ms, kvs[i].Metadata)
 			i++
 			j++
 		}
@@ -197,15 +331,46 @@ func (s *Store) StoresSet(opts *pb.StoresSetOptions) error {
 
 	s.keys = merge_ks
 	s.values = merge_vs
+	s.metadata = merge_ms
+
+	if s.index != nil {
+		for _, kv := range kvs {
+			s.index.insert(kv.Key)
+		}
+	}
 
 	return nil
 }
 
+// StoresDelete logs the change when the store is persisted, then applies it
 func (s *Store) StoresDelete(opts *pb.StoresDeleteOptions) error {
 	if len(opts.Keys) == 0 {
 		return fmt.Errorf("no keys to delete")
 	}
 
+	if err := s.checkKeys(opts.Keys); err != nil {
+		return err
+	}
+
+	if s.persistence != nil {
+		if err := s.persistence.logDelete(opts); err != nil {
+			return fmt.Errorf("unable to persist the deletion: %w", err)
+		}
+	}
+
+	if err := s.delete(opts); err != nil {
+		return err
+	}
+	s.maybeCompact()
+
+	return nil
+}
+
+func (s *Store) delete(opts *pb.StoresDeleteOptions) error {
+	if len(opts.Keys) == 0 {
+		return fmt.Errorf("no keys to delete")
+	}
+
 	if len(opts.Keys) == 0 {
 		return fmt.Errorf("no keys to add")
 	}
@@ -223,17 +388,25 @@ func (s *Store) StoresDelete(opts *pb.StoresDeleteOptions) error {
 	l := len(s.keys) - len(ks)
 	merge_ks := make([][]float32, 0, l)
 	merge_vs := make([][]byte, 0, l)
+	merge_ms := make([]entryMetadata, 0, l)
 
 	tail_ks := s.keys
 	tail_vs := s.values
+	tail_ms := s.metadata
 	for _, k := range ks {
 		j, found := findInSortedSlice(tail_ks, k)
 
 		if found {
 			merge_ks = append(merge_ks, tail_ks[:j]...)
 			merge_vs = append(merge_vs, tail_vs[:j]...)
+			merge_ms = append(merge_ms, tail_ms[:j]...)
 			tail_ks = tail_ks[j+1:]
 			tail_vs = tail_vs[j+1:]
+			tail_ms = tail_ms[j+1:]
+
+			if s.index != nil {
+				s.index.remove(k)
+			}
 		} else {
 			assert(!hasKey(s.keys, k), fmt.Sprintf("Key exists, but was not found: t=%d, %v", len(tail_ks), k))
 		}
@@ -243,11 +416,13 @@ func (s *Store) StoresDelete(opts *pb.StoresDeleteOptions) error {
 
 	merge_ks = append(merge_ks, tail_ks...)
 	merge_vs = append(merge_vs, tail_vs...)
+	merge_ms = append(merge_ms, tail_ms...)
 
 	assert(len(merge_ks) <= len(s.keys), fmt.Sprintf("len(merge_ks) = %d, len(s.keys) = %d", len(merge_ks), len(s.keys)))
 
 	s.keys = merge_ks
 	s.values = merge_vs
+	s.metadata = merge_ms
 
 	assert(len(s.keys) >= l, fmt.Sprintf("len(s.keys) = %d, l = %d", len(s.keys), l))
 	assert(isSortedKeys(s.keys), "keys are not sorted")
@@ -270,6 +445,7 @@ func (s *Store) StoresDelete(opts *pb.StoresDeleteOptions) error {
 func (s *Store) StoresGet(opts *pb.StoresGetOptions) (pb.StoresGetResult, error) {
 	pbKeys := make([]*pb.StoresKey, 0, len(opts.Keys))
 	pbValues := make([]*pb.StoresValue, 0, len(opts.Keys))
+	pbMetadata := make([][]byte, 0, len(opts.Keys))
 	ks := sortIntoKeySlicese(opts.Keys)
 
 	if len(s.keys) == 0 {
@@ -286,6 +462,7 @@ func (s *Store) StoresGet(opts *pb.StoresGetOptions) (pb.StoresGetResult, error)
 
 	tail_k := s.keys
 	tail_v := s.values
+	tail_m := s.metadata
 	for i, k := range ks {
 		j, found := findInSortedSlice(tail_k, k)
 
@@ -296,9 +473,11 @@ func (s *Store) StoresGet(opts *pb.StoresGetOptions) (pb.StoresGetResult, error)
 			pbValues = append(pbValues, &pb.StoresValue{
 				Bytes: tail_v[j],
 			})
+			pbMetadata = append(pbMetadata, tail_m[j].raw)
 
 			tail_k = tail_k[j+1:]
 			tail_v = tail_v[j+1:]
+			tail_m = tail_m[j+1:]
 		} else {
 			assert(!hasKey(s.keys, k), fmt.Sprintf("Key exists, but was not found: i=%d, %v", i, k))
 		}
@@ -309,8 +488,9 @@ func (s *Store) StoresGet(opts *pb.StoresGetOptions) (pb.StoresGetResult, error)
 	}
 
 	return pb.StoresGetResult{
-		Keys:   pbKeys,
-		Values: pbValues,
+		Keys:     pbKeys,
+		Values:   pbValues,
+		Metadata: pbMetadata,
 	}, nil
 }
 
@@ -346,6 +526,7 @@ type PriorityItem struct {
 	Similarity float32
 	Key        []float32
 	Value      []byte
+	Metadata   []byte
 }
 
 type PriorityQueue []*PriorityItem
@@ -374,17 +555,22 @@ func (pq *PriorityQueue) Pop() any {
 	return item
 }
 
-func (s *Store) StoresFindNormalized(opts *pb.StoresFindOptions) (pb.StoresFindResult, error) {
+func (s *Store) StoresFindNormalized(opts *pb.StoresFindOptions, filter metadataFilter) (pb.StoresFindResult, error) {
 	tk := opts.Key.Floats
 	top_ks := make(PriorityQueue, 0, int(opts.TopK))
 	heap.Init(&top_ks)
 
 	for i, k := range s.keys {
+		if filter != nil && !filter(s.metadata[i].fields) {
+			continue
+		}
+
 		sim := normalizedCosineSimilarity(tk, k)
 		heap.Push(&top_ks, &PriorityItem{
 			Similarity: sim,
 			Key:        k,
 			Value:      s.values[i],
+			Metadata:   s.metadata[i].raw,
 		})
 
 		if top_ks.Len() > int(opts.TopK) {
@@ -395,6 +581,7 @@ func (s *Store) StoresFindNormalized(opts *pb.StoresFindOptions) (pb.StoresFindR
 	similarities := make([]float32, top_ks.Len())
 	pbKeys := make([]*pb.StoresKey, top_ks.Len())
 	pbValues := make([]*pb.StoresValue, top_ks.Len())
+	pbMetadata := make([][]byte, top_ks.Len())
 
 	for i := top_ks.Len() - 1; i >= 0; i-- {
 		item := heap.Pop(&top_ks).(*PriorityItem)
@@ -406,12 +593,14 @@ func (s *Store) StoresFindNormalized(opts *pb.StoresFindOptions) (pb.StoresFindR
 		pbValues[i] = &pb.StoresValue{
 			Bytes: item.Value,
 		}
+		pbMetadata[i] = item.Metadata
 	}
 
 	return pb.StoresFindResult{
 		Keys:         pbKeys,
 		Values:       pbValues,
 		Similarities: similarities,
+		Metadata:     pbMetadata,
 	}, nil
 }
 
@@ -431,7 +620,7 @@ func cosineSimilarity(k1, k2 []float32, mag1 float64) float32 {
 	return sim
 }
 
-func (s *Store) StoresFindFallback(opts *pb.StoresFindOptions) (pb.StoresFindResult, error) {
+func (s *Store) StoresFindFallback(opts *pb.StoresFindOptions, filter metadataFilter) (pb.StoresFindResult, error) {
 	tk := opts.Key.Floats
 	top_ks := make(PriorityQueue, 0, int(opts.TopK))
 	heap.Init(&top_ks)
@@ -443,11 +632,16 @@ func (s *Store) StoresFindFallback(opts *pb.StoresFindOptions) (pb.StoresFindRes
 	mag1 = math.Sqrt(mag1)
 
 	for i, k := range s.keys {
+		if filter != nil && !filter(s.metadata[i].fields) {
+			continue
+		}
+
 		dist := cosineSimilarity(tk, k, mag1)
 		heap.Push(&top_ks, &PriorityItem{
 			Similarity: dist,
 			Key:        k,
 			Value:      s.values[i],
+			Metadata:   s.metadata[i].raw,
 		})
 
 		if top_ks.Len() > int(opts.TopK) {
@@ -458,6 +652,7 @@ func (s *Store) StoresFindFallback(opts *pb.StoresFindOptions) (pb.StoresFindRes
 	similarities := make([]float32, top_ks.Len())
 	pbKeys := make([]*pb.StoresKey, top_ks.Len())
 	pbValues := make([]*pb.StoresValue, top_ks.Len())
+	pbMetadata := make([][]byte, top_ks.Len())
 
 	for i := top_ks.Len() - 1; i >= 0; i-- {
 		item := heap.Pop(&top_ks).(*PriorityItem)
@@ -469,12 +664,83 @@ func (s *Store) StoresFindFallback(opts *pb.StoresFindOptions) (pb.StoresFindRes
 		pbValues[i] = &pb.StoresValue{
 			Bytes: item.Value,
 		}
+		pbMetadata[i] = item.Metadata
+	}
+
+	return pb.StoresFindResult{
+		Keys:         pbKeys,
+		Values:       pbValues,
+		Similarities: similarities,
+		Metadata:     pbMetadata,
+	}, nil
+}
+
+// StoresFindIndexed searches the index of the store, the similarities are the ones of the exact scan.
+// It falls back to the exact scan if the index could not find TopK keys, which happens when most of
+// the keys close to the query are deleted or filtered out.
+func (s *Store) StoresFindIndexed(opts *pb.StoresFindOptions, filter metadataFilter) (pb.StoresFindResult, error) {
+	tk := opts.Key.Floats
+	topK := min(int(opts.TopK), len(s.keys))
+	var accept func([]float32) bool
+	if filter != nil {
+		accept = func(k []float32) bool {
+			j, found := findInSortedSlice(s.keys, k)
+			return found && filter(s.metadata[j].fields)
+		}
+	}
+	keys := s.index.search(tk, topK, accept)
+	if len(keys) < topK {
+		log.Debug().Msgf("Find: the index returned %d keys instead of %d, falling back to an exact scan", len(keys), topK)
+		return s.storesFindExact(opts, filter)
+	}
+
+	normalized := s.keysAreNormalized && isNormalized(tk)
+	var mag1 float64
+	if !normalized {
+		for _, v := range tk {
+			mag1 += float64(v * v)
+		}
+		mag1 = math.Sqrt(mag1)
+	}
+
+	items := make([]PriorityItem, len(keys))
+	for i, k := range keys {
+		j, found := findInSortedSlice(s.keys, k)
+		assert(found, fmt.Sprintf("Indexed key is not in the store: %v", k))
+
+		items[i] = PriorityItem{Key: k, Value: s.values[j], Metadata: s.metadata[j].raw}
+		if normalized {
+			items[i].Similarity = normalizedCosineSimilarity(tk, k)
+		} else {
+			items[i].Similarity = cosineSimilarity(tk, k, mag1)
+		}
+	}
+	slices.SortStableFunc(items, func(a, b PriorityItem) int {
+		switch {
+		case a.Similarity > b.Similarity:
+			return -1
+		case a.Similarity < b.Similarity:
+			return 1
+		}
+		return 0
+	})
+
+	similarities := make([]float32, len(items))
+	pbKeys := make([]*pb.StoresKey, len(items))
+	pbValues := make([]*pb.StoresValue, len(items))
+	pbMetadata := make([][]byte, len(items))
+	for i, item := range items {
+		similarities[i] = item.Similarity
+		pbKeys[i] = &pb.StoresKey{Floats: item.Key}
+		pbValues[i] = &pb.StoresValue{Bytes: item.Value}
+		pbMetadata[i] = item.Metadata
 	}
 
 	return pb.StoresFindResult{
 		Keys:         pbKeys,
 		Values:       pbValues,
 		Similarities: similarities,
+		Metadata:     pbMetadata,
 	}, nil
 }
 
@@ -497,8 +763,24 @@ func (s *Store) StoresFind(opts *pb.StoresFindOptions) (pb.StoresFindResult, err
 		}
 	}
 
+	filter, err := parseFilter(opts.Filter)
+	if err != nil {
+		return pb.StoresFindResult{}, err
+	}
+
+	if s.index != nil && len(s.keys) >= s.index.config.ExactBelow {
+		return s.StoresFindIndexed(opts, filter)
+	}
+
+	return s.storesFindExact(opts, filter)
+}
+
+// storesFindExact compares the query with all the keys matching the filter
+func (s *Store) storesFindExact(opts *pb.StoresFindOptions, filter metadataFilter) (pb.StoresFindResult, error) {
+	tk := opts.Key.Floats
+
 	if s.keysAreNormalized && isNormalized(tk) {
-		return s.StoresFindNormalized(opts)
+		return s.StoresFindNormalized(opts, filter)
 	} else {
 		if s.keysAreNormalized {
 			var sample []float32
@@ -510,6 +792,6 @@ func (s *Store) StoresFind(opts *pb.StoresFindOptions) (pb.StoresFindResult, err
 			log.Debug().Msgf("Trying to compare non-normalized key with normalized keys: %v", sample)
 		}
 
-		return s.StoresFindFallback(opts)
+		return s.StoresFindFallback(opts, filter)
 	}
 }
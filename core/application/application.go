@@ -2,6 +2,7 @@ package application
 
 import (
 	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/core/services"
 	"github.com/mudler/LocalAI/core/templates"
 	"github.com/mudler/LocalAI/pkg/model"
 )
@@ -11,6 +12,10 @@ type Application struct {
 	modelLoader        *model.ModelLoader
 	applicationConfig  *config.ApplicationConfig
 	templatesEvaluator *templates.Evaluator
+	responseStore      services.ResponseStore
+	auditService       *services.AuditService
+	collectionService  *services.CollectionService
+	metricsService     *services.MaxGPTMetricsService
 }
 
 func newApplication(appConfig *config.ApplicationConfig) *Application {
@@ -37,3 +42,21 @@ func (a *Application) ApplicationConfig() *config.ApplicationConfig {
 func (a *Application) TemplatesEvaluator() *templates.Evaluator {
 	return a.templatesEvaluator
 }
+
+func (a *Application) ResponseStore() services.ResponseStore {
+	return a.responseStore
+}
+
+// AuditService returns the audit log, nil if it is disabled
+func (a *Application) AuditService() *services.AuditService {
+	return a.auditService
+}
+
+func (a *Application) CollectionService() *services.CollectionService {
+	return a.collectionService
+}
+
+// MetricsService returns the service exporting the metrics, nil if they are disabled
+func (a *Application) MetricsService() *services.MaxGPTMetricsService {
+	return a.metricsService
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"slices"
 	"time"
 
 	"dario.cat/mergo"
@@ -127,6 +128,8 @@ func (c *configFileHandler) Stop() error {
 	return c.watcher.Close()
 }
 
+// readApiKeysJson reads the API keys from api_keys.json. Each entry is either a plain key (a string)
+// with full access, or an object with the policy of the key, see config.ApiKeyPolicy.
 func readApiKeysJson(startupAppConfig config.ApplicationConfig) fileHandler {
 	handler := func(fileContent []byte, appConfig *config.ApplicationConfig) error {
 		log.Debug().Msg("processing api keys runtime update")
@@ -134,20 +137,45 @@ func readApiKeysJson(startupAppConfig config.ApplicationConfig) fileHandler {
 
 		if len(fileContent) > 0 {
 			// Parse JSON content from the file
-			var fileKeys []string
-			err := json.Unmarshal(fileContent, &fileKeys)
+			var fileEntries []json.RawMessage
+			err := json.Unmarshal(fileContent, &fileEntries)
 			if err != nil {
 				return err
 			}
 
-			log.Trace().Int("numKeys", len(fileKeys)).Msg("discovered API keys from api keys dynamic config dile")
+			var fileKeys []string
+			var filePolicies []config.ApiKeyPolicy
+			for i, entry := range fileEntries {
+				var key string
+				if err := json.Unmarshal(entry, &key); err == nil {
+					fileKeys = append(fileKeys, key)
+					continue
+				}
+				var policy config.ApiKeyPolicy
+				if err := json.Unmarshal(entry, &policy); err != nil {
+					return fmt.Errorf("invalid api key at index %d: %w", i, err)
+				}
+				if policy.Key == "" {
+					return fmt.Errorf("invalid api key at index %d: key is required", i)
+				}
+				filePolicies = append(filePolicies, policy)
+			}
+
+			log.Trace().Int("numKeys", len(fileKeys)).Int("numPolicies", len(filePolicies)).Msg("discovered API keys from api keys dynamic config dile")
+
+			policies := append(slices.Clone(startupAppConfig.ApiKeyPolicies), filePolicies...)
+			if err := config.ValidateApiKeyPolicies(policies); err != nil {
+				return err
+			}
 
 			appConfig.ApiKeys = append(startupAppConfig.ApiKeys, fileKeys...)
+			appConfig.ApiKeyPolicies = policies
 		} else {
 			log.Trace().Msg("no API keys discovered from dynamic config file")
 			appConfig.ApiKeys = startupAppConfig.ApiKeys
+			appConfig.ApiKeyPolicies = startupAppConfig.ApiKeyPolicies
 		}
-		log.Trace().Int("numKeys", len(appConfig.ApiKeys)).Msg("total api keys after processing")
+		log.Trace().Int("numKeys", len(appConfig.ApiKeys)).Int("numPolicies", len(appConfig.ApiKeyPolicies)).Msg("total api keys after processing")
 		return nil
 	}
 
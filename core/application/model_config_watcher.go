@@ -0,0 +1,92 @@
+package application
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/mudler/LocalAI/core/backend"
+	"github.com/mudler/LocalAI/core/config"
+	"github.com/rs/zerolog/log"
+)
+
+// modelConfigReloadDelay is how long the files must stay unchanged before they are reloaded, as editors and the
+// gallery write them in several steps
+const modelConfigReloadDelay = time.Second
+
+// watchModelConfigs reloads the configuration files of the models when they change in the models path. The changes
+// of the options the models are loaded with are applied to the loaded models by switching to new backends.
+func watchModelConfigs(application *Application) error {
+	options := application.ApplicationConfig()
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := watcher.Add(options.ModelPath); err != nil {
+		watcher.Close()
+		return fmt.Errorf("unable to create a watcher on the models path: %w", err)
+	}
+
+	go func() {
+		defer watcher.Close()
+
+		var reload <-chan time.Time
+		for {
+			select {
+			case <-options.Context.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if isModelConfigFile(event.Name) && event.Has(fsnotify.Write|fsnotify.Create|fsnotify.Rename) {
+					reload = time.After(modelConfigReloadDelay)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Error().Err(err).Msg("models path watcher error received")
+			case <-reload:
+				reload = nil
+				reloadModelConfigs(application)
+			}
+		}
+	}()
+
+	return nil
+}
+
+func isModelConfigFile(name string) bool {
+	base := filepath.Base(name)
+	return !strings.HasPrefix(base, ".") && (strings.HasSuffix(base, ".yaml") || strings.HasSuffix(base, ".yml"))
+}
+
+// reloadModelConfigs reads again the configuration files of the models, and reloads the models whose backend
+// must be restarted to apply the changes
+func reloadModelConfigs(application *Application) {
+	options := application.ApplicationConfig()
+
+	changes, err := application.BackendLoader().ReloadBackendConfigsFromPath(options.ModelPath, options.ToConfigLoaderOptions()...)
+	if err != nil {
+		log.Error().Err(err).Msg("error reloading the configuration files of the models")
+		return
+	}
+
+	for _, change := range changes {
+		if !backend.RequiresReload(change.Old, change.New, options) {
+			log.Info().Str("model", change.New.Name).Msg("Model configuration changed")
+			continue
+		}
+
+		log.Info().Str("model", change.New.Name).Msg("Model configuration changed, reloading the model")
+		go func(c config.BackendConfig) {
+			if err := backend.ReloadModel(c, application.ModelLoader(), options); err != nil {
+				log.Error().Err(err).Str("model", c.Name).Msg("error reloading the model")
+			}
+		}(change.New)
+	}
+}
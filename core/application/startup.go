@@ -1,8 +1,10 @@
 package application
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/mudler/LocalAI/core/backend"
 	"github.com/mudler/LocalAI/core/config"
@@ -42,6 +44,10 @@ func New(opts ...config.AppOption) (*Application, error) {
 	if err != nil {
 		return nil, fmt.Errorf("unable to create ModelPath: %q", err)
 	}
+	// Stateful APIs (e.g. stored responses, batches) persist under the data path, falling back to the models path
+	if options.DataPath == "" {
+		options.DataPath = options.ModelPath
+	}
 	if options.GeneratedContentDir != "" {
 		err := os.MkdirAll(options.GeneratedContentDir, 0750)
 		if err != nil {
@@ -55,6 +61,26 @@ func New(opts ...config.AppOption) (*Application, error) {
 		}
 	}
 
+	responseStore, err := services.NewFileResponseStore(filepath.Join(options.DataPath, "responses"))
+	if err != nil {
+		return nil, err
+	}
+	application.responseStore = responseStore
+
+	collectionService, err := services.NewCollectionService(options.DataPath)
+	if err != nil {
+		return nil, err
+	}
+	application.collectionService = collectionService
+
+	if options.AuditLog {
+		auditService, err := services.NewAuditService(options)
+		if err != nil {
+			return nil, err
+		}
+		application.auditService = auditService
+	}
+
 	if err := coreStartup.InstallModels(options.Galleries, options.BackendGalleries, options.ModelPath, options.BackendsPath, options.EnforcePredownloadScans, options.AutoloadBackendGalleries, nil, options.ModelsURL...); err != nil {
 		log.Error().Err(err).Msg("error installing models")
 	}
@@ -111,6 +137,25 @@ func New(opts ...config.AppOption) (*Application, error) {
 		}
 	}()
 
+	tracing, err := services.NewTracingService(options)
+	if err != nil {
+		return nil, err
+	}
+	if tracing != nil {
+		go func() {
+			<-options.Context.Done()
+			if err := tracing.Shutdown(context.Background()); err != nil {
+				log.Error().Err(err).Msg("error while flushing the traces")
+			}
+		}()
+	}
+
+	if !options.DisableMetrics {
+		if err := setupMetrics(application); err != nil {
+			return nil, err
+		}
+	}
+
 	if options.WatchDog {
 		wd := model.NewWatchDog(
 			application.ModelLoader(),
@@ -118,6 +163,9 @@ func New(opts ...config.AppOption) (*Application, error) {
 			options.WatchDogIdleTimeout,
 			options.WatchDogBusy,
 			options.WatchDogIdle)
+		if application.metricsService != nil {
+			wd.SetKillObserver(application.metricsService.ObserveWatchdogKill)
+		}
 		application.ModelLoader().SetWatchDog(wd)
 		go wd.Run()
 		go func() {
@@ -127,6 +175,16 @@ func New(opts ...config.AppOption) (*Application, error) {
 		}()
 	}
 
+	// The KV cache of the backends is lost when they are loaded, reloaded, restarted or stopped
+	application.ModelLoader().SetBackendObserver(backend.ResetPrefixCache)
+
+	// The memory of the backends is measured for the memory budget and the metrics
+	monitor := services.NewBackendMonitorService(application.ModelLoader(), application.BackendLoader(), options)
+	application.ModelLoader().SetMemoryObserver(monitor.ProcessMemory)
+	if options.MemoryBudget > 0 {
+		application.ModelLoader().SetMemoryBudget(options.MemoryBudget)
+	}
+
 	if options.LoadToMemory != nil && !options.SingleBackend {
 		for _, m := range options.LoadToMemory {
 			cfg, err := application.BackendLoader().LoadBackendConfigFileByNameDefaultOptions(m, options)
@@ -146,9 +204,30 @@ func New(opts ...config.AppOption) (*Application, error) {
 		}
 	}
 
+	if !options.SingleBackend {
+		preload := application.BackendLoader().GetBackendConfigsByFilter(func(_ string, c *config.BackendConfig) bool {
+			return c.Preload
+		})
+		for _, cfg := range preload {
+			log.Info().Str("model", cfg.Name).Msg("Preloading the model")
+			if err := backend.LoadModel(cfg, application.ModelLoader(), options); err != nil {
+				log.Error().Err(err).Str("model", cfg.Name).Msg("error preloading the model")
+			}
+		}
+	}
+
+	// Stop the backends idle for longer than the keep alive of their model
+	go application.ModelLoader().RunKeepAlive(options.Context)
+
 	// Watch the configuration directory
 	startWatcher(options)
 
+	if !options.DisableModelHotReload {
+		if err := watchModelConfigs(application); err != nil {
+			log.Error().Err(err).Msg("failed watching the configuration files of the models")
+		}
+	}
+
 	log.Info().Msg("core/startup process completed!")
 	return application, nil
 }
@@ -177,3 +256,25 @@ func startWatcher(options *config.ApplicationConfig) {
 		log.Error().Err(err).Msg("failed creating watcher")
 	}
 }
+
+// setupMetrics creates the metrics service and connects it to the backends
+func setupMetrics(application *Application) error {
+	metrics, err := services.NewMaxGPTMetricsService()
+	if err != nil {
+		return err
+	}
+	application.metricsService = metrics
+
+	ml := application.ModelLoader()
+	ml.SetLoadObserver(metrics.ObserveModelLoad)
+	backend.SetMetricsService(metrics)
+
+	if err := metrics.RegisterQueueStats(backend.AdmissionStats); err != nil {
+		return err
+	}
+	return metrics.RegisterBackendStats(func() services.BackendStats {
+		loaded, busy := ml.CountModels()
+		memory, _ := ml.MemoryUsage()
+		return services.BackendStats{Loaded: loaded, Busy: busy, Memory: memory}
+	})
+}
@@ -0,0 +1,293 @@
+package backend
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/core/services"
+)
+
+// Priority is the class of a request in the admission queue of a model: waiting requests of a higher class
+// are admitted first, and in arrival order within the same class.
+type Priority int
+
+const (
+	PriorityBatch Priority = iota
+	PriorityNormal
+	PriorityInteractive
+
+	priorities = 3
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityBatch:
+		return "batch"
+	case PriorityInteractive:
+		return "interactive"
+	default:
+		return "normal"
+	}
+}
+
+// ParsePriority parses a priority class: interactive, normal or batch
+func ParsePriority(s string) (Priority, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "interactive", "high":
+		return PriorityInteractive, nil
+	case "normal", "":
+		return PriorityNormal, nil
+	case "batch", "low":
+		return PriorityBatch, nil
+	}
+	return PriorityNormal, fmt.Errorf("unknown priority %q, expected interactive, normal or batch", s)
+}
+
+type priorityKey struct{}
+
+// WithPriority returns a copy of the context carrying the priority of the request
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// PriorityFromContext returns the priority of the request, PriorityNormal if none was set
+func PriorityFromContext(ctx context.Context) Priority {
+	if ctx == nil {
+		return PriorityNormal
+	}
+	if p, ok := ctx.Value(priorityKey{}).(Priority); ok {
+		return p
+	}
+	return PriorityNormal
+}
+
+var (
+	// ErrQueueFull is returned when the queue of the model already holds the maximum number of waiting requests
+	ErrQueueFull = errors.New("too many requests waiting for the model")
+	// ErrQueueTimeout is returned when a request waited for the model longer than the queue timeout
+	ErrQueueTimeout = errors.New("timed out waiting for the model")
+)
+
+// AdmissionLimits are the limits of the admission queue of a model, see config.Queue
+type AdmissionLimits struct {
+	MaxInFlight int
+	MaxLength   int
+	Timeout     time.Duration
+}
+
+// admissionLimits returns the limits of the queue of the model, falling back to the defaults of the instance
+func admissionLimits(c *config.BackendConfig, o *config.ApplicationConfig) AdmissionLimits {
+	limits := AdmissionLimits{
+		MaxInFlight: o.QueueMaxInFlight,
+		MaxLength:   o.QueueMaxLength,
+		Timeout:     o.QueueTimeout,
+	}
+	if c.Queue.MaxInFlight > 0 {
+		limits.MaxInFlight = c.Queue.MaxInFlight
+	}
+	if c.Queue.MaxLength > 0 {
+		limits.MaxLength = c.Queue.MaxLength
+	}
+	if timeout := c.Queue.GetTimeout(); timeout > 0 {
+		limits.Timeout = timeout
+	}
+	return limits
+}
+
+// AdmissionObserver is notified of the time each request waited in the queue, and of its result:
+// admitted, full, timeout or canceled
+type AdmissionObserver interface {
+	ObserveQueueWait(model string, priority string, result string, duration float64)
+}
+
+// AdmissionQueue limits the requests running concurrently on each model. Requests beyond the limit wait for
+// a running one to finish, the higher priorities first.
+type AdmissionQueue struct {
+	models   map[string]*modelQueue
+	observer AdmissionObserver
+	sync.Mutex
+}
+
+type modelQueue struct {
+	inFlight int
+	// maxInFlight is the limit of the last request, so that releasing a request knows how many can run
+	maxInFlight int
+	waiting     [priorities]*list.List
+}
+
+type admissionTicket struct {
+	ready    chan struct{}
+	admitted bool
+}
+
+var admission = NewAdmissionQueue()
+
+func NewAdmissionQueue() *AdmissionQueue {
+	return &AdmissionQueue{models: make(map[string]*modelQueue)}
+}
+
+// AdmissionStats returns the requests running on each model and the ones waiting for it
+func AdmissionStats() []services.QueueStats {
+	return admission.Stats()
+}
+
+func (q *AdmissionQueue) SetObserver(observer AdmissionObserver) {
+	q.Lock()
+	defer q.Unlock()
+	q.observer = observer
+}
+
+// Admit waits until the request can run on the model, and returns the function to call once it is done.
+// It fails with ErrQueueFull if too many requests are already waiting, with ErrQueueTimeout if the request
+// waited longer than limits.Timeout, or with the error of the context if it is canceled meanwhile.
+func (q *AdmissionQueue) Admit(ctx context.Context, model string, limits AdmissionLimits, priority Priority) (func(), error) {
+	start := time.Now()
+
+	q.Lock()
+	mq, ok := q.models[model]
+	if !ok {
+		mq = &modelQueue{}
+		for i := range mq.waiting {
+			mq.waiting[i] = list.New()
+		}
+		q.models[model] = mq
+	}
+	mq.maxInFlight = limits.MaxInFlight
+
+	if limits.MaxInFlight <= 0 || (mq.inFlight < limits.MaxInFlight && mq.queued() == 0) {
+		mq.inFlight++
+		q.Unlock()
+		q.observe(model, priority, "admitted", start)
+		return q.release(model, mq), nil
+	}
+
+	if limits.MaxLength > 0 && mq.queued() >= limits.MaxLength {
+		q.Unlock()
+		q.observe(model, priority, "full", start)
+		return nil, ErrQueueFull
+	}
+
+	ticket := &admissionTicket{ready: make(chan struct{})}
+	element := mq.waiting[priority].PushBack(ticket)
+	q.Unlock()
+
+	var timeout <-chan time.Time
+	if limits.Timeout > 0 {
+		timer := time.NewTimer(limits.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	var err error
+	select {
+	case <-ticket.ready:
+		q.observe(model, priority, "admitted", start)
+		return q.release(model, mq), nil
+	case <-timeout:
+		err = ErrQueueTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	q.Lock()
+	if ticket.admitted {
+		// Admitted while giving up: hand the slot over to the next request
+		q.Unlock()
+		q.release(model, mq)()
+	} else {
+		mq.waiting[priority].Remove(element)
+		q.forget(model, mq)
+		q.Unlock()
+	}
+
+	result := "canceled"
+	if errors.Is(err, ErrQueueTimeout) {
+		result = "timeout"
+	}
+	q.observe(model, priority, result, start)
+	return nil, err
+}
+
+// Stats returns the requests running on each model and the ones waiting for it, sorted by model
+func (q *AdmissionQueue) Stats() []services.QueueStats {
+	q.Lock()
+	defer q.Unlock()
+	stats := make([]services.QueueStats, 0, len(q.models))
+	for model, mq := range q.models {
+		stats = append(stats, services.QueueStats{Model: model, InFlight: mq.inFlight, Queued: mq.queued()})
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Model < stats[j].Model })
+	return stats
+}
+
+// release returns the function freeing the slot of a request, which admits the next waiting ones
+func (q *AdmissionQueue) release(model string, mq *modelQueue) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			q.Lock()
+			defer q.Unlock()
+			mq.inFlight--
+			for mq.maxInFlight <= 0 || mq.inFlight < mq.maxInFlight {
+				ticket := mq.next()
+				if ticket == nil {
+					break
+				}
+				ticket.admitted = true
+				mq.inFlight++
+				close(ticket.ready)
+			}
+			q.forget(model, mq)
+		})
+	}
+}
+
+// forget drops the queue of the model once no request runs or waits on it. q must be locked.
+func (q *AdmissionQueue) forget(model string, mq *modelQueue) {
+	if mq.inFlight == 0 && mq.queued() == 0 && q.models[model] == mq {
+		delete(q.models, model)
+	}
+}
+
+func (q *AdmissionQueue) observe(model string, priority Priority, result string, start time.Time) {
+	q.Lock()
+	observer := q.observer
+	q.Unlock()
+	if observer != nil {
+		observer.ObserveQueueWait(model, priority.String(), result, time.Since(start).Seconds())
+	}
+}
+
+// next pops the first waiting request of the highest priority, nil if none is waiting
+func (mq *modelQueue) next() *admissionTicket {
+	for p := priorities - 1; p >= 0; p-- {
+		if front := mq.waiting[p].Front(); front != nil {
+			return mq.waiting[p].Remove(front).(*admissionTicket)
+		}
+	}
+	return nil
+}
+
+func (mq *modelQueue) queued() int {
+	n := 0
+	for _, l := range mq.waiting {
+		n += l.Len()
+	}
+	return n
+}
+
+// admit waits for the request to be allowed to run on the model, see AdmissionQueue.Admit
+func admit(ctx context.Context, c *config.BackendConfig, o *config.ApplicationConfig) (func(), error) {
+	release, err := admission.Admit(ctx, c.Name, admissionLimits(c, o), PriorityFromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("model %q: %w", c.Name, err)
+	}
+	return release, nil
+}
@@ -0,0 +1,171 @@
+package backend_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/mudler/LocalAI/core/backend"
+	"github.com/mudler/LocalAI/core/services"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type queueObserver struct {
+	results chan string
+}
+
+func (o queueObserver) ObserveQueueWait(model string, priority string, result string, duration float64) {
+	o.results <- priority + ":" + result
+}
+
+var _ = Describe("AdmissionQueue", func() {
+	var queue *AdmissionQueue
+	limits := AdmissionLimits{MaxInFlight: 1}
+
+	// admitAsync queues a request and returns the channel receiving its release function once it is admitted
+	admitAsync := func(priority Priority, limits AdmissionLimits) (chan func(), chan error) {
+		admitted, failed := make(chan func(), 1), make(chan error, 1)
+		go func() {
+			release, err := queue.Admit(context.Background(), "model", limits, priority)
+			if err != nil {
+				failed <- err
+				return
+			}
+			admitted <- release
+		}()
+		return admitted, failed
+	}
+
+	queued := func() int {
+		for _, s := range queue.Stats() {
+			if s.Model == "model" {
+				return s.Queued
+			}
+		}
+		return 0
+	}
+
+	BeforeEach(func() {
+		queue = NewAdmissionQueue()
+	})
+
+	It("admits requests up to the limit", func() {
+		first, err := queue.Admit(context.Background(), "model", AdmissionLimits{MaxInFlight: 2}, PriorityNormal)
+		Expect(err).ToNot(HaveOccurred())
+		second, err := queue.Admit(context.Background(), "model", AdmissionLimits{MaxInFlight: 2}, PriorityNormal)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(queue.Stats()).To(Equal([]services.QueueStats{{Model: "model", InFlight: 2}}))
+
+		admitted, _ := admitAsync(PriorityNormal, AdmissionLimits{MaxInFlight: 2})
+		Eventually(queued).Should(Equal(1))
+		Consistently(admitted).ShouldNot(Receive())
+
+		first()
+		var third func()
+		Eventually(admitted).Should(Receive(&third))
+		second()
+		third()
+		Expect(queue.Stats()).To(BeEmpty())
+	})
+
+	It("does not limit requests without a limit", func() {
+		for i := 0; i < 10; i++ {
+			_, err := queue.Admit(context.Background(), "model", AdmissionLimits{}, PriorityNormal)
+			Expect(err).ToNot(HaveOccurred())
+		}
+		Expect(queue.Stats()).To(Equal([]services.QueueStats{{Model: "model", InFlight: 10}}))
+	})
+
+	It("admits the higher priorities first", func() {
+		running, err := queue.Admit(context.Background(), "model", limits, PriorityNormal)
+		Expect(err).ToNot(HaveOccurred())
+
+		batch, _ := admitAsync(PriorityBatch, limits)
+		Eventually(queued).Should(Equal(1))
+		normal, _ := admitAsync(PriorityNormal, limits)
+		Eventually(queued).Should(Equal(2))
+		interactive, _ := admitAsync(PriorityInteractive, limits)
+		Eventually(queued).Should(Equal(3))
+
+		running()
+		var release func()
+		Eventually(interactive).Should(Receive(&release))
+		Expect(normal).ToNot(Receive())
+		release()
+		Eventually(normal).Should(Receive(&release))
+		Expect(batch).ToNot(Receive())
+		release()
+		Eventually(batch).Should(Receive(&release))
+		release()
+	})
+
+	It("refuses requests when the queue is full", func() {
+		limits := AdmissionLimits{MaxInFlight: 1, MaxLength: 1}
+		running, err := queue.Admit(context.Background(), "model", limits, PriorityNormal)
+		Expect(err).ToNot(HaveOccurred())
+		defer running()
+
+		_, _ = admitAsync(PriorityNormal, limits)
+		Eventually(queued).Should(Equal(1))
+
+		_, err = queue.Admit(context.Background(), "model", limits, PriorityInteractive)
+		Expect(err).To(MatchError(ErrQueueFull))
+	})
+
+	It("times out requests waiting too long", func() {
+		observer := queueObserver{results: make(chan string, 10)}
+		queue.SetObserver(observer)
+
+		limits := AdmissionLimits{MaxInFlight: 1, Timeout: 50 * time.Millisecond}
+		running, err := queue.Admit(context.Background(), "model", limits, PriorityNormal)
+		Expect(err).ToNot(HaveOccurred())
+		// Requests admitted right away are observed too
+		Expect(observer.results).To(Receive(Equal("normal:admitted")))
+
+		_, err = queue.Admit(context.Background(), "model", limits, PriorityBatch)
+		Expect(err).To(MatchError(ErrQueueTimeout))
+		Expect(observer.results).To(Receive(Equal("batch:timeout")))
+		Expect(queued()).To(Equal(0))
+
+		running()
+		Expect(queue.Stats()).To(BeEmpty())
+	})
+
+	It("gives up when the request is canceled", func() {
+		running, err := queue.Admit(context.Background(), "model", limits, PriorityNormal)
+		Expect(err).ToNot(HaveOccurred())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			defer GinkgoRecover()
+			Eventually(queued).Should(Equal(1))
+			cancel()
+		}()
+		_, err = queue.Admit(ctx, "model", limits, PriorityNormal)
+		Expect(err).To(MatchError(context.Canceled))
+
+		running()
+		Expect(queue.Stats()).To(BeEmpty())
+	})
+
+	It("keeps the queues of the models apart", func() {
+		_, err := queue.Admit(context.Background(), "a", limits, PriorityNormal)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = queue.Admit(context.Background(), "b", limits, PriorityNormal)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(queue.Stats()).To(Equal([]services.QueueStats{{Model: "a", InFlight: 1}, {Model: "b", InFlight: 1}}))
+	})
+})
+
+var _ = Describe("ParsePriority", func() {
+	It("parses the priority classes", func() {
+		for s, p := range map[string]Priority{"interactive": PriorityInteractive, "Batch": PriorityBatch, "": PriorityNormal, "normal": PriorityNormal} {
+			parsed, err := ParsePriority(s)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(parsed).To(Equal(p))
+		}
+		_, err := ParsePriority("urgent")
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,85 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/core/services"
+	"github.com/mudler/LocalAI/pkg/model"
+	"github.com/mudler/LocalAI/pkg/store"
+)
+
+// CollectionIngest embeds the chunks with the embeddings model of the collection and stores them in its local-store
+func CollectionIngest(ctx context.Context, collection schema.Collection, chunks []schema.CollectionChunk, loader *model.ModelLoader, cl *config.BackendConfigLoader, appConfig *config.ApplicationConfig) error {
+	if len(chunks) == 0 {
+		return nil
+	}
+
+	keys := make([][]float32, len(chunks))
+	values := make([][]byte, len(chunks))
+	for i, chunk := range chunks {
+		embedding, err := collectionEmbedding(ctx, chunk.Text, collection, loader, cl, appConfig)
+		if err != nil {
+			return err
+		}
+		value, err := json.Marshal(chunk)
+		if err != nil {
+			return err
+		}
+		keys[i] = embedding
+		values[i] = value
+	}
+
+	sb, err := StoreBackend(loader, cl, appConfig, services.CollectionStoreName(collection.Name), "")
+	if err != nil {
+		return err
+	}
+	defer loader.Close()
+
+	return store.SetCols(ctx, sb, keys, values)
+}
+
+// CollectionQuery returns the topK chunks of the collection the most similar to the query
+func CollectionQuery(ctx context.Context, collection schema.Collection, query string, topK int, loader *model.ModelLoader, cl *config.BackendConfigLoader, appConfig *config.ApplicationConfig) ([]schema.CollectionChunk, error) {
+	embedding, err := collectionEmbedding(ctx, query, collection, loader, cl, appConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	sb, err := StoreBackend(loader, cl, appConfig, services.CollectionStoreName(collection.Name), "")
+	if err != nil {
+		return nil, err
+	}
+	defer loader.Close()
+
+	_, values, similarities, err := store.Find(ctx, sb, embedding, topK)
+	if err != nil {
+		return nil, err
+	}
+
+	chunks := []schema.CollectionChunk{}
+	for i, v := range values {
+		var chunk schema.CollectionChunk
+		if err := json.Unmarshal(v, &chunk); err != nil {
+			return nil, fmt.Errorf("invalid chunk in collection %q: %w", collection.Name, err)
+		}
+		chunk.Score = similarities[i]
+		chunks = append(chunks, chunk)
+	}
+	return chunks, nil
+}
+
+func collectionEmbedding(ctx context.Context, text string, collection schema.Collection, loader *model.ModelLoader, cl *config.BackendConfigLoader, appConfig *config.ApplicationConfig) ([]float32, error) {
+	cfg, err := cl.LoadBackendConfigFileByNameDefaultOptions(collection.EmbeddingsModel, appConfig)
+	if err != nil {
+		return nil, err
+	}
+	embedFn, err := ModelEmbedding(ctx, text, []int{}, loader, *cfg, appConfig)
+	if err != nil {
+		return nil, err
+	}
+	return embedFn()
+}
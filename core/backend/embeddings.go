@@ -1,15 +1,17 @@
 package backend
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/mudler/LocalAI/core/config"
 
 	"github.com/mudler/LocalAI/pkg/grpc"
+	"github.com/mudler/LocalAI/pkg/grpc/proto"
 	model "github.com/mudler/LocalAI/pkg/model"
 )
 
-func ModelEmbedding(s string, tokens []int, loader *model.ModelLoader, backendConfig config.BackendConfig, appConfig *config.ApplicationConfig) (func() ([]float32, error), error) {
+func ModelEmbedding(ctx context.Context, s string, tokens []int, loader *model.ModelLoader, backendConfig config.BackendConfig, appConfig *config.ApplicationConfig) (func() ([]float32, error), error) {
 
 	opts := ModelOptions(backendConfig, appConfig)
 
@@ -19,6 +21,12 @@ func ModelEmbedding(s string, tokens []int, loader *model.ModelLoader, backendCo
 	}
 	defer loader.Close()
 
+	embeddings := func(backend grpc.Backend, predictOptions *proto.PredictOptions) (*proto.EmbeddingResult, error) {
+		return retryOnCrash(loader, opts, backend, func(backend grpc.Backend) (*proto.EmbeddingResult, error) {
+			return backend.Embeddings(ctx, predictOptions)
+		})
+	}
+
 	var fn func() ([]float32, error)
 	switch model := inferenceModel.(type) {
 	case grpc.Backend:
@@ -32,7 +40,7 @@ func ModelEmbedding(s string, tokens []int, loader *model.ModelLoader, backendCo
 				}
 				predictOptions.EmbeddingTokens = embeds
 
-				res, err := model.Embeddings(appConfig.Context, predictOptions)
+				res, err := embeddings(model, predictOptions)
 				if err != nil {
 					return nil, err
 				}
@@ -41,7 +49,7 @@ func ModelEmbedding(s string, tokens []int, loader *model.ModelLoader, backendCo
 			}
 			predictOptions.Embeddings = s
 
-			res, err := model.Embeddings(appConfig.Context, predictOptions)
+			res, err := embeddings(model, predictOptions)
 			if err != nil {
 				return nil, err
 			}
@@ -55,6 +63,12 @@ func ModelEmbedding(s string, tokens []int, loader *model.ModelLoader, backendCo
 	}
 
 	return func() ([]float32, error) {
+		done, err := admit(ctx, &backendConfig, appConfig)
+		if err != nil {
+			return nil, err
+		}
+		defer done()
+
 		embeds, err := fn()
 		if err != nil {
 			return embeds, err
@@ -1,13 +1,15 @@
 package backend
 
 import (
+	"context"
+
 	"github.com/mudler/LocalAI/core/config"
 
 	"github.com/mudler/LocalAI/pkg/grpc/proto"
 	model "github.com/mudler/LocalAI/pkg/model"
 )
 
-func ImageGeneration(height, width, mode, step, seed int, positive_prompt, negative_prompt, src, dst string, loader *model.ModelLoader, backendConfig config.BackendConfig, appConfig *config.ApplicationConfig, refImages []string) (func() error, error) {
+func ImageGeneration(ctx context.Context, height, width, mode, step, seed int, positive_prompt, negative_prompt, src, dst string, loader *model.ModelLoader, backendConfig config.BackendConfig, appConfig *config.ApplicationConfig, refImages []string) (func() error, error) {
 
 	opts := ModelOptions(backendConfig, appConfig)
 	inferenceModel, err := loader.Load(
@@ -19,8 +21,14 @@ func ImageGeneration(height, width, mode, step, seed int, positive_prompt, negat
 	defer loader.Close()
 
 	fn := func() error {
-		_, err := inferenceModel.GenerateImage(
-			appConfig.Context,
+		done, err := admit(ctx, &backendConfig, appConfig)
+		if err != nil {
+			return err
+		}
+		defer done()
+
+		_, err = inferenceModel.GenerateImage(
+			ctx,
 			&proto.GenerateImageRequest{
 				Height:           int32(height),
 				Width:            int32(width),
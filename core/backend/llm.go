@@ -8,6 +8,7 @@ import (
 	"slices"
 	"strings"
 	"sync"
+	"time"
 	"unicode/utf8"
 
 	"github.com/rs/zerolog/log"
@@ -17,9 +18,11 @@ import (
 	"github.com/mudler/LocalAI/core/services"
 
 	"github.com/mudler/LocalAI/core/gallery"
+	"github.com/mudler/LocalAI/pkg/grpc"
 	"github.com/mudler/LocalAI/pkg/grpc/proto"
 	model "github.com/mudler/LocalAI/pkg/model"
 	"github.com/mudler/LocalAI/pkg/utils"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type LLMResponse struct {
@@ -33,6 +36,19 @@ type TokenUsage struct {
 	Completion             int
 	TimingPromptProcessing float64
 	TimingTokenGeneration  float64
+
+	// PromptCached is the number of prompt tokens reused from the KV cache of the backend,
+	// PrefixCache is "hit" or "miss" when the request was routed by the prefix cache
+	PromptCached int
+	PrefixCache  string
+}
+
+// AddPrefixCache accounts the prefix cache usage of another prediction of the same request
+func (t *TokenUsage) AddPrefixCache(other TokenUsage) {
+	t.PromptCached += other.PromptCached
+	if t.PrefixCache != "hit" && other.PrefixCache != "" {
+		t.PrefixCache = other.PrefixCache
+	}
 }
 
 func ModelInference(ctx context.Context, s string, messages []schema.Message, images, videos, audios []string, loader *model.ModelLoader, c *config.BackendConfig, cl *config.BackendConfigLoader, o *config.ApplicationConfig, tokenCallback func(string, TokenUsage) bool) (func() (LLMResponse, error), error) {
@@ -55,8 +71,9 @@ func ModelInference(ctx context.Context, s string, messages []schema.Message, im
 		}
 	}
 
-	opts := ModelOptions(*c, o)
-	inferenceModel, err := loader.Load(opts...)
+	// Trace the loading as part of the request, while it stays bound to the lifetime of the application
+	loadOpts := ModelOptions(*c, o, model.WithContext(trace.ContextWithSpan(o.Context, trace.SpanFromContext(ctx))))
+	inferenceModel, err := loader.Load(loadOpts...)
 	if err != nil {
 		return nil, err
 	}
@@ -92,6 +109,15 @@ func ModelInference(ctx context.Context, s string, messages []schema.Message, im
 
 	// in GRPC, the backend is supposed to answer to 1 single token if stream is not supported
 	fn := func() (LLMResponse, error) {
+		done, err := admit(ctx, c, o)
+		if err != nil {
+			return LLMResponse{}, err
+		}
+		defer done()
+
+		start := time.Now()
+		var firstToken time.Time
+
 		opts := gRPCPredictOpts(*c, loader.ModelPath)
 		opts.Prompt = s
 		opts.Messages = protoMessages
@@ -102,6 +128,27 @@ func ModelInference(ctx context.Context, s string, messages []schema.Message, im
 
 		tokenUsage := TokenUsage{}
 
+		// release records what the slot holds once the prediction is done, see PrefixCache
+		release := func(response string, err error) {}
+		if c.PrefixCacheSlots > 0 {
+			key := prefixCacheKey(opts.Prompt, messages, opts.UseTokenizerTemplate)
+			slot, hit, done := prefixCache.Acquire(c.Name, c.PrefixCacheSlots, key)
+			slotID := int32(slot)
+			opts.SlotId = &slotID
+			opts.PromptCacheAll = true
+			tokenUsage.PrefixCache = "miss"
+			if hit {
+				tokenUsage.PrefixCache = "hit"
+			}
+			release = func(response string, err error) {
+				if err != nil {
+					done("")
+					return
+				}
+				done(key + response)
+			}
+		}
+
 		// check the per-model feature flag for usage, since tokenCallback may have a cost.
 		// Defaults to off as for now it is still experimental
 		if c.FeatureFlag.Enabled("usage") {
@@ -135,11 +182,15 @@ func ModelInference(ctx context.Context, s string, messages []schema.Message, im
 			err := inferenceModel.PredictStream(ctx, opts, func(reply *proto.Reply) {
 				msg := reply.Message
 				partialRune = append(partialRune, msg...)
+				if firstToken.IsZero() && len(msg) > 0 {
+					firstToken = time.Now()
+				}
 
 				tokenUsage.Prompt = int(reply.PromptTokens)
 				tokenUsage.Completion = int(reply.Tokens)
 				tokenUsage.TimingTokenGeneration = reply.TimingTokenGeneration
 				tokenUsage.TimingPromptProcessing = reply.TimingPromptProcessing
+				tokenUsage.PromptCached = int(reply.PromptTokensCached)
 
 				// Process complete runes and accumulate them
 				var completeRunes []byte
@@ -163,16 +214,24 @@ func ModelInference(ctx context.Context, s string, messages []schema.Message, im
 					tokenCallback("", tokenUsage)
 				}
 			})
+			release(ss, err)
+			if err == nil {
+				observeInference(c.Name, tokenUsage, start, firstToken)
+			}
 			return LLMResponse{
 				Response: ss,
 				Usage:    tokenUsage,
 			}, err
 		} else {
 			// TODO: Is the chicken bit the only way to get here? is that acceptable?
-			reply, err := inferenceModel.Predict(ctx, opts)
+			reply, err := retryOnCrash(loader, loadOpts, inferenceModel, func(backend grpc.Backend) (*proto.Reply, error) {
+				return backend.Predict(ctx, opts)
+			})
 			if err != nil {
+				release("", err)
 				return LLMResponse{}, err
 			}
+			release(string(reply.Message), nil)
 			if tokenUsage.Prompt == 0 {
 				tokenUsage.Prompt = int(reply.PromptTokens)
 			}
@@ -182,6 +241,8 @@ func ModelInference(ctx context.Context, s string, messages []schema.Message, im
 
 			tokenUsage.TimingTokenGeneration = reply.TimingTokenGeneration
 			tokenUsage.TimingPromptProcessing = reply.TimingPromptProcessing
+			tokenUsage.PromptCached = int(reply.PromptTokensCached)
+			observeInference(c.Name, tokenUsage, start, firstToken)
 
 			response := string(reply.Message)
 			if c.TemplateConfig.ReplyPrefix != "" {
@@ -198,6 +259,25 @@ func ModelInference(ctx context.Context, s string, messages []schema.Message, im
 	return fn, nil
 }
 
+// prefixCacheKey returns the text the prefix cache matches requests on: the prompt, or the messages
+// when the backend applies the chat template itself
+func prefixCacheKey(prompt string, messages []schema.Message, useTokenizerTemplate bool) string {
+	if !useTokenizerTemplate || prompt != "" {
+		return prompt
+	}
+	var key strings.Builder
+	for _, m := range messages {
+		key.WriteString(m.Role)
+		key.WriteByte(0)
+		key.WriteString(m.StringContent)
+		key.WriteByte(0)
+	}
+	// the reply of the model is appended as the assistant message of the next turn
+	key.WriteString("assistant")
+	key.WriteByte(0)
+	return key.String()
+}
+
 var cutstrings map[string]*regexp.Regexp = make(map[string]*regexp.Regexp)
 var mu sync.Mutex = sync.Mutex{}
 
@@ -0,0 +1,47 @@
+package backend
+
+import (
+	"context"
+	"time"
+
+	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/pkg/grpc"
+	"github.com/mudler/LocalAI/pkg/model"
+	"github.com/rs/zerolog/log"
+)
+
+// LoadModel loads the model without running a request on it, e.g. to preload it
+func LoadModel(c config.BackendConfig, loader *model.ModelLoader, appConfig *config.ApplicationConfig) error {
+	if _, err := loader.Load(ModelOptions(c, appConfig)...); err != nil {
+		return err
+	}
+	loader.Close()
+	return nil
+}
+
+// warmUp returns the function running the warm-up request of the model once it is loaded, see config.Warmup
+func warmUp(c config.BackendConfig, modelPath string) func(context.Context, grpc.Backend) error {
+	return func(ctx context.Context, client grpc.Backend) error {
+		start := time.Now()
+		opts := gRPCPredictOpts(c, modelPath)
+
+		if c.Embeddings != nil && *c.Embeddings {
+			opts.Embeddings = c.Warmup.Prompt
+			if _, err := client.Embeddings(ctx, opts); err != nil {
+				return err
+			}
+		} else {
+			opts.Prompt = c.Warmup.Prompt
+			opts.Tokens = 1
+			if c.Warmup.Tokens > 0 {
+				opts.Tokens = int32(c.Warmup.Tokens)
+			}
+			if _, err := client.Predict(ctx, opts); err != nil {
+				return err
+			}
+		}
+
+		log.Info().Str("model", c.Name).Dur("duration", time.Since(start)).Msg("Model warmed up")
+		return nil
+	}
+}
@@ -0,0 +1,52 @@
+package backend
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/mudler/LocalAI/core/services"
+)
+
+var metricsService atomic.Pointer[services.MaxGPTMetricsService]
+
+// SetMetricsService sets the service recording the metrics of the backend calls: the waits in the admission
+// queues and the token usage of the predictions
+func SetMetricsService(metrics *services.MaxGPTMetricsService) {
+	metricsService.Store(metrics)
+	if metrics != nil {
+		admission.SetObserver(metrics)
+	}
+}
+
+// observeInference records the token usage and the speed of a prediction started at start, whose first token
+// came at firstToken (zero if unknown). The timings reported by the backend are preferred to the measured ones.
+func observeInference(model string, usage TokenUsage, start, firstToken time.Time) {
+	metrics := metricsService.Load()
+	if metrics == nil {
+		return
+	}
+
+	var timeToFirstToken float64
+	switch {
+	case usage.TimingPromptProcessing > 0:
+		timeToFirstToken = usage.TimingPromptProcessing / 1000
+	case !firstToken.IsZero():
+		timeToFirstToken = firstToken.Sub(start).Seconds()
+	}
+
+	var tokensPerSecond float64
+	if usage.Completion > 0 {
+		generation := usage.TimingTokenGeneration / 1000
+		if generation <= 0 {
+			if firstToken.IsZero() {
+				firstToken = start
+			}
+			generation = time.Since(firstToken).Seconds()
+		}
+		if generation > 0 {
+			tokensPerSecond = float64(usage.Completion) / generation
+		}
+	}
+
+	metrics.ObserveInference(model, usage.Prompt, usage.Completion, timeToFirstToken, tokensPerSecond)
+}
@@ -24,21 +24,16 @@ func ModelOptions(c config.BackendConfig, so *config.ApplicationConfig, opts ...
 		model.WithModelID(name),
 	}
 
-	threads := 1
+	defOpts = append(defOpts, model.WithLoadGRPCLoadModelOpts(loadModelOpts(c, so)))
 
-	if c.Threads != nil {
-		threads = *c.Threads
+	if keepAlive := c.GetKeepAlive(); keepAlive != 0 {
+		defOpts = append(defOpts, model.WithKeepAlive(keepAlive))
 	}
 
-	if so.Threads != 0 {
-		threads = so.Threads
+	if c.Warmup.Prompt != "" {
+		defOpts = append(defOpts, model.WithWarmUp(warmUp(c, so.ModelPath)))
 	}
 
-	c.Threads = &threads
-
-	grpcOpts := grpcModelOpts(c)
-	defOpts = append(defOpts, model.WithLoadGRPCLoadModelOpts(grpcOpts))
-
 	if so.ParallelBackendRequests {
 		defOpts = append(defOpts, model.EnableParallelRequests)
 	}
@@ -51,13 +46,40 @@ func ModelOptions(c config.BackendConfig, so *config.ApplicationConfig, opts ...
 		defOpts = append(defOpts, model.WithGRPCAttemptsDelay(c.GRPC.AttemptsSleepTime))
 	}
 
+	if len(c.GRPC.Endpoints) > 0 {
+		defOpts = append(defOpts, model.WithGRPCEndpoints(c.GRPC.Endpoints...))
+	}
+
 	for k, v := range so.ExternalGRPCBackends {
 		defOpts = append(defOpts, model.WithExternalBackend(k, v))
 	}
 
+	if so.MemoryBudget > 0 {
+		defOpts = append(defOpts, model.WithMemoryEstimator(func() uint64 {
+			return config.EstimateMemory(&c, so.ModelPath)
+		}))
+	}
+
 	return append(defOpts, opts...)
 }
 
+// loadModelOpts returns the options the backend loads the model with
+func loadModelOpts(c config.BackendConfig, so *config.ApplicationConfig) *pb.ModelOptions {
+	threads := 1
+
+	if c.Threads != nil {
+		threads = *c.Threads
+	}
+
+	if so.Threads != 0 {
+		threads = so.Threads
+	}
+
+	c.Threads = &threads
+
+	return grpcModelOpts(c)
+}
+
 func getSeed(c config.BackendConfig) int32 {
 	var seed int32 = config.RAND_SEED
 
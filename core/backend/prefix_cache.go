@@ -0,0 +1,105 @@
+package backend
+
+import (
+	"sync"
+	"time"
+)
+
+// prefixCacheMinMatch is the shortest common prefix, in bytes, worth routing a request to a busy or older slot
+const prefixCacheMinMatch = 64
+
+// PrefixCache tracks the prompt held in the KV cache of each slot of the backends, so that requests sharing a
+// prefix (e.g. the same system prompt, or the previous turns of a conversation) land on the slot that can reuse it.
+type PrefixCache struct {
+	models map[string][]prefixCacheSlot
+	sync.Mutex
+}
+
+type prefixCacheSlot struct {
+	prompt   string
+	busy     int
+	lastUsed time.Time
+}
+
+var prefixCache = NewPrefixCache()
+
+func NewPrefixCache() *PrefixCache {
+	return &PrefixCache{models: make(map[string][]prefixCacheSlot)}
+}
+
+// ResetPrefixCache forgets the slots of the model, whose backend was started, restarted or stopped with an empty cache
+func ResetPrefixCache(model string) {
+	prefixCache.Reset(model)
+}
+
+// Reset forgets the slots of the model. The predictions running on the previous backend don't update the new slots.
+func (p *PrefixCache) Reset(model string) {
+	p.Lock()
+	defer p.Unlock()
+	delete(p.models, model)
+}
+
+// Acquire picks the slot of the model to run the prompt on: the one holding the longest prefix of it,
+// preferring idle slots, else the least recently used one. It reports whether a prefix can be reused,
+// and returns the function to call with the text left in the slot once the prediction is done (empty on errors).
+func (p *PrefixCache) Acquire(model string, slots int, prompt string) (int, bool, func(cached string)) {
+	p.Lock()
+	defer p.Unlock()
+
+	state := p.models[model]
+	if len(state) != slots {
+		// First use, or the number of slots changed: nothing is known about the cache of the backend
+		state = make([]prefixCacheSlot, slots)
+		p.models[model] = state
+	}
+
+	best, bestMatch := -1, 0
+	for i, s := range state {
+		match := commonPrefixLength(s.prompt, prompt)
+		if match < prefixCacheMinMatch {
+			match = 0
+		}
+		if best == -1 || betterSlot(s, match, state[best], bestMatch) {
+			best, bestMatch = i, match
+		}
+	}
+
+	state[best].busy++
+	state[best].lastUsed = time.Now()
+
+	return best, bestMatch > 0, func(cached string) {
+		p.Lock()
+		defer p.Unlock()
+		// The slots may have been reset in the meantime
+		if current := p.models[model]; len(current) == 0 || &current[0] != &state[0] {
+			return
+		}
+		if state[best].busy > 0 {
+			state[best].busy--
+		}
+		state[best].prompt = cached
+		state[best].lastUsed = time.Now()
+	}
+}
+
+// betterSlot returns whether slot a, matching the prompt on aMatch bytes, is a better pick than b
+func betterSlot(a prefixCacheSlot, aMatch int, b prefixCacheSlot, bMatch int) bool {
+	aIdle, bIdle := a.busy == 0, b.busy == 0
+	if aIdle != bIdle {
+		return aIdle
+	}
+	if aMatch != bMatch {
+		return aMatch > bMatch
+	}
+	return a.lastUsed.Before(b.lastUsed)
+}
+
+func commonPrefixLength(a, b string) int {
+	n := min(len(a), len(b))
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return n
+}
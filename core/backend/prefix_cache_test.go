@@ -0,0 +1,115 @@
+package backend_test
+
+import (
+	"strings"
+
+	. "github.com/mudler/LocalAI/core/backend"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PrefixCache", func() {
+	var (
+		cache  *PrefixCache
+		system string
+	)
+
+	BeforeEach(func() {
+		cache = NewPrefixCache()
+		system = "You are a helpful assistant. " + strings.Repeat("Answer concisely. ", 10)
+	})
+
+	It("misses on the first request", func() {
+		_, hit, release := cache.Acquire("model", 2, system+"Hi")
+		Expect(hit).To(BeFalse())
+		release(system + "Hi" + "Hello!")
+	})
+
+	It("routes a request to the slot holding its prefix", func() {
+		first, _, release := cache.Acquire("model", 4, system+"Hi")
+		release(system + "Hi" + "Hello!")
+
+		slot, hit, release := cache.Acquire("model", 4, system+"Hi"+"Hello!"+"How are you?")
+		Expect(hit).To(BeTrue())
+		Expect(slot).To(Equal(first))
+		release("")
+	})
+
+	It("does not reuse short common prefixes", func() {
+		_, _, release := cache.Acquire("model", 1, "Hello there")
+		release("Hello there, general")
+
+		_, hit, release := cache.Acquire("model", 1, "Hello world")
+		Expect(hit).To(BeFalse())
+		release("")
+	})
+
+	It("prefers idle slots", func() {
+		first, _, releaseFirst := cache.Acquire("model", 2, system+"Hi")
+		releaseFirst(system + "Hi" + "Hello!")
+
+		busy, hit, releaseBusy := cache.Acquire("model", 2, system+"Hi"+"Hello!")
+		Expect(hit).To(BeTrue())
+		Expect(busy).To(Equal(first))
+
+		other, hit, release := cache.Acquire("model", 2, system+"Hi"+"Hello!")
+		Expect(hit).To(BeFalse())
+		Expect(other).ToNot(Equal(busy))
+		release("")
+		releaseBusy("")
+	})
+
+	It("evicts the least recently used slot", func() {
+		a, _, release := cache.Acquire("model", 2, system+"A")
+		release(system + "A")
+		b, _, release := cache.Acquire("model", 2, strings.Repeat("B", 100))
+		release(strings.Repeat("B", 100))
+		Expect(b).ToNot(Equal(a))
+
+		// a is reused, which makes b the least recently used slot
+		_, hit, release := cache.Acquire("model", 2, system+"A")
+		Expect(hit).To(BeTrue())
+		release(system + "A")
+
+		slot, hit, release := cache.Acquire("model", 2, "unrelated")
+		Expect(hit).To(BeFalse())
+		Expect(slot).To(Equal(b))
+		release("")
+	})
+
+	It("forgets the slots on errors and when their number changes", func() {
+		_, _, release := cache.Acquire("model", 2, system+"Hi")
+		release("")
+		_, hit, release := cache.Acquire("model", 2, system+"Hi")
+		Expect(hit).To(BeFalse())
+		release(system + "Hi")
+
+		_, hit, release = cache.Acquire("model", 3, system+"Hi")
+		Expect(hit).To(BeFalse())
+		release("")
+	})
+
+	It("forgets the slots of a model when it is reset", func() {
+		_, _, release := cache.Acquire("model", 2, system+"Hi")
+		release(system + "Hi")
+		_, _, running := cache.Acquire("model", 2, system+"Hi")
+
+		cache.Reset("model")
+		// The prediction running on the previous backend is done after the reset
+		running(system + "Hi")
+
+		_, hit, release := cache.Acquire("model", 2, system+"Hi")
+		Expect(hit).To(BeFalse())
+		release("")
+	})
+
+	It("tracks the models separately", func() {
+		_, _, release := cache.Acquire("model", 1, system+"Hi")
+		release(system + "Hi")
+
+		_, hit, release := cache.Acquire("other", 1, system+"Hi")
+		Expect(hit).To(BeFalse())
+		release("")
+	})
+})
@@ -0,0 +1,32 @@
+package backend
+
+import (
+	"slices"
+
+	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/pkg/model"
+	"google.golang.org/protobuf/proto"
+)
+
+// RequiresReload returns whether the backend of the model must be restarted to apply a change of its configuration:
+// when the options the model is loaded with changed. The other changes, e.g. of the templates or of the
+// prediction parameters, apply to the next requests.
+func RequiresReload(old, new config.BackendConfig, appConfig *config.ApplicationConfig) bool {
+	if old.Backend != new.Backend || old.Model != new.Model || !slices.Equal(old.GRPC.Endpoints, new.GRPC.Endpoints) {
+		return true
+	}
+	if (old.Seed == nil) != (new.Seed == nil) || (old.Seed != nil && *old.Seed != *new.Seed) {
+		return true
+	}
+
+	// A random seed is drawn each time the options are built
+	oldOpts, newOpts := loadModelOpts(old, appConfig), loadModelOpts(new, appConfig)
+	oldOpts.Seed, newOpts.Seed = 0, 0
+	return !proto.Equal(oldOpts, newOpts)
+}
+
+// ReloadModel applies the configuration to the model if it is loaded, by switching to a new backend without
+// downtime, see model.ModelLoader.Reload
+func ReloadModel(c config.BackendConfig, loader *model.ModelLoader, appConfig *config.ApplicationConfig) error {
+	return loader.Reload(ModelOptions(c, appConfig)...)
+}
@@ -0,0 +1,45 @@
+package backend_test
+
+import (
+	. "github.com/mudler/LocalAI/core/backend"
+	"github.com/mudler/LocalAI/core/config"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RequiresReload", func() {
+	var (
+		appConfig *config.ApplicationConfig
+		old       config.BackendConfig
+	)
+
+	BeforeEach(func() {
+		appConfig = config.NewApplicationConfig()
+		old = config.BackendConfig{Name: "model", Backend: "llama-cpp"}
+		old.SetDefaults()
+	})
+
+	It("restarts the backend when the load options change", func() {
+		new := old
+		contextSize := 8192
+		new.ContextSize = &contextSize
+		Expect(RequiresReload(old, new, appConfig)).To(BeTrue())
+
+		new = old
+		new.Backend = "vllm"
+		Expect(RequiresReload(old, new, appConfig)).To(BeTrue())
+
+		new = old
+		new.GRPC.Endpoints = []string{"10.0.0.1:50051", "10.0.0.2:50051"}
+		Expect(RequiresReload(old, new, appConfig)).To(BeTrue())
+	})
+
+	It("applies the other changes to the next requests", func() {
+		new := old
+		new.TemplateConfig.Chat = "{{.Input}}"
+		new.Description = "changed"
+		Expect(RequiresReload(old, new, appConfig)).To(BeFalse())
+		Expect(RequiresReload(old, old, appConfig)).To(BeFalse())
+	})
+})
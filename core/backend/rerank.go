@@ -5,11 +5,12 @@ import (
 	"fmt"
 
 	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/pkg/grpc"
 	"github.com/mudler/LocalAI/pkg/grpc/proto"
 	model "github.com/mudler/LocalAI/pkg/model"
 )
 
-func Rerank(request *proto.RerankRequest, loader *model.ModelLoader, appConfig *config.ApplicationConfig, backendConfig config.BackendConfig) (*proto.RerankResult, error) {
+func Rerank(ctx context.Context, request *proto.RerankRequest, loader *model.ModelLoader, appConfig *config.ApplicationConfig, backendConfig config.BackendConfig) (*proto.RerankResult, error) {
 	opts := ModelOptions(backendConfig, appConfig)
 	rerankModel, err := loader.Load(opts...)
 	if err != nil {
@@ -21,7 +22,15 @@ func Rerank(request *proto.RerankRequest, loader *model.ModelLoader, appConfig *
 		return nil, fmt.Errorf("could not load rerank model")
 	}
 
-	res, err := rerankModel.Rerank(context.Background(), request)
+	done, err := admit(ctx, &backendConfig, appConfig)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	res, err := retryOnCrash(loader, opts, rerankModel, func(backend grpc.Backend) (*proto.RerankResult, error) {
+		return backend.Rerank(ctx, request)
+	})
 
 	return res, err
 }
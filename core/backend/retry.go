@@ -0,0 +1,32 @@
+package backend
+
+import (
+	"github.com/mudler/LocalAI/pkg/grpc"
+	"github.com/mudler/LocalAI/pkg/model"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// retryOnCrash runs the request on the backend, and once more on a new backend of the model if the backend crashed
+// while running it. Only the requests which can be repeated without side effects are retried: not the streamed ones,
+// whose tokens were already sent.
+func retryOnCrash[T any](loader *model.ModelLoader, opts []model.Option, backend grpc.Backend, request func(grpc.Backend) (T, error)) (T, error) {
+	res, err := request(backend)
+	if err == nil || !backendCrashed(err) {
+		return res, err
+	}
+
+	log.Warn().Err(err).Msg("The backend crashed while running the request, retrying it on a new backend")
+	backend, loadErr := loader.Load(opts...)
+	if loadErr != nil {
+		return res, loadErr
+	}
+	defer loader.Close()
+	return request(backend)
+}
+
+// backendCrashed returns if the error of the request is caused by the backend being gone
+func backendCrashed(err error) bool {
+	return status.Code(err) == codes.Unavailable
+}
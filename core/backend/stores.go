@@ -1,20 +1,67 @@
 package backend
 
 import (
+	"fmt"
+	"path/filepath"
+
 	"github.com/mudler/LocalAI/core/config"
 
 	"github.com/mudler/LocalAI/pkg/grpc"
+	pb "github.com/mudler/LocalAI/pkg/grpc/proto"
 	"github.com/mudler/LocalAI/pkg/model"
+	"github.com/mudler/LocalAI/pkg/utils"
 )
 
-func StoreBackend(sl *model.ModelLoader, appConfig *config.ApplicationConfig, storeName string, backend string) (grpc.Backend, error) {
+// DefaultStoreName is the name of the directory of the store used when no store is given
+const DefaultStoreName = "default"
+
+// StoreBackend loads the backend of the store. A model configuration with the name of the store and its backend
+// sets the options of the store, e.g. its index:
+//
+//	name: docs
+//	backend: local-store
+//	options:
+//	- index:hnsw
+func StoreBackend(sl *model.ModelLoader, cl *config.BackendConfigLoader, appConfig *config.ApplicationConfig, storeName string, backend string) (grpc.Backend, error) {
 	if backend == "" {
 		backend = model.LocalStoreBackend
 	}
-	sc := []model.Option{
+
+	options := []string{}
+	if cl != nil {
+		if cfg, exists := cl.GetBackendConfig(storeName); exists && cfg.Backend == backend {
+			options = append(options, cfg.Options...)
+		}
+	}
+
+	if appConfig.StoresPath != "" {
+		path, err := StorePath(appConfig, storeName)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, "persistence_path:"+path)
+	}
+
+	return sl.Load(
 		model.WithBackendString(backend),
 		model.WithModel(storeName),
-	}
+		model.WithModelID(StoreModelID(storeName)),
+		model.WithLoadGRPCLoadModelOpts(&pb.ModelOptions{Options: options}),
+	)
+}
+
+// StoreModelID returns the ID of the backend serving the store in the model loader, set apart from the models
+func StoreModelID(storeName string) string {
+	return "stores/" + storeName
+}
 
-	return sl.Load(sc...)
+// StorePath returns the directory where the store is persisted
+func StorePath(appConfig *config.ApplicationConfig, storeName string) (string, error) {
+	if storeName == "" {
+		storeName = DefaultStoreName
+	}
+	if err := utils.VerifyPath(storeName, appConfig.StoresPath); err != nil {
+		return "", fmt.Errorf("invalid store name %q: %w", storeName, err)
+	}
+	return filepath.Join(appConfig.StoresPath, storeName), nil
 }
@@ -4,6 +4,7 @@ import (
 	"github.com/mudler/LocalAI/core/config"
 	"github.com/mudler/LocalAI/core/schema"
 	"github.com/mudler/LocalAI/pkg/grpc"
+	"github.com/mudler/LocalAI/pkg/grpc/proto"
 	"github.com/mudler/LocalAI/pkg/model"
 )
 
@@ -23,7 +24,9 @@ func ModelTokenize(s string, loader *model.ModelLoader, backendConfig config.Bac
 	predictOptions.Prompt = s
 
 	// tokenize the string
-	resp, err := inferenceModel.TokenizeString(appConfig.Context, predictOptions)
+	resp, err := retryOnCrash(loader, opts, inferenceModel, func(backend grpc.Backend) (*proto.TokenizationResponse, error) {
+		return backend.TokenizeString(appConfig.Context, predictOptions)
+	})
 	if err != nil {
 		return schema.TokenizeResponse{}, err
 	}
@@ -0,0 +1,207 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/core/services"
+	"github.com/mudler/LocalAI/pkg/model"
+)
+
+const (
+	// maxToolResultBytes bounds the result of a tool fed back to the model
+	maxToolResultBytes = 16 * 1024
+	// defaultToolSearchTopK is the number of chunks returned by a collection search
+	defaultToolSearchTopK = 4
+)
+
+// RunServerTool runs the tool with the arguments the model called it with, and returns its result
+func RunServerTool(ctx context.Context, tool config.ServerTool, arguments string, collections *services.CollectionService, loader *model.ModelLoader, cl *config.BackendConfigLoader, appConfig *config.ApplicationConfig) (string, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(ctx, tool.GetTimeout())
+	defer cancel()
+
+	var result string
+	var err error
+	switch {
+	case tool.URL != "":
+		result, err = callToolWebhook(ctx, tool, arguments)
+	case len(tool.Command) > 0:
+		result, err = runToolCommand(ctx, tool, arguments)
+	default:
+		result, err = runBuiltinTool(ctx, tool, arguments, collections, loader, cl, appConfig)
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return "", fmt.Errorf("tool %s timed out after %s", tool.Name, tool.GetTimeout())
+	}
+	if err != nil {
+		return "", err
+	}
+	return truncateToolResult(result), nil
+}
+
+func callToolWebhook(ctx context.Context, tool config.ServerTool, arguments string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tool.URL, strings.NewReader(arguments))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range tool.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxToolResultBytes+1))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("tool %s returned status %d: %s", tool.Name, resp.StatusCode, truncateToolResult(string(body)))
+	}
+	return string(body), nil
+}
+
+// runToolCommand runs the command of the tool in a temporary working directory, removed afterwards, with no other
+// environment than its own. It is not isolated: it runs as the user of the server (or the user of the tool), with
+// access to its files and network, and its arguments are written by the model.
+// The command runs in its own process group, which is killed as a whole when the command times out.
+func runToolCommand(ctx context.Context, tool config.ServerTool, arguments string) (string, error) {
+	credential, err := toolCredential(tool.User)
+	if err != nil {
+		return "", fmt.Errorf("tool %s: %w", tool.Name, err)
+	}
+
+	workDir, err := os.MkdirTemp("", "localai-tool-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(workDir)
+	if credential != nil {
+		if err := os.Chown(workDir, int(credential.Uid), int(credential.Gid)); err != nil {
+			return "", fmt.Errorf("tool %s: %w", tool.Name, err)
+		}
+	}
+
+	name := tool.Command[0]
+	if strings.ContainsRune(name, filepath.Separator) && !filepath.IsAbs(name) {
+		name = filepath.Join(tool.Dir, name)
+	}
+	cmd := exec.CommandContext(ctx, name, tool.Command[1:]...)
+	cmd.Dir = workDir
+	cmd.Env = []string{"PATH=" + os.Getenv("PATH"), "HOME=" + workDir, "TMPDIR=" + workDir}
+	for k, v := range tool.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	cmd.Stdin = strings.NewReader(arguments)
+	stdout := &limitedBuffer{limit: maxToolResultBytes + 1}
+	stderr := &limitedBuffer{limit: maxToolResultBytes}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true, Credential: credential}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	// The children which left the process group can keep the output of the command open once it is killed
+	cmd.WaitDelay = time.Second
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("tool %s failed: %w: %s", tool.Name, err, msg)
+		}
+		return "", fmt.Errorf("tool %s failed: %w", tool.Name, err)
+	}
+	return stdout.String(), nil
+}
+
+// toolCredential returns the credential of the user a command runs as, nil for the user of the server
+func toolCredential(name string) (*syscall.Credential, error) {
+	if name == "" {
+		return nil, nil
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		if u, err = user.LookupId(name); err != nil {
+			return nil, fmt.Errorf("unknown user %q", name)
+		}
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("user %q: invalid uid %q", name, u.Uid)
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("user %q: invalid gid %q", name, u.Gid)
+	}
+	return &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}, nil
+}
+
+func runBuiltinTool(ctx context.Context, tool config.ServerTool, arguments string, collections *services.CollectionService, loader *model.ModelLoader, cl *config.BackendConfigLoader, appConfig *config.ApplicationConfig) (string, error) {
+	switch tool.Builtin {
+	case config.BuiltinCollectionSearch:
+		var args struct {
+			Query string `json:"query"`
+			TopK  int    `json:"top_k"`
+		}
+		if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+		if args.Query == "" {
+			return "", errors.New("the query is required")
+		}
+		if args.TopK <= 0 {
+			args.TopK = defaultToolSearchTopK
+		}
+
+		collection, err := collections.Get(tool.Collection)
+		if err != nil {
+			return "", fmt.Errorf("collection %s: %w", tool.Collection, err)
+		}
+		chunks, err := CollectionQuery(ctx, collection, args.Query, args.TopK, loader, cl, appConfig)
+		if err != nil {
+			return "", err
+		}
+		result, err := json.Marshal(chunks)
+		return string(result), err
+	}
+	return "", fmt.Errorf("unknown builtin %q", tool.Builtin)
+}
+
+func truncateToolResult(result string) string {
+	if len(result) <= maxToolResultBytes {
+		return result
+	}
+	return result[:maxToolResultBytes] + "\n[truncated]"
+}
+
+// limitedBuffer keeps the first limit bytes written to it, and discards the others
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); room > 0 {
+		b.Buffer.Write(p[:min(room, len(p))])
+	}
+	return len(p), nil
+}
@@ -0,0 +1,110 @@
+package backend_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/mudler/LocalAI/core/backend"
+	"github.com/mudler/LocalAI/core/config"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RunServerTool", func() {
+	run := func(tool config.ServerTool, arguments string) (string, error) {
+		return RunServerTool(context.Background(), tool, arguments, nil, nil, nil, &config.ApplicationConfig{})
+	}
+
+	It("posts the arguments to the webhook", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.Header.Get("Authorization")).To(Equal("Bearer secret"))
+			body, _ := io.ReadAll(r.Body)
+			if string(body) == `{"city":"nowhere"}` {
+				http.Error(w, "unknown city", http.StatusNotFound)
+				return
+			}
+			w.Write([]byte(`{"temperature":21}`))
+		}))
+		defer server.Close()
+
+		tool := config.ServerTool{Name: "weather", URL: server.URL, Headers: map[string]string{"Authorization": "Bearer secret"}}
+		Expect(run(tool, `{"city":"Rome"}`)).To(Equal(`{"temperature":21}`))
+
+		_, err := run(tool, `{"city":"nowhere"}`)
+		Expect(err).To(MatchError(ContainSubstring("returned status 404: unknown city")))
+	})
+
+	It("runs the command in an empty working directory with the arguments on its stdin", func() {
+		dir := GinkgoT().TempDir()
+		script := "#!/bin/sh\nls -A\necho \"$HOME $SECRET$GREETING\"\ncat\n"
+		Expect(os.WriteFile(filepath.Join(dir, "tool.sh"), []byte(script), 0700)).To(Succeed())
+		os.Setenv("SECRET", "leaked")
+		defer os.Unsetenv("SECRET")
+
+		tool := config.ServerTool{Name: "echo", Command: []string{"./tool.sh"}, Dir: dir, Env: map[string]string{"GREETING": "hi"}}
+		result, err := run(tool, `{"text":"hello"}`)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result).To(MatchRegexp(`^/\S+localai-tool-\S+ hi\n\{"text":"hello"\}$`))
+	})
+
+	It("reports the failures and the timeouts of the commands", func() {
+		_, err := run(config.ServerTool{Name: "fail", Command: []string{"sh", "-c", "echo broken >&2; exit 3"}}, `{}`)
+		Expect(err).To(MatchError(ContainSubstring("tool fail failed: exit status 3: broken")))
+
+		_, err = run(config.ServerTool{Name: "slow", Command: []string{"sleep", "10"}, Timeout: "100ms"}, `{}`)
+		Expect(err).To(MatchError("tool slow timed out after 100ms"))
+	})
+
+	It("kills the children of the commands which time out", func() {
+		pidFile := filepath.Join(GinkgoT().TempDir(), "child.pid")
+		tool := config.ServerTool{
+			Name:    "spawner",
+			Command: []string{"sh", "-c", `sleep 10 & echo $! > "$PID_FILE"; wait`},
+			Env:     map[string]string{"PID_FILE": pidFile},
+			Timeout: "200ms",
+		}
+
+		start := time.Now()
+		_, err := run(tool, `{}`)
+		Expect(err).To(MatchError("tool spawner timed out after 200ms"))
+		// The child doesn't keep the output of the command open until the wait delay
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+
+		dat, err := os.ReadFile(pidFile)
+		Expect(err).ToNot(HaveOccurred())
+		pid, err := strconv.Atoi(strings.TrimSpace(string(dat)))
+		Expect(err).ToNot(HaveOccurred())
+		// The killed child is gone, or a zombie until it is reaped
+		Eventually(func() bool {
+			stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+			return err != nil || strings.Contains(string(stat), ") Z ")
+		}).Should(BeTrue())
+	})
+
+	It("runs the commands as the user of the tool", func() {
+		if os.Geteuid() != 0 {
+			Skip("switching users requires root")
+		}
+		nobody, err := user.Lookup("nobody")
+		if err != nil {
+			Skip("no nobody user")
+		}
+
+		result, err := run(config.ServerTool{Name: "whoami", Command: []string{"id", "-u"}, User: "nobody"}, `{}`)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(strings.TrimSpace(result)).To(Equal(nobody.Uid))
+
+		_, err = run(config.ServerTool{Name: "whoami", Command: []string{"id", "-u"}, User: "no-such-user"}, `{}`)
+		Expect(err).To(MatchError(`tool whoami: unknown user "no-such-user"`))
+	})
+})
@@ -12,7 +12,7 @@ import (
 	"github.com/mudler/LocalAI/pkg/model"
 )
 
-func ModelTranscription(audio, language string, translate bool, ml *model.ModelLoader, backendConfig config.BackendConfig, appConfig *config.ApplicationConfig) (*schema.TranscriptionResult, error) {
+func ModelTranscription(ctx context.Context, audio, language string, translate bool, ml *model.ModelLoader, backendConfig config.BackendConfig, appConfig *config.ApplicationConfig) (*schema.TranscriptionResult, error) {
 
 	if backendConfig.Backend == "" {
 		backendConfig.Backend = model.WhisperBackend
@@ -30,7 +30,13 @@ func ModelTranscription(audio, language string, translate bool, ml *model.ModelL
 		return nil, fmt.Errorf("could not load transcription model")
 	}
 
-	r, err := transcriptionModel.AudioTranscription(context.Background(), &proto.TranscriptRequest{
+	done, err := admit(ctx, &backendConfig, appConfig)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	r, err := transcriptionModel.AudioTranscription(ctx, &proto.TranscriptRequest{
 		Dst:       audio,
 		Language:  language,
 		Translate: translate,
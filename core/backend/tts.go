@@ -14,6 +14,7 @@ import (
 )
 
 func ModelTTS(
+	ctx context.Context,
 	text,
 	voice,
 	language string,
@@ -57,7 +58,13 @@ func ModelTTS(
 		modelPath = backendConfig.Model // skip this step if it fails?????
 	}
 
-	res, err := ttsModel.TTS(context.Background(), &proto.TTSRequest{
+	done, err := admit(ctx, &backendConfig, appConfig)
+	if err != nil {
+		return "", nil, err
+	}
+	defer done()
+
+	res, err := ttsModel.TTS(ctx, &proto.TTSRequest{
 		Text:     text,
 		Model:    modelPath,
 		Voice:    voice,
@@ -7,6 +7,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/dustin/go-humanize"
 	"github.com/mudler/LocalAI/core/application"
 	cli_api "github.com/mudler/LocalAI/core/cli/api"
 	cliContext "github.com/mudler/LocalAI/core/cli/context"
@@ -25,6 +26,9 @@ type RunCMD struct {
 	ModelsPath                   string        `env:"LOCALAI_MODELS_PATH,MODELS_PATH" type:"path" default:"${basepath}/models" help:"Path containing models used for inferencing" group:"storage"`
 	GeneratedContentPath         string        `env:"LOCALAI_GENERATED_CONTENT_PATH,GENERATED_CONTENT_PATH" type:"path" default:"/tmp/generated/content" help:"Location for generated content (e.g. images, audio, videos)" group:"storage"`
 	UploadPath                   string        `env:"LOCALAI_UPLOAD_PATH,UPLOAD_PATH" type:"path" default:"/tmp/localai/upload" help:"Path to store uploads from files api" group:"storage"`
+	DataPath                     string        `env:"LOCALAI_DATA_PATH,DATA_PATH" type:"path" default:"${basepath}/data" help:"Path used to persist server-side state (e.g. stored responses)" group:"storage"`
+	StoresPath                   string        `env:"LOCALAI_STORES_PATH,STORES_PATH" type:"path" default:"${basepath}/data/stores" help:"Path where the vector stores are persisted, set to an empty string to keep them in memory only" group:"storage"`
+	ToolsPath                    string        `env:"LOCALAI_TOOLS_PATH,TOOLS_PATH" type:"path" default:"${basepath}/tools" help:"Path containing the tools the server can run for the models during the chat completions" group:"storage"`
 	LocalaiConfigDir             string        `env:"LOCALAI_CONFIG_DIR" type:"path" default:"${basepath}/configuration" help:"Directory for dynamic loading of certain configuration files (currently api_keys.json and external_backends.json)" group:"storage"`
 	LocalaiConfigDirPollInterval time.Duration `env:"LOCALAI_CONFIG_DIR_POLL_INTERVAL" help:"Typically the config path picks up changes automatically, but if your system has broken fsnotify events, set this to an interval to poll the LocalAI Config Dir (example: 1m)" group:"storage"`
 	// The alias on this option is there to preserve functionality with the old `--config-file` parameter
@@ -61,6 +65,11 @@ type RunCMD struct {
 	Peer2PeerNetworkID                 string   `env:"LOCALAI_P2P_NETWORK_ID,P2P_NETWORK_ID" help:"Network ID for P2P mode, can be set arbitrarly by the user for grouping a set of instances" group:"p2p"`
 	ParallelRequests                   bool     `env:"LOCALAI_PARALLEL_REQUESTS,PARALLEL_REQUESTS" help:"Enable backends to handle multiple requests in parallel if they support it (e.g.: llama.cpp or vllm)" group:"backends"`
 	SingleActiveBackend                bool     `env:"LOCALAI_SINGLE_ACTIVE_BACKEND,SINGLE_ACTIVE_BACKEND" help:"Allow only one backend to be run at a time" group:"backends"`
+	MemoryBudget                       string   `env:"LOCALAI_MEMORY_BUDGET,MEMORY_BUDGET" help:"Memory the loaded backends can use together (e.g. 24GB). The least recently used backends are stopped to load a model that does not fit. Unlimited when empty" group:"backends"`
+	QueueMaxInFlight                   int      `env:"LOCALAI_QUEUE_MAX_IN_FLIGHT,QUEUE_MAX_IN_FLIGHT" default:"0" help:"Default number of requests sent to a model at the same time, the others wait in a queue by priority. Unlimited when 0" group:"backends"`
+	QueueMaxLength                     int      `env:"LOCALAI_QUEUE_MAX_LENGTH,QUEUE_MAX_LENGTH" default:"0" help:"Default number of requests that can wait for a model, the others are refused. Unlimited when 0" group:"backends"`
+	QueueTimeout                       string   `env:"LOCALAI_QUEUE_TIMEOUT,QUEUE_TIMEOUT" help:"Default time a request can wait for a model before it is refused (e.g. 30s). Unlimited when empty" group:"backends"`
+	RejectRequestsWhileLoading         bool     `env:"LOCALAI_REJECT_REQUESTS_WHILE_LOADING,REJECT_REQUESTS_WHILE_LOADING" default:"false" help:"Answer the requests for a model which is loading with a 503 and a Retry-After header, instead of making them wait for the load" group:"backends"`
 	PreloadBackendOnly                 bool     `env:"LOCALAI_PRELOAD_BACKEND_ONLY,PRELOAD_BACKEND_ONLY" default:"false" help:"Do not launch the API services, only the preloaded models / backends are started (useful for multi-node setups)" group:"backends"`
 	ExternalGRPCBackends               []string `env:"LOCALAI_EXTERNAL_GRPC_BACKENDS,EXTERNAL_GRPC_BACKENDS" help:"A list of external grpc backends" group:"backends"`
 	EnableWatchdogIdle                 bool     `env:"LOCALAI_WATCHDOG_IDLE,WATCHDOG_IDLE" default:"false" help:"Enable watchdog for stopping backends that are idle longer than the watchdog-idle-timeout" group:"backends"`
@@ -70,7 +79,17 @@ type RunCMD struct {
 	Federated                          bool     `env:"LOCALAI_FEDERATED,FEDERATED" help:"Enable federated instance" group:"federated"`
 	DisableGalleryEndpoint             bool     `env:"LOCALAI_DISABLE_GALLERY_ENDPOINT,DISABLE_GALLERY_ENDPOINT" help:"Disable the gallery endpoints" group:"api"`
 	MachineTag                         string   `env:"LOCALAI_MACHINE_TAG,MACHINE_TAG" help:"Add Machine-Tag header to each response which is useful to track the machine in the P2P network" group:"api"`
+	BatchConcurrency                   int      `env:"LOCALAI_BATCH_CONCURRENCY,BATCH_CONCURRENCY" default:"1" help:"Number of requests of a batch (Batch API) processed concurrently" group:"api"`
+	AuditLog                           bool     `env:"LOCALAI_AUDIT_LOG,AUDIT_LOG" default:"false" help:"Record an audit entry for each inference request (model, API key, parameters, latency, token usage) in the data path" group:"audit"`
+	AuditLogRedact                     []string `env:"LOCALAI_AUDIT_LOG_REDACT,AUDIT_LOG_REDACT" help:"Parts of the inference requests to leave out of the audit log: prompts, responses" group:"audit"`
+	AuditLogMaxSize                    int      `env:"LOCALAI_AUDIT_LOG_MAX_SIZE,AUDIT_LOG_MAX_SIZE" default:"100" help:"Size in MB after which the audit log file is rotated" group:"audit"`
+	AuditLogMaxFiles                   int      `env:"LOCALAI_AUDIT_LOG_MAX_FILES,AUDIT_LOG_MAX_FILES" default:"10" help:"Number of rotated audit log files to keep, 0 keeps all of them" group:"audit"`
+	TracingEndpoint                    string   `env:"LOCALAI_TRACING_ENDPOINT,TRACING_ENDPOINT" help:"OTLP endpoint the traces of the requests are exported to (e.g. http://otel-collector:4317)" group:"tracing"`
+	TracingProtocol                    string   `env:"LOCALAI_TRACING_PROTOCOL,TRACING_PROTOCOL" default:"grpc" enum:"grpc,http" help:"Protocol of the OTLP endpoint: grpc or http" group:"tracing"`
+	TracingFile                        string   `env:"LOCALAI_TRACING_FILE,TRACING_FILE" help:"File the traces of the requests are written to, as JSON (useful without a collector)" group:"tracing"`
+	TracingSampleRatio                 float64  `env:"LOCALAI_TRACING_SAMPLE_RATIO,TRACING_SAMPLE_RATIO" default:"1" help:"Ratio of the requests traced, from 0 to 1. Requests with a sampled parent trace are always traced" group:"tracing"`
 	LoadToMemory                       []string `env:"LOCALAI_LOAD_TO_MEMORY,LOAD_TO_MEMORY" help:"A list of models to load into memory at startup" group:"models"`
+	DisableModelHotReload              bool     `env:"LOCALAI_DISABLE_MODEL_HOT_RELOAD,DISABLE_MODEL_HOT_RELOAD" help:"Do not reload the configuration files of the models when they change in the models path" group:"models"`
 }
 
 func (r *RunCMD) Run(ctx *cliContext.Context) error {
@@ -87,6 +106,9 @@ func (r *RunCMD) Run(ctx *cliContext.Context) error {
 		config.WithDebug(zerolog.GlobalLevel() <= zerolog.DebugLevel),
 		config.WithGeneratedContentDir(r.GeneratedContentPath),
 		config.WithUploadDir(r.UploadPath),
+		config.WithDataPath(r.DataPath),
+		config.WithStoresPath(r.StoresPath),
+		config.WithToolsPath(r.ToolsPath),
 		config.WithDynamicConfigDir(r.LocalaiConfigDir),
 		config.WithDynamicConfigDirPollInterval(r.LocalaiConfigDirPollInterval),
 		config.WithF16(r.F16),
@@ -107,6 +129,9 @@ func (r *RunCMD) Run(ctx *cliContext.Context) error {
 		config.WithHttpGetExemptedEndpoints(r.HttpGetExemptedEndpoints),
 		config.WithP2PNetworkID(r.Peer2PeerNetworkID),
 		config.WithLoadToMemory(r.LoadToMemory),
+		config.WithBatchConcurrency(r.BatchConcurrency),
+		config.WithAuditLog(r.AuditLog, r.AuditLogRedact, r.AuditLogMaxSize, r.AuditLogMaxFiles),
+		config.WithTracing(r.TracingEndpoint, r.TracingProtocol, r.TracingFile, r.TracingSampleRatio),
 		config.WithMachineTag(r.MachineTag),
 	}
 
@@ -149,6 +174,14 @@ func (r *RunCMD) Run(ctx *cliContext.Context) error {
 		opts = append(opts, config.DisableGalleryEndpoint)
 	}
 
+	if r.DisableModelHotReload {
+		opts = append(opts, config.DisableModelHotReload)
+	}
+
+	if r.RejectRequestsWhileLoading {
+		opts = append(opts, config.RejectRequestsWhileLoading)
+	}
+
 	if idleWatchDog || busyWatchDog {
 		opts = append(opts, config.EnableWatchDog)
 		if idleWatchDog {
@@ -174,6 +207,21 @@ func (r *RunCMD) Run(ctx *cliContext.Context) error {
 	if r.SingleActiveBackend {
 		opts = append(opts, config.EnableSingleBackend)
 	}
+	if r.MemoryBudget != "" {
+		budget, err := humanize.ParseBytes(r.MemoryBudget)
+		if err != nil {
+			return fmt.Errorf("invalid memory budget %q: %w", r.MemoryBudget, err)
+		}
+		opts = append(opts, config.WithMemoryBudget(budget))
+	}
+	opts = append(opts, config.WithQueueMaxInFlight(r.QueueMaxInFlight), config.WithQueueMaxLength(r.QueueMaxLength))
+	if r.QueueTimeout != "" {
+		timeout, err := time.ParseDuration(r.QueueTimeout)
+		if err != nil {
+			return fmt.Errorf("invalid queue timeout %q: %w", r.QueueTimeout, err)
+		}
+		opts = append(opts, config.WithQueueTimeout(timeout))
+	}
 
 	// split ":" to get backend name and the uri
 	for _, v := range r.ExternalGRPCBackends {
@@ -49,7 +49,7 @@ func (t *TranscriptCMD) Run(ctx *cliContext.Context) error {
 		}
 	}()
 
-	tr, err := backend.ModelTranscription(t.Filename, t.Language, t.Translate, ml, c, opts)
+	tr, err := backend.ModelTranscription(opts.Context, t.Filename, t.Language, t.Translate, ml, c, opts)
 	if err != nil {
 		return err
 	}
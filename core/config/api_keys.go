@@ -0,0 +1,109 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// ApiKeyPolicy describes what an API key is allowed to do.
+// Keys configured as plain strings (--api-keys, or strings in api_keys.json) have no restrictions.
+type ApiKeyPolicy struct {
+	Key  string `json:"key" yaml:"key"`
+	Name string `json:"name" yaml:"name"`
+
+	// AllowedModels restricts the models the key can use, empty allows every model
+	AllowedModels []string `json:"allowed_models,omitempty" yaml:"allowed_models,omitempty"`
+	// AllowedEndpoints restricts the endpoints the key can call by path prefix (e.g. "/v1/chat/completions").
+	// The "/v1" prefix is optional. Empty allows every endpoint.
+	AllowedEndpoints []string `json:"allowed_endpoints,omitempty" yaml:"allowed_endpoints,omitempty"`
+
+	// RequestsPerMinute and TokensPerDay are the rate limits of the key, 0 means unlimited
+	RequestsPerMinute int `json:"requests_per_minute,omitempty" yaml:"requests_per_minute,omitempty"`
+	TokensPerDay      int `json:"tokens_per_day,omitempty" yaml:"tokens_per_day,omitempty"`
+
+	// Priority is the queueing priority of the requests made with the key: interactive, normal or batch.
+	// It overrides the X-Priority header of the requests when set.
+	Priority string `json:"priority,omitempty" yaml:"priority,omitempty"`
+
+	// Admin keys can access the administrative endpoints, such as the usage report
+	Admin bool `json:"admin,omitempty" yaml:"admin,omitempty"`
+
+	// KeyID identifies the key of the policies kept without it, e.g. the policies persisted with the batches. See ID.
+	KeyID string `json:"key_id,omitempty" yaml:"-"`
+}
+
+// ID identifies the key without revealing it: the usage, the rate limits and the objects created with the key
+// (files, batches, responses) belong to it
+func (p ApiKeyPolicy) ID() string {
+	if p.Key == "" {
+		return p.KeyID
+	}
+	sum := sha256.Sum256([]byte(p.Key))
+	return hex.EncodeToString(sum[:16])
+}
+
+// ValidateApiKeyPolicies returns an error if two policies have the same key or the same name
+func ValidateApiKeyPolicies(policies []ApiKeyPolicy) error {
+	keys := map[string]bool{}
+	names := map[string]bool{}
+	for _, p := range policies {
+		if keys[p.Key] {
+			return fmt.Errorf("the API key %q is configured twice", p.DisplayName())
+		}
+		keys[p.Key] = true
+		if p.Name == "" {
+			continue
+		}
+		if names[p.Name] {
+			return fmt.Errorf("two API keys are named %q", p.Name)
+		}
+		names[p.Name] = true
+	}
+	return nil
+}
+
+// DisplayName returns the name of the key, or a masked version of the key when it has no name
+func (p ApiKeyPolicy) DisplayName() string {
+	if p.Name != "" {
+		return p.Name
+	}
+	if len(p.Key) <= 8 {
+		return "key-****"
+	}
+	return "key-****" + p.Key[len(p.Key)-4:]
+}
+
+func (p ApiKeyPolicy) ModelAllowed(model string) bool {
+	if len(p.AllowedModels) == 0 {
+		return true
+	}
+	for _, m := range p.AllowedModels {
+		if m == model {
+			return true
+		}
+	}
+	return false
+}
+
+func (p ApiKeyPolicy) EndpointAllowed(path string) bool {
+	if len(p.AllowedEndpoints) == 0 {
+		return true
+	}
+	path = trimVersionPrefix(path)
+	for _, e := range p.AllowedEndpoints {
+		e = strings.TrimSuffix(trimVersionPrefix(e), "/")
+		if e == "" || path == e || strings.HasPrefix(path, e+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func trimVersionPrefix(path string) string {
+	if path == "/v1" || strings.HasPrefix(path, "/v1/") {
+		return strings.TrimPrefix(path, "/v1")
+	}
+	return path
+}
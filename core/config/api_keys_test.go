@@ -0,0 +1,26 @@
+package config_test
+
+import (
+	. "github.com/mudler/LocalAI/core/config"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ApiKeyPolicy", func() {
+	It("identifies the keys apart from their display name", func() {
+		a, b := ApiKeyPolicy{Key: "sk-a"}, ApiKeyPolicy{Key: "sk-b"}
+		Expect(a.DisplayName()).To(Equal(b.DisplayName()))
+		Expect(a.ID()).ToNot(Equal(b.ID()))
+		Expect(a.ID()).ToNot(ContainSubstring("sk-a"))
+
+		// The policies kept without their key keep its ID
+		Expect(ApiKeyPolicy{KeyID: a.ID()}.ID()).To(Equal(a.ID()))
+	})
+
+	It("refuses the keys and the names configured twice", func() {
+		Expect(ValidateApiKeyPolicies([]ApiKeyPolicy{{Key: "sk-a", Name: "a"}, {Key: "sk-b", Name: "b"}, {Key: "sk-c"}, {Key: "sk-d"}})).To(Succeed())
+		Expect(ValidateApiKeyPolicies([]ApiKeyPolicy{{Key: "sk-a", Name: "a"}, {Key: "sk-b", Name: "a"}})).ToNot(Succeed())
+		Expect(ValidateApiKeyPolicies([]ApiKeyPolicy{{Key: "sk-a", Name: "a"}, {Key: "sk-a", Name: "b"}})).ToNot(Succeed())
+	})
+})
@@ -22,6 +22,11 @@ type ApplicationConfig struct {
 	GeneratedContentDir                 string
 
 	UploadDir string
+	DataPath  string
+	// StoresPath is where the local-store stores are persisted, in memory only when empty
+	StoresPath string
+	// ToolsPath is the directory of the tools the server can run for the models, see BackendConfig.ServerTools
+	ToolsPath string
 
 	DynamicConfigsDir             string
 	DynamicConfigsDirPollInterval time.Duration
@@ -31,6 +36,7 @@ type ApplicationConfig struct {
 	PreloadModelsFromPath         string
 	CORSAllowOrigins              string
 	ApiKeys                       []string
+	ApiKeyPolicies                []ApiKeyPolicy
 	P2PToken                      string
 	P2PNetworkID                  string
 
@@ -42,8 +48,13 @@ type ApplicationConfig struct {
 	DisableMetrics                     bool
 	HttpGetExemptedEndpoints           []*regexp.Regexp
 	DisableGalleryEndpoint             bool
+	DisableModelHotReload              bool
 	LoadToMemory                       []string
 
+	// RejectRequestsWhileLoading answers the requests for a model which is loading with a 503 instead of
+	// making them wait for the load
+	RejectRequestsWhileLoading bool
+
 	Galleries        []Gallery
 	BackendGalleries []Gallery
 
@@ -53,6 +64,28 @@ type ApplicationConfig struct {
 
 	SingleBackend           bool
 	ParallelBackendRequests bool
+	// MemoryBudget is the memory, in bytes, the loaded backends can use together before the least recently
+	// used ones are stopped. 0 disables the budget.
+	MemoryBudget uint64
+
+	// Defaults of the admission queue of the models, see Queue
+	QueueMaxInFlight int
+	QueueMaxLength   int
+	QueueTimeout     time.Duration
+
+	BatchConcurrency int
+
+	AuditLog         bool
+	AuditLogRedact   []string
+	AuditLogMaxSize  int
+	AuditLogMaxFiles int
+
+	// TracingEndpoint is the OTLP endpoint the spans are exported to, using TracingProtocol (grpc or http).
+	// TracingFile is a file the spans are written to as JSON. Tracing is disabled if neither is set.
+	TracingEndpoint    string
+	TracingProtocol    string
+	TracingFile        string
+	TracingSampleRatio float64
 
 	WatchDogIdle bool
 	WatchDogBusy bool
@@ -147,6 +180,14 @@ var DisableGalleryEndpoint = func(o *ApplicationConfig) {
 	o.DisableGalleryEndpoint = true
 }
 
+var DisableModelHotReload = func(o *ApplicationConfig) {
+	o.DisableModelHotReload = true
+}
+
+var RejectRequestsWhileLoading = func(o *ApplicationConfig) {
+	o.RejectRequestsWhileLoading = true
+}
+
 var EnableWatchDogBusyCheck = func(o *ApplicationConfig) {
 	o.WatchDog = true
 	o.WatchDogBusy = true
@@ -301,6 +342,54 @@ func WithUploadDir(uploadDir string) AppOption {
 	}
 }
 
+func WithDataPath(dataPath string) AppOption {
+	return func(o *ApplicationConfig) {
+		o.DataPath = dataPath
+	}
+}
+
+func WithStoresPath(storesPath string) AppOption {
+	return func(o *ApplicationConfig) {
+		o.StoresPath = storesPath
+	}
+}
+
+func WithToolsPath(toolsPath string) AppOption {
+	return func(o *ApplicationConfig) {
+		o.ToolsPath = toolsPath
+	}
+}
+
+func WithMemoryBudget(budget uint64) AppOption {
+	return func(o *ApplicationConfig) {
+		o.MemoryBudget = budget
+	}
+}
+
+func WithQueueMaxInFlight(requests int) AppOption {
+	return func(o *ApplicationConfig) {
+		o.QueueMaxInFlight = requests
+	}
+}
+
+func WithQueueMaxLength(requests int) AppOption {
+	return func(o *ApplicationConfig) {
+		o.QueueMaxLength = requests
+	}
+}
+
+func WithQueueTimeout(timeout time.Duration) AppOption {
+	return func(o *ApplicationConfig) {
+		o.QueueTimeout = timeout
+	}
+}
+
+func WithBatchConcurrency(concurrency int) AppOption {
+	return func(o *ApplicationConfig) {
+		o.BatchConcurrency = concurrency
+	}
+}
+
 func WithDynamicConfigDir(dynamicConfigsDir string) AppOption {
 	return func(o *ApplicationConfig) {
 		o.DynamicConfigsDir = dynamicConfigsDir
@@ -319,6 +408,30 @@ func WithApiKeys(apiKeys []string) AppOption {
 	}
 }
 
+func WithAuditLog(enabled bool, redact []string, maxSizeMB, maxFiles int) AppOption {
+	return func(o *ApplicationConfig) {
+		o.AuditLog = enabled
+		o.AuditLogRedact = redact
+		o.AuditLogMaxSize = maxSizeMB
+		o.AuditLogMaxFiles = maxFiles
+	}
+}
+
+func WithTracing(endpoint, protocol, file string, sampleRatio float64) AppOption {
+	return func(o *ApplicationConfig) {
+		o.TracingEndpoint = endpoint
+		o.TracingProtocol = protocol
+		o.TracingFile = file
+		o.TracingSampleRatio = sampleRatio
+	}
+}
+
+func WithApiKeyPolicies(policies []ApiKeyPolicy) AppOption {
+	return func(o *ApplicationConfig) {
+		o.ApiKeyPolicies = policies
+	}
+}
+
 func WithEnforcedPredownloadScans(enforced bool) AppOption {
 	return func(o *ApplicationConfig) {
 		o.EnforcePredownloadScans = enforced
@@ -383,6 +496,15 @@ func (o *ApplicationConfig) ToConfigLoaderOptions() []ConfigLoaderOption {
 	}
 }
 
+// HasApiKeys returns true if authentication is enabled, either with plain keys or with key policies
+func (o *ApplicationConfig) TracingEnabled() bool {
+	return o.TracingEndpoint != "" || o.TracingFile != ""
+}
+
+func (o *ApplicationConfig) HasApiKeys() bool {
+	return len(o.ApiKeys) > 0 || len(o.ApiKeyPolicies) > 0
+}
+
 // func WithMetrics(meter *metrics.Metrics) AppOption {
 // 	return func(o *StartupOptions) {
 // 		o.Metrics = meter
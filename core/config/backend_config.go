@@ -1,14 +1,17 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"regexp"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/mudler/LocalAI/core/schema"
 	"github.com/mudler/LocalAI/pkg/downloader"
 	"github.com/mudler/LocalAI/pkg/functions"
+	"github.com/mudler/LocalAI/pkg/reasoning"
 	"gopkg.in/yaml.v3"
 )
 
@@ -58,6 +61,27 @@ type BackendConfig struct {
 	// GRPC Options
 	GRPC GRPC `yaml:"grpc"`
 
+	// Semantic cache of the chat and completion responses
+	ResponseCache ResponseCache `yaml:"response_cache"`
+
+	// Admission queue of the requests to the backend
+	Queue Queue `yaml:"queue"`
+
+	// KeepAlive is how long the backend stays loaded once idle, e.g. "30m", or "forever"
+	KeepAlive string `yaml:"keep_alive"`
+	// Preload loads the model at startup
+	Preload bool   `yaml:"preload"`
+	Warmup  Warmup `yaml:"warmup"`
+
+	// Tools run by the server during the chat completions
+	ServerTools ServerTools `yaml:"server_tools"`
+
+	// Validation of the JSON outputs against the schemas of the requests
+	StructuredOutput StructuredOutput `yaml:"structured_output"`
+
+	// Extraction of the reasoning out of the content of the chat responses
+	Reasoning reasoning.Config `yaml:"reasoning"`
+
 	// TTS specifics
 	TTSConfig `yaml:"tts"`
 
@@ -98,6 +122,103 @@ func (ff FeatureFlag) Enabled(s string) bool {
 type GRPC struct {
 	Attempts          int `yaml:"attempts"`
 	AttemptsSleepTime int `yaml:"attempts_sleep_time"`
+	// Endpoints are the addresses of identical remote backends serving the model instead of a local one.
+	// The requests go to the least busy of them.
+	Endpoints []string `yaml:"endpoints"`
+}
+
+// ResponseCache configures the semantic cache of the responses of a model: requests similar enough
+// to a previous one are answered with its response, without running the inference.
+type ResponseCache struct {
+	Enabled bool `yaml:"enabled"`
+	// EmbeddingsModel is the model used to embed the requests
+	EmbeddingsModel string `yaml:"embeddings_model"`
+	// Threshold is the cosine similarity above which a cached response is returned, 0.95 if unset
+	Threshold float32 `yaml:"threshold"`
+	// TTL is how long the responses are cached, e.g. "24h". They don't expire if unset.
+	TTL string `yaml:"ttl"`
+	// Store is the local-store namespace of the cache, "response-cache-<model name>" if unset
+	Store string `yaml:"store"`
+	// Shared answers the requests of every API key from the same responses. By default, a key is only
+	// answered from the responses of its own requests.
+	Shared bool `yaml:"shared"`
+}
+
+const DefaultResponseCacheThreshold = 0.95
+
+func (r ResponseCache) GetThreshold() float32 {
+	if r.Threshold <= 0 {
+		return DefaultResponseCacheThreshold
+	}
+	return r.Threshold
+}
+
+// GetTTL returns how long the responses are cached, 0 if they don't expire
+func (r ResponseCache) GetTTL() time.Duration {
+	if r.TTL == "" {
+		return 0
+	}
+	// Invalid TTLs are refused by Validate
+	ttl, _ := time.ParseDuration(r.TTL)
+	return ttl
+}
+
+// Queue limits the requests a model runs concurrently: the others wait in a queue, the higher priorities first.
+// Unset fields take the defaults of the instance (--queue-max-in-flight, --queue-max-length and --queue-timeout).
+type Queue struct {
+	// MaxInFlight is the number of requests sent to the backend at the same time, 0 means unlimited
+	MaxInFlight int `yaml:"max_in_flight"`
+	// MaxLength is the number of requests that can wait, 0 means unlimited. Requests beyond it are refused.
+	MaxLength int `yaml:"max_length"`
+	// Timeout is how long a request can wait, e.g. "30s". Requests wait as long as the client does if unset.
+	Timeout string `yaml:"timeout"`
+}
+
+// GetTimeout returns how long a request can wait in the queue, 0 if there is no limit
+func (q Queue) GetTimeout() time.Duration {
+	if q.Timeout == "" {
+		return 0
+	}
+	// Invalid timeouts are refused by Validate
+	timeout, _ := time.ParseDuration(q.Timeout)
+	return timeout
+}
+
+// KeepAliveForever is the keep alive of the models which stay loaded until they are unloaded explicitly
+const KeepAliveForever time.Duration = -1
+
+// ParseKeepAlive parses a keep alive: a duration, or "forever" (as well as any negative duration)
+func ParseKeepAlive(s string) (time.Duration, error) {
+	if s == "forever" {
+		return KeepAliveForever, nil
+	}
+	keepAlive, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid keep alive %q, expected a duration or forever", s)
+	}
+	if keepAlive < 0 {
+		return KeepAliveForever, nil
+	}
+	return keepAlive, nil
+}
+
+// GetKeepAlive returns how long the backend stays loaded once idle, KeepAliveForever to keep it loaded, 0 if unset
+func (c *BackendConfig) GetKeepAlive() time.Duration {
+	if c.KeepAlive == "" {
+		return 0
+	}
+	// Invalid keep alives are refused by Validate
+	keepAlive, _ := ParseKeepAlive(c.KeepAlive)
+	return keepAlive
+}
+
+// Warmup is a request run once the model is loaded, so that the first requests do not pay for the allocations
+// of the backend
+type Warmup struct {
+	// Prompt is predicted, or embedded for the embedding models. There is no warm-up without one.
+	Prompt string `yaml:"prompt"`
+	// Tokens is the number of tokens predicted, 1 by default
+	Tokens int `yaml:"tokens"`
 }
 
 type Diffusers struct {
@@ -138,6 +259,10 @@ type LLMConfig struct {
 	TrimSpace       []string `yaml:"trimspace"`
 	TrimSuffix      []string `yaml:"trimsuffix"`
 
+	// PrefixCacheSlots is the number of parallel slots of the backend (e.g. LLAMACPP_PARALLEL).
+	// When set, requests are routed to the slot holding the longest prefix of their prompt.
+	PrefixCacheSlots int `yaml:"prefix_cache_slots"`
+
 	ContextSize          *int             `yaml:"context_size"`
 	NUMA                 bool             `yaml:"numa"`
 	LoraAdapter          string           `yaml:"lora_adapter"`
@@ -201,6 +326,9 @@ type TemplateConfig struct {
 	// Functions is the template used when tools are present in the client requests
 	Functions string `yaml:"function"`
 
+	// Retrieval is the template rendering the chunks retrieved from a collection, injected as a system message
+	Retrieval string `yaml:"retrieval"`
+
 	// UseTokenizerTemplate is a flag that indicates if the tokenizer template should be used.
 	// Note: this is mostly consumed for backends such as vllm and transformers
 	// that can use the tokenizers specified in the JSON config files of the models
@@ -429,6 +557,30 @@ func (c *BackendConfig) Validate() bool {
 		}
 	}
 
+	if c.ResponseCache.TTL != "" {
+		if _, err := time.ParseDuration(c.ResponseCache.TTL); err != nil {
+			return false
+		}
+	}
+
+	if c.Queue.Timeout != "" {
+		if _, err := time.ParseDuration(c.Queue.Timeout); err != nil {
+			return false
+		}
+	}
+
+	if c.KeepAlive != "" {
+		if _, err := ParseKeepAlive(c.KeepAlive); err != nil {
+			return false
+		}
+	}
+
+	for _, tool := range c.ServerTools.Tools {
+		if tool.Validate() != nil {
+			return false
+		}
+	}
+
 	if c.Backend != "" {
 		// a regex that checks that is a string name with no special characters, except '-' and '_'
 		re := regexp.MustCompile(`^[a-zA-Z0-9-_]+$`)
@@ -4,8 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"io/fs"
+	"maps"
 	"os"
 	"path/filepath"
+	"reflect"
 	"sort"
 	"strings"
 	"sync"
@@ -333,21 +335,32 @@ func (bcl *BackendConfigLoader) Preload(modelPath string) error {
 // LoadBackendConfigsFromPath reads all the configurations of the models from a path
 // (non-recursive)
 func (bcl *BackendConfigLoader) LoadBackendConfigsFromPath(path string, opts ...ConfigLoaderOption) error {
+	configs, err := readBackendConfigsFromPath(path, opts...)
+	if err != nil {
+		return err
+	}
+
 	bcl.Lock()
 	defer bcl.Unlock()
+	maps.Copy(bcl.configs, configs)
+	return nil
+}
 
+// readBackendConfigsFromPath reads the valid configurations of the models from a path (non-recursive), by name
+func readBackendConfigsFromPath(path string, opts ...ConfigLoaderOption) (map[string]BackendConfig, error) {
 	entries, err := os.ReadDir(path)
 	if err != nil {
-		return fmt.Errorf("LoadBackendConfigsFromPath cannot read directory '%s': %w", path, err)
+		return nil, fmt.Errorf("LoadBackendConfigsFromPath cannot read directory '%s': %w", path, err)
 	}
 	files := make([]fs.FileInfo, 0, len(entries))
 	for _, entry := range entries {
 		info, err := entry.Info()
 		if err != nil {
-			return err
+			return nil, err
 		}
 		files = append(files, info)
 	}
+	configs := map[string]BackendConfig{}
 	for _, file := range files {
 		// Skip templates, YAML and .keep files
 		if !strings.Contains(file.Name(), ".yaml") && !strings.Contains(file.Name(), ".yml") ||
@@ -360,11 +373,50 @@ func (bcl *BackendConfigLoader) LoadBackendConfigsFromPath(path string, opts ...
 			continue
 		}
 		if c.Validate() {
-			bcl.configs[c.Name] = *c
+			configs[c.Name] = *c
 		} else {
 			log.Error().Err(err).Str("Name", c.Name).Msgf("config is not valid")
 		}
 	}
 
-	return nil
+	return configs, nil
+}
+
+// BackendConfigChange is a configuration of a model changed by ReloadBackendConfigsFromPath
+type BackendConfigChange struct {
+	Old, New BackendConfig
+}
+
+// ReloadBackendConfigsFromPath reads again the configurations of the models from a path, and returns the ones
+// which changed, sorted by name. The model files downloaded by Preload are kept.
+// The configurations are swapped at once, so the requests never see them before the model files are fixed up.
+func (bcl *BackendConfigLoader) ReloadBackendConfigsFromPath(path string, opts ...ConfigLoaderOption) ([]BackendConfigChange, error) {
+	configs, err := readBackendConfigsFromPath(path, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	bcl.Lock()
+	defer bcl.Unlock()
+	changes := []BackendConfigChange{}
+	for name, c := range configs {
+		old, exists := bcl.configs[name]
+		if exists {
+			if c.IsModelURL() && c.ModelFileName() == old.Model {
+				c.Model = old.Model
+			}
+			if c.IsMMProjURL() && c.MMProjFileName() == old.MMProj {
+				c.MMProj = old.MMProj
+			}
+			if !reflect.DeepEqual(old, c) {
+				changes = append(changes, BackendConfigChange{Old: old, New: c})
+			}
+		}
+		bcl.configs[name] = c
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].New.Name < changes[j].New.Name
+	})
+	return changes, nil
 }
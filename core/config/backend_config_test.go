@@ -4,6 +4,7 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -160,4 +161,20 @@ parameters:
 		Expect(i.HasUsecases(FLAG_COMPLETION)).To(BeTrue())
 		Expect(i.HasUsecases(FLAG_CHAT)).To(BeTrue())
 	})
+
+	It("parses the keep alive", func() {
+		for s, keepAlive := range map[string]time.Duration{"30m": 30 * time.Minute, "forever": KeepAliveForever, "-1s": KeepAliveForever} {
+			parsed, err := ParseKeepAlive(s)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(parsed).To(Equal(keepAlive))
+		}
+		_, err := ParseKeepAlive("always")
+		Expect(err).To(HaveOccurred())
+
+		c := BackendConfig{Name: "c", KeepAlive: "always"}
+		Expect(c.Validate()).To(BeFalse())
+		c.KeepAlive = "1h"
+		Expect(c.Validate()).To(BeTrue())
+		Expect(c.GetKeepAlive()).To(Equal(time.Hour))
+	})
 })
@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"path/filepath"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -110,4 +111,40 @@ options:
 
 		})
 	})
+
+	Context("ReloadBackendConfigsFromPath", func() {
+		It("returns the configurations which changed", func() {
+			tmpdir, err := os.MkdirTemp("", "test")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(tmpdir)
+
+			write := func(name, content string) {
+				Expect(os.WriteFile(filepath.Join(tmpdir, name+".yaml"), []byte(content), 0644)).To(Succeed())
+			}
+			write("changed", "name: changed\ncontext_size: 2048\n")
+			write("unchanged", "name: unchanged\ncontext_size: 2048\n")
+			write("downloaded", "name: downloaded\nparameters:\n  model: https://example.com/model.gguf\n")
+
+			bcl := NewBackendConfigLoader(tmpdir)
+			Expect(bcl.LoadBackendConfigsFromPath(tmpdir)).To(Succeed())
+			// As done by Preload once the model is downloaded
+			downloaded, _ := bcl.GetBackendConfig("downloaded")
+			downloaded.Model = downloaded.ModelFileName()
+			bcl.configs["downloaded"] = downloaded
+
+			write("changed", "name: changed\ncontext_size: 8192\n")
+			write("added", "name: added\n")
+
+			changes, err := bcl.ReloadBackendConfigsFromPath(tmpdir)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(changes).To(HaveLen(1))
+			Expect(*changes[0].Old.ContextSize).To(Equal(2048))
+			Expect(*changes[0].New.ContextSize).To(Equal(8192))
+
+			downloaded, _ = bcl.GetBackendConfig("downloaded")
+			Expect(downloaded.Model).To(Equal("model.gguf"))
+			_, exists := bcl.GetBackendConfig("added")
+			Expect(exists).To(BeTrue())
+		})
+	})
 })
@@ -44,3 +44,46 @@ func guessDefaultsFromFile(cfg *BackendConfig, modelPath string, defaultCtx int)
 		return
 	}
 }
+
+// EstimateMemory estimates the memory, RAM and VRAM, the model needs once loaded: from the metadata of GGUF files with
+// the context size and GPU layers of the configuration, and from the size of the model file otherwise. It returns 0
+// if the model is not a file in modelPath.
+func EstimateMemory(cfg *BackendConfig, modelPath string) (estimate uint64) {
+	if cfg.Model == "" {
+		return 0
+	}
+	path := filepath.Join(modelPath, cfg.ModelFileName())
+	st, err := os.Stat(path)
+	if err != nil || st.IsDir() {
+		return 0
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error().Msgf("EstimateMemory: %s", "panic while parsing gguf file")
+			estimate = uint64(st.Size())
+		}
+	}()
+
+	f, err := gguf.ParseGGUFFile(path)
+	if err != nil {
+		return uint64(st.Size())
+	}
+
+	opts := []gguf.GGUFRunEstimateOption{}
+	if cfg.ContextSize != nil && *cfg.ContextSize > 0 {
+		opts = append(opts, gguf.WithLLaMACppContextSize(int32(*cfg.ContextSize)))
+	}
+	if cfg.NGPULayers != nil && *cfg.NGPULayers >= 0 {
+		opts = append(opts, gguf.WithLLaMACppOffloadLayers(uint64(*cfg.NGPULayers)))
+	}
+
+	// The weights are counted even if they are memory mapped, they end up resident
+	summary := f.EstimateLLaMACppRun(opts...).SummarizeItem(false, 0, 0)
+	estimate = uint64(summary.RAM.NonUMA)
+	for _, vram := range summary.VRAMs {
+		estimate += uint64(vram.NonUMA)
+	}
+
+	return estimate
+}
@@ -0,0 +1,207 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mudler/LocalAI/pkg/functions"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// DefaultServerToolsMaxIterations is the number of rounds of tool calls of a request when unset
+	DefaultServerToolsMaxIterations = 5
+	// DefaultServerToolTimeout is how long a tool can run when unset
+	DefaultServerToolTimeout = 30 * time.Second
+)
+
+// The built-in tools
+const (
+	// BuiltinCollectionSearch searches the chunks of the RAG collection of the tool, in its local-store
+	BuiltinCollectionSearch = "collection_search"
+)
+
+// ServerTools are the tools the server runs itself during the chat completions of a model: their results are fed back
+// to the model until it answers. The tools come from the configuration of the model, and from the tools directory.
+type ServerTools struct {
+	// MaxIterations is the number of rounds of tool calls of a request, DefaultServerToolsMaxIterations if unset
+	MaxIterations int `yaml:"max_iterations"`
+	// Tools are the tools of the model
+	Tools []ServerTool `yaml:"tools"`
+	// Use names the tools of the tools directory the model uses
+	Use []string `yaml:"use"`
+}
+
+// GetMaxIterations returns the number of rounds of tool calls of a request
+func (s ServerTools) GetMaxIterations() int {
+	if s.MaxIterations <= 0 {
+		return DefaultServerToolsMaxIterations
+	}
+	return s.MaxIterations
+}
+
+// ServerTool is a tool the model can call, run by the server. It is either a webhook (URL), a command, or a built-in.
+type ServerTool struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	// Parameters is the JSON schema of the arguments of the tool
+	Parameters map[string]interface{} `yaml:"parameters"`
+
+	// URL is called with a POST of the arguments, and the body of its response is the result
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers"`
+
+	// Command is run with the arguments on its stdin in an empty working directory, with only the environment of
+	// Env, and its stdout is the result. A relative path is relative to the directory of the tool.
+	Command []string          `yaml:"command"`
+	Env     map[string]string `yaml:"env"`
+	// User is the user (name or ID) the command runs as, the user of the server if unset.
+	// The server must be allowed to switch to it, e.g. by running as root.
+	User string `yaml:"user"`
+
+	// Builtin names a tool of the server, e.g. BuiltinCollectionSearch
+	Builtin    string `yaml:"builtin"`
+	Collection string `yaml:"collection"`
+
+	// Timeout is how long the tool can run, e.g. "10s", DefaultServerToolTimeout if unset
+	Timeout string `yaml:"timeout"`
+
+	// Dir is the directory of the file declaring the tool
+	Dir string `yaml:"-"`
+}
+
+// Validate returns an error if the tool can't be run
+func (t ServerTool) Validate() error {
+	if t.Name == "" {
+		return errors.New("the tool has no name")
+	}
+	kinds := 0
+	for _, set := range []bool{t.URL != "", len(t.Command) > 0, t.Builtin != ""} {
+		if set {
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		return fmt.Errorf("tool %s must have exactly one of url, command and builtin", t.Name)
+	}
+	if t.User != "" && len(t.Command) == 0 {
+		return fmt.Errorf("tool %s: only the commands can run as another user", t.Name)
+	}
+	if t.Builtin != "" && t.Builtin != BuiltinCollectionSearch {
+		return fmt.Errorf("tool %s: unknown builtin %q", t.Name, t.Builtin)
+	}
+	if t.Builtin == BuiltinCollectionSearch && t.Collection == "" {
+		return fmt.Errorf("tool %s: the collection to search is required", t.Name)
+	}
+	if t.Timeout != "" {
+		if _, err := time.ParseDuration(t.Timeout); err != nil {
+			return fmt.Errorf("tool %s: invalid timeout %q", t.Name, t.Timeout)
+		}
+	}
+	return nil
+}
+
+// GetTimeout returns how long the tool can run
+func (t ServerTool) GetTimeout() time.Duration {
+	if t.Timeout == "" {
+		return DefaultServerToolTimeout
+	}
+	// Invalid timeouts are refused by Validate
+	timeout, _ := time.ParseDuration(t.Timeout)
+	return timeout
+}
+
+// Function returns the function the model calls the tool with
+func (t ServerTool) Function() functions.Function {
+	parameters := t.Parameters
+	if parameters == nil && t.Builtin == BuiltinCollectionSearch {
+		parameters = map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"query": map[string]interface{}{
+					"type":        "string",
+					"description": "What to search for",
+				},
+			},
+			"required": []interface{}{"query"},
+		}
+	}
+	if parameters == nil {
+		parameters = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+	}
+	return functions.Function{Name: t.Name, Description: t.Description, Parameters: parameters}
+}
+
+// LoadServerTools reads the tools of the tools directory: each YAML file declares a tool, named after the file if
+// it has no name. A directory which does not exist has no tools.
+func LoadServerTools(path string) (map[string]ServerTool, error) {
+	tools := map[string]ServerTool{}
+	if path == "" {
+		return tools, nil
+	}
+	entries, err := os.ReadDir(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return tools, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+		file := filepath.Join(path, entry.Name())
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var tool ServerTool
+		if err := yaml.Unmarshal(data, &tool); err != nil {
+			return nil, fmt.Errorf("cannot unmarshal tool file %q: %w", file, err)
+		}
+		if tool.Name == "" {
+			tool.Name = strings.TrimSuffix(entry.Name(), ext)
+		}
+		tool.Dir = path
+		if err := tool.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid tool file %q: %w", file, err)
+		}
+		tools[tool.Name] = tool
+	}
+	return tools, nil
+}
+
+// GetServerTools returns the tools of the server the model can use: those of its configuration, whose directory is
+// the models path, and those of the tools directory it uses
+func (c *BackendConfig) GetServerTools(toolsPath, modelPath string) ([]ServerTool, error) {
+	tools := []ServerTool{}
+	for _, tool := range c.ServerTools.Tools {
+		if err := tool.Validate(); err != nil {
+			return nil, err
+		}
+		tool.Dir = modelPath
+		tools = append(tools, tool)
+	}
+	if len(c.ServerTools.Use) == 0 {
+		return tools, nil
+	}
+
+	available, err := LoadServerTools(toolsPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range c.ServerTools.Use {
+		tool, ok := available[name]
+		if !ok {
+			return nil, fmt.Errorf("tool %s not found in the tools directory", name)
+		}
+		tools = append(tools, tool)
+	}
+	return tools, nil
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Server tools", func() {
+	var toolsPath string
+
+	BeforeEach(func() {
+		toolsPath = GinkgoT().TempDir()
+		Expect(os.WriteFile(filepath.Join(toolsPath, "weather.yaml"), []byte(`url: http://127.0.0.1:8081/weather
+description: Returns the weather of a city
+timeout: 5s
+`), 0600)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(toolsPath, "notes.txt"), []byte("not a tool"), 0600)).To(Succeed())
+	})
+
+	It("merges the tools of the model with those of the tools directory it uses", func() {
+		cfg := &BackendConfig{ServerTools: ServerTools{
+			Tools: []ServerTool{{Name: "docs", Builtin: BuiltinCollectionSearch, Collection: "docs"}},
+			Use:   []string{"weather"},
+		}}
+		Expect(cfg.Validate()).To(BeTrue())
+
+		tools, err := cfg.GetServerTools(toolsPath, "/models")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tools).To(HaveLen(2))
+		Expect(tools[0].Name).To(Equal("docs"))
+		Expect(tools[0].Dir).To(Equal("/models"))
+		Expect(tools[0].Function().Parameters["required"]).To(ConsistOf("query"))
+		Expect(tools[1].Name).To(Equal("weather"))
+		Expect(tools[1].Dir).To(Equal(toolsPath))
+		Expect(tools[1].GetTimeout().Seconds()).To(Equal(5.0))
+		Expect(cfg.ServerTools.GetMaxIterations()).To(Equal(DefaultServerToolsMaxIterations))
+
+		cfg.ServerTools.Use = []string{"missing"}
+		_, err = cfg.GetServerTools(toolsPath, "/models")
+		Expect(err).To(MatchError(ContainSubstring("tool missing not found")))
+	})
+
+	It("refuses the invalid tools", func() {
+		Expect(ServerTool{Name: "none"}.Validate()).ToNot(Succeed())
+		Expect(ServerTool{Name: "both", URL: "http://localhost", Command: []string{"true"}}.Validate()).ToNot(Succeed())
+		Expect(ServerTool{Name: "search", Builtin: BuiltinCollectionSearch}.Validate()).ToNot(Succeed())
+		Expect(ServerTool{Name: "slow", Command: []string{"true"}, Timeout: "forever"}.Validate()).ToNot(Succeed())
+		Expect((&BackendConfig{ServerTools: ServerTools{Tools: []ServerTool{{Name: "none"}}}}).Validate()).To(BeFalse())
+
+		Expect(os.WriteFile(filepath.Join(toolsPath, "broken.yaml"), []byte("builtin: unknown\n"), 0600)).To(Succeed())
+		_, err := LoadServerTools(toolsPath)
+		Expect(err).To(MatchError(ContainSubstring("unknown builtin")))
+	})
+})
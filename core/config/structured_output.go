@@ -0,0 +1,27 @@
+package config
+
+// DefaultStructuredOutputMaxRetries is the number of times an invalid output is generated again when unset
+const DefaultStructuredOutputMaxRetries = 2
+
+// StructuredOutput validates the JSON the model returns against the schemas of the request: the schema of the
+// json_schema response format, and the parameters of the functions the model calls. The outputs of the strict schemas
+// are always validated. An invalid output is generated again with the mismatch appended to the conversation, and the
+// request fails once the retries run out.
+type StructuredOutput struct {
+	// Validate validates the outputs of the schemas which aren't strict too, and that the json_object responses are JSON
+	Validate bool `yaml:"validate"`
+	// MaxRetries is the number of times an invalid output is generated again, DefaultStructuredOutputMaxRetries if
+	// unset, and none if negative
+	MaxRetries int `yaml:"max_retries"`
+}
+
+// GetMaxRetries returns the number of times an invalid output is generated again
+func (s StructuredOutput) GetMaxRetries() int {
+	switch {
+	case s.MaxRetries < 0:
+		return 0
+	case s.MaxRetries == 0:
+		return DefaultStructuredOutputMaxRetries
+	}
+	return s.MaxRetries
+}
@@ -4,9 +4,11 @@ import (
 	"embed"
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 
 	"github.com/dave-gray101/v2keyauth"
 	"github.com/gofiber/websocket/v2"
@@ -16,8 +18,12 @@ import (
 	"github.com/mudler/LocalAI/core/http/routes"
 
 	"github.com/mudler/LocalAI/core/application"
+	"github.com/mudler/LocalAI/core/backend"
+	"github.com/mudler/LocalAI/core/config"
 	"github.com/mudler/LocalAI/core/schema"
 	"github.com/mudler/LocalAI/core/services"
+	"github.com/mudler/LocalAI/pkg/functions"
+	"github.com/mudler/LocalAI/pkg/model"
 
 	"github.com/gofiber/contrib/fiberzerolog"
 	"github.com/gofiber/fiber/v2"
@@ -26,6 +32,7 @@ import (
 	"github.com/gofiber/fiber/v2/middleware/favicon"
 	"github.com/gofiber/fiber/v2/middleware/filesystem"
 	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/valyala/fasthttp"
 
 	// swagger handler
 	"github.com/rs/zerolog/log"
@@ -72,10 +79,38 @@ func API(application *application.Application) (*fiber.App, error) {
 				code = e.Code
 			}
 
+			// The model is overloaded or its backend keeps crashing, the client can try again later
+			var crashLoop *model.CrashLoopError
+			var loading *model.ModelLoadingError
+			var invalidOutput *functions.ValidationError
+			errType := ""
+			var param *string
+			switch {
+			case errors.Is(err, backend.ErrQueueFull):
+				code = fiber.StatusTooManyRequests
+				ctx.Set(fiber.HeaderRetryAfter, "1")
+			case errors.Is(err, backend.ErrQueueTimeout):
+				code = fiber.StatusServiceUnavailable
+				ctx.Set(fiber.HeaderRetryAfter, "1")
+			case errors.As(err, &crashLoop):
+				code = fiber.StatusServiceUnavailable
+				ctx.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(crashLoop.RetryAfter.Seconds()))))
+			case errors.As(err, &loading):
+				code = fiber.StatusServiceUnavailable
+				ctx.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(loading.RetryAfter.Seconds()))))
+				errType = "model_loading"
+			case errors.As(err, &invalidOutput):
+				// The outputs of the model kept mismatching the schema of the request, param is the path of the mismatch.
+				// The request was valid, but the model couldn't comply with it.
+				code = fiber.StatusUnprocessableEntity
+				errType = "invalid_structured_output"
+				param = &invalidOutput.Path
+			}
+
 			// Send custom error page
 			return ctx.Status(code).JSON(
 				schema.ErrorResponse{
-					Error: &schema.APIError{Message: err.Error(), Code: code},
+					Error: &schema.APIError{Message: err.Error(), Code: code, Type: errType, Param: param},
 				},
 			)
 		}
@@ -128,18 +163,16 @@ func API(application *application.Application) (*fiber.App, error) {
 		router.Use(recover.New())
 	}
 
-	if !application.ApplicationConfig().DisableMetrics {
-		metricsService, err := services.NewMaxGPTMetricsService()
-		if err != nil {
-			return nil, err
-		}
+	if application.ApplicationConfig().TracingEnabled() {
+		router.Use(middleware.Tracing())
+	}
 
-		if metricsService != nil {
-			router.Use(localai.MaxGPTMetricsAPIMiddleware(metricsService))
-			router.Hooks().OnShutdown(func() error {
-				return metricsService.Shutdown()
-			})
-		}
+	metricsService := application.MetricsService()
+	if metricsService != nil {
+		router.Use(localai.MaxGPTMetricsAPIMiddleware(metricsService))
+		router.Hooks().OnShutdown(func() error {
+			return metricsService.Shutdown()
+		})
 	}
 	// Health Checks should always be exempt from auth, so register these first
 	routes.HealthRoutes(router)
@@ -181,6 +214,19 @@ func API(application *application.Application) (*fiber.App, error) {
 	// Auth is applied to _all_ endpoints. No exceptions. Filtering out endpoints to bypass is the role of the Filter property of the KeyAuth Configuration
 	router.Use(v2keyauth.New(*kaConfig))
 
+	// Registered before the API key policy, so that refused requests are audited as well
+	if auditService := application.AuditService(); auditService != nil {
+		router.Use(middleware.Audit(auditService))
+		router.Hooks().OnShutdown(auditService.Close)
+	}
+
+	apiKeyUsageService, err := services.NewApiKeyUsageService(application.ApplicationConfig())
+	if err != nil {
+		return nil, err
+	}
+	router.Use(middleware.ApiKeyPolicy(apiKeyUsageService, application.ApplicationConfig()))
+	router.Hooks().OnShutdown(apiKeyUsageService.Flush)
+
 	if application.ApplicationConfig().CORS {
 		var c func(ctx *fiber.Ctx) error
 		if application.ApplicationConfig().CORSAllowOrigins == "" {
@@ -197,17 +243,31 @@ func API(application *application.Application) (*fiber.App, error) {
 		router.Use(csrf.New())
 	}
 
-	galleryService := services.NewGalleryService(application.ApplicationConfig(), application.ModelLoader())
+	galleryService := services.NewGalleryService(application.ApplicationConfig(), application.ModelLoader(), metricsService)
 	err = galleryService.Start(application.ApplicationConfig().Context, application.BackendLoader())
 	if err != nil {
 		return nil, err
 	}
 
+	uploadDir := application.ApplicationConfig().UploadDir
+	if uploadDir == "" {
+		uploadDir = filepath.Join(application.ApplicationConfig().DataPath, "files")
+	}
+	fileService, err := services.NewFileService(uploadDir)
+	if err != nil {
+		return nil, err
+	}
+	batchService, err := services.NewBatchService(application.ApplicationConfig(), fileService)
+	if err != nil {
+		return nil, err
+	}
+
 	requestExtractor := middleware.NewRequestExtractor(application.BackendLoader(), application.ModelLoader(), application.ApplicationConfig())
+	responseCache := middleware.ResponseCache(application.BackendLoader(), application.ModelLoader(), application.ApplicationConfig(), metricsService)
 
 	routes.RegisterElevenLabsRoutes(router, requestExtractor, application.BackendLoader(), application.ModelLoader(), application.ApplicationConfig())
-	routes.RegisterMaxGPTRoutes(router, requestExtractor, application.BackendLoader(), application.ModelLoader(), application.ApplicationConfig(), galleryService)
-	routes.RegisterOpenAIRoutes(router, requestExtractor, application)
+	routes.RegisterMaxGPTRoutes(router, requestExtractor, application.BackendLoader(), application.ModelLoader(), application.ApplicationConfig(), galleryService, application.CollectionService(), apiKeyUsageService, application.AuditService())
+	routes.RegisterOpenAIRoutes(router, requestExtractor, responseCache, application, fileService, batchService)
 	if !application.ApplicationConfig().DisableWebUI {
 		routes.RegisterUIRoutes(router, application.BackendLoader(), application.ModelLoader(), application.ApplicationConfig(), galleryService)
 	}
@@ -217,5 +277,29 @@ func API(application *application.Application) (*fiber.App, error) {
 	// Note: keep this at the bottom!
 	router.Use(notFoundHandler)
 
+	// Batched requests are dispatched in-process to a router exposing the same OpenAI handlers.
+	// The batch was authenticated when it was created: the policy of its key is set on each request instead,
+	// so that the requests are restricted, rate limited, accounted and audited like the regular ones.
+	batchRouter := fiber.New(fiberCfg)
+	if !application.ApplicationConfig().Debug {
+		batchRouter.Use(recover.New())
+	}
+	if auditService := application.AuditService(); auditService != nil {
+		batchRouter.Use(middleware.Audit(auditService))
+	}
+	batchRouter.Use(middleware.ApiKeyPolicy(apiKeyUsageService, application.ApplicationConfig()))
+	routes.RegisterOpenAIRoutes(batchRouter, requestExtractor, responseCache, application, fileService, batchService)
+	batchRouter.Use(notFoundHandler)
+	batchHandler := batchRouter.Handler()
+	err = batchService.Start(application.ApplicationConfig().Context, func(ctx *fasthttp.RequestCtx, policy *config.ApiKeyPolicy) {
+		if policy != nil {
+			ctx.SetUserValue(middleware.CONTEXT_LOCALS_KEY_API_KEY_POLICY, policy)
+		}
+		batchHandler(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	return router, nil
 }
@@ -38,7 +38,7 @@ func JINARerankEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, a
 			Documents: input.Documents,
 		}
 
-		results, err := backend.Rerank(request, ml, appConfig, *cfg)
+		results, err := backend.Rerank(c.UserContext(), request, ml, appConfig, *cfg)
 		if err != nil {
 			return err
 		}
@@ -57,6 +57,7 @@ func JINARerankEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, a
 
 		response.Usage.TotalTokens = int(results.Usage.TotalTokens)
 		response.Usage.PromptTokens = int(results.Usage.PromptTokens)
+		middleware.RecordUsage(c, response.Usage.PromptTokens, 0)
 
 		return c.Status(fiber.StatusOK).JSON(response)
 	}
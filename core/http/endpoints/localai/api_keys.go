@@ -0,0 +1,20 @@
+package localai
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/core/services"
+)
+
+// ApiKeyUsageEndpoint returns the usage accounted to each API key
+// @Summary Returns the requests and tokens used by each API key. Requires an admin key.
+// @Success 200 {object} schema.ApiKeyUsageResponse "Response"
+// @Router /api/usage [get]
+func ApiKeyUsageEndpoint(usage *services.ApiKeyUsageService) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		return c.JSON(schema.ApiKeyUsageResponse{
+			Object: "list",
+			Data:   usage.Usage(),
+		})
+	}
+}
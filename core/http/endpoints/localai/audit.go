@@ -0,0 +1,63 @@
+package localai
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/core/services"
+)
+
+// AuditLogEndpoint queries the audit log
+// @Summary Returns the audit log records, the most recent first. Requires an admin key.
+// @Param model query string false "model name"
+// @Param api_key query string false "API key name"
+// @Param status query string false "HTTP status code, success or error"
+// @Param since query string false "RFC3339 time or unix timestamp"
+// @Param until query string false "RFC3339 time or unix timestamp"
+// @Param limit query int false "maximum number of records (default 100, max 1000)"
+// @Success 200 {object} schema.AuditRecordList "Response"
+// @Router /api/audit [get]
+func AuditLogEndpoint(audit *services.AuditService) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		query := schema.AuditQuery{
+			Model:  c.Query("model"),
+			ApiKey: c.Query("api_key"),
+			Status: c.Query("status"),
+			Limit:  c.QueryInt("limit", 100),
+		}
+		if query.Limit < 1 || query.Limit > 1000 {
+			return fiber.NewError(fiber.StatusBadRequest, "limit must be between 1 and 1000")
+		}
+
+		var err error
+		if query.Since, err = parseAuditTime(c.Query("since")); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid since: "+err.Error())
+		}
+		if query.Until, err = parseAuditTime(c.Query("until")); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid until: "+err.Error())
+		}
+
+		records, hasMore, err := audit.Query(query)
+		if err != nil {
+			return err
+		}
+		return c.JSON(schema.AuditRecordList{
+			Object:  "list",
+			Data:    records,
+			HasMore: hasMore,
+		})
+	}
+}
+
+// parseAuditTime parses either an RFC3339 time or a unix timestamp
+func parseAuditTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if ts, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(ts, 0), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
@@ -0,0 +1,85 @@
+package localai
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/pkg/model"
+	"github.com/valyala/fasthttp"
+)
+
+// backendLogsPingInterval is how often a comment is sent to the followers of the logs while the backend is quiet,
+// to notice the ones which are gone
+const backendLogsPingInterval = 15 * time.Second
+
+// BackendLogsEndpoint returns the last lines written by the backends of a model on their stdout and stderr. With
+// follow, they are sent as server-sent events, followed by the next ones as they are written.
+// @Summary Logs of the backends of a model
+// @Param model path string true "Model name"
+// @Param tail query int false "Number of the last lines to return, all the kept ones by default"
+// @Param follow query bool false "Stream the lines as server-sent events, and the next ones as they are written"
+// @Success 200 {object} schema.BackendLogsResponse "Response"
+// @Router /backend/logs/{model} [get]
+func BackendLogsEndpoint(ml *model.ModelLoader) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		name := c.Params("model")
+		tail := c.QueryInt("tail", 0)
+
+		if !c.QueryBool("follow", false) {
+			return c.JSON(schema.BackendLogsResponse{Model: name, Lines: ml.BackendLogs(name, tail)})
+		}
+
+		lines, next, stop := ml.FollowBackendLogs(name, tail)
+
+		c.Context().SetContentType("text/event-stream")
+		c.Set("Cache-Control", "no-cache")
+		c.Set("Connection", "keep-alive")
+		c.Set("Transfer-Encoding", "chunked")
+
+		c.Context().SetBodyStreamWriter(fasthttp.StreamWriter(func(w *bufio.Writer) {
+			defer stop()
+
+			for _, line := range lines {
+				if err := writeBackendLogEvent(w, line); err != nil {
+					return
+				}
+			}
+			if err := w.Flush(); err != nil {
+				return
+			}
+
+			ping := time.NewTicker(backendLogsPingInterval)
+			defer ping.Stop()
+			for {
+				select {
+				case line := <-next:
+					if err := writeBackendLogEvent(w, line); err != nil {
+						return
+					}
+				case <-ping.C:
+					if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+						return
+					}
+				}
+				// Fails once the client is gone
+				if err := w.Flush(); err != nil {
+					return
+				}
+			}
+		}))
+		return nil
+	}
+}
+
+func writeBackendLogEvent(w *bufio.Writer, line model.BackendLogLine) error {
+	data, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+	return err
+}
@@ -2,6 +2,7 @@ package localai
 
 import (
 	"github.com/gofiber/fiber/v2"
+	"github.com/mudler/LocalAI/core/http/middleware"
 	"github.com/mudler/LocalAI/core/schema"
 	"github.com/mudler/LocalAI/core/services"
 )
@@ -19,6 +20,9 @@ func BackendMonitorEndpoint(bm *services.BackendMonitorService) func(c *fiber.Ct
 		if err := c.BodyParser(input); err != nil {
 			return err
 		}
+		if err := middleware.CheckModelAllowed(c, input.Model); err != nil {
+			return err
+		}
 
 		resp, err := bm.CheckAndSample(input.Model)
 		if err != nil {
@@ -39,6 +43,9 @@ func BackendShutdownEndpoint(bm *services.BackendMonitorService) func(c *fiber.C
 		if err := c.BodyParser(input); err != nil {
 			return err
 		}
+		if err := middleware.CheckModelAllowed(c, input.Model); err != nil {
+			return err
+		}
 
 		return bm.ShutdownModel(input.Model)
 	}
@@ -0,0 +1,213 @@
+package localai
+
+import (
+	"errors"
+	"os"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mudler/LocalAI/core/backend"
+	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/core/http/middleware"
+	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/core/services"
+	"github.com/mudler/LocalAI/pkg/model"
+	"github.com/rs/zerolog/log"
+)
+
+// defaultCollectionQueryTopK is the number of chunks returned by a query when top_k is not set
+const defaultCollectionQueryTopK = 5
+
+// CreateCollectionEndpoint creates a RAG collection
+// @Summary Create a collection of documents, embedded with the given model
+// @Param request body schema.CollectionCreateRequest true "collection"
+// @Success 200 {object} schema.Collection "Response"
+// @Router /stores/collections [post]
+func CreateCollectionEndpoint(collections *services.CollectionService, cl *config.BackendConfigLoader, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		input := new(schema.CollectionCreateRequest)
+		if err := c.BodyParser(input); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		if input.EmbeddingsModel != "" {
+			if err := middleware.CheckModelAllowed(c, input.EmbeddingsModel); err != nil {
+				return err
+			}
+			if _, err := cl.LoadBackendConfigFileByNameDefaultOptions(input.EmbeddingsModel, appConfig); err != nil {
+				return fiber.NewError(fiber.StatusBadRequest, "unable to load the embeddings model: "+err.Error())
+			}
+		}
+
+		collection, err := collections.Create(*input)
+		if err != nil {
+			return collectionError(err)
+		}
+		return c.JSON(collection)
+	}
+}
+
+// @Summary List the collections
+// @Success 200 {object} schema.CollectionList "Response"
+// @Router /stores/collections [get]
+func ListCollectionsEndpoint(collections *services.CollectionService) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		// Only list the collections embedded with a model the API key is allowed to use
+		data := []schema.Collection{}
+		for _, collection := range collections.List() {
+			if middleware.CheckModelAllowed(c, collection.EmbeddingsModel) == nil {
+				data = append(data, collection)
+			}
+		}
+		return c.JSON(schema.CollectionList{Object: "list", Data: data})
+	}
+}
+
+// @Summary Get a collection
+// @Success 200 {object} schema.Collection "Response"
+// @Router /stores/collections/{name} [get]
+func GetCollectionEndpoint(collections *services.CollectionService) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		collection, err := getAllowedCollection(c, collections, c.Params("name"))
+		if err != nil {
+			return err
+		}
+		return c.JSON(collection)
+	}
+}
+
+// @Summary Delete a collection and its documents
+// @Router /stores/collections/{name} [delete]
+func DeleteCollectionEndpoint(collections *services.CollectionService, ml *model.ModelLoader, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		name := c.Params("name")
+		if _, err := getAllowedCollection(c, collections, name); err != nil {
+			return err
+		}
+		if err := collections.Delete(name); err != nil {
+			return collectionError(err)
+		}
+		// The chunks only live in the store
+		storeName := services.CollectionStoreName(name)
+		if err := ml.ShutdownModel(backend.StoreModelID(storeName)); err != nil {
+			log.Debug().Err(err).Str("collection", name).Msg("no store to stop for the collection")
+		}
+		if appConfig.StoresPath != "" {
+			path, err := backend.StorePath(appConfig, storeName)
+			if err != nil {
+				return err
+			}
+			if err := os.RemoveAll(path); err != nil {
+				log.Error().Err(err).Str("collection", name).Msg("unable to remove the store of the collection")
+			}
+		}
+		return c.JSON(fiber.Map{"name": name, "object": "collection.deleted", "deleted": true})
+	}
+}
+
+// IngestCollectionEndpoint chunks the documents, embeds the chunks and stores them in the collection
+// @Summary Add documents to a collection
+// @Param request body schema.CollectionIngestRequest true "documents"
+// @Success 200 {object} schema.CollectionIngestResponse "Response"
+// @Router /stores/collections/{name}/documents [post]
+func IngestCollectionEndpoint(collections *services.CollectionService, cl *config.BackendConfigLoader, ml *model.ModelLoader, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		collection, err := getAllowedCollection(c, collections, c.Params("name"))
+		if err != nil {
+			return err
+		}
+
+		input := new(schema.CollectionIngestRequest)
+		if err := c.BodyParser(input); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		if len(input.Documents) == 0 {
+			return fiber.NewError(fiber.StatusBadRequest, "documents are required")
+		}
+
+		size, overlap := collection.ChunkSize, collection.ChunkOverlap
+		if input.ChunkSize > 0 {
+			size, overlap = input.ChunkSize, input.ChunkSize/5
+		}
+		if input.ChunkOverlap > 0 {
+			overlap = input.ChunkOverlap
+		}
+
+		response := schema.CollectionIngestResponse{Object: "list", Documents: []string{}}
+		chunks := []schema.CollectionChunk{}
+		for _, d := range input.Documents {
+			documentChunks, err := services.ChunkDocument(d, size, overlap)
+			if err != nil {
+				return fiber.NewError(fiber.StatusBadRequest, err.Error())
+			}
+			if len(documentChunks) == 0 {
+				continue
+			}
+			response.Documents = append(response.Documents, documentChunks[0].DocumentID)
+			chunks = append(chunks, documentChunks...)
+		}
+
+		if err := backend.CollectionIngest(c.Context(), collection, chunks, ml, cl, appConfig); err != nil {
+			return err
+		}
+		if _, err := collections.AddDocuments(collection.Name, len(response.Documents), len(chunks)); err != nil {
+			return err
+		}
+
+		response.Chunks = len(chunks)
+		return c.JSON(response)
+	}
+}
+
+// QueryCollectionEndpoint returns the chunks of the collection the most similar to a text
+// @Summary Query a collection
+// @Param request body schema.CollectionQueryRequest true "query"
+// @Success 200 {object} schema.CollectionQueryResponse "Response"
+// @Router /stores/collections/{name}/query [post]
+func QueryCollectionEndpoint(collections *services.CollectionService, cl *config.BackendConfigLoader, ml *model.ModelLoader, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		collection, err := getAllowedCollection(c, collections, c.Params("name"))
+		if err != nil {
+			return err
+		}
+
+		input := new(schema.CollectionQueryRequest)
+		if err := c.BodyParser(input); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		if input.Query == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "query is required")
+		}
+		if input.TopK <= 0 {
+			input.TopK = defaultCollectionQueryTopK
+		}
+
+		chunks, err := backend.CollectionQuery(c.Context(), collection, input.Query, input.TopK, ml, cl, appConfig)
+		if err != nil {
+			return err
+		}
+		return c.JSON(schema.CollectionQueryResponse{Object: "list", Data: chunks})
+	}
+}
+
+// getAllowedCollection returns a collection, or an error if the key used for the request can't use its embeddings model
+func getAllowedCollection(c *fiber.Ctx, collections *services.CollectionService, name string) (schema.Collection, error) {
+	collection, err := collections.Get(name)
+	if err != nil {
+		return collection, collectionError(err)
+	}
+	if err := middleware.CheckModelAllowed(c, collection.EmbeddingsModel); err != nil {
+		return collection, err
+	}
+	return collection, nil
+}
+
+func collectionError(err error) error {
+	switch {
+	case errors.Is(err, services.ErrCollectionNotFound):
+		return fiber.NewError(fiber.StatusNotFound, err.Error())
+	case errors.Is(err, services.ErrCollectionExists):
+		return fiber.NewError(fiber.StatusConflict, err.Error())
+	case errors.Is(err, services.ErrInvalidCollection):
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	return err
+}
@@ -0,0 +1,71 @@
+package localai
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/mudler/LocalAI/core/backend"
+	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/pkg/model"
+)
+
+// ModelLoadEndpoint loads a model, so that the next requests do not wait for it
+// @Summary Load a model in memory, running its warm-up if it has one
+// @Param name path string true "Model name"
+// @Success 200 {object} schema.ModelLoadResponse "Response"
+// @Router /models/{name}/load [post]
+func ModelLoadEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		name := c.Params("name")
+		if _, exists := cl.GetBackendConfig(name); !exists && !ml.ExistsInModelPath(name) {
+			return fiber.NewError(fiber.StatusNotFound, "model not found: "+name)
+		}
+		cfg, err := cl.LoadBackendConfigFileByNameDefaultOptions(name, appConfig)
+		if err != nil {
+			return err
+		}
+
+		if err := backend.LoadModel(*cfg, ml, appConfig); err != nil {
+			return err
+		}
+		return c.JSON(schema.ModelLoadResponse{Model: name, Loaded: true})
+	}
+}
+
+// ModelUnloadEndpoint stops the backend of a model, once the requests running on it are done
+// @Summary Unload a model from memory
+// @Param name path string true "Model name"
+// @Success 200 {object} schema.ModelLoadResponse "Response"
+// @Router /models/{name}/unload [post]
+func ModelUnloadEndpoint(ml *model.ModelLoader) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		name := c.Params("name")
+		if ml.CheckIsLoaded(name) == nil {
+			return fiber.NewError(fiber.StatusNotFound, "model not loaded: "+name)
+		}
+		if err := ml.ShutdownModel(name); err != nil {
+			return err
+		}
+		return c.JSON(schema.ModelLoadResponse{Model: name, Loaded: false})
+	}
+}
+
+// ModelStatusEndpoint returns the load state of a model: not_loaded, loading, ready or failed with the error
+// @Summary Load state of a model
+// @Param name path string true "Model name"
+// @Success 200 {object} schema.ModelStatusResponse "Response"
+// @Router /models/{name}/status [get]
+func ModelStatusEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		name := c.Params("name")
+		if _, exists := cl.GetBackendConfig(name); !exists && !ml.ExistsInModelPath(name) {
+			return fiber.NewError(fiber.StatusNotFound, "model not found: "+name)
+		}
+
+		state := ml.LoadState(name)
+		resp := schema.ModelStatusResponse{Model: name, Status: string(state.Status), Error: state.Error}
+		if !state.Since.IsZero() {
+			resp.Since = &state.Since
+		}
+		return c.JSON(resp)
+	}
+}
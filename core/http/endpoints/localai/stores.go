@@ -1,15 +1,24 @@
 package localai
 
 import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"regexp"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/mudler/LocalAI/core/backend"
 	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/core/http/middleware"
 	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/pkg/grpc"
 	"github.com/mudler/LocalAI/pkg/model"
 	"github.com/mudler/LocalAI/pkg/store"
 )
 
-func StoresSetEndpoint(sl *model.ModelLoader, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
+var validSnapshotName = regexp.MustCompile(`^[a-zA-Z0-9_-][a-zA-Z0-9_.-]*$`)
+
+func StoresSetEndpoint(sl *model.ModelLoader, cl *config.BackendConfigLoader, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
 	return func(c *fiber.Ctx) error {
 		input := new(schema.StoresSet)
 
@@ -17,7 +26,11 @@ func StoresSetEndpoint(sl *model.ModelLoader, appConfig *config.ApplicationConfi
 			return err
 		}
 
-		sb, err := backend.StoreBackend(sl, appConfig, input.Store, input.Backend)
+		if err := checkStoreAllowed(c, input.Store); err != nil {
+			return err
+		}
+
+		sb, err := backend.StoreBackend(sl, cl, appConfig, input.Store, input.Backend)
 		if err != nil {
 			return err
 		}
@@ -28,7 +41,12 @@ func StoresSetEndpoint(sl *model.ModelLoader, appConfig *config.ApplicationConfi
 			vals[i] = []byte(v)
 		}
 
-		err = store.SetCols(c.Context(), sb, input.Keys, vals)
+		metadata := make([][]byte, len(input.Metadata))
+		for i, m := range input.Metadata {
+			metadata[i] = m
+		}
+
+		err = store.SetCols(c.Context(), sb, input.Keys, vals, store.WithNamespace(input.Namespace), store.WithMetadata(metadata))
 		if err != nil {
 			return err
 		}
@@ -37,7 +55,7 @@ func StoresSetEndpoint(sl *model.ModelLoader, appConfig *config.ApplicationConfi
 	}
 }
 
-func StoresDeleteEndpoint(sl *model.ModelLoader, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
+func StoresDeleteEndpoint(sl *model.ModelLoader, cl *config.BackendConfigLoader, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
 	return func(c *fiber.Ctx) error {
 		input := new(schema.StoresDelete)
 
@@ -45,13 +63,17 @@ func StoresDeleteEndpoint(sl *model.ModelLoader, appConfig *config.ApplicationCo
 			return err
 		}
 
-		sb, err := backend.StoreBackend(sl, appConfig, input.Store, input.Backend)
+		if err := checkStoreAllowed(c, input.Store); err != nil {
+			return err
+		}
+
+		sb, err := backend.StoreBackend(sl, cl, appConfig, input.Store, input.Backend)
 		if err != nil {
 			return err
 		}
 		defer sl.Close()
 
-		if err := store.DeleteCols(c.Context(), sb, input.Keys); err != nil {
+		if err := store.DeleteCols(c.Context(), sb, input.Keys, store.WithNamespace(input.Namespace)); err != nil {
 			return err
 		}
 
@@ -59,7 +81,7 @@ func StoresDeleteEndpoint(sl *model.ModelLoader, appConfig *config.ApplicationCo
 	}
 }
 
-func StoresGetEndpoint(sl *model.ModelLoader, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
+func StoresGetEndpoint(sl *model.ModelLoader, cl *config.BackendConfigLoader, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
 	return func(c *fiber.Ctx) error {
 		input := new(schema.StoresGet)
 
@@ -67,20 +89,25 @@ func StoresGetEndpoint(sl *model.ModelLoader, appConfig *config.ApplicationConfi
 			return err
 		}
 
-		sb, err := backend.StoreBackend(sl, appConfig, input.Store, input.Backend)
+		if err := checkStoreAllowed(c, input.Store); err != nil {
+			return err
+		}
+
+		sb, err := backend.StoreBackend(sl, cl, appConfig, input.Store, input.Backend)
 		if err != nil {
 			return err
 		}
 		defer sl.Close()
 
-		keys, vals, err := store.GetCols(c.Context(), sb, input.Keys)
+		keys, vals, metadata, err := store.GetColsWithMetadata(c.Context(), sb, input.Keys, store.WithNamespace(input.Namespace))
 		if err != nil {
 			return err
 		}
 
 		res := schema.StoresGetResponse{
-			Keys:   keys,
-			Values: make([]string, len(vals)),
+			Keys:     keys,
+			Values:   make([]string, len(vals)),
+			Metadata: metadataResponse(metadata),
 		}
 
 		for i, v := range vals {
@@ -91,7 +118,7 @@ func StoresGetEndpoint(sl *model.ModelLoader, appConfig *config.ApplicationConfi
 	}
 }
 
-func StoresFindEndpoint(sl *model.ModelLoader, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
+func StoresFindEndpoint(sl *model.ModelLoader, cl *config.BackendConfigLoader, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
 	return func(c *fiber.Ctx) error {
 		input := new(schema.StoresFind)
 
@@ -99,13 +126,18 @@ func StoresFindEndpoint(sl *model.ModelLoader, appConfig *config.ApplicationConf
 			return err
 		}
 
-		sb, err := backend.StoreBackend(sl, appConfig, input.Store, input.Backend)
+		if err := checkStoreAllowed(c, input.Store); err != nil {
+			return err
+		}
+
+		sb, err := backend.StoreBackend(sl, cl, appConfig, input.Store, input.Backend)
 		if err != nil {
 			return err
 		}
 		defer sl.Close()
 
-		keys, vals, similarities, err := store.Find(c.Context(), sb, input.Key, input.Topk)
+		keys, vals, similarities, metadata, err := store.FindWithMetadata(c.Context(), sb, input.Key, input.Topk,
+			store.WithNamespace(input.Namespace), store.WithFilter(input.Filter))
 		if err != nil {
 			return err
 		}
@@ -114,6 +146,7 @@ func StoresFindEndpoint(sl *model.ModelLoader, appConfig *config.ApplicationConf
 			Keys:         keys,
 			Values:       make([]string, len(vals)),
 			Similarities: similarities,
+			Metadata:     metadataResponse(metadata),
 		}
 
 		for i, v := range vals {
@@ -123,3 +156,90 @@ func StoresFindEndpoint(sl *model.ModelLoader, appConfig *config.ApplicationConf
 		return c.JSON(res)
 	}
 }
+
+// metadataResponse returns the metadata of the keys, null for the keys without. It is omitted when no key has any.
+func metadataResponse(metadata [][]byte) []json.RawMessage {
+	res := make([]json.RawMessage, len(metadata))
+	found := false
+	for i, m := range metadata {
+		if len(m) == 0 {
+			res[i] = json.RawMessage("null")
+			continue
+		}
+		res[i] = m
+		found = true
+	}
+	if !found {
+		return nil
+	}
+	return res
+}
+
+// StoresSnapshotEndpoint saves the content of a store in a named snapshot, or compacts its persisted state
+// @Summary Snapshot a store
+// @Param request body schema.StoresSnapshot true "query params"
+// @Success 200 {object} schema.StoresSnapshotResponse "Response"
+// @Router /stores/snapshot [post]
+func StoresSnapshotEndpoint(sl *model.ModelLoader, cl *config.BackendConfigLoader, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
+	return storesSnapshotHandler(sl, cl, appConfig, store.Snapshot)
+}
+
+// StoresRestoreEndpoint replaces the content of a store with a named snapshot, or reloads its persisted state
+// @Summary Restore a store
+// @Param request body schema.StoresSnapshot true "query params"
+// @Success 200 {object} schema.StoresSnapshotResponse "Response"
+// @Router /stores/restore [post]
+func StoresRestoreEndpoint(sl *model.ModelLoader, cl *config.BackendConfigLoader, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
+	return storesSnapshotHandler(sl, cl, appConfig, store.Restore)
+}
+
+func storesSnapshotHandler(sl *model.ModelLoader, cl *config.BackendConfigLoader, appConfig *config.ApplicationConfig, op func(context.Context, grpc.Backend, string, ...store.Option) (string, int64, error)) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		input := new(schema.StoresSnapshot)
+
+		if err := c.BodyParser(input); err != nil {
+			return err
+		}
+
+		if appConfig.StoresPath == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "the stores are not persisted, set a stores path to use snapshots")
+		}
+
+		path := ""
+		if input.Name != "" {
+			if !validSnapshotName.MatchString(input.Name) {
+				return fiber.NewError(fiber.StatusBadRequest, "the snapshot name must only contain letters, digits, '.', '-' and '_'")
+			}
+			path = filepath.Join(appConfig.StoresPath, "snapshots", input.Name+".snapshot")
+		}
+
+		if err := checkStoreAllowed(c, input.Store); err != nil {
+			return err
+		}
+
+		sb, err := backend.StoreBackend(sl, cl, appConfig, input.Store, input.Backend)
+		if err != nil {
+			return err
+		}
+		defer sl.Close()
+
+		_, entries, err := op(c.Context(), sb, path, store.WithNamespace(input.Namespace))
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(schema.StoresSnapshotResponse{
+			Store:   input.Store,
+			Name:    input.Name,
+			Entries: entries,
+		})
+	}
+}
+
+// checkStoreAllowed returns an error if the key used for the request can't use the store: the stores are allowed by name, like the models
+func checkStoreAllowed(c *fiber.Ctx, storeName string) error {
+	if storeName == "" {
+		storeName = backend.DefaultStoreName
+	}
+	return middleware.CheckModelAllowed(c, storeName)
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/mudler/LocalAI/core/config"
 	"github.com/mudler/LocalAI/core/http/middleware"
 	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/core/services"
 
 	"github.com/mudler/LocalAI/core/backend"
 
@@ -173,6 +174,7 @@ func VideoEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, appCon
 		if err := fn(); err != nil {
 			return err
 		}
+		middleware.RecordUsage(c, services.EstimateTokens(input.Prompt), 0)
 
 		item := &schema.Item{}
 
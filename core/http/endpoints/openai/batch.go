@@ -0,0 +1,88 @@
+package openai
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mudler/LocalAI/core/http/middleware"
+	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/core/services"
+)
+
+// CreateBatchEndpoint creates a batch from an uploaded JSONL file https://platform.openai.com/docs/api-reference/batch/create
+// @Summary Creates and executes a batch from an uploaded file of requests.
+// @Param request body schema.BatchRequest true "query params"
+// @Success 200 {object} schema.Batch "Response"
+// @Router /v1/batches [post]
+func CreateBatchEndpoint(bs *services.BatchService) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		input := new(schema.BatchRequest)
+		if err := c.BodyParser(input); err != nil {
+			return err
+		}
+
+		batch, err := bs.Create(*input, middleware.GetApiKeyPolicy(c))
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		return c.JSON(batch)
+	}
+}
+
+// GetBatchEndpoint returns a batch https://platform.openai.com/docs/api-reference/batch/retrieve
+// @Summary Retrieves a batch.
+// @Success 200 {object} schema.Batch "Response"
+// @Router /v1/batches/{batch_id} [get]
+func GetBatchEndpoint(bs *services.BatchService) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		batch, err := bs.Get(c.Params("batch_id"), middleware.GetApiKeyPolicy(c))
+		if err != nil {
+			return batchError(err)
+		}
+		return c.JSON(batch)
+	}
+}
+
+// ListBatchesEndpoint lists the batches https://platform.openai.com/docs/api-reference/batch/list
+// @Summary List your organization's batches.
+// @Success 200 {object} schema.BatchList "Response"
+// @Router /v1/batches [get]
+func ListBatchesEndpoint(bs *services.BatchService) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		limit := c.QueryInt("limit", 20)
+		if limit < 1 || limit > 100 {
+			return fiber.NewError(fiber.StatusBadRequest, "limit must be between 1 and 100")
+		}
+
+		batches, hasMore := bs.List(c.Query("after"), limit, middleware.GetApiKeyPolicy(c))
+		return c.JSON(schema.BatchList{
+			Object:  "list",
+			Data:    batches,
+			HasMore: hasMore,
+		})
+	}
+}
+
+// CancelBatchEndpoint cancels an in-progress batch https://platform.openai.com/docs/api-reference/batch/cancel
+// @Summary Cancels an in-progress batch.
+// @Success 200 {object} schema.Batch "Response"
+// @Router /v1/batches/{batch_id}/cancel [post]
+func CancelBatchEndpoint(bs *services.BatchService) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		batch, err := bs.Cancel(c.Params("batch_id"), middleware.GetApiKeyPolicy(c))
+		if err != nil {
+			if errors.Is(err, services.ErrBatchNotFound) {
+				return batchError(err)
+			}
+			return fiber.NewError(fiber.StatusConflict, err.Error())
+		}
+		return c.JSON(batch)
+	}
+}
+
+func batchError(err error) error {
+	if errors.Is(err, services.ErrBatchNotFound) {
+		return fiber.NewError(fiber.StatusNotFound, err.Error())
+	}
+	return err
+}
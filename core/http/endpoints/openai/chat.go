@@ -13,6 +13,7 @@ import (
 	"github.com/mudler/LocalAI/core/config"
 	"github.com/mudler/LocalAI/core/http/middleware"
 	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/core/services"
 	"github.com/mudler/LocalAI/pkg/functions"
 
 	"github.com/mudler/LocalAI/core/templates"
@@ -27,7 +28,7 @@ import (
 // @Param request body schema.OpenAIRequest true "query params"
 // @Success 200 {object} schema.OpenAIResponse "Response"
 // @Router /v1/chat/completions [post]
-func ChatEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, evaluator *templates.Evaluator, startupOptions *config.ApplicationConfig) func(c *fiber.Ctx) error {
+func ChatEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, evaluator *templates.Evaluator, startupOptions *config.ApplicationConfig, collections *services.CollectionService) func(c *fiber.Ctx) error {
 	var id, textContentToReturn string
 	var created int
 
@@ -41,41 +42,146 @@ func ChatEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, evaluat
 		}
 		responses <- initialMessage
 
-		ComputeChoices(req, s, config, cl, startupOptions, loader, func(s string, c *[]schema.Choice) {}, func(s string, tokenUsage backend.TokenUsage) bool {
-			usage := schema.OpenAIUsage{
-				PromptTokens:     tokenUsage.Prompt,
-				CompletionTokens: tokenUsage.Completion,
-				TotalTokens:      tokenUsage.Prompt + tokenUsage.Completion,
-			}
-			if extraUsage {
-				usage.TimingTokenGeneration = tokenUsage.TimingTokenGeneration
-				usage.TimingPromptProcessing = tokenUsage.TimingPromptProcessing
-			}
-
+		// The reasoning of the model is sent apart from its content, its tokens are counted once it is complete
+		parser := config.Reasoning.NewParser()
+		reasoningText := ""
+		reasoningTokens := 0
+		var lastUsage backend.TokenUsage
+		send := func(delta *schema.Message, tokenUsage backend.TokenUsage) {
 			resp := schema.OpenAIResponse{
 				ID:      id,
 				Created: created,
 				Model:   req.Model, // we have to return what the user sent here, due to OpenAI spec.
-				Choices: []schema.Choice{{Delta: &schema.Message{Content: &s}, Index: 0}},
+				Choices: []schema.Choice{{Delta: delta, Index: 0}},
 				Object:  "chat.completion.chunk",
-				Usage:   usage,
+				Usage:   streamUsage(config, tokenUsage, reasoningTokens, extraUsage),
 			}
 
 			responses <- resp
+		}
+
+		ComputeChoices(req, s, config, cl, startupOptions, loader, func(s string, c *[]schema.Choice) {}, func(s string, tokenUsage backend.TokenUsage) bool {
+			if parser == nil {
+				send(&schema.Message{Content: &s}, tokenUsage)
+				return true
+			}
+			lastUsage = tokenUsage
+			reasoning, content := parser.Write(s)
+			reasoningText += reasoning
+			if delta := reasoningDelta(config, reasoning, content); delta != nil {
+				send(delta, tokenUsage)
+			}
 			return true
 		})
+		if parser != nil {
+			reasoning, content := parser.Flush()
+			reasoningText += reasoning
+			reasoningTokens = countReasoningTokens(reasoningText)
+			// The last chunk has the usage with the reasoning tokens, the finish chunk reports it
+			delta := reasoningDelta(config, reasoning, content)
+			if delta == nil {
+				delta = &schema.Message{}
+			}
+			send(delta, lastUsage)
+		}
 		close(responses)
 	}
 	processTools := func(noAction string, prompt string, req *schema.OpenAIRequest, config *config.BackendConfig, loader *model.ModelLoader, responses chan schema.OpenAIResponse, extraUsage bool) {
 		result := ""
-		_, tokenUsage, _ := ComputeChoices(req, prompt, config, cl, startupOptions, loader, func(s string, c *[]schema.Choice) {}, func(s string, usage backend.TokenUsage) bool {
+
+		// The tool calls are streamed as they are generated, unless the configuration needs the whole result to
+		// parse them. The no action function is not a tool call: its answer is handled once the result is complete.
+		parser := functions.NewToolCallParser(config.FunctionsConfig)
+		indexes := map[int]int{}
+		streamed := 0
+		sendToolCallDeltas := func(deltas []functions.ToolCallDelta) {
+			for _, delta := range deltas {
+				if delta.Name != "" {
+					indexes[delta.Index] = -1
+					if delta.Name != noAction {
+						indexes[delta.Index] = streamed
+						streamed++
+					}
+				}
+				index := indexes[delta.Index]
+				if index < 0 {
+					continue
+				}
+
+				toolCall := schema.ToolCall{Index: index, FunctionCall: schema.FunctionCall{Name: delta.Name, Arguments: delta.Arguments}}
+				message := &schema.Message{}
+				if delta.Name != "" {
+					// Only the first delta of a call has its id and type, as the clients concatenate the deltas
+					message.Role = "assistant"
+					toolCall.ID, toolCall.Type = id, "function"
+				}
+				message.ToolCalls = []schema.ToolCall{toolCall}
+				responses <- schema.OpenAIResponse{
+					ID:      id,
+					Created: created,
+					Model:   req.Model, // we have to return what the user sent here, due to OpenAI spec.
+					Choices: []schema.Choice{{Delta: message, Index: 0}},
+					Object:  "chat.completion.chunk",
+				}
+			}
+		}
+
+		// The reasoning is sent as it is generated, and the calls in it are left out
+		reasoningParser := config.Reasoning.NewParser()
+		reasoningText := ""
+		sendReasoning := func(reasoning string) {
+			if delta := reasoningDelta(config, reasoning, ""); delta != nil {
+				responses <- schema.OpenAIResponse{
+					ID:      id,
+					Created: created,
+					Model:   req.Model, // we have to return what the user sent here, due to OpenAI spec.
+					Choices: []schema.Choice{{Delta: delta, Index: 0}},
+					Object:  "chat.completion.chunk",
+				}
+			}
+		}
+		writeContent := func(s string) {
 			result += s
-			// TODO: Change generated BNF grammar to be compliant with the schema so we can
-			// stream the result token by token here.
+			if parser != nil {
+				sendToolCallDeltas(parser.Write(s))
+			}
+		}
+
+		_, tokenUsage, _ := ComputeChoices(req, prompt, config, cl, startupOptions, loader, func(s string, c *[]schema.Choice) {}, func(s string, usage backend.TokenUsage) bool {
+			if reasoningParser != nil {
+				var reasoning string
+				reasoning, s = reasoningParser.Write(s)
+				reasoningText += reasoning
+				sendReasoning(reasoning)
+			}
+			writeContent(s)
 			return true
 		})
+		if reasoningParser != nil {
+			reasoning, content := reasoningParser.Flush()
+			reasoningText += reasoning
+			sendReasoning(reasoning)
+			writeContent(content)
+		}
+		if parser != nil {
+			sendToolCallDeltas(parser.Flush())
+		}
+		usage := streamUsage(config, tokenUsage, countReasoningTokens(reasoningText), extraUsage)
 
 		textContentToReturn = functions.ParseTextContent(result, config.FunctionsConfig)
+		if streamed > 0 {
+			// The tool calls are sent, the last chunk has the usage for the finish chunk
+			responses <- schema.OpenAIResponse{
+				ID:      id,
+				Created: created,
+				Model:   req.Model, // we have to return what the user sent here, due to OpenAI spec.
+				Choices: []schema.Choice{{Delta: &schema.Message{}, Index: 0}},
+				Object:  "chat.completion.chunk",
+				Usage:   usage,
+			}
+			close(responses)
+			return
+		}
 		result = functions.CleanupLLMResult(result, config.FunctionsConfig)
 		functionResults := functions.ParseFunctionCall(result, config.FunctionsConfig)
 		log.Debug().Msgf("Text content to return: %s", textContentToReturn)
@@ -97,16 +203,6 @@ func ChatEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, evaluat
 				log.Error().Err(err).Msg("error handling question")
 				return
 			}
-			usage := schema.OpenAIUsage{
-				PromptTokens:     tokenUsage.Prompt,
-				CompletionTokens: tokenUsage.Completion,
-				TotalTokens:      tokenUsage.Prompt + tokenUsage.Completion,
-			}
-			if extraUsage {
-				usage.TimingTokenGeneration = tokenUsage.TimingTokenGeneration
-				usage.TimingPromptProcessing = tokenUsage.TimingPromptProcessing
-			}
-
 			resp := schema.OpenAIResponse{
 				ID:      id,
 				Created: created,
@@ -164,6 +260,7 @@ func ChatEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, evaluat
 							},
 						}}},
 					Object: "chat.completion.chunk",
+					Usage:  usage,
 				}
 			}
 		}
@@ -190,129 +287,25 @@ func ChatEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, evaluat
 
 		log.Debug().Msgf("Chat endpoint configuration read: %+v", config)
 
-		funcs := input.Functions
-		shouldUseFn := len(input.Functions) > 0 && config.ShouldUseFunctions()
-		strictMode := false
-
-		for _, f := range input.Functions {
-			if f.Strict {
-				strictMode = true
-				break
-			}
-		}
-
-		// Allow the user to set custom actions via config file
-		// to be "embedded" in each model
-		noActionName := "answer"
-		noActionDescription := "use this action to answer without performing any action"
-
-		if config.FunctionsConfig.NoActionFunctionName != "" {
-			noActionName = config.FunctionsConfig.NoActionFunctionName
-		}
-		if config.FunctionsConfig.NoActionDescriptionName != "" {
-			noActionDescription = config.FunctionsConfig.NoActionDescriptionName
-		}
-
-		if config.ResponseFormatMap != nil {
-			d := schema.ChatCompletionResponseFormat{}
-			dat, err := json.Marshal(config.ResponseFormatMap)
-			if err != nil {
-				return err
-			}
-			err = json.Unmarshal(dat, &d)
-			if err != nil {
+		if input.Collection != "" {
+			if err := injectRetrievedContext(c, input, config, collections, cl, ml, evaluator, startupOptions); err != nil {
 				return err
 			}
-			if d.Type == "json_object" {
-				input.Grammar = functions.JSONBNF
-			} else if d.Type == "json_schema" {
-				d := schema.JsonSchemaRequest{}
-				dat, err := json.Marshal(config.ResponseFormatMap)
-				if err != nil {
-					return err
-				}
-				err = json.Unmarshal(dat, &d)
-				if err != nil {
-					return err
-				}
-				fs := &functions.JSONFunctionStructure{
-					AnyOf: []functions.Item{d.JsonSchema.Schema},
-				}
-				g, err := fs.Grammar(config.FunctionsConfig.GrammarOptions()...)
-				if err == nil {
-					input.Grammar = g
-				}
-			}
 		}
 
-		config.Grammar = input.Grammar
-
-		if shouldUseFn {
-			log.Debug().Msgf("Response needs to process functions")
+		serverTools, err := requestServerTools(input, config, startupOptions)
+		if err != nil {
+			return err
 		}
 
-		switch {
-		case (!config.FunctionsConfig.GrammarConfig.NoGrammar || strictMode) && shouldUseFn:
-			noActionGrammar := functions.Function{
-				Name:        noActionName,
-				Description: noActionDescription,
-				Parameters: map[string]interface{}{
-					"properties": map[string]interface{}{
-						"message": map[string]interface{}{
-							"type":        "string",
-							"description": "The message to reply the user with",
-						}},
-				},
-			}
-
-			// Append the no action function
-			if !config.FunctionsConfig.DisableNoAction {
-				funcs = append(funcs, noActionGrammar)
-			}
-
-			// Force picking one of the functions by the request
-			if config.FunctionToCall() != "" {
-				funcs = funcs.Select(config.FunctionToCall())
-			}
-
-			// Update input grammar
-			jsStruct := funcs.ToJSONStructure(config.FunctionsConfig.FunctionNameKey, config.FunctionsConfig.FunctionNameKey)
-			g, err := jsStruct.Grammar(config.FunctionsConfig.GrammarOptions()...)
-			if err == nil {
-				config.Grammar = g
-			}
-		case input.JSONFunctionGrammarObject != nil:
-			g, err := input.JSONFunctionGrammarObject.Grammar(config.FunctionsConfig.GrammarOptions()...)
-			if err == nil {
-				config.Grammar = g
-			}
-		default:
-			// Force picking one of the functions by the request
-			if config.FunctionToCall() != "" {
-				funcs = funcs.Select(config.FunctionToCall())
-			}
+		prompt, err := buildChatPrompt(input, config, evaluator)
+		if err != nil {
+			return err
 		}
+		shouldUseFn, noActionName, predInput := prompt.shouldUseFn, prompt.noActionName, prompt.predInput
 
-		// process functions if we have any defined or if we have a function call string
-
-		// functions are not supported in stream mode (yet?)
 		toStream := input.Stream
 
-		log.Debug().Msgf("Parameters: %+v", config)
-
-		var predInput string
-
-		// If we are using the tokenizer template, we don't need to process the messages
-		// unless we are processing functions
-		if !config.TemplateConfig.UseTokenizerTemplate || shouldUseFn {
-			predInput = evaluator.TemplateMessages(input.Messages, config, funcs, shouldUseFn)
-
-			log.Debug().Msgf("Prompt (after templating): %s", predInput)
-			if config.Grammar != "" {
-				log.Debug().Msgf("Grammar: %+v", config.Grammar)
-			}
-		}
-
 		switch {
 		case toStream:
 
@@ -333,7 +326,10 @@ func ChatEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, evaluat
 				go processTools(noActionName, predInput, input, config, ml, responses, extraUsage)
 			}
 
+			streamEnd := middleware.StreamEnd(c)
 			c.Context().SetBodyStreamWriter(fasthttp.StreamWriter(func(w *bufio.Writer) {
+				// the client went away if the stream can't be flushed anymore
+				defer func() { streamEnd(w.Flush()) }()
 				usage := &schema.OpenAIUsage{}
 				toolsCalled := false
 				for ev := range responses {
@@ -384,8 +380,9 @@ func ChatEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, evaluat
 		// no streaming mode
 		default:
 
-			tokenCallback := func(s string, c *[]schema.Choice) {
-				if !shouldUseFn {
+			// answerContent returns the choices of the content of the result of the prompt
+			answerContent := func(prompt *chatPrompt, s string, c *[]schema.Choice) {
+				if !prompt.shouldUseFn {
 					// no function is called, just reply and use stop as finish reason
 					*c = append(*c, schema.Choice{FinishReason: "stop", Index: 0, Message: &schema.Message{Role: "assistant", Content: &s}})
 					return
@@ -395,7 +392,7 @@ func ChatEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, evaluat
 				s = functions.CleanupLLMResult(s, config.FunctionsConfig)
 				results := functions.ParseFunctionCall(s, config.FunctionsConfig)
 				log.Debug().Msgf("Text content to return: %s", textContentToReturn)
-				noActionsToRun := len(results) > 0 && results[0].Name == noActionName || len(results) == 0
+				noActionsToRun := len(results) > 0 && results[0].Name == prompt.noActionName || len(results) == 0
 
 				finishReason := "stop"
 				if len(input.Tools) > 0 {
@@ -404,7 +401,7 @@ func ChatEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, evaluat
 
 				switch {
 				case noActionsToRun:
-					result, err := handleQuestion(config, cl, input, ml, startupOptions, results, s, predInput)
+					result, err := handleQuestion(config, cl, input, ml, startupOptions, results, s, prompt.predInput)
 					if err != nil {
 						log.Error().Err(err).Msg("error handling question")
 						return
@@ -461,16 +458,51 @@ func ChatEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, evaluat
 
 			}
 
-			result, tokenUsage, err := ComputeChoices(
-				input,
-				predInput,
-				config,
-				cl,
-				startupOptions,
-				ml,
-				tokenCallback,
-				nil,
-			)
+			// answer returns the choices of the result of the prompt, with the reasoning of the model apart from its
+			// content, so that the calls in the reasoning are left out
+			reasoningTokens := 0
+			answer := func(prompt *chatPrompt, s string, c *[]schema.Choice) {
+				reasoning, s := config.Reasoning.Split(s)
+				reasoningTokens += countReasoningTokens(reasoning)
+
+				first := len(*c)
+				answerContent(prompt, s, c)
+				if config.Reasoning.Strip {
+					return
+				}
+				for _, choice := range (*c)[first:] {
+					if choice.Message != nil {
+						choice.Message.ReasoningContent = reasoning
+					}
+				}
+			}
+
+			var result []schema.Choice
+			var tokenUsage backend.TokenUsage
+			var steps []schema.ToolStep
+			if len(serverTools) > 0 {
+				result, tokenUsage, steps, err = runServerTools(input, config, prompt, serverTools, answer, evaluator, cl, ml, startupOptions, collections)
+			} else {
+				result, tokenUsage, err = computeValidChoices(
+					input,
+					predInput,
+					config,
+					cl,
+					startupOptions,
+					ml,
+					func(s string) error { return prompt.validate(config, s) },
+					func(s string, c *[]schema.Choice) { answer(prompt, s, c) },
+					func(output string, invalid error) (string, error) {
+						_, output = config.Reasoning.Split(output)
+						input.Messages = append(input.Messages, retryMessages(output, invalid)...)
+						var err error
+						if prompt, err = buildChatPrompt(input, config, evaluator); err != nil {
+							return "", err
+						}
+						return prompt.predInput, nil
+					},
+				)
+			}
 			if err != nil {
 				return err
 			}
@@ -479,18 +511,21 @@ func ChatEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, evaluat
 				CompletionTokens: tokenUsage.Completion,
 				TotalTokens:      tokenUsage.Prompt + tokenUsage.Completion,
 			}
+			usage.PromptTokensDetails = promptTokensDetails(tokenUsage)
+			usage.CompletionTokensDetails = completionTokensDetails(config, reasoningTokens)
 			if extraUsage {
 				usage.TimingTokenGeneration = tokenUsage.TimingTokenGeneration
 				usage.TimingPromptProcessing = tokenUsage.TimingPromptProcessing
 			}
 
 			resp := &schema.OpenAIResponse{
-				ID:      id,
-				Created: created,
-				Model:   input.Model, // we have to return what the user sent here, due to OpenAI spec.
-				Choices: result,
-				Object:  "chat.completion",
-				Usage:   usage,
+				ID:        id,
+				Created:   created,
+				Model:     input.Model, // we have to return what the user sent here, due to OpenAI spec.
+				Choices:   result,
+				Object:    "chat.completion",
+				Usage:     usage,
+				ToolSteps: steps,
 			}
 			respData, _ := json.Marshal(resp)
 			log.Debug().Msgf("Response: %s", respData)
@@ -563,3 +598,122 @@ func handleQuestion(config *config.BackendConfig, cl *config.BackendConfigLoader
 	}
 	return backend.Finetune(*config, prompt, prediction.Response), nil
 }
+
+// chatPrompt holds the templated prompt of a chat request along with the
+// function calling setup that was used to build it
+type chatPrompt struct {
+	predInput    string
+	funcs        functions.Functions
+	shouldUseFn  bool
+	noActionName string
+	// responseSchema is the schema the outputs are validated against, if any
+	responseSchema map[string]interface{}
+}
+
+// buildChatPrompt sets up the grammar for the request (functions, response_format) in the config
+// and evaluates the chat template over the request messages
+func buildChatPrompt(input *schema.OpenAIRequest, config *config.BackendConfig, evaluator *templates.Evaluator) (*chatPrompt, error) {
+	funcs := input.Functions
+	shouldUseFn := len(input.Functions) > 0 && config.ShouldUseFunctions()
+	strictMode := false
+
+	for _, f := range input.Functions {
+		if f.Strict {
+			strictMode = true
+			break
+		}
+	}
+
+	// Allow the user to set custom actions via config file
+	// to be "embedded" in each model
+	noActionName := "answer"
+	noActionDescription := "use this action to answer without performing any action"
+
+	if config.FunctionsConfig.NoActionFunctionName != "" {
+		noActionName = config.FunctionsConfig.NoActionFunctionName
+	}
+	if config.FunctionsConfig.NoActionDescriptionName != "" {
+		noActionDescription = config.FunctionsConfig.NoActionDescriptionName
+	}
+
+	responseGrammar, responseSchema, err := responseFormat(config)
+	if err != nil {
+		return nil, err
+	}
+	if responseGrammar != "" {
+		input.Grammar = responseGrammar
+	}
+
+	config.Grammar = input.Grammar
+
+	if shouldUseFn {
+		log.Debug().Msgf("Response needs to process functions")
+	}
+
+	switch {
+	case (!config.FunctionsConfig.GrammarConfig.NoGrammar || strictMode) && shouldUseFn:
+		noActionGrammar := functions.Function{
+			Name:        noActionName,
+			Description: noActionDescription,
+			Parameters: map[string]interface{}{
+				"properties": map[string]interface{}{
+					"message": map[string]interface{}{
+						"type":        "string",
+						"description": "The message to reply the user with",
+					}},
+			},
+		}
+
+		// Append the no action function
+		if !config.FunctionsConfig.DisableNoAction {
+			funcs = append(funcs, noActionGrammar)
+		}
+
+		// Force picking one of the functions by the request
+		if config.FunctionToCall() != "" {
+			funcs = funcs.Select(config.FunctionToCall())
+		}
+
+		// Update input grammar
+		jsStruct := funcs.ToJSONStructure(config.FunctionsConfig.FunctionNameKey, config.FunctionsConfig.FunctionNameKey)
+		g, err := jsStruct.Grammar(config.FunctionsConfig.GrammarOptions()...)
+		if err == nil {
+			config.Grammar = g
+		}
+	case input.JSONFunctionGrammarObject != nil:
+		g, err := input.JSONFunctionGrammarObject.Grammar(config.FunctionsConfig.GrammarOptions()...)
+		if err == nil {
+			config.Grammar = g
+		}
+	default:
+		// Force picking one of the functions by the request
+		if config.FunctionToCall() != "" {
+			funcs = funcs.Select(config.FunctionToCall())
+		}
+	}
+
+	log.Debug().Msgf("Parameters: %+v", config)
+
+	var predInput string
+
+	// If we are using the tokenizer template, we don't need to process the messages
+	// unless we are processing functions
+	if !config.TemplateConfig.UseTokenizerTemplate || shouldUseFn {
+		span := startTemplateSpan(input.Context, "TemplateMessages")
+		predInput = evaluator.TemplateMessages(input.Messages, config, funcs, shouldUseFn)
+		span.End()
+
+		log.Debug().Msgf("Prompt (after templating): %s", predInput)
+		if config.Grammar != "" {
+			log.Debug().Msgf("Grammar: %+v", config.Grammar)
+		}
+	}
+
+	return &chatPrompt{
+		predInput:      predInput,
+		funcs:          funcs,
+		shouldUseFn:    shouldUseFn,
+		noActionName:   noActionName,
+		responseSchema: responseSchema,
+	}, nil
+}
@@ -37,6 +37,7 @@ func CompletionEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, e
 				CompletionTokens: tokenUsage.Completion,
 				TotalTokens:      tokenUsage.Prompt + tokenUsage.Completion,
 			}
+			usage.PromptTokensDetails = promptTokensDetails(tokenUsage)
 			if extraUsage {
 				usage.TimingTokenGeneration = tokenUsage.TimingTokenGeneration
 				usage.TimingPromptProcessing = tokenUsage.TimingPromptProcessing
@@ -78,13 +79,17 @@ func CompletionEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, e
 			return fiber.ErrBadRequest
 		}
 
-		if config.ResponseFormatMap != nil {
-			d := schema.ChatCompletionResponseFormat{}
-			dat, _ := json.Marshal(config.ResponseFormatMap)
-			_ = json.Unmarshal(dat, &d)
-			if d.Type == "json_object" {
-				input.Grammar = functions.JSONBNF
-			}
+		responseGrammar, responseSchema, err := responseFormat(config)
+		if err != nil {
+			return err
+		}
+		if responseGrammar != "" {
+			input.Grammar = responseGrammar
+		}
+		// The outputs are validated against the schema of the response format, if any
+		validate := func(string) error { return nil }
+		if responseSchema != nil {
+			validate = func(s string) error { return functions.ValidateJSON(responseSchema, s) }
 		}
 
 		config.Grammar = input.Grammar
@@ -108,10 +113,12 @@ func CompletionEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, e
 
 			predInput := config.PromptStrings[0]
 
+			span := startTemplateSpan(input.Context, "EvaluateTemplateForPrompt")
 			templatedInput, err := evaluator.EvaluateTemplateForPrompt(templates.CompletionPromptTemplate, *config, templates.PromptTemplateData{
 				Input:        predInput,
 				SystemPrompt: config.SystemPrompt,
 			})
+			span.End()
 			if err == nil {
 				predInput = templatedInput
 				log.Debug().Msgf("Template found, input modified to: %s", predInput)
@@ -121,7 +128,10 @@ func CompletionEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, e
 
 			go process(id, predInput, input, config, ml, responses, extraUsage)
 
+			streamEnd := middleware.StreamEnd(c)
 			c.Context().SetBodyStreamWriter(fasthttp.StreamWriter(func(w *bufio.Writer) {
+				// the client went away if the stream can't be flushed anymore
+				defer func() { streamEnd(w.Flush()) }()
 
 				for ev := range responses {
 					var buf bytes.Buffer
@@ -159,25 +169,31 @@ func CompletionEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, e
 		totalTokenUsage := backend.TokenUsage{}
 
 		for k, i := range config.PromptStrings {
+			span := startTemplateSpan(input.Context, "EvaluateTemplateForPrompt")
 			templatedInput, err := evaluator.EvaluateTemplateForPrompt(templates.CompletionPromptTemplate, *config, templates.PromptTemplateData{
 				SystemPrompt: config.SystemPrompt,
 				Input:        i,
 			})
+			span.End()
 			if err == nil {
 				i = templatedInput
 				log.Debug().Msgf("Template found, input modified to: %s", i)
 			}
 
-			r, tokenUsage, err := ComputeChoices(
-				input, i, config, cl, appConfig, ml, func(s string, c *[]schema.Choice) {
+			predInput := i
+			r, tokenUsage, err := computeValidChoices(
+				input, predInput, config, cl, appConfig, ml, validate, func(s string, c *[]schema.Choice) {
 					*c = append(*c, schema.Choice{Text: s, FinishReason: "stop", Index: k})
-				}, nil)
+				}, func(output string, invalid error) (string, error) {
+					// The model continues the prompt with the mismatch of its output
+					predInput += output + "\n\n" + retryFeedback(invalid) + "\n"
+					return predInput, nil
+				})
 			if err != nil {
 				return err
 			}
 
-			totalTokenUsage.TimingTokenGeneration += tokenUsage.TimingTokenGeneration
-			totalTokenUsage.TimingPromptProcessing += tokenUsage.TimingPromptProcessing
+			addTokenUsage(&totalTokenUsage, tokenUsage)
 
 			result = append(result, r...)
 		}
@@ -186,6 +202,7 @@ func CompletionEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, e
 			CompletionTokens: totalTokenUsage.Completion,
 			TotalTokens:      totalTokenUsage.Prompt + totalTokenUsage.Completion,
 		}
+		usage.PromptTokensDetails = promptTokensDetails(totalTokenUsage)
 		if extraUsage {
 			usage.TimingTokenGeneration = totalTokenUsage.TimingTokenGeneration
 			usage.TimingPromptProcessing = totalTokenUsage.TimingPromptProcessing
@@ -46,11 +46,13 @@ func EditEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, evaluat
 		totalTokenUsage := backend.TokenUsage{}
 
 		for _, i := range config.InputStrings {
+			span := startTemplateSpan(input.Context, "EvaluateTemplateForPrompt")
 			templatedInput, err := evaluator.EvaluateTemplateForPrompt(templates.EditPromptTemplate, *config, templates.PromptTemplateData{
 				Input:        i,
 				Instruction:  input.Instruction,
 				SystemPrompt: config.SystemPrompt,
 			})
+			span.End()
 			if err == nil {
 				i = templatedInput
 				log.Debug().Msgf("Template found, input modified to: %s", i)
@@ -68,6 +70,7 @@ func EditEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, evaluat
 
 			totalTokenUsage.TimingTokenGeneration += tokenUsage.TimingTokenGeneration
 			totalTokenUsage.TimingPromptProcessing += tokenUsage.TimingPromptProcessing
+			totalTokenUsage.AddPrefixCache(tokenUsage)
 
 			result = append(result, r...)
 		}
@@ -76,6 +79,7 @@ func EditEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, evaluat
 			CompletionTokens: totalTokenUsage.Completion,
 			TotalTokens:      totalTokenUsage.Prompt + totalTokenUsage.Completion,
 		}
+		usage.PromptTokensDetails = promptTokensDetails(totalTokenUsage)
 		if extraUsage {
 			usage.TimingTokenGeneration = totalTokenUsage.TimingTokenGeneration
 			usage.TimingPromptProcessing = totalTokenUsage.TimingPromptProcessing
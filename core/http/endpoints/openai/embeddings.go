@@ -7,6 +7,7 @@ import (
 	"github.com/mudler/LocalAI/core/backend"
 	"github.com/mudler/LocalAI/core/config"
 	"github.com/mudler/LocalAI/core/http/middleware"
+	"github.com/mudler/LocalAI/core/services"
 	"github.com/mudler/LocalAI/pkg/model"
 
 	"github.com/google/uuid"
@@ -35,10 +36,11 @@ func EmbeddingsEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, a
 
 		log.Debug().Msgf("Parameter Config: %+v", config)
 		items := []schema.Item{}
+		promptTokens := 0
 
 		for i, s := range config.InputToken {
 			// get the model function to call for the result
-			embedFn, err := backend.ModelEmbedding("", s, ml, *config, appConfig)
+			embedFn, err := backend.ModelEmbedding(input.Context, "", s, ml, *config, appConfig)
 			if err != nil {
 				return err
 			}
@@ -48,11 +50,12 @@ func EmbeddingsEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, a
 				return err
 			}
 			items = append(items, schema.Item{Embedding: embeddings, Index: i, Object: "embedding"})
+			promptTokens += len(s)
 		}
 
 		for i, s := range config.InputStrings {
 			// get the model function to call for the result
-			embedFn, err := backend.ModelEmbedding(s, []int{}, ml, *config, appConfig)
+			embedFn, err := backend.ModelEmbedding(input.Context, s, []int{}, ml, *config, appConfig)
 			if err != nil {
 				return err
 			}
@@ -62,7 +65,10 @@ func EmbeddingsEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, a
 				return err
 			}
 			items = append(items, schema.Item{Embedding: embeddings, Index: i, Object: "embedding"})
+			// The backends don't report the tokens of the embedded strings
+			promptTokens += services.EstimateTokens(s)
 		}
+		middleware.RecordUsage(c, promptTokens, 0)
 
 		id := uuid.New().String()
 		created := int(time.Now().Unix())
@@ -72,6 +78,10 @@ func EmbeddingsEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, a
 			Model:   input.Model, // we have to return what the user sent here, due to OpenAI spec.
 			Data:    items,
 			Object:  "list",
+			Usage: schema.OpenAIUsage{
+				PromptTokens: promptTokens,
+				TotalTokens:  promptTokens,
+			},
 		}
 
 		jsonResult, _ := json.Marshal(resp)
@@ -0,0 +1,105 @@
+package openai
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mudler/LocalAI/core/http/middleware"
+	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/core/services"
+)
+
+// UploadFileEndpoint uploads a file, e.g. the input of a batch https://platform.openai.com/docs/api-reference/files/create
+// @Summary Upload a file.
+// @Param file formData file true "file"
+// @Param purpose formData string true "purpose"
+// @Success 200 {object} schema.File "Response"
+// @Router /v1/files [post]
+func UploadFileEndpoint(fs *services.FileService) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		purpose := c.FormValue("purpose")
+		if purpose == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "purpose is required")
+		}
+
+		fileHeader, err := c.FormFile("file")
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "file is required")
+		}
+
+		f, err := fileHeader.Open()
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		file, err := fs.Create(fileHeader.Filename, purpose, f, middleware.GetApiKeyPolicy(c))
+		if err != nil {
+			return err
+		}
+		return c.JSON(file)
+	}
+}
+
+// ListFilesEndpoint lists the uploaded files https://platform.openai.com/docs/api-reference/files/list
+// @Summary List files.
+// @Success 200 {object} schema.FileList "Response"
+// @Router /v1/files [get]
+func ListFilesEndpoint(fs *services.FileService) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		return c.JSON(schema.FileList{
+			Object: "list",
+			Data:   fs.List(c.Query("purpose"), middleware.GetApiKeyPolicy(c)),
+		})
+	}
+}
+
+// GetFileEndpoint returns the metadata of a file https://platform.openai.com/docs/api-reference/files/retrieve
+// @Summary Returns information about a specific file.
+// @Success 200 {object} schema.File "Response"
+// @Router /v1/files/{file_id} [get]
+func GetFileEndpoint(fs *services.FileService) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		file, err := fs.Get(c.Params("file_id"), middleware.GetApiKeyPolicy(c))
+		if err != nil {
+			return fileError(err)
+		}
+		return c.JSON(file)
+	}
+}
+
+// GetFileContentEndpoint returns the content of a file https://platform.openai.com/docs/api-reference/files/retrieve-contents
+// @Summary Returns the contents of the specified file.
+// @Success 200 {string} binary "file"
+// @Router /v1/files/{file_id}/content [get]
+func GetFileContentEndpoint(fs *services.FileService) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		f, err := fs.Open(c.Params("file_id"), middleware.GetApiKeyPolicy(c))
+		if err != nil {
+			return fileError(err)
+		}
+		// fiber closes the reader once the body is sent
+		return c.SendStream(f)
+	}
+}
+
+// DeleteFileEndpoint deletes a file https://platform.openai.com/docs/api-reference/files/delete
+// @Summary Delete a file.
+// @Success 200 {object} schema.DeleteFileResponse "Response"
+// @Router /v1/files/{file_id} [delete]
+func DeleteFileEndpoint(fs *services.FileService) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		id := c.Params("file_id")
+		if err := fs.Delete(id, middleware.GetApiKeyPolicy(c)); err != nil {
+			return fileError(err)
+		}
+		return c.JSON(schema.DeleteFileResponse{ID: id, Object: "file", Deleted: true})
+	}
+}
+
+func fileError(err error) error {
+	if errors.Is(err, services.ErrFileNotFound) {
+		return fiber.NewError(fiber.StatusNotFound, err.Error())
+	}
+	return err
+}
@@ -1,13 +1,27 @@
 package openai
 
 import (
+	"context"
+
 	"github.com/mudler/LocalAI/core/backend"
 	"github.com/mudler/LocalAI/core/config"
 
 	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/core/services"
 	model "github.com/mudler/LocalAI/pkg/model"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// startTemplateSpan starts the span of the evaluation of a template of the request
+func startTemplateSpan(ctx context.Context, name string) trace.Span {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	_, span := otel.Tracer("github.com/mudler/LocalAI/core/http/endpoints/openai").Start(ctx, "TemplatesEvaluator."+name)
+	return span
+}
+
 func ComputeChoices(
 	req *schema.OpenAIRequest,
 	predInput string,
@@ -55,6 +69,7 @@ func ComputeChoices(
 		tokenUsage.Completion += prediction.Usage.Completion
 		tokenUsage.TimingPromptProcessing += prediction.Usage.TimingPromptProcessing
 		tokenUsage.TimingTokenGeneration += prediction.Usage.TimingTokenGeneration
+		tokenUsage.AddPrefixCache(prediction.Usage)
 
 		finetunedResponse := backend.Finetune(*config, predInput, prediction.Response)
 		cb(finetunedResponse, &result)
@@ -62,5 +77,17 @@ func ComputeChoices(
 		//result = append(result, Choice{Text: prediction})
 
 	}
+	services.RecordUsage(req.Context, tokenUsage.Prompt, tokenUsage.Completion)
 	return result, tokenUsage, err
 }
+
+// promptTokensDetails returns the prefix cache usage to report, nil when the prefix cache is disabled for the model
+func promptTokensDetails(tokenUsage backend.TokenUsage) *schema.PromptTokensDetails {
+	if tokenUsage.PrefixCache == "" {
+		return nil
+	}
+	return &schema.PromptTokensDetails{
+		CachedTokens: tokenUsage.PromptCached,
+		PrefixCache:  tokenUsage.PrefixCache,
+	}
+}
@@ -3,6 +3,7 @@ package openai
 import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/core/http/middleware"
 	"github.com/mudler/LocalAI/core/schema"
 	"github.com/mudler/LocalAI/core/services"
 	model "github.com/mudler/LocalAI/pkg/model"
@@ -37,8 +38,13 @@ func ListModelsEndpoint(bcl *config.BackendConfigLoader, ml *model.ModelLoader,
 
 		// Map from a slice of names to a slice of OpenAIModel response objects
 		dataModels := []schema.OpenAIModel{}
+		keyPolicy := middleware.GetApiKeyPolicy(c)
 		for _, m := range modelNames {
-			dataModels = append(dataModels, schema.OpenAIModel{ID: m, Object: "model"})
+			// Hide the models the API key is not allowed to use
+			if keyPolicy != nil && !keyPolicy.ModelAllowed(m) {
+				continue
+			}
+			dataModels = append(dataModels, schema.OpenAIModel{ID: m, Object: "model", Status: string(ml.LoadState(m).Status)})
 		}
 
 		return c.JSON(schema.ModelsDataResponse{
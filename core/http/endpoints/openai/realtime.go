@@ -16,6 +16,9 @@ import (
 	"github.com/mudler/LocalAI/core/application"
 	"github.com/mudler/LocalAI/core/config"
 	"github.com/mudler/LocalAI/core/http/endpoints/openai/types"
+	"github.com/mudler/LocalAI/core/http/middleware"
+	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/core/services"
 	"github.com/mudler/LocalAI/core/templates"
 	laudio "github.com/mudler/LocalAI/pkg/audio"
 	"github.com/mudler/LocalAI/pkg/functions"
@@ -51,6 +54,9 @@ type Session struct {
 	Instructions            string
 	DefaultConversationID   string
 	ModelInterface          Model
+	// AuditService records the inferences of the session, nil if the audit log is disabled
+	AuditService *services.AuditService
+	ApiKey       string
 }
 
 func (s *Session) FromClient(session *types.ClientSession) {
@@ -219,6 +225,10 @@ func registerRealtime(application *application.Application) func(c *websocket.Co
 				Model: "whisper-1",
 			},
 			Conversations: make(map[string]*Conversation),
+			AuditService:  application.AuditService(),
+		}
+		if policy, ok := c.Locals(middleware.CONTEXT_LOCALS_KEY_API_KEY_POLICY).(*config.ApiKeyPolicy); ok && policy != nil {
+			session.ApiKey = policy.DisplayName()
 		}
 
 		// Create a default conversation
@@ -772,6 +782,7 @@ func commitUtterance(ctx context.Context, utt []byte, cfg *config.BackendConfig,
 	f.Sync()
 
 	if session.InputAudioTranscription != nil {
+		start := time.Now()
 		tr, err := session.ModelInterface.Transcribe(ctx, &proto.TranscriptRequest{
 			Dst:       f.Name(),
 			Language:  session.InputAudioTranscription.Language,
@@ -781,6 +792,7 @@ func commitUtterance(ctx context.Context, utt []byte, cfg *config.BackendConfig,
 		if err != nil {
 			sendError(c, "transcription_failed", err.Error(), "", "event_TODO")
 		}
+		auditTranscription(session, start, len(utt), tr, err)
 
 		sendEvent(c, types.ResponseAudioTranscriptDoneEvent{
 			ServerEventBase: types.ServerEventBase{
@@ -831,6 +843,36 @@ func commitUtterance(ctx context.Context, utt []byte, cfg *config.BackendConfig,
 	// generateResponse(cfg, evaluator, session, conv, ResponseCreate{}, c, websocket.TextMessage)
 }
 
+// auditTranscription records a transcription of the session in the audit log
+func auditTranscription(session *Session, start time.Time, audioBytes int, tr *proto.TranscriptResult, err error) {
+	if session.AuditService == nil {
+		return
+	}
+
+	record := schema.AuditRecord{
+		Timestamp: start,
+		Endpoint:  "/v1/realtime",
+		Model:     session.InputAudioTranscription.Model,
+		ApiKey:    session.ApiKey,
+		Status:    fiber.StatusOK,
+		LatencyMs: time.Since(start).Milliseconds(),
+	}
+	if request, merr := json.Marshal(map[string]interface{}{
+		"session_id":  session.ID,
+		"language":    session.InputAudioTranscription.Language,
+		"audio_bytes": audioBytes,
+	}); merr == nil {
+		record.Request = session.AuditService.SanitizeRequest(request)
+	}
+	if err != nil {
+		record.Status = fiber.StatusInternalServerError
+		record.Error = err.Error()
+	} else if response, merr := json.Marshal(map[string]string{"text": tr.GetText()}); merr == nil {
+		record.Response = session.AuditService.SanitizeResponse(response)
+	}
+	session.AuditService.Record(record)
+}
+
 func runVAD(ctx context.Context, session *Session, adata []int16) ([]*proto.VADSegment, error) {
 	soundIntBuffer := &audio.IntBuffer{
 		Format:         &audio.Format{SampleRate: localSampleRate, NumChannels: 1},
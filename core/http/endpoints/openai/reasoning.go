@@ -0,0 +1,55 @@
+package openai
+
+import (
+	"github.com/mudler/LocalAI/core/backend"
+	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/core/services"
+)
+
+// countReasoningTokens returns the number of tokens of the reasoning of a whole output. The backends only report
+// the tokens of the whole completion, the ones of the reasoning are estimated rather than tokenized again.
+func countReasoningTokens(reasoning string) int {
+	return services.EstimateTokens(reasoning)
+}
+
+// streamUsage returns the usage sent in the chunks of the streamed chat completions
+func streamUsage(cfg *config.BackendConfig, tokenUsage backend.TokenUsage, reasoningTokens int, extraUsage bool) schema.OpenAIUsage {
+	usage := schema.OpenAIUsage{
+		PromptTokens:            tokenUsage.Prompt,
+		CompletionTokens:        tokenUsage.Completion,
+		TotalTokens:             tokenUsage.Prompt + tokenUsage.Completion,
+		PromptTokensDetails:     promptTokensDetails(tokenUsage),
+		CompletionTokensDetails: completionTokensDetails(cfg, reasoningTokens),
+	}
+	if extraUsage {
+		usage.TimingTokenGeneration = tokenUsage.TimingTokenGeneration
+		usage.TimingPromptProcessing = tokenUsage.TimingPromptProcessing
+	}
+	return usage
+}
+
+// completionTokensDetails returns the reasoning tokens to report, nil when the reasoning isn't extracted for the model
+func completionTokensDetails(cfg *config.BackendConfig, reasoningTokens int) *schema.CompletionTokensDetails {
+	if !cfg.Reasoning.Enabled {
+		return nil
+	}
+	return &schema.CompletionTokensDetails{ReasoningTokens: reasoningTokens}
+}
+
+// reasoningDelta returns the delta of the reasoning and the content of a token, nil if there is nothing to send. The
+// content is left out of the reasoning deltas, and the reasoning is left out if stripped.
+func reasoningDelta(cfg *config.BackendConfig, reasoning, content string) *schema.Message {
+	if cfg.Reasoning.Strip {
+		reasoning = ""
+	}
+	switch {
+	case reasoning != "" && content != "":
+		return &schema.Message{ReasoningContent: reasoning, Content: &content}
+	case reasoning != "":
+		return &schema.Message{ReasoningContent: reasoning}
+	case content != "":
+		return &schema.Message{Content: &content}
+	}
+	return nil
+}
@@ -0,0 +1,430 @@
+package openai
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/mudler/LocalAI/core/backend"
+	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/core/http/middleware"
+	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/core/services"
+	"github.com/mudler/LocalAI/core/templates"
+	"github.com/mudler/LocalAI/pkg/functions"
+	"github.com/mudler/LocalAI/pkg/model"
+	"github.com/rs/zerolog/log"
+	"github.com/valyala/fasthttp"
+)
+
+// ResponsesEndpoint is the OpenAI Responses API endpoint https://platform.openai.com/docs/api-reference/responses/create
+// @Summary Create a model response. Conversations can be continued with previous_response_id.
+// @Param request body schema.OpenResponsesRequest true "query params"
+// @Success 200 {object} schema.OpenResponsesResponse "Response"
+// @Router /v1/responses [post]
+func ResponsesEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, evaluator *templates.Evaluator, appConfig *config.ApplicationConfig, store services.ResponseStore) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		input, ok := c.Locals(middleware.CONTEXT_LOCALS_KEY_LOCALAI_REQUEST).(*schema.OpenAIRequest)
+		if !ok || input.Model == "" {
+			return fiber.ErrBadRequest
+		}
+
+		responsesRequest, ok := c.Locals(middleware.CONTEXT_LOCALS_KEY_RESPONSES_REQUEST).(*schema.OpenResponsesRequest)
+		if !ok {
+			return fiber.ErrBadRequest
+		}
+
+		conversation, _ := c.Locals(middleware.CONTEXT_LOCALS_KEY_RESPONSES_CONVERSATION).([]schema.Message)
+		// the response is stored after the stream ends, once the context of the request is released
+		policy := middleware.GetApiKeyPolicy(c)
+
+		config, ok := c.Locals(middleware.CONTEXT_LOCALS_KEY_MODEL_CONFIG).(*config.BackendConfig)
+		if !ok || config == nil {
+			return fiber.ErrBadRequest
+		}
+
+		log.Debug().Msgf("Responses endpoint configuration read: %+v", config)
+
+		prompt, err := buildChatPrompt(input, config, evaluator)
+		if err != nil {
+			return err
+		}
+
+		response := &schema.OpenResponsesResponse{
+			ID:                 newResponseID("resp"),
+			Object:             "response",
+			CreatedAt:          time.Now().Unix(),
+			Status:             "in_progress",
+			Model:              responsesRequest.Model, // we have to return what the user sent here, due to OpenAI spec.
+			Instructions:       responsesRequest.Instructions,
+			PreviousResponseID: responsesRequest.PreviousResponseID,
+			Metadata:           responsesRequest.Metadata,
+			Output:             []schema.ResponseItem{},
+		}
+
+		// complete marks the response as done and stores it, so it can be retrieved or chained to later on
+		complete := func(output []schema.ResponseItem, tokenUsage backend.TokenUsage) {
+			response.Status = "completed"
+			response.Output = output
+			response.Usage = &schema.ResponseUsage{
+				InputTokens:  tokenUsage.Prompt,
+				OutputTokens: tokenUsage.Completion,
+				TotalTokens:  tokenUsage.Prompt + tokenUsage.Completion,
+			}
+
+			if !responsesRequest.ShouldStore() {
+				return
+			}
+			err := store.Set(&services.StoredResponse{
+				Response: *response,
+				Messages: append(conversation, responseOutputToMessages(output)...),
+			}, policy)
+			if err != nil {
+				log.Error().Err(err).Str("id", response.ID).Msg("failed storing response")
+			}
+		}
+
+		if !input.Stream {
+			text, tokenUsage, err := computeResponseText(input, prompt, config, cl, appConfig, ml, nil)
+			if err != nil {
+				return err
+			}
+			output, err := buildResponseOutput(text, prompt, input, config, cl, ml, appConfig)
+			if err != nil {
+				return err
+			}
+			complete(output, tokenUsage)
+
+			return c.JSON(response)
+		}
+
+		c.Context().SetContentType("text/event-stream")
+		c.Set("Cache-Control", "no-cache")
+		c.Set("Connection", "keep-alive")
+		c.Set("Transfer-Encoding", "chunked")
+
+		events := make(chan schema.ResponseStreamEvent)
+
+		go func() {
+			defer close(events)
+
+			snapshot := func() *schema.OpenResponsesResponse {
+				r := *response
+				return &r
+			}
+			events <- schema.ResponseStreamEvent{Type: "response.created", Response: snapshot()}
+			events <- schema.ResponseStreamEvent{Type: "response.in_progress", Response: snapshot()}
+
+			var tokenCallback func(string, backend.TokenUsage) bool
+			// the items streamed token by token, the reasoning comes first
+			var reasoningItem, messageItem *schema.ResponseItem
+
+			startMessage := func() {
+				if messageItem != nil {
+					return
+				}
+				item := newResponseMessageItem("")
+				item.Status = "in_progress"
+				messageItem = &item
+				index := 0
+				if reasoningItem != nil {
+					index = 1
+				}
+				events <- schema.ResponseStreamEvent{Type: "response.output_item.added", OutputIndex: intPtr(index), Item: messageItem}
+				events <- schema.ResponseStreamEvent{Type: "response.content_part.added", OutputIndex: intPtr(index), ContentIndex: intPtr(0), ItemID: messageItem.ID}
+			}
+			streamText := func(reasoning, content string) {
+				if reasoning != "" && !config.Reasoning.Strip && messageItem == nil {
+					if reasoningItem == nil {
+						item := newResponseReasoningItem("")
+						item.Status = "in_progress"
+						reasoningItem = &item
+						events <- schema.ResponseStreamEvent{Type: "response.output_item.added", OutputIndex: intPtr(0), Item: reasoningItem}
+					}
+					events <- schema.ResponseStreamEvent{Type: "response.reasoning_text.delta", OutputIndex: intPtr(0), ContentIndex: intPtr(0), ItemID: reasoningItem.ID, Delta: reasoning}
+				}
+				if content != "" {
+					startMessage()
+					events <- schema.ResponseStreamEvent{Type: "response.output_text.delta", OutputIndex: intPtr(messageIndex(reasoningItem)), ContentIndex: intPtr(0), ItemID: messageItem.ID, Delta: content}
+				}
+			}
+
+			// Without functions the text can be streamed token by token, after the reasoning of the model
+			reasoningParser := config.Reasoning.NewParser()
+			if !prompt.shouldUseFn {
+				tokenCallback = func(s string, _ backend.TokenUsage) bool {
+					reasoning := ""
+					if reasoningParser != nil {
+						reasoning, s = reasoningParser.Write(s)
+					}
+					streamText(reasoning, s)
+					return true
+				}
+			}
+
+			fail := func(err error) {
+				log.Error().Err(err).Msg("error computing response")
+				response.Status = "failed"
+				response.Error = &schema.APIError{Message: err.Error(), Type: "server_error"}
+				events <- schema.ResponseStreamEvent{Type: "response.failed", Response: snapshot()}
+			}
+
+			text, tokenUsage, err := computeResponseText(input, prompt, config, cl, appConfig, ml, tokenCallback)
+			if err != nil {
+				fail(err)
+				return
+			}
+			if !prompt.shouldUseFn {
+				if reasoningParser != nil {
+					streamText(reasoningParser.Flush())
+				}
+				startMessage()
+			}
+
+			output, err := buildResponseOutput(text, prompt, input, config, cl, ml, appConfig)
+			if err != nil {
+				fail(err)
+				return
+			}
+
+			for i := range output {
+				item := output[i]
+				// the items already streamed keep their ID
+				streamed := (*schema.ResponseItem)(nil)
+				switch {
+				case prompt.shouldUseFn:
+				case item.Type == "reasoning":
+					streamed = reasoningItem
+				case item.Type == "message":
+					streamed = messageItem
+				}
+				if streamed != nil {
+					item.ID = streamed.ID
+					output[i] = item
+				} else {
+					events <- schema.ResponseStreamEvent{Type: "response.output_item.added", OutputIndex: intPtr(i), Item: &item}
+				}
+
+				switch item.Type {
+				case "reasoning":
+					text := responseItemText(item)
+					if streamed == nil {
+						events <- schema.ResponseStreamEvent{Type: "response.reasoning_text.delta", OutputIndex: intPtr(i), ContentIndex: intPtr(0), ItemID: item.ID, Delta: text}
+					}
+					events <- schema.ResponseStreamEvent{Type: "response.reasoning_text.done", OutputIndex: intPtr(i), ContentIndex: intPtr(0), ItemID: item.ID, Text: text}
+				case "message":
+					text := responseItemText(item)
+					if streamed == nil {
+						events <- schema.ResponseStreamEvent{Type: "response.content_part.added", OutputIndex: intPtr(i), ContentIndex: intPtr(0), ItemID: item.ID}
+						events <- schema.ResponseStreamEvent{Type: "response.output_text.delta", OutputIndex: intPtr(i), ContentIndex: intPtr(0), ItemID: item.ID, Delta: text}
+					}
+					events <- schema.ResponseStreamEvent{Type: "response.output_text.done", OutputIndex: intPtr(i), ContentIndex: intPtr(0), ItemID: item.ID, Text: text}
+					events <- schema.ResponseStreamEvent{Type: "response.content_part.done", OutputIndex: intPtr(i), ContentIndex: intPtr(0), ItemID: item.ID}
+				case "function_call":
+					events <- schema.ResponseStreamEvent{Type: "response.function_call_arguments.delta", OutputIndex: intPtr(i), ItemID: item.ID, Delta: item.Arguments}
+					events <- schema.ResponseStreamEvent{Type: "response.function_call_arguments.done", OutputIndex: intPtr(i), ItemID: item.ID, Text: item.Arguments}
+				}
+				events <- schema.ResponseStreamEvent{Type: "response.output_item.done", OutputIndex: intPtr(i), Item: &item}
+			}
+
+			complete(output, tokenUsage)
+			events <- schema.ResponseStreamEvent{Type: "response.completed", Response: snapshot()}
+		}()
+
+		streamEnd := middleware.StreamEnd(c)
+		c.Context().SetBodyStreamWriter(fasthttp.StreamWriter(func(w *bufio.Writer) {
+			// the client went away if the stream can't be flushed anymore
+			defer func() { streamEnd(w.Flush()) }()
+			sequence := 0
+			for ev := range events {
+				ev.SequenceNumber = sequence
+				sequence++
+
+				dat, err := json.Marshal(ev)
+				if err != nil {
+					log.Error().Err(err).Msg("failed marshalling response event")
+					continue
+				}
+				log.Debug().Msgf("Sending event: %s", dat)
+				_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, dat)
+				if err != nil {
+					log.Debug().Msgf("Sending event failed: %v", err)
+					input.Cancel()
+				}
+				w.Flush()
+			}
+		}))
+
+		return nil
+	}
+}
+
+// GetResponseEndpoint returns a stored response
+// @Summary Retrieve a model response stored with the Responses API
+// @Success 200 {object} schema.OpenResponsesResponse "Response"
+// @Router /v1/responses/{id} [get]
+func GetResponseEndpoint(store services.ResponseStore) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		r, err := store.Get(c.Params("id"), middleware.GetApiKeyPolicy(c))
+		if err != nil {
+			return responseStoreError(err)
+		}
+		return c.JSON(r.Response)
+	}
+}
+
+// DeleteResponseEndpoint deletes a stored response
+// @Summary Delete a model response stored with the Responses API
+// @Success 200 {object} schema.DeleteResponseResponse "Response"
+// @Router /v1/responses/{id} [delete]
+func DeleteResponseEndpoint(store services.ResponseStore) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		id := c.Params("id")
+		if err := store.Delete(id, middleware.GetApiKeyPolicy(c)); err != nil {
+			return responseStoreError(err)
+		}
+		return c.JSON(schema.DeleteResponseResponse{ID: id, Object: "response.deleted", Deleted: true})
+	}
+}
+
+// responseStoreError maps the errors of the response store to the HTTP status of the request
+func responseStoreError(err error) error {
+	switch {
+	case errors.Is(err, services.ErrResponseNotFound):
+		return fiber.NewError(fiber.StatusNotFound, err.Error())
+	case errors.Is(err, services.ErrInvalidResponseID):
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	return err
+}
+
+// computeResponseText runs the inference and returns the (finetuned) text of the first choice
+func computeResponseText(input *schema.OpenAIRequest, prompt *chatPrompt, config *config.BackendConfig, cl *config.BackendConfigLoader, appConfig *config.ApplicationConfig, ml *model.ModelLoader, tokenCallback func(string, backend.TokenUsage) bool) (string, backend.TokenUsage, error) {
+	// The Responses API has no notion of multiple choices
+	input.N = 1
+
+	text := ""
+	_, tokenUsage, err := ComputeChoices(input, prompt.predInput, config, cl, appConfig, ml, func(s string, c *[]schema.Choice) {
+		text = s
+	}, tokenCallback)
+	return text, tokenUsage, err
+}
+
+// buildResponseOutput turns the LLM result into output items: the reasoning of the model if it is extracted,
+// a message, and function calls if the model picked any
+func buildResponseOutput(result string, prompt *chatPrompt, input *schema.OpenAIRequest, config *config.BackendConfig, cl *config.BackendConfigLoader, ml *model.ModelLoader, appConfig *config.ApplicationConfig) ([]schema.ResponseItem, error) {
+	reasoning, result := config.Reasoning.Split(result)
+	output := []schema.ResponseItem{}
+	if reasoning != "" && !config.Reasoning.Strip {
+		output = append(output, newResponseReasoningItem(reasoning))
+	}
+
+	if !prompt.shouldUseFn {
+		return append(output, newResponseMessageItem(result)), nil
+	}
+
+	textContent := functions.ParseTextContent(result, config.FunctionsConfig)
+	result = functions.CleanupLLMResult(result, config.FunctionsConfig)
+	results := functions.ParseFunctionCall(result, config.FunctionsConfig)
+
+	if len(results) == 0 || results[0].Name == prompt.noActionName {
+		answer, err := handleQuestion(config, cl, input, ml, appConfig, results, result, prompt.predInput)
+		if err != nil {
+			return nil, err
+		}
+		_, answer = config.Reasoning.Split(answer)
+		return append(output, newResponseMessageItem(answer)), nil
+	}
+
+	if textContent != "" {
+		output = append(output, newResponseMessageItem(textContent))
+	}
+	for _, r := range results {
+		output = append(output, schema.ResponseItem{
+			Type:      "function_call",
+			ID:        newResponseID("fc"),
+			CallID:    newResponseID("call"),
+			Status:    "completed",
+			Name:      r.Name,
+			Arguments: r.Arguments,
+		})
+	}
+	return output, nil
+}
+
+// responseOutputToMessages converts output items back to chat messages, to be replayed when chaining responses
+func responseOutputToMessages(output []schema.ResponseItem) []schema.Message {
+	messages := []schema.Message{}
+	for _, item := range output {
+		switch item.Type {
+		case "message":
+			messages = append(messages, schema.Message{Role: "assistant", Content: responseItemText(item)})
+		case "function_call":
+			toolCall := schema.ToolCall{
+				ID:           item.CallID,
+				Type:         "function",
+				FunctionCall: schema.FunctionCall{Name: item.Name, Arguments: item.Arguments},
+			}
+			// consecutive function calls belong to the same assistant turn
+			if n := len(messages); n > 0 && len(messages[n-1].ToolCalls) > 0 {
+				messages[n-1].ToolCalls = append(messages[n-1].ToolCalls, toolCall)
+				continue
+			}
+			messages = append(messages, schema.Message{Role: "assistant", ToolCalls: []schema.ToolCall{toolCall}})
+		}
+	}
+	return messages
+}
+
+func newResponseMessageItem(text string) schema.ResponseItem {
+	return schema.ResponseItem{
+		Type:    "message",
+		ID:      newResponseID("msg"),
+		Status:  "completed",
+		Role:    "assistant",
+		Content: []schema.ResponseContent{{Type: "output_text", Text: text, Annotations: []interface{}{}}},
+	}
+}
+
+func newResponseReasoningItem(text string) schema.ResponseItem {
+	return schema.ResponseItem{
+		Type:    "reasoning",
+		ID:      newResponseID("rs"),
+		Status:  "completed",
+		Content: []schema.ResponseContent{{Type: "reasoning_text", Text: text}},
+		Summary: []schema.ResponseContent{},
+	}
+}
+
+// messageIndex returns the output index of the streamed message, which follows the streamed reasoning if any
+func messageIndex(reasoningItem *schema.ResponseItem) int {
+	if reasoningItem != nil {
+		return 1
+	}
+	return 0
+}
+
+func responseItemText(item schema.ResponseItem) string {
+	contents, ok := item.Content.([]schema.ResponseContent)
+	if !ok {
+		return ""
+	}
+	text := ""
+	for _, c := range contents {
+		text += c.Text
+	}
+	return text
+}
+
+func newResponseID(prefix string) string {
+	return prefix + "_" + strings.ReplaceAll(uuid.New().String(), "-", "")
+}
+
+func intPtr(i int) *int {
+	return &i
+}
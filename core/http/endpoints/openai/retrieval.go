@@ -0,0 +1,76 @@
+package openai
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mudler/LocalAI/core/backend"
+	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/core/http/middleware"
+	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/core/services"
+	"github.com/mudler/LocalAI/core/templates"
+	"github.com/mudler/LocalAI/pkg/model"
+	"github.com/rs/zerolog/log"
+)
+
+// defaultCollectionTopK is the number of chunks retrieved from the collection of a chat request
+const defaultCollectionTopK = 4
+
+// injectRetrievedContext queries the collection of the request with its last user message,
+// and injects the retrieved chunks as a system message, after the leading system messages
+func injectRetrievedContext(c *fiber.Ctx, input *schema.OpenAIRequest, cfg *config.BackendConfig, collections *services.CollectionService, cl *config.BackendConfigLoader, ml *model.ModelLoader, evaluator *templates.Evaluator, appConfig *config.ApplicationConfig) error {
+	collection, err := collections.Get(input.Collection)
+	if err != nil {
+		if errors.Is(err, services.ErrCollectionNotFound) {
+			return fiber.NewError(fiber.StatusNotFound, "collection "+input.Collection+" not found")
+		}
+		return err
+	}
+	if err := middleware.CheckModelAllowed(c, collection.EmbeddingsModel); err != nil {
+		return err
+	}
+
+	query := ""
+	for i := len(input.Messages) - 1; i >= 0; i-- {
+		if input.Messages[i].Role == "user" {
+			query = input.Messages[i].StringContent
+			break
+		}
+	}
+	if query == "" {
+		return nil
+	}
+
+	topK := input.CollectionTopK
+	if topK <= 0 {
+		topK = defaultCollectionTopK
+	}
+	chunks, err := backend.CollectionQuery(input.Context, collection, query, topK, ml, cl, appConfig)
+	if err != nil {
+		return err
+	}
+	if len(chunks) == 0 {
+		return nil
+	}
+
+	span := startTemplateSpan(input.Context, "TemplateRetrieval")
+	retrieved, err := evaluator.TemplateRetrieval(*cfg, templates.RetrievalTemplateData{
+		Collection: collection.Name,
+		Query:      query,
+		Chunks:     chunks,
+	})
+	span.End()
+	if err != nil {
+		return err
+	}
+	log.Debug().Str("collection", collection.Name).Int("chunks", len(chunks)).Msg("injecting the retrieved context")
+
+	i := 0
+	for i < len(input.Messages) && input.Messages[i].Role == "system" {
+		i++
+	}
+	message := schema.Message{Role: "system", Content: retrieved, StringContent: retrieved}
+	input.Messages = append(input.Messages[:i], append([]schema.Message{message}, input.Messages[i:]...)...)
+	return nil
+}
@@ -0,0 +1,143 @@
+package openai
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/mudler/LocalAI/core/backend"
+	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/core/services"
+	"github.com/mudler/LocalAI/core/templates"
+	"github.com/mudler/LocalAI/pkg/functions"
+	"github.com/mudler/LocalAI/pkg/model"
+	"github.com/rs/zerolog/log"
+)
+
+// requestServerTools returns the tools of the server for the chat request, and offers them to the model along with
+// the functions of the request. The streamed requests and those with several choices can't run them, and are refused.
+func requestServerTools(input *schema.OpenAIRequest, cfg *config.BackendConfig, appConfig *config.ApplicationConfig) ([]config.ServerTool, error) {
+	if !cfg.ShouldUseFunctions() {
+		return nil, nil
+	}
+	tools, err := cfg.GetServerTools(appConfig.ToolsPath, appConfig.ModelPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(tools) > 0 && (input.Stream || input.N > 1) {
+		return nil, fiber.NewError(fiber.StatusBadRequest,
+			fmt.Sprintf("the model %q runs tools on the server, which is not supported for streamed requests nor for those with n greater than 1", cfg.Name))
+	}
+
+	offered := []config.ServerTool{}
+	for _, tool := range tools {
+		// The functions of the request are run by the client
+		if slices.ContainsFunc(input.Functions, func(f functions.Function) bool { return f.Name == tool.Name }) {
+			continue
+		}
+		input.Functions = append(input.Functions, tool.Function())
+		offered = append(offered, tool)
+	}
+	return offered, nil
+}
+
+// runServerTools runs the chat completion, running the tools of the server the model calls and feeding their results
+// back into the conversation, until the model answers or calls a function of the request. Once the iterations run
+// out, the model answers without the tools of the server. answer returns the choices of the final result, which is
+// generated again while it doesn't match the schemas of the request.
+func runServerTools(input *schema.OpenAIRequest, cfg *config.BackendConfig, prompt *chatPrompt, tools []config.ServerTool, answer func(*chatPrompt, string, *[]schema.Choice),
+	evaluator *templates.Evaluator, cl *config.BackendConfigLoader, ml *model.ModelLoader, appConfig *config.ApplicationConfig, collections *services.CollectionService) ([]schema.Choice, backend.TokenUsage, []schema.ToolStep, error) {
+	byName := map[string]config.ServerTool{}
+	for _, tool := range tools {
+		byName[tool.Name] = tool
+	}
+
+	usage := backend.TokenUsage{}
+	steps := []schema.ToolStep{}
+	maxIterations := cfg.ServerTools.GetMaxIterations()
+	retries := 0
+	for iteration := 1; ; iteration++ {
+		var result string
+		_, tokenUsage, err := ComputeChoices(input, prompt.predInput, cfg, cl, appConfig, ml, func(s string, _ *[]schema.Choice) { result = s }, nil)
+		if err != nil {
+			return nil, usage, steps, err
+		}
+		addTokenUsage(&usage, tokenUsage)
+
+		// The calls in the reasoning of the model are left out
+		_, content := cfg.Reasoning.Split(result)
+		calls := functions.ParseFunctionCall(functions.CleanupLLMResult(content, cfg.FunctionsConfig), cfg.FunctionsConfig)
+		if !prompt.shouldUseFn || len(calls) == 0 || slices.ContainsFunc(calls, func(call functions.FuncCallResults) bool {
+			_, ok := byName[call.Name]
+			return !ok
+		}) {
+			if invalid := prompt.validate(cfg, result); invalid != nil {
+				if retries == cfg.StructuredOutput.GetMaxRetries() {
+					return nil, usage, steps, invalidOutputError(retries+1, invalid)
+				}
+				retries++
+				log.Debug().Err(invalid).Int("retry", retries).Msg("the output of the model doesn't match the schema of the request, retrying")
+				input.Messages = append(input.Messages, retryMessages(content, invalid)...)
+				if prompt, err = buildChatPrompt(input, cfg, evaluator); err != nil {
+					return nil, usage, steps, err
+				}
+				// Generating the answer again isn't a round of tool calls
+				iteration--
+				continue
+			}
+
+			choices := []schema.Choice{}
+			answer(prompt, result, &choices)
+			return choices, usage, steps, nil
+		}
+
+		message := schema.Message{Role: "assistant"}
+		results := []schema.Message{}
+		for i, call := range calls {
+			step := schema.ToolStep{Iteration: iteration, ID: uuid.New().String(), Name: call.Name, Arguments: call.Arguments}
+			log.Debug().Str("tool", call.Name).Int("iteration", iteration).Msg("running the tool")
+
+			start := time.Now()
+			// The model is told about the invalid arguments, so that it can fix them
+			err := prompt.validateCall(cfg, call)
+			output := ""
+			if err == nil {
+				output, err = backend.RunServerTool(input.Context, byName[call.Name], call.Arguments, collections, ml, cl, appConfig)
+			}
+			step.Duration = time.Since(start).Milliseconds()
+			if err != nil {
+				log.Debug().Err(err).Str("tool", call.Name).Msg("the tool failed")
+				step.Error = err.Error()
+				// The model is told about the error, so that it can do without the tool
+				output = "error: " + err.Error()
+			} else {
+				step.Result = output
+			}
+			steps = append(steps, step)
+
+			message.ToolCalls = append(message.ToolCalls, schema.ToolCall{
+				Index:        i,
+				ID:           step.ID,
+				Type:         "function",
+				FunctionCall: schema.FunctionCall{Name: call.Name, Arguments: call.Arguments},
+			})
+			results = append(results, schema.Message{Role: "tool", Name: call.Name, ToolCallID: step.ID, Content: output, StringContent: output})
+		}
+		input.Messages = append(append(input.Messages, message), results...)
+
+		if iteration == maxIterations {
+			log.Debug().Int("iterations", iteration).Msg("the tool iterations ran out, the model answers without the tools of the server")
+			input.Functions = slices.DeleteFunc(input.Functions, func(f functions.Function) bool {
+				_, ok := byName[f.Name]
+				return ok
+			})
+			byName = nil
+		}
+		if prompt, err = buildChatPrompt(input, cfg, evaluator); err != nil {
+			return nil, usage, steps, err
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package openai
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/mudler/LocalAI/core/backend"
+	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/pkg/functions"
+	"github.com/mudler/LocalAI/pkg/model"
+	"github.com/rs/zerolog/log"
+)
+
+// responseFormat returns the grammar of the response format of the request, and the schema its outputs are validated
+// against, if any
+func responseFormat(cfg *config.BackendConfig) (string, map[string]interface{}, error) {
+	if cfg.ResponseFormatMap == nil {
+		return "", nil, nil
+	}
+	dat, err := json.Marshal(cfg.ResponseFormatMap)
+	if err != nil {
+		return "", nil, err
+	}
+	d := schema.JsonSchemaRequest{}
+	if err := json.Unmarshal(dat, &d); err != nil {
+		return "", nil, err
+	}
+
+	switch d.Type {
+	case "json_object":
+		if cfg.StructuredOutput.Validate {
+			return functions.JSONBNF, map[string]interface{}{}, nil
+		}
+		return functions.JSONBNF, nil, nil
+	case "json_schema":
+		fs := &functions.JSONFunctionStructure{
+			AnyOf: []functions.Item{d.JsonSchema.Schema},
+		}
+		// The references of the schema are resolved from the root
+		if defs, ok := d.JsonSchema.Schema.Keywords["$defs"].(map[string]interface{}); ok {
+			fs.Defs = defs
+		}
+		// The grammar is left out if the schema can't be converted
+		g, _ := fs.Grammar(cfg.FunctionsConfig.GrammarOptions()...)
+
+		if !d.JsonSchema.Strict && !cfg.StructuredOutput.Validate {
+			return g, nil, nil
+		}
+		var format struct {
+			JsonSchema struct {
+				Schema map[string]interface{} `json:"schema"`
+			} `json:"json_schema"`
+		}
+		if err := json.Unmarshal(dat, &format); err != nil {
+			return "", nil, err
+		}
+		return g, format.JsonSchema.Schema, nil
+	}
+	return "", nil, nil
+}
+
+// validate checks the output of the model against the schema of the response format, or the arguments of the calls of
+// the functions against their parameters. The reasoning of the model isn't validated.
+func (p *chatPrompt) validate(cfg *config.BackendConfig, output string) error {
+	_, output = cfg.Reasoning.Split(output)
+	if !p.shouldUseFn {
+		if p.responseSchema == nil {
+			return nil
+		}
+		return functions.ValidateJSON(p.responseSchema, output)
+	}
+
+	calls := functions.ParseFunctionCall(functions.CleanupLLMResult(output, cfg.FunctionsConfig), cfg.FunctionsConfig)
+	for _, call := range calls {
+		if call.Name == p.noActionName {
+			continue
+		}
+		if err := p.validateCall(cfg, call); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateCall checks the arguments of the call against the parameters of the function, if it is strict or the
+// outputs of the model are always validated
+func (p *chatPrompt) validateCall(cfg *config.BackendConfig, call functions.FuncCallResults) error {
+	i := slices.IndexFunc(p.funcs, func(f functions.Function) bool { return f.Name == call.Name })
+	if !cfg.StructuredOutput.Validate && (i < 0 || !p.funcs[i].Strict) {
+		return nil
+	}
+	return p.funcs.ValidateCall(call)
+}
+
+// retryMessages returns the messages asking the model to fix its invalid output
+func retryMessages(output string, invalid error) []schema.Message {
+	feedback := retryFeedback(invalid)
+	return []schema.Message{
+		{Role: "assistant", Content: output, StringContent: output},
+		{Role: "user", Content: feedback, StringContent: feedback},
+	}
+}
+
+func retryFeedback(invalid error) string {
+	return fmt.Sprintf("The JSON of your answer doesn't match the expected schema: %s. Answer again, with JSON matching the schema.", invalid)
+}
+
+// computeValidChoices runs the prediction until the outputs of the model are valid, and fails with the mismatch once
+// the retries run out. answer returns the choices of a valid output, and retry returns the prompt asking the model to
+// fix an invalid one. The streamed requests aren't validated.
+func computeValidChoices(req *schema.OpenAIRequest, predInput string, cfg *config.BackendConfig, cl *config.BackendConfigLoader, appConfig *config.ApplicationConfig, ml *model.ModelLoader,
+	validate func(string) error, answer func(string, *[]schema.Choice), retry func(string, error) (string, error)) ([]schema.Choice, backend.TokenUsage, error) {
+	usage := backend.TokenUsage{}
+	maxRetries := cfg.StructuredOutput.GetMaxRetries()
+	for attempt := 1; ; attempt++ {
+		var invalid error
+		var invalidOutput string
+		choices, tokenUsage, err := ComputeChoices(req, predInput, cfg, cl, appConfig, ml, func(s string, c *[]schema.Choice) {
+			if invalid != nil {
+				return
+			}
+			if invalid = validate(s); invalid != nil {
+				invalidOutput = s
+				return
+			}
+			answer(s, c)
+		}, nil)
+		addTokenUsage(&usage, tokenUsage)
+		if err != nil {
+			return nil, usage, err
+		}
+		if invalid == nil {
+			return choices, usage, nil
+		}
+
+		if attempt > maxRetries {
+			return nil, usage, invalidOutputError(attempt, invalid)
+		}
+		log.Debug().Err(invalid).Int("retry", attempt).Msg("the output of the model doesn't match the schema of the request, retrying")
+		if predInput, err = retry(invalidOutput, invalid); err != nil {
+			return nil, usage, err
+		}
+	}
+}
+
+// invalidOutputError is the error of a request whose outputs didn't match its schemas in any of the attempts
+func invalidOutputError(attempts int, invalid error) error {
+	return fmt.Errorf("the output of the model doesn't match the schema of the request after %d attempts: %w", attempts, invalid)
+}
+
+// addTokenUsage adds the tokens and the timings of a prediction to the usage of a request
+func addTokenUsage(usage *backend.TokenUsage, other backend.TokenUsage) {
+	usage.Prompt += other.Prompt
+	usage.Completion += other.Completion
+	usage.TimingPromptProcessing += other.TimingPromptProcessing
+	usage.TimingTokenGeneration += other.TimingTokenGeneration
+	usage.AddPrefixCache(other)
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/mudler/LocalAI/core/config"
 	"github.com/mudler/LocalAI/core/http/middleware"
 	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/core/services"
 	model "github.com/mudler/LocalAI/pkg/model"
 
 	"github.com/gofiber/fiber/v2"
@@ -67,11 +68,20 @@ func TranscriptEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, a
 
 		log.Debug().Msgf("Audio file copied to: %+v", dst)
 
-		tr, err := backend.ModelTranscription(dst, input.Language, input.Translate, ml, *config, appConfig)
+		tr, err := backend.ModelTranscription(input.Context, dst, input.Language, input.Translate, ml, *config, appConfig)
 		if err != nil {
 			return err
 		}
 
+		completionTokens := 0
+		for _, s := range tr.Segments {
+			completionTokens += len(s.Tokens)
+		}
+		if completionTokens == 0 {
+			completionTokens = services.EstimateTokens(tr.Text)
+		}
+		middleware.RecordUsage(c, 0, completionTokens)
+
 		log.Debug().Msgf("Trascribed: %+v", tr)
 		// TODO: handle different outputs here
 		return c.Status(http.StatusOK).JSON(tr)
@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/core/services"
+)
+
+// CONTEXT_LOCALS_KEY_API_KEY_POLICY holds the *config.ApiKeyPolicy of the key used to authenticate the request
+const CONTEXT_LOCALS_KEY_API_KEY_POLICY = "API_KEY_POLICY"
+const CONTEXT_LOCALS_KEY_USAGE_RECORDER = "USAGE_RECORDER"
+
+// ApiKeyPolicy enforces the endpoint restrictions and the rate limits of the API key used for the request,
+// and makes the token usage of the request accounted to the key. It must be registered after the key auth middleware.
+func ApiKeyPolicy(usage *services.ApiKeyUsageService, appConfig *config.ApplicationConfig) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		policy := GetApiKeyPolicy(c)
+		if policy == nil {
+			return c.Next()
+		}
+
+		if !policy.EndpointAllowed(c.Path()) {
+			return apiKeyPolicyError(c, appConfig, fiber.StatusForbidden, "permission_error", "forbidden",
+				fmt.Sprintf("the API key %q is not allowed to call %s", policy.DisplayName(), c.Path()))
+		}
+
+		retryAfter, err := usage.Allow(*policy)
+		if err != nil {
+			errType := "requests"
+			if errors.Is(err, services.ErrTokenQuotaExceeded) {
+				errType = "tokens"
+			}
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			return apiKeyPolicyError(c, appConfig, fiber.StatusTooManyRequests, errType, "rate_limit_exceeded",
+				fmt.Sprintf("%s for API key %q, please try again later", err.Error(), policy.DisplayName()))
+		}
+
+		addUsageRecorder(c, usage.Recorder(*policy))
+		return c.Next()
+	}
+}
+
+// RequireAdminApiKey restricts an endpoint to admin keys. Every request is allowed when authentication is disabled.
+func RequireAdminApiKey(appConfig *config.ApplicationConfig) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		policy := GetApiKeyPolicy(c)
+		if policy == nil || policy.Admin {
+			return c.Next()
+		}
+		return apiKeyPolicyError(c, appConfig, fiber.StatusForbidden, "permission_error", "forbidden",
+			fmt.Sprintf("the API key %q is not an admin key", policy.DisplayName()))
+	}
+}
+
+// GetApiKeyPolicy returns the policy of the key used to authenticate the request, or nil if authentication is disabled
+func GetApiKeyPolicy(c *fiber.Ctx) *config.ApiKeyPolicy {
+	policy, ok := c.Locals(CONTEXT_LOCALS_KEY_API_KEY_POLICY).(*config.ApiKeyPolicy)
+	if !ok {
+		return nil
+	}
+	return policy
+}
+
+// addUsageRecorder adds a recorder of the token usage of the request, see SetOpenAIRequest
+func addUsageRecorder(c *fiber.Ctx, recorder services.UsageRecorder) {
+	if previous, ok := c.Locals(CONTEXT_LOCALS_KEY_USAGE_RECORDER).(services.UsageRecorder); ok {
+		next := recorder
+		recorder = func(prompt, completion int) {
+			previous(prompt, completion)
+			next(prompt, completion)
+		}
+	}
+	c.Locals(CONTEXT_LOCALS_KEY_USAGE_RECORDER, recorder)
+}
+
+// RecordUsage accounts the tokens used by the request to its API key, for the endpoints not going through SetOpenAIRequest
+func RecordUsage(c *fiber.Ctx, prompt, completion int) {
+	if recorder, ok := c.Locals(CONTEXT_LOCALS_KEY_USAGE_RECORDER).(services.UsageRecorder); ok {
+		recorder(prompt, completion)
+	}
+}
+
+// RequireModelAllowed restricts an endpoint to the keys allowed to use the model named by the route parameter
+func RequireModelAllowed(param string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if err := CheckModelAllowed(c, c.Params(param)); err != nil {
+			return err
+		}
+		return c.Next()
+	}
+}
+
+// CheckModelAllowed returns an error if the key used for the request can't use the model
+func CheckModelAllowed(c *fiber.Ctx, model string) error {
+	policy := GetApiKeyPolicy(c)
+	if policy == nil || policy.ModelAllowed(model) {
+		return nil
+	}
+	return fiber.NewError(fiber.StatusForbidden, fmt.Sprintf("the API key %q is not allowed to use the model %q", policy.DisplayName(), model))
+}
+
+func apiKeyPolicyError(c *fiber.Ctx, appConfig *config.ApplicationConfig, status int, errType, code, message string) error {
+	if appConfig.OpaqueErrors {
+		return c.SendStatus(status)
+	}
+	return c.Status(status).JSON(schema.ErrorResponse{
+		Error: &schema.APIError{Message: message, Code: code, Type: errType},
+	})
+}
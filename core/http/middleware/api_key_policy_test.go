@@ -0,0 +1,134 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dave-gray101/v2keyauth"
+	"github.com/gofiber/fiber/v2"
+	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/core/services"
+	"github.com/stretchr/testify/require"
+)
+
+func newApiKeyPolicyApp(t *testing.T) *fiber.App {
+	appConfig := config.NewApplicationConfig(
+		config.WithApiKeys([]string{"sk-plain"}),
+		config.WithApiKeyPolicies([]config.ApiKeyPolicy{{
+			Key:               "sk-team-a",
+			Name:              "team-a",
+			AllowedEndpoints:  []string{"/v1/chat/completions"},
+			RequestsPerMinute: 2,
+		}}),
+	)
+	usage, err := services.NewApiKeyUsageService(appConfig)
+	require.NoError(t, err)
+
+	kaConfig, err := GetKeyAuthConfig(appConfig)
+	require.NoError(t, err)
+
+	app := fiber.New()
+	app.Use(v2keyauth.New(*kaConfig))
+	app.Use(ApiKeyPolicy(usage, appConfig))
+	ok := func(c *fiber.Ctx) error { return c.SendString("ok") }
+	app.Post("/v1/chat/completions", ok)
+	app.Post("/chat/completions", ok)
+	app.Post("/v1/embeddings", ok)
+	app.Get("/api/usage", RequireAdminApiKey(appConfig), ok)
+	return app
+}
+
+func apiKeyRequest(t *testing.T, app *fiber.App, method, path, key string) (int, *schema.ErrorResponse) {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", "Bearer "+key)
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	if resp.StatusCode == fiber.StatusOK {
+		return resp.StatusCode, nil
+	}
+	errResp := &schema.ErrorResponse{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(errResp))
+	return resp.StatusCode, errResp
+}
+
+func TestApiKeyPolicyEndpoints(t *testing.T) {
+	app := newApiKeyPolicyApp(t)
+
+	status, _ := apiKeyRequest(t, app, "POST", "/chat/completions", "sk-team-a")
+	require.Equal(t, fiber.StatusOK, status)
+
+	status, errResp := apiKeyRequest(t, app, "POST", "/v1/embeddings", "sk-team-a")
+	require.Equal(t, fiber.StatusForbidden, status)
+	require.Equal(t, "permission_error", errResp.Error.Type)
+
+	status, _ = apiKeyRequest(t, app, "GET", "/api/usage", "sk-team-a")
+	require.Equal(t, fiber.StatusForbidden, status)
+
+	// Plain keys are unrestricted
+	status, _ = apiKeyRequest(t, app, "POST", "/v1/embeddings", "sk-plain")
+	require.Equal(t, fiber.StatusOK, status)
+	status, _ = apiKeyRequest(t, app, "GET", "/api/usage", "sk-plain")
+	require.Equal(t, fiber.StatusOK, status)
+}
+
+func TestApiKeyPolicyRateLimit(t *testing.T) {
+	app := newApiKeyPolicyApp(t)
+
+	for i := 0; i < 2; i++ {
+		status, _ := apiKeyRequest(t, app, "POST", "/v1/chat/completions", "sk-team-a")
+		require.Equal(t, fiber.StatusOK, status)
+	}
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+	req.Header.Set("Authorization", "Bearer sk-team-a")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusTooManyRequests, resp.StatusCode)
+	require.NotEmpty(t, resp.Header.Get("Retry-After"))
+
+	errResp := &schema.ErrorResponse{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(errResp))
+	require.Equal(t, "requests", errResp.Error.Type)
+	require.Equal(t, "rate_limit_exceeded", errResp.Error.Code)
+}
+
+func TestApiKeyPolicyModelsAndUsage(t *testing.T) {
+	appConfig := config.NewApplicationConfig(
+		config.WithApiKeyPolicies([]config.ApiKeyPolicy{{
+			Key:           "sk-team-b",
+			Name:          "team-b",
+			AllowedModels: []string{"m1"},
+		}}),
+	)
+	usage, err := services.NewApiKeyUsageService(appConfig)
+	require.NoError(t, err)
+	kaConfig, err := GetKeyAuthConfig(appConfig)
+	require.NoError(t, err)
+
+	app := fiber.New()
+	app.Use(v2keyauth.New(*kaConfig))
+	app.Use(ApiKeyPolicy(usage, appConfig))
+	app.Get("/models/:name/status", RequireModelAllowed("name"), func(c *fiber.Ctx) error {
+		RecordUsage(c, 3, 2)
+		return c.SendString("ok")
+	})
+
+	status := func(path string) int {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer sk-team-b")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		return resp.StatusCode
+	}
+	require.Equal(t, fiber.StatusOK, status("/models/m1/status"))
+	require.Equal(t, fiber.StatusForbidden, status("/models/m2/status"))
+
+	report := usage.Usage()
+	require.Len(t, report, 1)
+	require.Equal(t, "team-b", report[0].Name)
+	require.EqualValues(t, 5, report[0].TotalTokens)
+}
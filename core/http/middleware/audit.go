@@ -0,0 +1,202 @@
+package middleware
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/core/services"
+)
+
+// CONTEXT_LOCALS_KEY_STREAM_END holds the function called when the body writer of a streamed response exits, see StreamEnd
+const CONTEXT_LOCALS_KEY_STREAM_END = "STREAM_END"
+
+// auditedEndpoints are the path prefixes of the inference endpoints, without the optional "/v1" prefix
+var auditedEndpoints = []string{
+	"/chat/completions",
+	"/completions",
+	"/edits",
+	"/embeddings",
+	"/engines/",
+	"/audio/",
+	"/images/",
+	"/rerank",
+	"/tts",
+	"/text-to-speech/",
+	"/sound-generation",
+	"/responses",
+	"/video",
+	"/detection",
+	"/vad",
+}
+
+func isAuditedEndpoint(path string) bool {
+	path = strings.TrimPrefix(path, "/v1")
+	for _, e := range auditedEndpoints {
+		if path == e || strings.HasPrefix(path, e) && (strings.HasSuffix(e, "/") || path[len(e)] == '/') {
+			return true
+		}
+	}
+	return false
+}
+
+// Audit records an audit log entry for each inference request. It must be registered after the key auth middleware.
+// Streamed responses are recorded without their content once their body writer exits (see StreamEnd), including
+// those whose inference failed or whose client went away.
+func Audit(audit *services.AuditService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Method() != fiber.MethodPost || !isAuditedEndpoint(c.Path()) {
+			return c.Next()
+		}
+
+		start := time.Now()
+		record := schema.AuditRecord{
+			Timestamp: start,
+			Endpoint:  c.Path(),
+			Request:   auditRequest(c, audit),
+		}
+		if policy := GetApiKeyPolicy(c); policy != nil {
+			record.ApiKey = policy.DisplayName()
+		}
+
+		var (
+			mu        sync.Mutex
+			usage     *schema.OpenAIUsage
+			ended     bool
+			streamErr error
+			finish    func()
+		)
+		addUsageRecorder(c, func(prompt, completion int) {
+			mu.Lock()
+			defer mu.Unlock()
+			if usage == nil {
+				usage = &schema.OpenAIUsage{}
+			}
+			usage.PromptTokens += prompt
+			usage.CompletionTokens += completion
+			usage.TotalTokens += prompt + completion
+		})
+		c.Locals(CONTEXT_LOCALS_KEY_STREAM_END, func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if ended {
+				return
+			}
+			ended, streamErr = true, err
+			if finish != nil {
+				finish()
+			}
+		})
+
+		if err := c.Next(); err != nil {
+			// Render the error now, to record the actual status
+			if herr := c.App().ErrorHandler(c, err); herr != nil {
+				_ = c.SendStatus(fiber.StatusInternalServerError)
+			}
+			record.Error = err.Error()
+		}
+
+		record.Status = c.Response().StatusCode()
+		record.CorrelationID = string(c.Response().Header.Peek("X-Correlation-ID"))
+		if cfg, ok := c.Locals(CONTEXT_LOCALS_KEY_MODEL_CONFIG).(*config.BackendConfig); ok && cfg != nil {
+			record.Model = cfg.Name
+			record.Backend = cfg.Backend
+		}
+		if record.Model == "" {
+			record.Model, _ = c.Locals(CONTEXT_LOCALS_KEY_MODEL_NAME).(string)
+		}
+
+		if c.Response().IsBodyStream() {
+			record.Stream = true
+			mu.Lock()
+			finish = func() {
+				record.Usage = usage
+				switch {
+				case streamErr != nil:
+					record.Error = streamErr.Error()
+				case usage == nil:
+					// The usage is only recorded once the inference completes
+					record.Error = "the stream ended before the inference completed"
+				}
+				record.LatencyMs = time.Since(start).Milliseconds()
+				audit.Record(record)
+			}
+			if ended {
+				// The body writer already exited
+				finish()
+			}
+			mu.Unlock()
+			return nil
+		}
+
+		record.LatencyMs = time.Since(start).Milliseconds()
+		if strings.HasPrefix(string(c.Response().Header.ContentType()), fiber.MIMEApplicationJSON) {
+			body := c.Response().Body()
+			record.Response = audit.SanitizeResponse(body)
+			if usage == nil {
+				usage = responseUsage(body)
+			}
+		}
+		mu.Lock()
+		record.Usage = usage
+		mu.Unlock()
+		audit.Record(record)
+		return nil
+	}
+}
+
+// StreamEnd returns the function the body writer of a streamed response calls when it exits, with the error that
+// interrupted the stream if any. It must be taken before the handler returns, as the writer outlives the request.
+func StreamEnd(c *fiber.Ctx) func(err error) {
+	if end, ok := c.Locals(CONTEXT_LOCALS_KEY_STREAM_END).(func(error)); ok {
+		return end
+	}
+	return func(error) {}
+}
+
+// auditRequest returns the request for the audit log. Uploaded files are only described by their name and size.
+func auditRequest(c *fiber.Ctx, audit *services.AuditService) json.RawMessage {
+	if !strings.HasPrefix(c.Get(fiber.HeaderContentType), fiber.MIMEMultipartForm) {
+		return audit.SanitizeRequest(c.Body())
+	}
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		return nil
+	}
+	request := map[string]interface{}{}
+	for k, v := range form.Value {
+		if len(v) == 1 {
+			request[k] = v[0]
+		} else {
+			request[k] = v
+		}
+	}
+	for k, files := range form.File {
+		described := []map[string]interface{}{}
+		for _, f := range files {
+			described = append(described, map[string]interface{}{"filename": f.Filename, "size": f.Size})
+		}
+		request[k] = described
+	}
+	dat, err := json.Marshal(request)
+	if err != nil {
+		return nil
+	}
+	return audit.SanitizeRequest(dat)
+}
+
+// responseUsage returns the OpenAI usage of a response body, if any
+func responseUsage(body []byte) *schema.OpenAIUsage {
+	var response struct {
+		Usage *schema.OpenAIUsage `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil
+	}
+	return response.Usage
+}
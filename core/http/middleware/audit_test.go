@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"bufio"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/core/services"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsAuditedEndpoint(t *testing.T) {
+	for path, expected := range map[string]bool{
+		"/v1/chat/completions":           true,
+		"/chat/completions":              true,
+		"/v1/completions":                true,
+		"/v1/audio/transcriptions":       true,
+		"/v1/text-to-speech/voice":       true,
+		"/v1/completionsfoo":             false,
+		"/v1/models":                     false,
+		"/api/audit":                     false,
+		"/v1/engines/model/embeddings":   true,
+		"/v1/responses":                  true,
+		"/v1/chat/completions/something": true,
+	} {
+		require.Equal(t, expected, isAuditedEndpoint(path), path)
+	}
+}
+
+func TestAudit(t *testing.T) {
+	appConfig := config.NewApplicationConfig(config.WithDataPath(t.TempDir()), config.WithAuditLog(true, nil, 100, 10))
+	audit, err := services.NewAuditService(appConfig)
+	require.NoError(t, err)
+	defer audit.Close()
+
+	app := fiber.New()
+	app.Use(Audit(audit))
+	app.Post("/v1/embeddings", func(c *fiber.Ctx) error {
+		c.Locals(CONTEXT_LOCALS_KEY_MODEL_CONFIG, &config.BackendConfig{Name: "embedder", Backend: "llama-cpp"})
+		return c.JSON(schema.OpenAIResponse{Object: "list", Usage: schema.OpenAIUsage{PromptTokens: 3, TotalTokens: 3}})
+	})
+	app.Post("/v1/completions", func(c *fiber.Ctx) error {
+		return fiber.NewError(fiber.StatusNotFound, "model not found")
+	})
+	app.Post("/v1/chat/completions", func(c *fiber.Ctx) error {
+		recorder := c.Locals(CONTEXT_LOCALS_KEY_USAGE_RECORDER).(services.UsageRecorder)
+		end := StreamEnd(c)
+		c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+			defer end(nil)
+			w.WriteString("data: {}\n\n")
+			w.Flush()
+			recorder(5, 7)
+		})
+		return nil
+	})
+	app.Post("/v1/responses", func(c *fiber.Ctx) error {
+		// The inference fails after the stream started, the usage is never recorded
+		end := StreamEnd(c)
+		c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+			defer end(nil)
+			w.WriteString("event: error\ndata: {}\n\n")
+			w.Flush()
+		})
+		return nil
+	})
+
+	for _, path := range []string{"/v1/embeddings", "/v1/completions", "/v1/chat/completions", "/v1/responses"} {
+		req := httptest.NewRequest("POST", path, strings.NewReader(`{"model": "embedder", "input": "hello"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		_, err = io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	// The streamed responses are recorded once their body is written
+	records := map[string]schema.AuditRecord{}
+	require.Eventually(t, func() bool {
+		found, _, err := audit.Query(schema.AuditQuery{})
+		require.NoError(t, err)
+		for _, r := range found {
+			records[r.Endpoint] = r
+		}
+		return len(found) == 4
+	}, 5*time.Second, 10*time.Millisecond)
+
+	embeddings, failed, stream, failedStream := records["/v1/embeddings"], records["/v1/completions"], records["/v1/chat/completions"], records["/v1/responses"]
+
+	require.Equal(t, "/v1/embeddings", embeddings.Endpoint)
+	require.Equal(t, "embedder", embeddings.Model)
+	require.Equal(t, "llama-cpp", embeddings.Backend)
+	require.Equal(t, fiber.StatusOK, embeddings.Status)
+	require.JSONEq(t, `{"model": "embedder", "input": "hello"}`, string(embeddings.Request))
+	require.NotEmpty(t, embeddings.Response)
+	require.Equal(t, 3, embeddings.Usage.PromptTokens)
+
+	require.Equal(t, fiber.StatusNotFound, failed.Status)
+	require.Equal(t, "model not found", failed.Error)
+
+	require.True(t, stream.Stream)
+	require.Empty(t, stream.Response)
+	require.Equal(t, 12, stream.Usage.TotalTokens)
+	require.Empty(t, stream.Error)
+
+	require.True(t, failedStream.Stream)
+	require.Nil(t, failedStream.Usage)
+	require.Equal(t, "the stream ended before the inference completed", failedStream.Error)
+}
@@ -33,7 +33,7 @@ func GetKeyAuthConfig(applicationConfig *config.ApplicationConfig) (*v2keyauth.C
 func getApiKeyErrorHandler(applicationConfig *config.ApplicationConfig) fiber.ErrorHandler {
 	return func(ctx *fiber.Ctx, err error) error {
 		if errors.Is(err, v2keyauth.ErrMissingOrMalformedAPIKey) {
-			if len(applicationConfig.ApiKeys) == 0 {
+			if !applicationConfig.HasApiKeys() {
 				return ctx.Next() // if no keys are set up, any error we get here is not an error.
 			}
 			ctx.Set("WWW-Authenticate", "Bearer")
@@ -53,26 +53,30 @@ func getApiKeyErrorHandler(applicationConfig *config.ApplicationConfig) fiber.Er
 
 func getApiKeyValidationFunction(applicationConfig *config.ApplicationConfig) func(*fiber.Ctx, string) (bool, error) {
 
+	compare := func(apiKey, validKey string) bool {
+		return apiKey == validKey
+	}
 	if applicationConfig.UseSubtleKeyComparison {
-		return func(ctx *fiber.Ctx, apiKey string) (bool, error) {
-			if len(applicationConfig.ApiKeys) == 0 {
-				return true, nil // If no keys are setup, accept everything
-			}
-			for _, validKey := range applicationConfig.ApiKeys {
-				if subtle.ConstantTimeCompare([]byte(apiKey), []byte(validKey)) == 1 {
-					return true, nil
-				}
-			}
-			return false, v2keyauth.ErrMissingOrMalformedAPIKey
+		compare = func(apiKey, validKey string) bool {
+			return subtle.ConstantTimeCompare([]byte(apiKey), []byte(validKey)) == 1
 		}
 	}
 
 	return func(ctx *fiber.Ctx, apiKey string) (bool, error) {
-		if len(applicationConfig.ApiKeys) == 0 {
+		if !applicationConfig.HasApiKeys() {
 			return true, nil // If no keys are setup, accept everything
 		}
 		for _, validKey := range applicationConfig.ApiKeys {
-			if apiKey == validKey {
+			if compare(apiKey, validKey) {
+				// Plain keys have full access to the API, but their usage is still accounted
+				ctx.Locals(CONTEXT_LOCALS_KEY_API_KEY_POLICY, &config.ApiKeyPolicy{Key: validKey, Admin: true})
+				return true, nil
+			}
+		}
+		policies := applicationConfig.ApiKeyPolicies
+		for i := range policies {
+			if policies[i].Key != "" && compare(apiKey, policies[i].Key) {
+				ctx.Locals(CONTEXT_LOCALS_KEY_API_KEY_POLICY, &policies[i])
 				return true, nil
 			}
 		}
@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/google/uuid"
+	"github.com/mudler/LocalAI/core/backend"
 	"github.com/mudler/LocalAI/core/config"
 	"github.com/mudler/LocalAI/core/schema"
 	"github.com/mudler/LocalAI/core/services"
@@ -18,6 +19,8 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type correlationIDKeyType string
@@ -95,6 +98,17 @@ func (re *RequestExtractor) BuildFilteredFirstAvailableDefaultModel(filterFn con
 			return ctx.Next()
 		}
 
+		// Only pick a model the API key is allowed to use
+		if policy := GetApiKeyPolicy(ctx); policy != nil {
+			allowed := []string{}
+			for _, m := range modelNames {
+				if policy.ModelAllowed(m) {
+					allowed = append(allowed, m)
+				}
+			}
+			modelNames = allowed
+		}
+
 		if len(modelNames) == 0 {
 			log.Warn().Msg("SetDefaultModelNameToFirstAvailable used with no matching models installed")
 			// This is non-fatal - making it so was breaking the case of direct installation of raw models
@@ -112,41 +126,73 @@ func (re *RequestExtractor) BuildFilteredFirstAvailableDefaultModel(filterFn con
 // Otherwise, it's in its own method below for now
 func (re *RequestExtractor) SetModelAndConfig(initializer func() schema.MaxGPTRequest) fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
-		input := initializer()
-		if input == nil {
-			return fmt.Errorf("unable to initialize body")
-		}
-		if err := ctx.BodyParser(input); err != nil {
-			return fmt.Errorf("failed parsing request body: %w", err)
+		if err := re.setModelAndConfig(ctx, initializer); err != nil {
+			return err
 		}
+		return ctx.Next()
+	}
+}
 
-		// If this request doesn't have an associated model name, fetch it from earlier in the middleware chain
-		if input.ModelName(nil) == "" {
-			localModelName, ok := ctx.Locals(CONTEXT_LOCALS_KEY_MODEL_NAME).(string)
-			if ok && localModelName != "" {
-				log.Debug().Str("context localModelName", localModelName).Msg("overriding empty model name in request body with value found earlier in middleware chain")
-				input.ModelName(&localModelName)
-			}
-		}
+func (re *RequestExtractor) setModelAndConfig(ctx *fiber.Ctx, initializer func() schema.MaxGPTRequest) error {
+	span := startSpan(ctx, "RequestExtractor.SetModelAndConfig")
+	defer span.End()
 
-		cfg, err := re.backendConfigLoader.LoadBackendConfigFileByNameDefaultOptions(input.ModelName(nil), re.applicationConfig)
+	input := initializer()
+	if input == nil {
+		return fmt.Errorf("unable to initialize body")
+	}
+	if err := ctx.BodyParser(input); err != nil {
+		return fmt.Errorf("failed parsing request body: %w", err)
+	}
 
-		if err != nil {
-			log.Err(err)
-			log.Warn().Msgf("Model Configuration File not found for %q", input.ModelName(nil))
-		} else if cfg.Model == "" && input.ModelName(nil) != "" {
-			log.Debug().Str("input.ModelName", input.ModelName(nil)).Msg("config does not include model, using input")
-			cfg.Model = input.ModelName(nil)
+	// If this request doesn't have an associated model name, fetch it from earlier in the middleware chain
+	if input.ModelName(nil) == "" {
+		localModelName, ok := ctx.Locals(CONTEXT_LOCALS_KEY_MODEL_NAME).(string)
+		if ok && localModelName != "" {
+			log.Debug().Str("context localModelName", localModelName).Msg("overriding empty model name in request body with value found earlier in middleware chain")
+			input.ModelName(&localModelName)
 		}
+	}
+	span.SetAttributes(attribute.String("model", input.ModelName(nil)))
+
+	if err := CheckModelAllowed(ctx, input.ModelName(nil)); err != nil {
+		return err
+	}
 
-		ctx.Locals(CONTEXT_LOCALS_KEY_LOCALAI_REQUEST, input)
-		ctx.Locals(CONTEXT_LOCALS_KEY_MODEL_CONFIG, cfg)
+	cfg, err := re.backendConfigLoader.LoadBackendConfigFileByNameDefaultOptions(input.ModelName(nil), re.applicationConfig)
 
-		return ctx.Next()
+	if err != nil {
+		log.Err(err)
+		log.Warn().Msgf("Model Configuration File not found for %q", input.ModelName(nil))
+	} else if cfg.Model == "" && input.ModelName(nil) != "" {
+		log.Debug().Str("input.ModelName", input.ModelName(nil)).Msg("config does not include model, using input")
+		cfg.Model = input.ModelName(nil)
 	}
+
+	// Refuse the request right away rather than making it wait for the load of the model
+	if re.applicationConfig.RejectRequestsWhileLoading && cfg != nil {
+		if err := re.modelLoader.LoadingError(cfg.Name); err != nil {
+			return err
+		}
+	}
+
+	ctx.Locals(CONTEXT_LOCALS_KEY_LOCALAI_REQUEST, input)
+	ctx.Locals(CONTEXT_LOCALS_KEY_MODEL_CONFIG, cfg)
+
+	return nil
 }
 
 func (re *RequestExtractor) SetOpenAIRequest(ctx *fiber.Ctx) error {
+	if err := re.setOpenAIRequest(ctx); err != nil {
+		return err
+	}
+	return ctx.Next()
+}
+
+func (re *RequestExtractor) setOpenAIRequest(ctx *fiber.Ctx) error {
+	span := startSpan(ctx, "RequestExtractor.SetOpenAIRequest")
+	defer span.End()
+
 	input, ok := ctx.Locals(CONTEXT_LOCALS_KEY_LOCALAI_REQUEST).(*schema.OpenAIRequest)
 	if !ok || input.Model == "" {
 		return fiber.ErrBadRequest
@@ -164,11 +210,25 @@ func (re *RequestExtractor) SetOpenAIRequest(ctx *fiber.Ctx) error {
 	c1, cancel := context.WithCancel(re.applicationConfig.Context)
 	// Add the correlation ID to the new context
 	ctxWithCorrelationID := context.WithValue(c1, CorrelationIDKey, correlationID)
+	// Continue the trace of the request in the backend calls
+	ctxWithCorrelationID = trace.ContextWithSpan(ctxWithCorrelationID, trace.SpanFromContext(ctx.UserContext()))
+	// Account the token usage to the API key, if any
+	if recorder, ok := ctx.Locals(CONTEXT_LOCALS_KEY_USAGE_RECORDER).(services.UsageRecorder); ok {
+		ctxWithCorrelationID = services.WithUsageRecorder(ctxWithCorrelationID, recorder)
+	}
+
+	// Queue the request with the priority of the API key, or else the one it asks for
+	priority, err := requestPriority(ctx)
+	if err != nil {
+		cancel()
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	ctxWithCorrelationID = backend.WithPriority(ctxWithCorrelationID, priority)
 
 	input.Context = ctxWithCorrelationID
 	input.Cancel = cancel
 
-	err := mergeOpenAIRequestAndBackendConfig(cfg, input)
+	err = mergeOpenAIRequestAndBackendConfig(cfg, input)
 	if err != nil {
 		return err
 	}
@@ -181,7 +241,15 @@ func (re *RequestExtractor) SetOpenAIRequest(ctx *fiber.Ctx) error {
 	ctx.Locals(CONTEXT_LOCALS_KEY_LOCALAI_REQUEST, input)
 	ctx.Locals(CONTEXT_LOCALS_KEY_MODEL_CONFIG, cfg)
 
-	return ctx.Next()
+	return nil
+}
+
+// requestPriority returns the queueing priority of the request: the one of its API key if set, else the X-Priority header
+func requestPriority(ctx *fiber.Ctx) (backend.Priority, error) {
+	if policy := GetApiKeyPolicy(ctx); policy != nil && policy.Priority != "" {
+		return backend.ParsePriority(policy.Priority)
+	}
+	return backend.ParsePriority(ctx.Get("X-Priority"))
 }
 
 func mergeOpenAIRequestAndBackendConfig(config *config.BackendConfig, input *schema.OpenAIRequest) error {
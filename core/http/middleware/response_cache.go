@@ -0,0 +1,259 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mudler/LocalAI/core/backend"
+	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/core/services"
+	"github.com/mudler/LocalAI/pkg/model"
+	"github.com/mudler/LocalAI/pkg/store"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// ResponseCacheHeader reports the result of the response cache lookup: HIT, MISS or BYPASS
+	ResponseCacheHeader = "X-Cache"
+	// ResponseCacheBypassHeader skips the response cache when set to "true", as does "Cache-Control: no-cache, no-store"
+	ResponseCacheBypassHeader = "X-Cache-Bypass"
+
+	responseCacheHit    = "hit"
+	responseCacheMiss   = "miss"
+	responseCacheBypass = "bypass"
+
+	// responseCacheTopK is the number of similar requests looked up, as the closest ones may have expired or other parameters
+	responseCacheTopK = 5
+)
+
+// responseCacheEntry is the value stored in the cache for each request
+type responseCacheEntry struct {
+	// Params is the hash of the parameters of the request other than its prompt, which must match exactly
+	Params    string          `json:"params"`
+	ExpiresAt int64           `json:"expires_at,omitempty"`
+	Response  json.RawMessage `json:"response"`
+}
+
+// ResponseCache answers the chat and completion requests from the semantic cache of the model, when enabled in its config.
+// The normalized prompt of the request is embedded and looked up in a local-store namespace; when a previous request is
+// similar enough, and had the same parameters, its response is returned without running the inference.
+// "Cache-Control: no-cache" skips the lookup, "Cache-Control: no-store" does not cache the response.
+// It must be registered after SetOpenAIRequest.
+func ResponseCache(cl *config.BackendConfigLoader, ml *model.ModelLoader, appConfig *config.ApplicationConfig, metrics *services.MaxGPTMetricsService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		input, ok := c.Locals(CONTEXT_LOCALS_KEY_LOCALAI_REQUEST).(*schema.OpenAIRequest)
+		if !ok || input == nil {
+			return c.Next()
+		}
+		cfg, ok := c.Locals(CONTEXT_LOCALS_KEY_MODEL_CONFIG).(*config.BackendConfig)
+		if !ok || cfg == nil || !cfg.ResponseCache.Enabled {
+			return c.Next()
+		}
+
+		observe := func(result string) {
+			c.Set(ResponseCacheHeader, strings.ToUpper(result))
+			if metrics != nil {
+				metrics.ObserveResponseCache(cfg.Name, result)
+			}
+		}
+
+		noCache, noStore := responseCacheDirectives(c)
+		text := responseCacheText(input, cfg)
+		if text == "" || input.Stream || (noCache && noStore) {
+			observe(responseCacheBypass)
+			return c.Next()
+		}
+
+		embedding, err := responseCacheEmbedding(input.Context, text, cfg, cl, ml, appConfig)
+		if err != nil {
+			log.Warn().Err(err).Str("model", cfg.Name).Msg("unable to embed the request for the response cache")
+			observe(responseCacheBypass)
+			return c.Next()
+		}
+		owner := ""
+		if policy := GetApiKeyPolicy(c); policy != nil && !cfg.ResponseCache.Shared {
+			owner = policy.ID()
+		}
+		params := responseCacheParams(input, owner)
+
+		if !noCache {
+			response, err := responseCacheLookup(c, cl, ml, appConfig, cfg, embedding, params)
+			if err != nil {
+				log.Warn().Err(err).Str("model", cfg.Name).Msg("unable to look up the response cache")
+			}
+			if response != nil {
+				observe(responseCacheHit)
+				c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+				return c.Send(response)
+			}
+		}
+
+		observe(responseCacheMiss)
+		if err := c.Next(); err != nil {
+			return err
+		}
+
+		if noStore || c.Response().StatusCode() != fiber.StatusOK || c.Response().IsBodyStream() ||
+			!strings.HasPrefix(string(c.Response().Header.ContentType()), fiber.MIMEApplicationJSON) {
+			return nil
+		}
+		entry := responseCacheEntry{
+			Params:   params,
+			Response: append(json.RawMessage{}, c.Response().Body()...),
+		}
+		if ttl := cfg.ResponseCache.GetTTL(); ttl > 0 {
+			entry.ExpiresAt = time.Now().Add(ttl).Unix()
+		}
+		if err := responseCacheStore(c, cl, ml, appConfig, cfg, embedding, entry); err != nil {
+			log.Warn().Err(err).Str("model", cfg.Name).Msg("unable to store the response in the response cache")
+		}
+		return nil
+	}
+}
+
+// responseCacheDirectives returns whether the request asks to skip the cache lookup, and to not cache the response
+func responseCacheDirectives(c *fiber.Ctx) (noCache bool, noStore bool) {
+	if strings.EqualFold(c.Get(ResponseCacheBypassHeader), "true") {
+		return true, true
+	}
+	for _, d := range strings.Split(c.Get(fiber.HeaderCacheControl), ",") {
+		switch strings.ToLower(strings.TrimSpace(d)) {
+		case "no-cache":
+			noCache = true
+		case "no-store":
+			noStore = true
+		}
+	}
+	return noCache, noStore
+}
+
+// responseCacheText returns the normalized prompt of the request, the text that is embedded to look it up.
+// It is empty when the request can't be cached, e.g. when it carries images.
+func responseCacheText(input *schema.OpenAIRequest, cfg *config.BackendConfig) string {
+	var text []string
+	if len(input.Messages) > 0 {
+		for _, m := range input.Messages {
+			if len(m.StringImages) > 0 || len(m.StringVideos) > 0 || len(m.StringAudios) > 0 {
+				return ""
+			}
+			text = append(text, m.Role+": "+normalizeResponseCacheText(m.StringContent))
+		}
+	} else {
+		for _, p := range cfg.PromptStrings {
+			text = append(text, normalizeResponseCacheText(p))
+		}
+	}
+	return strings.TrimSpace(strings.Join(text, "\n"))
+}
+
+func normalizeResponseCacheText(s string) string {
+	return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+}
+
+// responseCacheParams returns the hash of everything in the request but its prompt, and of the ID of the API key
+// whose responses it can be answered from (none when they are shared). Chat and completion requests are told apart
+// by their messages, which are set for chat requests only.
+func responseCacheParams(input *schema.OpenAIRequest, owner string) string {
+	params := *input
+	params.Context = nil
+	params.Cancel = nil
+	params.Prompt = nil
+	params.Stream = false
+	params.Messages = nil
+	dat, err := json.Marshal(struct {
+		Chat    bool                  `json:"chat"`
+		Owner   string                `json:"owner,omitempty"`
+		Request *schema.OpenAIRequest `json:"request"`
+	}{len(input.Messages) > 0, owner, &params})
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(dat)
+	return hex.EncodeToString(sum[:])
+}
+
+func responseCacheEmbedding(ctx context.Context, text string, cfg *config.BackendConfig, cl *config.BackendConfigLoader, ml *model.ModelLoader, appConfig *config.ApplicationConfig) ([]float32, error) {
+	if cfg.ResponseCache.EmbeddingsModel == "" {
+		return nil, fmt.Errorf("no embeddings model configured for the response cache")
+	}
+	embeddingsConfig, err := cl.LoadBackendConfigFileByNameDefaultOptions(cfg.ResponseCache.EmbeddingsModel, appConfig)
+	if err != nil {
+		return nil, err
+	}
+	embedFn, err := backend.ModelEmbedding(ctx, text, []int{}, ml, *embeddingsConfig, appConfig)
+	if err != nil {
+		return nil, err
+	}
+	return embedFn()
+}
+
+func responseCacheStoreName(cfg *config.BackendConfig) string {
+	if cfg.ResponseCache.Store != "" {
+		return cfg.ResponseCache.Store
+	}
+	return "response-cache-" + cfg.Name
+}
+
+// responseCacheLookup returns the response cached for the closest request with the same parameters, nil if there is none.
+// Expired entries found on the way are deleted.
+func responseCacheLookup(c *fiber.Ctx, cl *config.BackendConfigLoader, ml *model.ModelLoader, appConfig *config.ApplicationConfig, cfg *config.BackendConfig, embedding []float32, params string) (json.RawMessage, error) {
+	sb, err := backend.StoreBackend(ml, cl, appConfig, responseCacheStoreName(cfg), "")
+	if err != nil {
+		return nil, err
+	}
+	// The loader must be released before the inference runs
+	defer ml.Close()
+
+	keys, values, similarities, err := store.Find(c.Context(), sb, embedding, responseCacheTopK)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	expired := [][]float32{}
+	var response json.RawMessage
+	for i := range values {
+		if similarities[i] < cfg.ResponseCache.GetThreshold() {
+			continue
+		}
+		var entry responseCacheEntry
+		if err := json.Unmarshal(values[i], &entry); err != nil {
+			continue
+		}
+		if entry.ExpiresAt > 0 && entry.ExpiresAt <= now {
+			expired = append(expired, keys[i])
+			continue
+		}
+		if entry.Params == params {
+			response = entry.Response
+			break
+		}
+	}
+
+	if len(expired) > 0 {
+		if err := store.DeleteCols(c.Context(), sb, expired); err != nil {
+			log.Warn().Err(err).Str("model", cfg.Name).Msg("unable to delete the expired responses from the response cache")
+		}
+	}
+	return response, nil
+}
+
+func responseCacheStore(c *fiber.Ctx, cl *config.BackendConfigLoader, ml *model.ModelLoader, appConfig *config.ApplicationConfig, cfg *config.BackendConfig, embedding []float32, entry responseCacheEntry) error {
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	sb, err := backend.StoreBackend(ml, cl, appConfig, responseCacheStoreName(cfg), "")
+	if err != nil {
+		return err
+	}
+	defer ml.Close()
+	return store.SetSingle(c.Context(), sb, embedding, value)
+}
@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/core/schema"
+	"github.com/stretchr/testify/require"
+)
+
+func newResponseCacheApp(input *schema.OpenAIRequest, cfg *config.BackendConfig) *fiber.App {
+	app := fiber.New()
+	app.Post("/v1/chat/completions", func(c *fiber.Ctx) error {
+		c.Locals(CONTEXT_LOCALS_KEY_LOCALAI_REQUEST, input)
+		c.Locals(CONTEXT_LOCALS_KEY_MODEL_CONFIG, cfg)
+		return c.Next()
+	}, ResponseCache(nil, nil, config.NewApplicationConfig(), nil), func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"ok": true})
+	})
+	return app
+}
+
+func TestResponseCacheBypass(t *testing.T) {
+	input := &schema.OpenAIRequest{Messages: []schema.Message{{Role: "user", StringContent: "What is LocalAI?"}}}
+	cfg := &config.BackendConfig{Name: "model"}
+
+	// Disabled for the model
+	resp, err := newResponseCacheApp(input, cfg).Test(httptest.NewRequest(fiber.MethodPost, "/v1/chat/completions", nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	require.Empty(t, resp.Header.Get(ResponseCacheHeader))
+
+	cfg.ResponseCache.Enabled = true
+	req := httptest.NewRequest(fiber.MethodPost, "/v1/chat/completions", nil)
+	req.Header.Set(ResponseCacheBypassHeader, "true")
+	resp, err = newResponseCacheApp(input, cfg).Test(req)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	require.Equal(t, "BYPASS", resp.Header.Get(ResponseCacheHeader))
+
+	input.Stream = true
+	resp, err = newResponseCacheApp(input, cfg).Test(httptest.NewRequest(fiber.MethodPost, "/v1/chat/completions", nil))
+	require.NoError(t, err)
+	require.Equal(t, "BYPASS", resp.Header.Get(ResponseCacheHeader))
+}
+
+func TestResponseCacheText(t *testing.T) {
+	cfg := &config.BackendConfig{}
+	a := responseCacheText(&schema.OpenAIRequest{Messages: []schema.Message{
+		{Role: "system", StringContent: "You are helpful."},
+		{Role: "user", StringContent: "  What is   LocalAI?\n"},
+	}}, cfg)
+	b := responseCacheText(&schema.OpenAIRequest{Messages: []schema.Message{
+		{Role: "system", StringContent: "you are helpful."},
+		{Role: "user", StringContent: "what is localai?"},
+	}}, cfg)
+	require.Equal(t, "system: you are helpful.\nuser: what is localai?", a)
+	require.Equal(t, a, b)
+
+	require.Empty(t, responseCacheText(&schema.OpenAIRequest{Messages: []schema.Message{
+		{Role: "user", StringContent: "What is this?", StringImages: []string{"data"}},
+	}}, cfg))
+
+	cfg.PromptStrings = []string{"Once upon a  time"}
+	require.Equal(t, "once upon a time", responseCacheText(&schema.OpenAIRequest{}, cfg))
+}
+
+func TestResponseCacheParams(t *testing.T) {
+	request := func(content string, temperature float64) *schema.OpenAIRequest {
+		r := &schema.OpenAIRequest{Messages: []schema.Message{{Role: "user", StringContent: content}}}
+		r.Temperature = &temperature
+		return r
+	}
+
+	require.Equal(t, responseCacheParams(request("a", 0.2), ""), responseCacheParams(request("b", 0.2), ""))
+	require.NotEqual(t, responseCacheParams(request("a", 0.2), ""), responseCacheParams(request("a", 0.7), ""))
+
+	streamed := request("a", 0.2)
+	streamed.Stream = true
+	require.Equal(t, responseCacheParams(request("a", 0.2), ""), responseCacheParams(streamed, ""))
+
+	// Chat and completion requests don't share responses
+	completion := request("a", 0.2)
+	completion.Messages = nil
+	require.NotEqual(t, responseCacheParams(request("a", 0.2), ""), responseCacheParams(completion, ""))
+
+	// Nor do the API keys
+	require.NotEqual(t, responseCacheParams(request("a", 0.2), "key-1"), responseCacheParams(request("a", 0.2), "key-2"))
+	require.NotEqual(t, responseCacheParams(request("a", 0.2), "key-1"), responseCacheParams(request("a", 0.2), ""))
+}
+
+func TestResponseCacheDirectives(t *testing.T) {
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		noCache, noStore := responseCacheDirectives(c)
+		if noCache {
+			c.Append("X-Directives", "no-cache")
+		}
+		if noStore {
+			c.Append("X-Directives", "no-store")
+		}
+		return nil
+	})
+
+	for header, expected := range map[string]string{
+		"":                   "",
+		"no-cache":           "no-cache",
+		"No-Store":           "no-store",
+		"no-cache, no-store": "no-cache, no-store",
+		"max-age=0":          "",
+	} {
+		req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+		req.Header.Set(fiber.HeaderCacheControl, header)
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		require.Equal(t, expected, resp.Header.Get("X-Directives"), header)
+	}
+}
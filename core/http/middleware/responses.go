@@ -0,0 +1,197 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/core/services"
+	"github.com/mudler/LocalAI/pkg/functions"
+)
+
+const CONTEXT_LOCALS_KEY_RESPONSES_REQUEST = "RESPONSES_REQUEST"
+const CONTEXT_LOCALS_KEY_RESPONSES_CONVERSATION = "RESPONSES_CONVERSATION"
+
+// SetOpenResponsesRequest translates a Responses API request into a chat completion request:
+// the conversation of previous_response_id (if any) is replayed and followed by the new input items.
+// The original request and the conversation are kept in the context locals, then the chat request
+// goes through the same merging as SetOpenAIRequest.
+func (re *RequestExtractor) SetOpenResponsesRequest(store services.ResponseStore) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		input, ok := ctx.Locals(CONTEXT_LOCALS_KEY_LOCALAI_REQUEST).(*schema.OpenResponsesRequest)
+		if !ok || input.Model == "" {
+			return fiber.ErrBadRequest
+		}
+
+		conversation := []schema.Message{}
+		if input.PreviousResponseID != "" {
+			previous, err := store.Get(input.PreviousResponseID, GetApiKeyPolicy(ctx))
+			if err != nil {
+				switch {
+				case errors.Is(err, services.ErrResponseNotFound):
+					return fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("previous response %q not found", input.PreviousResponseID))
+				case errors.Is(err, services.ErrInvalidResponseID):
+					return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("invalid previous_response_id %q", input.PreviousResponseID))
+				}
+				return err
+			}
+			conversation = append(conversation, previous.Messages...)
+		}
+
+		messages, err := responseInputToMessages(input.Input, conversation)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		conversation = append(conversation, messages...)
+
+		chatRequest := &schema.OpenAIRequest{
+			PredictionOptions: input.PredictionOptions,
+			Stream:            input.Stream,
+			ToolsChoice:       responseToolChoice(input.ToolChoice),
+		}
+		if input.MaxOutputTokens != nil {
+			chatRequest.Maxtokens = input.MaxOutputTokens
+		}
+		if input.Instructions != "" {
+			chatRequest.Messages = append(chatRequest.Messages, schema.Message{Role: "system", Content: input.Instructions})
+		}
+		// the merge decodes message contents in place, keep the stored conversation untouched
+		chatRequest.Messages = append(chatRequest.Messages, conversation...)
+
+		for _, t := range input.Tools {
+			if t.Type != "function" {
+				continue
+			}
+			chatRequest.Tools = append(chatRequest.Tools, functions.Tool{Type: "function", Function: t.ToFunction()})
+		}
+
+		if input.Text != nil && input.Text.Format != nil {
+			chatRequest.ResponseFormat = responseTextFormat(input.Text.Format)
+		}
+
+		ctx.Locals(CONTEXT_LOCALS_KEY_RESPONSES_REQUEST, input)
+		ctx.Locals(CONTEXT_LOCALS_KEY_RESPONSES_CONVERSATION, conversation)
+		ctx.Locals(CONTEXT_LOCALS_KEY_LOCALAI_REQUEST, chatRequest)
+
+		return re.SetOpenAIRequest(ctx)
+	}
+}
+
+// responseInputToMessages converts the input of a Responses API request (a string or a list of items) to chat messages.
+// The function calls of the previous conversation are needed to name the outputs of the calls made before it.
+func responseInputToMessages(input interface{}, conversation []schema.Message) ([]schema.Message, error) {
+	switch in := input.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []schema.Message{{Role: "user", Content: in}}, nil
+	case []interface{}:
+		dat, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		items := []schema.ResponseItem{}
+		if err := json.Unmarshal(dat, &items); err != nil {
+			return nil, fmt.Errorf("invalid input items: %w", err)
+		}
+
+		// the tool messages are named after the function, function_call_output items only carry the call ID
+		functionNames := map[string]string{}
+		for _, m := range conversation {
+			for _, call := range m.ToolCalls {
+				functionNames[call.ID] = call.FunctionCall.Name
+			}
+		}
+		for _, item := range items {
+			if item.Type == "function_call" {
+				functionNames[item.CallID] = item.Name
+			}
+		}
+
+		messages := []schema.Message{}
+		for _, item := range items {
+			switch item.Type {
+			case "", "message":
+				messages = append(messages, schema.Message{Role: item.Role, Content: responseContentToChatContent(item.Content)})
+			case "function_call":
+				messages = append(messages, schema.Message{
+					Role: "assistant",
+					ToolCalls: []schema.ToolCall{{
+						ID:           item.CallID,
+						Type:         "function",
+						FunctionCall: schema.FunctionCall{Name: item.Name, Arguments: item.Arguments},
+					}},
+				})
+			case "function_call_output":
+				name, ok := functionNames[item.CallID]
+				if !ok {
+					return nil, fmt.Errorf("no function call matches the output of call %q", item.CallID)
+				}
+				messages = append(messages, schema.Message{Role: "tool", Name: name, ToolCallID: item.CallID, Content: item.Output})
+			case "reasoning":
+				// reasoning items are not replayed to the model
+			default:
+				return nil, fmt.Errorf("unsupported input item type %q", item.Type)
+			}
+		}
+		return messages, nil
+	default:
+		return nil, fmt.Errorf("input must be a string or a list of items")
+	}
+}
+
+// responseContentToChatContent maps input_text/output_text/input_image parts to the chat completion content format
+func responseContentToChatContent(content interface{}) interface{} {
+	parts, ok := content.([]interface{})
+	if !ok {
+		return content
+	}
+
+	res := []interface{}{}
+	for _, p := range parts {
+		part, ok := p.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		switch part["type"] {
+		case "input_text", "output_text", "text":
+			res = append(res, map[string]interface{}{"type": "text", "text": part["text"]})
+		case "input_image":
+			res = append(res, map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": part["image_url"]}})
+		}
+	}
+	return res
+}
+
+// responseToolChoice maps {"type": "function", "name": "x"} to the chat completion format, other values are left untouched
+func responseToolChoice(choice interface{}) interface{} {
+	c, ok := choice.(map[string]interface{})
+	if !ok {
+		return choice
+	}
+	name, ok := c["name"]
+	if !ok {
+		return choice
+	}
+	return map[string]interface{}{
+		"type":     "function",
+		"function": map[string]interface{}{"name": name},
+	}
+}
+
+// responseTextFormat maps text.format to the chat completion response_format
+func responseTextFormat(format map[string]interface{}) interface{} {
+	if format["type"] != "json_schema" {
+		return format
+	}
+	return map[string]interface{}{
+		"type": "json_schema",
+		"json_schema": map[string]interface{}{
+			"name":   format["name"],
+			"strict": format["strict"],
+			"schema": format["schema"],
+		},
+	}
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/mudler/LocalAI/core/schema"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponseInputToMessages(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		input    string
+		expected []schema.Message
+	}{
+		{
+			name:     "string input",
+			input:    `"hello"`,
+			expected: []schema.Message{{Role: "user", Content: "hello"}},
+		},
+		{
+			name:  "message items",
+			input: `[{"role": "user", "content": [{"type": "input_text", "text": "hi"}]}, {"type": "message", "role": "assistant", "content": "hey"}]`,
+			expected: []schema.Message{
+				{Role: "user", Content: []interface{}{map[string]interface{}{"type": "text", "text": "hi"}}},
+				{Role: "assistant", Content: "hey"},
+			},
+		},
+		{
+			name:  "function call round trip",
+			input: `[{"type": "function_call", "call_id": "call_1", "name": "get_weather", "arguments": "{}"}, {"type": "function_call_output", "call_id": "call_1", "output": "sunny"}]`,
+			expected: []schema.Message{
+				{Role: "assistant", ToolCalls: []schema.ToolCall{{ID: "call_1", Type: "function", FunctionCall: schema.FunctionCall{Name: "get_weather", Arguments: "{}"}}}},
+				{Role: "tool", Name: "get_weather", ToolCallID: "call_1", Content: "sunny"},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var input interface{}
+			require.NoError(t, json.Unmarshal([]byte(tc.input), &input))
+
+			messages, err := responseInputToMessages(input, nil)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, messages)
+		})
+	}
+
+	_, err := responseInputToMessages([]interface{}{map[string]interface{}{"type": "computer_call"}}, nil)
+	require.Error(t, err)
+
+	// the function call was returned by the previous response
+	output := []interface{}{map[string]interface{}{"type": "function_call_output", "call_id": "call_2", "output": "rainy"}}
+	previous := []schema.Message{{Role: "assistant", ToolCalls: []schema.ToolCall{{ID: "call_2", Type: "function", FunctionCall: schema.FunctionCall{Name: "get_weather"}}}}}
+	messages, err := responseInputToMessages(output, previous)
+	require.NoError(t, err)
+	require.Equal(t, []schema.Message{{Role: "tool", Name: "get_weather", ToolCallID: "call_2", Content: "rainy"}}, messages)
+
+	_, err = responseInputToMessages(output, nil)
+	require.Error(t, err)
+}
+
+func TestResponseToolChoice(t *testing.T) {
+	require.Equal(t, "auto", responseToolChoice("auto"))
+	require.Equal(t,
+		map[string]interface{}{"type": "function", "function": map[string]interface{}{"name": "get_weather"}},
+		responseToolChoice(map[string]interface{}{"type": "function", "name": "get_weather"}),
+	)
+}
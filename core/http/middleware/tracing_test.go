@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+	})
+
+	app := fiber.New()
+	app.Use(Tracing())
+	app.Post("/v1/chat/completions", func(c *fiber.Ctx) error {
+		span := startSpan(c, "RequestExtractor.SetOpenAIRequest")
+		span.End()
+		return c.SendString("ok")
+	})
+	app.Get("/fail", func(c *fiber.Ctx) error {
+		return fiber.NewError(fiber.StatusServiceUnavailable, "loading")
+	})
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+	child, server := spans[0], spans[1]
+	require.Equal(t, "RequestExtractor.SetOpenAIRequest", child.Name)
+	require.Equal(t, "POST /v1/chat/completions", server.Name)
+	require.Equal(t, trace.SpanKindServer, server.SpanKind)
+	// The request span continues the trace of the caller, and is the parent of the steps of the request
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext.TraceID().String())
+	require.Equal(t, "00f067aa0ba902b7", server.Parent.SpanID().String())
+	require.Equal(t, server.SpanContext.SpanID(), child.Parent.SpanID())
+
+	exporter.Reset()
+	resp, err = app.Test(httptest.NewRequest("GET", "/fail", nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusServiceUnavailable, resp.StatusCode)
+
+	spans = exporter.GetSpans()
+	require.Len(t, spans, 1)
+	require.Equal(t, "GET /fail", spans[0].Name)
+	require.Equal(t, "Error", spans[0].Status.Code.String())
+	require.False(t, spans[0].Parent.IsValid())
+}
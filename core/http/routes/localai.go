@@ -17,7 +17,10 @@ func RegisterMaxGPTRoutes(router *fiber.App,
 	cl *config.BackendConfigLoader,
 	ml *model.ModelLoader,
 	appConfig *config.ApplicationConfig,
-	galleryService *services.GalleryService) {
+	galleryService *services.GalleryService,
+	collectionService *services.CollectionService,
+	apiKeyUsageService *services.ApiKeyUsageService,
+	auditService *services.AuditService) {
 
 	router.Get("/swagger/*", swagger.HandlerDefault) // default
 
@@ -60,10 +63,20 @@ func RegisterMaxGPTRoutes(router *fiber.App,
 	router.Post("/v1/vad", vadChain...)
 
 	// Stores
-	router.Post("/stores/set", localai.StoresSetEndpoint(ml, appConfig))
-	router.Post("/stores/delete", localai.StoresDeleteEndpoint(ml, appConfig))
-	router.Post("/stores/get", localai.StoresGetEndpoint(ml, appConfig))
-	router.Post("/stores/find", localai.StoresFindEndpoint(ml, appConfig))
+	router.Post("/stores/set", localai.StoresSetEndpoint(ml, cl, appConfig))
+	router.Post("/stores/delete", localai.StoresDeleteEndpoint(ml, cl, appConfig))
+	router.Post("/stores/get", localai.StoresGetEndpoint(ml, cl, appConfig))
+	router.Post("/stores/find", localai.StoresFindEndpoint(ml, cl, appConfig))
+	router.Post("/stores/snapshot", localai.StoresSnapshotEndpoint(ml, cl, appConfig))
+	router.Post("/stores/restore", localai.StoresRestoreEndpoint(ml, cl, appConfig))
+
+	// RAG collections, built on the stores
+	router.Post("/stores/collections", localai.CreateCollectionEndpoint(collectionService, cl, appConfig))
+	router.Get("/stores/collections", localai.ListCollectionsEndpoint(collectionService))
+	router.Get("/stores/collections/:name", localai.GetCollectionEndpoint(collectionService))
+	router.Delete("/stores/collections/:name", localai.DeleteCollectionEndpoint(collectionService, ml, appConfig))
+	router.Post("/stores/collections/:name/documents", localai.IngestCollectionEndpoint(collectionService, cl, ml, appConfig))
+	router.Post("/stores/collections/:name/query", localai.QueryCollectionEndpoint(collectionService, cl, ml, appConfig))
 
 	if !appConfig.DisableMetrics {
 		router.Get("/metrics", localai.MaxGPTMetricsEndpoint())
@@ -78,15 +91,28 @@ func RegisterMaxGPTRoutes(router *fiber.App,
 	// TODO: Should these use standard middlewares? Refactor later, they are extremely simple.
 	backendMonitorService := services.NewBackendMonitorService(ml, cl, appConfig) // Split out for now
 	router.Get("/backend/monitor", localai.BackendMonitorEndpoint(backendMonitorService))
-	router.Post("/backend/shutdown", localai.BackendShutdownEndpoint(backendMonitorService))
+	router.Post("/backend/shutdown", middleware.RequireAdminApiKey(appConfig), localai.BackendShutdownEndpoint(backendMonitorService))
 	// The v1/* urls are exactly the same as above - makes local e2e testing easier if they are registered.
 	router.Get("/v1/backend/monitor", localai.BackendMonitorEndpoint(backendMonitorService))
-	router.Post("/v1/backend/shutdown", localai.BackendShutdownEndpoint(backendMonitorService))
+	router.Post("/v1/backend/shutdown", middleware.RequireAdminApiKey(appConfig), localai.BackendShutdownEndpoint(backendMonitorService))
+	router.Get("/backend/logs/:model", middleware.RequireAdminApiKey(appConfig), middleware.RequireModelAllowed("model"), localai.BackendLogsEndpoint(ml))
+
+	// Models lifecycle, loading and stopping the backends affects the requests of every key
+	router.Post("/models/:name/load", middleware.RequireAdminApiKey(appConfig), middleware.RequireModelAllowed("name"), localai.ModelLoadEndpoint(cl, ml, appConfig))
+	router.Post("/models/:name/unload", middleware.RequireAdminApiKey(appConfig), middleware.RequireModelAllowed("name"), localai.ModelUnloadEndpoint(ml))
+	router.Get("/models/:name/status", middleware.RequireModelAllowed("name"), localai.ModelStatusEndpoint(cl, ml))
 
 	// p2p
 	router.Get("/api/p2p", localai.ShowP2PNodes(appConfig))
 	router.Get("/api/p2p/token", localai.ShowP2PToken(appConfig))
 
+	// API keys usage
+	router.Get("/api/usage", middleware.RequireAdminApiKey(appConfig), localai.ApiKeyUsageEndpoint(apiKeyUsageService))
+
+	if auditService != nil {
+		router.Get("/api/audit", middleware.RequireAdminApiKey(appConfig), localai.AuditLogEndpoint(auditService))
+	}
+
 	router.Get("/version", func(c *fiber.Ctx) error {
 		return c.JSON(struct {
 			Version string `json:"version"`
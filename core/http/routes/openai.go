@@ -8,11 +8,15 @@ import (
 	"github.com/mudler/LocalAI/core/http/endpoints/openai"
 	"github.com/mudler/LocalAI/core/http/middleware"
 	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/core/services"
 )
 
 func RegisterOpenAIRoutes(app *fiber.App,
 	re *middleware.RequestExtractor,
-	application *application.Application) {
+	responseCache fiber.Handler,
+	application *application.Application,
+	fileService *services.FileService,
+	batchService *services.BatchService) {
 	// openAI compatible API endpoint
 
 	// realtime
@@ -26,11 +30,24 @@ func RegisterOpenAIRoutes(app *fiber.App,
 		re.BuildFilteredFirstAvailableDefaultModel(config.BuildUsecaseFilterFn(config.FLAG_CHAT)),
 		re.SetModelAndConfig(func() schema.MaxGPTRequest { return new(schema.OpenAIRequest) }),
 		re.SetOpenAIRequest,
-		openai.ChatEndpoint(application.BackendLoader(), application.ModelLoader(), application.TemplatesEvaluator(), application.ApplicationConfig()),
+		responseCache,
+		openai.ChatEndpoint(application.BackendLoader(), application.ModelLoader(), application.TemplatesEvaluator(), application.ApplicationConfig(), application.CollectionService()),
 	}
 	app.Post("/v1/chat/completions", chatChain...)
 	app.Post("/chat/completions", chatChain...)
 
+	// responses
+	responsesChain := []fiber.Handler{
+		re.BuildFilteredFirstAvailableDefaultModel(config.BuildUsecaseFilterFn(config.FLAG_CHAT)),
+		re.SetModelAndConfig(func() schema.MaxGPTRequest { return new(schema.OpenResponsesRequest) }),
+		re.SetOpenResponsesRequest(application.ResponseStore()),
+		openai.ResponsesEndpoint(application.BackendLoader(), application.ModelLoader(), application.TemplatesEvaluator(), application.ApplicationConfig(), application.ResponseStore()),
+	}
+	app.Post("/v1/responses", responsesChain...)
+	app.Post("/responses", responsesChain...)
+	app.Get("/v1/responses/:id", openai.GetResponseEndpoint(application.ResponseStore()))
+	app.Delete("/v1/responses/:id", openai.DeleteResponseEndpoint(application.ResponseStore()))
+
 	// edit
 	editChain := []fiber.Handler{
 		re.BuildFilteredFirstAvailableDefaultModel(config.BuildUsecaseFilterFn(config.FLAG_EDIT)),
@@ -48,6 +65,7 @@ func RegisterOpenAIRoutes(app *fiber.App,
 		re.BuildConstantDefaultModelNameMiddleware("gpt-4o"),
 		re.SetModelAndConfig(func() schema.MaxGPTRequest { return new(schema.OpenAIRequest) }),
 		re.SetOpenAIRequest,
+		responseCache,
 		openai.CompletionEndpoint(application.BackendLoader(), application.ModelLoader(), application.TemplatesEvaluator(), application.ApplicationConfig()),
 	}
 	app.Post("/v1/completions", completionChain...)
@@ -86,6 +104,19 @@ func RegisterOpenAIRoutes(app *fiber.App,
 		re.SetOpenAIRequest,
 		openai.ImageEndpoint(application.BackendLoader(), application.ModelLoader(), application.ApplicationConfig()))
 
+	// files
+	app.Post("/v1/files", openai.UploadFileEndpoint(fileService))
+	app.Get("/v1/files", openai.ListFilesEndpoint(fileService))
+	app.Get("/v1/files/:file_id", openai.GetFileEndpoint(fileService))
+	app.Get("/v1/files/:file_id/content", openai.GetFileContentEndpoint(fileService))
+	app.Delete("/v1/files/:file_id", openai.DeleteFileEndpoint(fileService))
+
+	// batches
+	app.Post("/v1/batches", openai.CreateBatchEndpoint(batchService))
+	app.Get("/v1/batches", openai.ListBatchesEndpoint(batchService))
+	app.Get("/v1/batches/:batch_id", openai.GetBatchEndpoint(batchService))
+	app.Post("/v1/batches/:batch_id/cancel", openai.CancelBatchEndpoint(batchService))
+
 	// List models
 	app.Get("/v1/models", openai.ListModelsEndpoint(application.BackendLoader(), application.ModelLoader(), application.ApplicationConfig()))
 	app.Get("/models", openai.ListModelsEndpoint(application.BackendLoader(), application.ModelLoader(), application.ApplicationConfig()))
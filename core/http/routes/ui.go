@@ -207,6 +207,18 @@ func RegisterUIRoutes(app *fiber.App,
 		return c.Render("views/text2image", summary)
 	})
 
+	app.Get("/logs/:model", func(c *fiber.Ctx) error {
+		summary := fiber.Map{
+			"Title":   "MaxGPT - Backend logs of " + c.Params("model"),
+			"BaseURL": utils.BaseURL(c),
+			"Model":   c.Params("model"),
+			"Version": internal.PrintableVersion(),
+		}
+
+		// Render index
+		return c.Render("views/backend_logs", summary)
+	})
+
 	app.Get("/tts/:model", func(c *fiber.Ctx) error {
 		backendConfigs := cl.GetAllBackendConfigs()
 		modelsWithoutConfig, _ := services.ListModels(cl, ml, config.NoFilterFn, services.LOOSE_ONLY)
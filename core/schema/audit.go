@@ -0,0 +1,42 @@
+package schema
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AuditRecord is the audit log entry of an inference request
+type AuditRecord struct {
+	ID            string    `json:"id"`
+	Timestamp     time.Time `json:"timestamp"`
+	Endpoint      string    `json:"endpoint"`
+	Model         string    `json:"model,omitempty"`
+	Backend       string    `json:"backend,omitempty"`
+	ApiKey        string    `json:"api_key,omitempty"` // name of the API key, never the key itself
+	CorrelationID string    `json:"correlation_id,omitempty"`
+	Status        int       `json:"status"`
+	Error         string    `json:"error,omitempty"`
+	LatencyMs     int64     `json:"latency_ms"`
+	Stream        bool      `json:"stream,omitempty"`
+
+	Request  json.RawMessage `json:"request,omitempty"`
+	Response json.RawMessage `json:"response,omitempty"`
+	Usage    *OpenAIUsage    `json:"usage,omitempty"`
+}
+
+// AuditQuery filters the audit log records, zero values match every record
+type AuditQuery struct {
+	Model  string
+	ApiKey string
+	// Status is either an HTTP status code, "success" or "error"
+	Status string
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+}
+
+type AuditRecordList struct {
+	Object  string        `json:"object"`
+	Data    []AuditRecord `json:"data"`
+	HasMore bool          `json:"has_more"`
+}
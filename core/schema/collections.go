@@ -0,0 +1,69 @@
+package schema
+
+// Collection is a named set of documents, chunked and embedded with EmbeddingsModel in a local-store
+type Collection struct {
+	Name            string `json:"name"`
+	Object          string `json:"object"`
+	EmbeddingsModel string `json:"embeddings_model"`
+	// ChunkSize and ChunkOverlap are the default chunking of the documents, in bytes
+	ChunkSize    int   `json:"chunk_size"`
+	ChunkOverlap int   `json:"chunk_overlap"`
+	CreatedAt    int64 `json:"created_at"`
+	Documents    int   `json:"documents"`
+	Chunks       int   `json:"chunks"`
+}
+
+type CollectionCreateRequest struct {
+	Name            string `json:"name"`
+	EmbeddingsModel string `json:"embeddings_model"`
+	ChunkSize       int    `json:"chunk_size,omitempty"`
+	ChunkOverlap    int    `json:"chunk_overlap,omitempty"`
+}
+
+type CollectionList struct {
+	Object string       `json:"object"`
+	Data   []Collection `json:"data"`
+}
+
+// CollectionDocument is a document to ingest in a collection
+type CollectionDocument struct {
+	// ID identifies the document in the query results, generated if empty
+	ID string `json:"id,omitempty"`
+	// Format is "text" (default), "markdown" or "pdf", for text extracted from a PDF with pages separated by form feeds
+	Format   string            `json:"format,omitempty"`
+	Text     string            `json:"text"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+type CollectionIngestRequest struct {
+	Documents []CollectionDocument `json:"documents"`
+	// ChunkSize and ChunkOverlap override the chunking of the collection
+	ChunkSize    int `json:"chunk_size,omitempty"`
+	ChunkOverlap int `json:"chunk_overlap,omitempty"`
+}
+
+type CollectionIngestResponse struct {
+	Object    string   `json:"object"`
+	Documents []string `json:"documents"`
+	Chunks    int      `json:"chunks"`
+}
+
+type CollectionQueryRequest struct {
+	Query string `json:"query"`
+	TopK  int    `json:"top_k,omitempty"`
+}
+
+// CollectionChunk is a chunk of a document, as stored in the collection and returned by queries
+type CollectionChunk struct {
+	DocumentID string            `json:"document_id"`
+	Index      int               `json:"index"`
+	Text       string            `json:"text"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+	// Score is the similarity of the chunk with the query
+	Score float32 `json:"score,omitempty"`
+}
+
+type CollectionQueryResponse struct {
+	Object string            `json:"object"`
+	Data   []CollectionChunk `json:"data"`
+}
@@ -1,7 +1,11 @@
 package schema
 
 import (
+	"encoding/json"
+	"time"
+
 	"github.com/mudler/LocalAI/core/p2p"
+	"github.com/mudler/LocalAI/pkg/model"
 	gopsutil "github.com/shirou/gopsutil/v3/process"
 )
 
@@ -65,12 +69,16 @@ type VADResponse struct {
 
 type StoreCommon struct {
 	Backend string `json:"backend,omitempty" yaml:"backend,omitempty"`
+	// Namespace scopes the request to an independent part of the store, e.g. one per tenant
+	Namespace string `json:"namespace,omitempty" yaml:"namespace,omitempty"`
 }
 type StoresSet struct {
 	Store string `json:"store,omitempty" yaml:"store,omitempty"`
 
 	Keys   [][]float32 `json:"keys" yaml:"keys"`
 	Values []string    `json:"values" yaml:"values"`
+	// Metadata[i] is the JSON object of metadata of Keys[i], to filter StoresFind on. Optional
+	Metadata []json.RawMessage `json:"metadata,omitempty" yaml:"metadata,omitempty"`
 	StoreCommon
 }
 
@@ -89,8 +97,9 @@ type StoresGet struct {
 }
 
 type StoresGetResponse struct {
-	Keys   [][]float32 `json:"keys" yaml:"keys"`
-	Values []string    `json:"values" yaml:"values"`
+	Keys     [][]float32       `json:"keys" yaml:"keys"`
+	Values   []string          `json:"values" yaml:"values"`
+	Metadata []json.RawMessage `json:"metadata,omitempty" yaml:"metadata,omitempty"`
 }
 
 type StoresFind struct {
@@ -98,13 +107,52 @@ type StoresFind struct {
 
 	Key  []float32 `json:"key" yaml:"key"`
 	Topk int       `json:"topk" yaml:"topk"`
+	// Filter only finds the keys whose metadata match it, e.g. {"lang": "en", "year": {"$gte": 2020}}
+	Filter json.RawMessage `json:"filter,omitempty" yaml:"filter,omitempty"`
 	StoreCommon
 }
 
 type StoresFindResponse struct {
-	Keys         [][]float32 `json:"keys" yaml:"keys"`
-	Values       []string    `json:"values" yaml:"values"`
-	Similarities []float32   `json:"similarities" yaml:"similarities"`
+	Keys         [][]float32       `json:"keys" yaml:"keys"`
+	Values       []string          `json:"values" yaml:"values"`
+	Similarities []float32         `json:"similarities" yaml:"similarities"`
+	Metadata     []json.RawMessage `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+}
+
+// StoresSnapshot saves or restores a store. Snapshots are named files in the snapshots directory of the stores
+// path, the persisted state of the store is used when no name is given.
+type StoresSnapshot struct {
+	Store string `json:"store,omitempty" yaml:"store,omitempty"`
+
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	StoreCommon
+}
+
+type StoresSnapshotResponse struct {
+	Store   string `json:"store" yaml:"store"`
+	Name    string `json:"name,omitempty" yaml:"name,omitempty"`
+	Entries int64  `json:"entries" yaml:"entries"`
+}
+
+// ModelLoadResponse is the state of a model once loaded or unloaded with /models/{name}/load and /models/{name}/unload
+type ModelLoadResponse struct {
+	Model  string `json:"model" yaml:"model"`
+	Loaded bool   `json:"loaded" yaml:"loaded"`
+}
+
+// ModelStatusResponse is the load state of a model, see /models/{name}/status
+type ModelStatusResponse struct {
+	Model string `json:"model" yaml:"model"`
+	// Status is one of not_loaded, loading, ready and failed
+	Status string     `json:"status" yaml:"status"`
+	Since  *time.Time `json:"since,omitempty" yaml:"since,omitempty"`
+	Error  string     `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// BackendLogsResponse has the last lines written by the backends of a model, see /backend/logs/{model}
+type BackendLogsResponse struct {
+	Model string                 `json:"model" yaml:"model"`
+	Lines []model.BackendLogLine `json:"lines" yaml:"lines"`
 }
 
 type P2PNodesResponse struct {
@@ -137,3 +185,24 @@ type Detection struct {
 	Height    float32 `json:"height"`
 	ClassName string  `json:"class_name"`
 }
+
+// ApiKeyUsage is the usage accounted to an API key
+type ApiKeyUsage struct {
+	Name             string `json:"name"`
+	Requests         int64  `json:"requests"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+	TotalTokens      int64  `json:"total_tokens"`
+	// Day (UTC, YYYY-MM-DD) the TokensToday counter refers to
+	Day         string `json:"day"`
+	TokensToday int64  `json:"tokens_today"`
+	LastUsedAt  int64  `json:"last_used_at,omitempty"`
+
+	RequestsPerMinute int `json:"requests_per_minute,omitempty"`
+	TokensPerDay      int `json:"tokens_per_day,omitempty"`
+}
+
+type ApiKeyUsageResponse struct {
+	Object string        `json:"object"`
+	Data   []ApiKeyUsage `json:"data"`
+}
@@ -25,6 +25,21 @@ type OpenAIUsage struct {
 	// Extra timing data, disabled by default as is't not a part of OpenAI specification
 	TimingPromptProcessing float64 `json:"timing_prompt_processing,omitempty"`
 	TimingTokenGeneration  float64 `json:"timing_token_generation,omitempty"`
+	// Reuse of the KV cache of the backend, only set when the prefix cache is enabled for the model
+	PromptTokensDetails *PromptTokensDetails `json:"prompt_tokens_details,omitempty"`
+	// Tokens of the reasoning, only set when the reasoning is extracted for the model
+	CompletionTokensDetails *CompletionTokensDetails `json:"completion_tokens_details,omitempty"`
+}
+
+type PromptTokensDetails struct {
+	CachedTokens int `json:"cached_tokens"`
+	// PrefixCache is "hit" when the request was routed to a slot holding a prefix of its prompt, "miss" otherwise
+	PrefixCache string `json:"prefix_cache,omitempty"`
+}
+
+type CompletionTokensDetails struct {
+	// ReasoningTokens are the completion tokens of the reasoning of the model, whether it is returned or not
+	ReasoningTokens int `json:"reasoning_tokens"`
 }
 
 type Item struct {
@@ -46,6 +61,22 @@ type OpenAIResponse struct {
 	Data    []Item   `json:"data,omitempty"`
 
 	Usage OpenAIUsage `json:"usage"`
+
+	// ToolSteps are the calls of the tools the server ran before the response (not supported by OpenAI)
+	ToolSteps []ToolStep `json:"tool_steps,omitempty"`
+}
+
+// ToolStep is a call of a tool run by the server during a chat completion, with its result fed back to the model
+type ToolStep struct {
+	// Iteration is the round of tool calls, from 1
+	Iteration int    `json:"iteration"`
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+	Result    string `json:"result,omitempty"`
+	Error     string `json:"error,omitempty"`
+	// Duration is how long the tool ran, in milliseconds
+	Duration int64 `json:"duration_ms"`
 }
 
 type Choice struct {
@@ -83,9 +114,15 @@ type Message struct {
 	// The message name (used for tools calls)
 	Name string `json:"name,omitempty" yaml:"name"`
 
+	// The ID of the tool call the message is the result of
+	ToolCallID string `json:"tool_call_id,omitempty" yaml:"tool_call_id,omitempty"`
+
 	// The message content
 	Content interface{} `json:"content" yaml:"content"`
 
+	// The reasoning of the model before its content, see the reasoning section of the model configuration
+	ReasoningContent string `json:"reasoning_content,omitempty" yaml:"reasoning_content,omitempty"`
+
 	StringContent string   `json:"string_content,omitempty" yaml:"string_content,omitempty"`
 	StringImages  []string `json:"string_images,omitempty" yaml:"string_images,omitempty"`
 	StringVideos  []string `json:"string_videos,omitempty" yaml:"string_videos,omitempty"`
@@ -112,6 +149,8 @@ type FunctionCall struct {
 type OpenAIModel struct {
 	ID     string `json:"id"`
 	Object string `json:"object"`
+	// Status is the load state of the model, see ModelStatusResponse
+	Status string `json:"status,omitempty"`
 }
 
 type ImageGenerationResponseFormat string
@@ -170,6 +209,11 @@ type OpenAIRequest struct {
 
 	Stream bool `json:"stream"`
 
+	// Collection names a RAG collection: the chunks the most relevant to the last user message
+	// are injected as a system message (not supported by OpenAI)
+	Collection     string `json:"collection,omitempty" yaml:"collection"`
+	CollectionTopK int    `json:"collection_top_k,omitempty" yaml:"collection_top_k"`
+
 	// Image (not supported by OpenAI)
 	Mode    int    `json:"mode"`
 	Quality string `json:"quality"`
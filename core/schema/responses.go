@@ -0,0 +1,130 @@
+package schema
+
+import (
+	functions "github.com/mudler/LocalAI/pkg/functions"
+)
+
+// OpenResponsesRequest is the request body of the OpenAI Responses API https://platform.openai.com/docs/api-reference/responses/create
+type OpenResponsesRequest struct {
+	PredictionOptions
+
+	// Input can be either a string or a list of ResponseItem
+	Input interface{} `json:"input" yaml:"input"`
+
+	// Instructions is inserted as the first system message of the conversation
+	Instructions string `json:"instructions,omitempty" yaml:"instructions"`
+
+	// PreviousResponseID chains this request to a stored response, replaying its conversation
+	PreviousResponseID string `json:"previous_response_id,omitempty" yaml:"previous_response_id"`
+
+	MaxOutputTokens *int `json:"max_output_tokens,omitempty" yaml:"max_output_tokens"`
+
+	Tools      []ResponseTool `json:"tools,omitempty" yaml:"tools"`
+	ToolChoice interface{}    `json:"tool_choice,omitempty" yaml:"tool_choice"`
+
+	Text *ResponseTextConfig `json:"text,omitempty" yaml:"text"`
+
+	// Store defaults to true, as in the OpenAI API
+	Store *bool `json:"store,omitempty" yaml:"store"`
+
+	Stream   bool              `json:"stream" yaml:"stream"`
+	Metadata map[string]string `json:"metadata,omitempty" yaml:"metadata"`
+}
+
+// ShouldStore reports whether the response has to be persisted in the response store
+func (r *OpenResponsesRequest) ShouldStore() bool {
+	return r.Store == nil || *r.Store
+}
+
+// ResponseTool is a tool definition in the Responses API flat format
+type ResponseTool struct {
+	Type        string                 `json:"type"`
+	Name        string                 `json:"name,omitempty"`
+	Description string                 `json:"description,omitempty"`
+	Strict      bool                   `json:"strict,omitempty"`
+	Parameters  map[string]interface{} `json:"parameters,omitempty"`
+}
+
+// ToFunction converts a Responses API tool to the chat completion function format
+func (t ResponseTool) ToFunction() functions.Function {
+	return functions.Function{
+		Name:        t.Name,
+		Description: t.Description,
+		Strict:      t.Strict,
+		Parameters:  t.Parameters,
+	}
+}
+
+type ResponseTextConfig struct {
+	Format map[string]interface{} `json:"format,omitempty"`
+}
+
+// ResponseItem is an input or output item of the Responses API.
+// Depending on Type (message, function_call, function_call_output, reasoning) only a subset of the fields is set.
+type ResponseItem struct {
+	Type   string `json:"type,omitempty"`
+	ID     string `json:"id,omitempty"`
+	Status string `json:"status,omitempty"`
+
+	// message
+	Role string `json:"role,omitempty"`
+	// Content is a string or a list of ResponseContent when used as input,
+	// and always a list of ResponseContent in output items
+	Content interface{} `json:"content,omitempty"`
+
+	// function_call and function_call_output
+	CallID    string `json:"call_id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+	Output    string `json:"output,omitempty"`
+
+	// reasoning
+	Summary []ResponseContent `json:"summary,omitempty"`
+}
+
+type ResponseContent struct {
+	Type        string        `json:"type"`
+	Text        string        `json:"text,omitempty"`
+	ImageURL    string        `json:"image_url,omitempty"`
+	Annotations []interface{} `json:"annotations"`
+}
+
+type ResponseUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
+
+// OpenResponsesResponse is the response object of the OpenAI Responses API
+type OpenResponsesResponse struct {
+	ID                 string            `json:"id"`
+	Object             string            `json:"object"`
+	CreatedAt          int64             `json:"created_at"`
+	Status             string            `json:"status"`
+	Model              string            `json:"model"`
+	Instructions       string            `json:"instructions,omitempty"`
+	PreviousResponseID string            `json:"previous_response_id,omitempty"`
+	Output             []ResponseItem    `json:"output"`
+	Usage              *ResponseUsage    `json:"usage,omitempty"`
+	Error              *APIError         `json:"error,omitempty"`
+	Metadata           map[string]string `json:"metadata,omitempty"`
+}
+
+// ResponseStreamEvent is a server-sent event emitted when a response is streamed
+type ResponseStreamEvent struct {
+	Type           string                 `json:"type"`
+	SequenceNumber int                    `json:"sequence_number"`
+	Response       *OpenResponsesResponse `json:"response,omitempty"`
+	OutputIndex    *int                   `json:"output_index,omitempty"`
+	ContentIndex   *int                   `json:"content_index,omitempty"`
+	ItemID         string                 `json:"item_id,omitempty"`
+	Item           *ResponseItem          `json:"item,omitempty"`
+	Delta          string                 `json:"delta,omitempty"`
+	Text           string                 `json:"text,omitempty"`
+}
+
+type DeleteResponseResponse struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Deleted bool   `json:"deleted"`
+}
@@ -0,0 +1,267 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/core/schema"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrRequestRateLimited = errors.New("rate limit reached for requests per minute")
+	ErrTokenQuotaExceeded = errors.New("rate limit reached for tokens per day")
+)
+
+// usageSaveInterval is how often the usage is written to disk when it changed
+const usageSaveInterval = 10 * time.Second
+
+// ApiKeyUsageService enforces the rate limits of the API key policies and accounts the usage of each key.
+// Usage is keyed by the ID of the key and persisted, so daily quotas survive restarts.
+type ApiKeyUsageService struct {
+	appConfig *config.ApplicationConfig
+	path      string
+
+	usage map[string]*schema.ApiKeyUsage
+	// requests holds the timestamps of the requests of the last minute, per key
+	requests map[string][]time.Time
+	// dirty is set when the usage changed since it was last saved
+	dirty bool
+
+	sync.Mutex
+}
+
+func NewApiKeyUsageService(appConfig *config.ApplicationConfig) (*ApiKeyUsageService, error) {
+	s := &ApiKeyUsageService{
+		appConfig: appConfig,
+		usage:     make(map[string]*schema.ApiKeyUsage),
+		requests:  make(map[string][]time.Time),
+	}
+	if appConfig.DataPath != "" {
+		if err := os.MkdirAll(appConfig.DataPath, 0750); err != nil {
+			return nil, fmt.Errorf("unable to create data path: %w", err)
+		}
+		s.path = filepath.Join(appConfig.DataPath, "api_key_usage.json")
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if s.path != "" {
+		go s.run(appConfig.Context)
+	}
+	return s, nil
+}
+
+// run saves the usage periodically, and once more when the context is done
+func (s *ApiKeyUsageService) run(ctx context.Context) {
+	ticker := time.NewTicker(usageSaveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			s.Flush()
+			return
+		case <-ticker.C:
+			s.Flush()
+		}
+	}
+}
+
+// Flush writes the usage to disk if it changed since it was last saved
+func (s *ApiKeyUsageService) Flush() error {
+	s.Lock()
+	defer s.Unlock()
+	if !s.dirty {
+		return nil
+	}
+	if err := s.save(); err != nil {
+		log.Error().Err(err).Msg("unable to save the API key usage")
+		return err
+	}
+	s.dirty = false
+	return nil
+}
+
+// Allow checks the limits of the key and, if the request is allowed, accounts it.
+// When the request is refused, it returns the time after which the client can retry.
+func (s *ApiKeyUsageService) Allow(policy config.ApiKeyPolicy) (time.Duration, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now()
+	id := policy.ID()
+	u := s.get(id, policy.DisplayName(), now)
+
+	if policy.TokensPerDay > 0 && u.TokensToday >= int64(policy.TokensPerDay) {
+		tomorrow := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+		return tomorrow.Sub(now), ErrTokenQuotaExceeded
+	}
+
+	if policy.RequestsPerMinute > 0 {
+		window := now.Add(-time.Minute)
+		recent := s.requests[id]
+		i := 0
+		for i < len(recent) && !recent[i].After(window) {
+			i++
+		}
+		recent = recent[i:]
+		if len(recent) >= policy.RequestsPerMinute {
+			s.requests[id] = recent
+			return recent[0].Sub(window), ErrRequestRateLimited
+		}
+		s.requests[id] = append(recent, now)
+	}
+
+	u.Requests++
+	u.LastUsedAt = now.Unix()
+	s.dirty = true
+	return 0, nil
+}
+
+// RecordTokens accounts the tokens used by a request of the key. The usage is saved periodically, see Flush.
+func (s *ApiKeyUsageService) RecordTokens(policy config.ApiKeyPolicy, prompt, completion int) {
+	if prompt == 0 && completion == 0 {
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	u := s.get(policy.ID(), policy.DisplayName(), time.Now())
+	u.PromptTokens += int64(prompt)
+	u.CompletionTokens += int64(completion)
+	u.TotalTokens += int64(prompt + completion)
+	u.TokensToday += int64(prompt + completion)
+	s.dirty = true
+}
+
+// Recorder returns a UsageRecorder accounting the tokens to the key
+func (s *ApiKeyUsageService) Recorder(policy config.ApiKeyPolicy) UsageRecorder {
+	return func(prompt, completion int) {
+		s.RecordTokens(policy, prompt, completion)
+	}
+}
+
+// Usage returns the usage of every key, along with the limits currently configured for it
+func (s *ApiKeyUsageService) Usage() []schema.ApiKeyUsage {
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now()
+	result := []schema.ApiKeyUsage{}
+	for id, u := range s.usage {
+		usage := *s.get(id, u.Name, now)
+		for _, p := range s.appConfig.ApiKeyPolicies {
+			if p.ID() == id {
+				usage.Name = p.DisplayName()
+				usage.RequestsPerMinute = p.RequestsPerMinute
+				usage.TokensPerDay = p.TokensPerDay
+				break
+			}
+		}
+		result = append(result, usage)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// get returns the usage of the key with the ID, resetting the daily counter if the day changed. Callers must hold the lock.
+func (s *ApiKeyUsageService) get(id, name string, now time.Time) *schema.ApiKeyUsage {
+	day := now.UTC().Format(time.DateOnly)
+	u, ok := s.usage[id]
+	if !ok {
+		u = &schema.ApiKeyUsage{Name: name, Day: day}
+		s.usage[id] = u
+	}
+	if u.Day != day {
+		u.Day = day
+		u.TokensToday = 0
+	}
+	return u
+}
+
+func (s *ApiKeyUsageService) load() error {
+	if s.path == "" {
+		return nil
+	}
+	dat, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return json.Unmarshal(dat, &s.usage)
+}
+
+// save writes the usage to disk, callers must hold the lock
+func (s *ApiKeyUsageService) save() error {
+	if s.path == "" {
+		return nil
+	}
+	dat, err := json.Marshal(s.usage)
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, dat, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// ownerOf returns the ID of the key owning the objects created with the policy, none when authentication is disabled
+func ownerOf(policy *config.ApiKeyPolicy) string {
+	if policy == nil {
+		return ""
+	}
+	return policy.ID()
+}
+
+// canAccess returns whether the key of the policy can access an object owned by the key with the ID owner.
+// Every object is accessible without authentication and to the admin keys.
+func canAccess(owner string, policy *config.ApiKeyPolicy) bool {
+	if policy == nil || policy.Admin {
+		return true
+	}
+	return owner != "" && owner == policy.ID()
+}
+
+// EstimateTokens estimates the tokens of a text, about 4 characters each, for the backends which do not tokenize it
+func EstimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
+
+// UsageRecorder accounts the tokens used by a request
+type UsageRecorder func(prompt, completion int)
+
+type usageRecorderKeyType string
+
+const usageRecorderKey usageRecorderKeyType = "usageRecorder"
+
+// WithUsageRecorder attaches a UsageRecorder to the context of a request
+func WithUsageRecorder(ctx context.Context, recorder UsageRecorder) context.Context {
+	return context.WithValue(ctx, usageRecorderKey, recorder)
+}
+
+// RecordUsage accounts the tokens to the UsageRecorder of the context, if any
+func RecordUsage(ctx context.Context, prompt, completion int) {
+	if ctx == nil {
+		return
+	}
+	if recorder, ok := ctx.Value(usageRecorderKey).(UsageRecorder); ok && recorder != nil {
+		recorder(prompt, completion)
+	}
+}
@@ -0,0 +1,99 @@
+package services_test
+
+import (
+	"os"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/core/services"
+)
+
+var _ = Describe("ApiKeyUsageService", func() {
+	var (
+		tmpDir    string
+		appConfig *config.ApplicationConfig
+		usage     *services.ApiKeyUsageService
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = os.MkdirTemp("", "apikeys")
+		Expect(err).ToNot(HaveOccurred())
+
+		appConfig = config.NewApplicationConfig(config.WithDataPath(tmpDir))
+		usage, err = services.NewApiKeyUsageService(appConfig)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	It("limits the requests per minute", func() {
+		policy := config.ApiKeyPolicy{Key: "sk-team-a", Name: "team-a", RequestsPerMinute: 2}
+
+		for i := 0; i < 2; i++ {
+			_, err := usage.Allow(policy)
+			Expect(err).ToNot(HaveOccurred())
+		}
+		retryAfter, err := usage.Allow(policy)
+		Expect(err).To(MatchError(services.ErrRequestRateLimited))
+		Expect(retryAfter).To(BeNumerically(">", 0))
+
+		// Other keys are not affected
+		_, err = usage.Allow(config.ApiKeyPolicy{Key: "sk-team-b", Name: "team-b", RequestsPerMinute: 2})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("limits the tokens per day", func() {
+		policy := config.ApiKeyPolicy{Key: "sk-team-a", Name: "team-a", TokensPerDay: 100}
+
+		_, err := usage.Allow(policy)
+		Expect(err).ToNot(HaveOccurred())
+		usage.RecordTokens(policy, 60, 50)
+
+		retryAfter, err := usage.Allow(policy)
+		Expect(err).To(MatchError(services.ErrTokenQuotaExceeded))
+		Expect(retryAfter).To(BeNumerically(">", 0))
+	})
+
+	It("does not share the usage of the keys with the same display name", func() {
+		a := config.ApiKeyPolicy{Key: "sk-a", TokensPerDay: 100}
+		b := config.ApiKeyPolicy{Key: "sk-b", TokensPerDay: 100}
+		Expect(a.DisplayName()).To(Equal(b.DisplayName()))
+
+		usage.RecordTokens(a, 100, 0)
+		_, err := usage.Allow(a)
+		Expect(err).To(MatchError(services.ErrTokenQuotaExceeded))
+		_, err = usage.Allow(b)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("accounts and persists the usage of each key", func() {
+		appConfig.ApiKeyPolicies = []config.ApiKeyPolicy{{Key: "sk-team-a", Name: "team-a", TokensPerDay: 1000}}
+		policy := appConfig.ApiKeyPolicies[0]
+
+		_, err := usage.Allow(policy)
+		Expect(err).ToNot(HaveOccurred())
+		usage.Recorder(policy)(10, 5)
+		usage.RecordTokens(config.ApiKeyPolicy{Key: "sk-0123456789"}, 1, 2)
+
+		report := usage.Usage()
+		Expect(report).To(HaveLen(2))
+		Expect(report[0].Name).To(Equal("key-****6789"))
+		Expect(report[0].TotalTokens).To(Equal(int64(3)))
+		Expect(report[1].Name).To(Equal("team-a"))
+		Expect(report[1].Requests).To(Equal(int64(1)))
+		Expect(report[1].PromptTokens).To(Equal(int64(10)))
+		Expect(report[1].CompletionTokens).To(Equal(int64(5)))
+		Expect(report[1].TokensToday).To(Equal(int64(15)))
+		Expect(report[1].TokensPerDay).To(Equal(1000))
+
+		Expect(usage.Flush()).To(Succeed())
+		reloaded, err := services.NewApiKeyUsageService(appConfig)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(reloaded.Usage()).To(Equal(report))
+	})
+})
@@ -0,0 +1,319 @@
+package services
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/core/schema"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	AuditRedactPrompts   = "prompts"
+	AuditRedactResponses = "responses"
+
+	auditFileName = "audit.jsonl"
+	// Long strings (e.g. base64 images) and arrays (e.g. embeddings) are shortened in the records
+	auditMaxStringLength = 4096
+	auditMaxArrayLength  = 128
+)
+
+// auditPromptFields are the request fields carrying user content, left out when prompts are redacted
+var auditPromptFields = map[string]bool{
+	"messages":     true,
+	"prompt":       true,
+	"input":        true,
+	"instruction":  true,
+	"instructions": true,
+	"query":        true,
+	"documents":    true,
+	"text":         true,
+}
+
+// AuditService writes the audit log: a JSONL file under the data path, rotated by size.
+type AuditService struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+
+	redactPrompts   bool
+	redactResponses bool
+
+	file *os.File
+	size int64
+	sync.Mutex
+}
+
+func NewAuditService(appConfig *config.ApplicationConfig) (*AuditService, error) {
+	path := filepath.Join(appConfig.DataPath, "audit")
+	if err := os.MkdirAll(path, 0750); err != nil {
+		return nil, fmt.Errorf("unable to create audit log path: %w", err)
+	}
+
+	a := &AuditService{
+		path:     path,
+		maxSize:  int64(appConfig.AuditLogMaxSize) * 1024 * 1024,
+		maxFiles: appConfig.AuditLogMaxFiles,
+	}
+	for _, r := range appConfig.AuditLogRedact {
+		switch strings.TrimSpace(r) {
+		case AuditRedactPrompts:
+			a.redactPrompts = true
+		case AuditRedactResponses:
+			a.redactResponses = true
+		default:
+			return nil, fmt.Errorf("unknown audit log redaction %q, expected %q or %q", r, AuditRedactPrompts, AuditRedactResponses)
+		}
+	}
+
+	return a, a.open()
+}
+
+// Record appends a record to the audit log. Errors are logged, they must not fail the request being audited.
+func (a *AuditService) Record(record schema.AuditRecord) {
+	if record.ID == "" {
+		record.ID = uuid.New().String()
+	}
+	if a.redactResponses {
+		record.Response = nil
+	}
+
+	dat, err := json.Marshal(record)
+	if err != nil {
+		log.Error().Err(err).Msg("unable to marshal the audit record")
+		return
+	}
+	dat = append(dat, '\n')
+
+	a.Lock()
+	defer a.Unlock()
+
+	if a.maxSize > 0 && a.size > 0 && a.size+int64(len(dat)) > a.maxSize {
+		if err := a.rotate(); err != nil {
+			log.Error().Err(err).Msg("unable to rotate the audit log")
+		}
+	}
+	n, err := a.file.Write(dat)
+	a.size += int64(n)
+	if err != nil {
+		log.Error().Err(err).Msg("unable to write the audit record")
+	}
+}
+
+// SanitizeRequest prepares a JSON request body for the audit log, redacting the prompts if configured
+func (a *AuditService) SanitizeRequest(body []byte) json.RawMessage {
+	var request map[string]interface{}
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil
+	}
+	if a.redactPrompts {
+		for k := range request {
+			if auditPromptFields[k] {
+				request[k] = "[redacted]"
+			}
+		}
+	}
+	return auditMarshal(request)
+}
+
+// SanitizeResponse prepares a JSON response body for the audit log, nil if responses are redacted
+func (a *AuditService) SanitizeResponse(body []byte) json.RawMessage {
+	if a.redactResponses {
+		return nil
+	}
+	var response interface{}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil
+	}
+	return auditMarshal(response)
+}
+
+// Query returns the records matching the query, the most recent first, and whether more records match it
+func (a *AuditService) Query(query schema.AuditQuery) ([]schema.AuditRecord, bool, error) {
+	a.Lock()
+	// Make sure everything written so far can be read
+	if err := a.file.Sync(); err != nil {
+		log.Warn().Err(err).Msg("unable to sync the audit log")
+	}
+	a.Unlock()
+
+	files, err := a.files()
+	if err != nil {
+		return nil, false, err
+	}
+
+	result := []schema.AuditRecord{}
+	// Files are sorted from the oldest to the most recent, as are the records in each of them
+	for i := len(files) - 1; i >= 0; i-- {
+		records, err := readAuditFile(files[i], query)
+		if err != nil {
+			return nil, false, err
+		}
+		for j := len(records) - 1; j >= 0; j-- {
+			if query.Limit > 0 && len(result) == query.Limit {
+				return result, true, nil
+			}
+			result = append(result, records[j])
+		}
+	}
+	return result, false, nil
+}
+
+func (a *AuditService) Close() error {
+	a.Lock()
+	defer a.Unlock()
+	return a.file.Close()
+}
+
+func (a *AuditService) open() error {
+	f, err := os.OpenFile(filepath.Join(a.path, auditFileName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	a.file = f
+	a.size = st.Size()
+	return nil
+}
+
+// rotate moves the current file aside and prunes the oldest ones, callers must hold the lock
+func (a *AuditService) rotate() error {
+	if err := a.file.Close(); err != nil {
+		return err
+	}
+	rotated := filepath.Join(a.path, fmt.Sprintf("audit-%d.jsonl", time.Now().UnixNano()))
+	if err := os.Rename(filepath.Join(a.path, auditFileName), rotated); err != nil {
+		return err
+	}
+	if err := a.open(); err != nil {
+		return err
+	}
+
+	if a.maxFiles <= 0 {
+		return nil
+	}
+	files, err := a.files()
+	if err != nil {
+		return err
+	}
+	// the current file is not counted
+	for len(files)-1 > a.maxFiles {
+		if err := os.Remove(files[0]); err != nil {
+			return err
+		}
+		files = files[1:]
+	}
+	return nil
+}
+
+// files returns the audit log files, from the oldest to the current one
+func (a *AuditService) files() ([]string, error) {
+	rotated, err := filepath.Glob(filepath.Join(a.path, "audit-*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(rotated, func(i, j int) bool {
+		return auditFileTimestamp(rotated[i]) < auditFileTimestamp(rotated[j])
+	})
+	return append(rotated, filepath.Join(a.path, auditFileName)), nil
+}
+
+func auditFileTimestamp(path string) int64 {
+	ts, _ := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), "audit-"), ".jsonl"), 10, 64)
+	return ts
+}
+
+func readAuditFile(path string, query schema.AuditQuery) ([]schema.AuditRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	records := []schema.AuditRecord{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var record schema.AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			log.Warn().Err(err).Str("file", path).Msg("skipping invalid audit record")
+			continue
+		}
+		if auditRecordMatches(record, query) {
+			records = append(records, record)
+		}
+	}
+	return records, scanner.Err()
+}
+
+func auditRecordMatches(record schema.AuditRecord, query schema.AuditQuery) bool {
+	if query.Model != "" && record.Model != query.Model {
+		return false
+	}
+	if query.ApiKey != "" && record.ApiKey != query.ApiKey {
+		return false
+	}
+	if !query.Since.IsZero() && record.Timestamp.Before(query.Since) {
+		return false
+	}
+	if !query.Until.IsZero() && record.Timestamp.After(query.Until) {
+		return false
+	}
+	switch query.Status {
+	case "":
+	case "success":
+		return record.Status < 400
+	case "error":
+		return record.Status >= 400
+	default:
+		return strconv.Itoa(record.Status) == query.Status
+	}
+	return true
+}
+
+func auditMarshal(v interface{}) json.RawMessage {
+	dat, err := json.Marshal(shortenAuditValue(v))
+	if err != nil {
+		return nil
+	}
+	return dat
+}
+
+// shortenAuditValue truncates the long strings and arrays of a decoded JSON value
+func shortenAuditValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case string:
+		if len(t) > auditMaxStringLength {
+			return fmt.Sprintf("%s...[truncated %d bytes]", t[:auditMaxStringLength], len(t)-auditMaxStringLength)
+		}
+	case []interface{}:
+		if len(t) > auditMaxArrayLength {
+			return fmt.Sprintf("[%d items]", len(t))
+		}
+		for i := range t {
+			t[i] = shortenAuditValue(t[i])
+		}
+	case map[string]interface{}:
+		for k := range t {
+			t[k] = shortenAuditValue(t[k])
+		}
+	}
+	return v
+}
@@ -0,0 +1,129 @@
+package services_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/core/services"
+)
+
+var _ = Describe("AuditService", func() {
+	var (
+		tmpDir string
+		audit  *services.AuditService
+	)
+
+	newAuditService := func(opts ...config.AppOption) *services.AuditService {
+		appConfig := config.NewApplicationConfig(append([]config.AppOption{config.WithDataPath(tmpDir)}, opts...)...)
+		a, err := services.NewAuditService(appConfig)
+		Expect(err).ToNot(HaveOccurred())
+		return a
+	}
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = os.MkdirTemp("", "audit")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		if audit != nil {
+			audit.Close()
+		}
+		os.RemoveAll(tmpDir)
+	})
+
+	It("filters the records", func() {
+		audit = newAuditService(config.WithAuditLog(true, nil, 100, 10))
+		base := time.Now().Add(-time.Hour)
+		audit.Record(schema.AuditRecord{Timestamp: base, Model: "a", ApiKey: "team-a", Status: 200})
+		audit.Record(schema.AuditRecord{Timestamp: base.Add(time.Minute), Model: "b", ApiKey: "team-a", Status: 500})
+		audit.Record(schema.AuditRecord{Timestamp: base.Add(2 * time.Minute), Model: "a", ApiKey: "team-b", Status: 429})
+
+		records, hasMore, err := audit.Query(schema.AuditQuery{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(hasMore).To(BeFalse())
+		Expect(records).To(HaveLen(3))
+		Expect(records[0].ApiKey).To(Equal("team-b"))
+		Expect(records[0].ID).ToNot(BeEmpty())
+
+		records, _, err = audit.Query(schema.AuditQuery{Model: "a"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(records).To(HaveLen(2))
+
+		records, _, err = audit.Query(schema.AuditQuery{ApiKey: "team-a", Status: "error"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(records).To(HaveLen(1))
+		Expect(records[0].Model).To(Equal("b"))
+
+		records, _, err = audit.Query(schema.AuditQuery{Status: "429"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(records).To(HaveLen(1))
+
+		records, _, err = audit.Query(schema.AuditQuery{Since: base.Add(30 * time.Second), Until: base.Add(90 * time.Second)})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(records).To(HaveLen(1))
+		Expect(records[0].Model).To(Equal("b"))
+
+		records, hasMore, err = audit.Query(schema.AuditQuery{Limit: 2})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(hasMore).To(BeTrue())
+		Expect(records).To(HaveLen(2))
+	})
+
+	It("rotates the log and keeps the configured number of files", func() {
+		audit = newAuditService(config.WithAuditLog(true, nil, 1, 2))
+
+		big := strings.Repeat("x", 3000)
+		for i := 0; i < 2000; i++ {
+			audit.Record(schema.AuditRecord{Timestamp: time.Now(), Model: "m", Error: big})
+		}
+
+		rotated, err := filepath.Glob(filepath.Join(tmpDir, "audit", "audit-*.jsonl"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rotated).To(HaveLen(2))
+
+		// The oldest records are gone with the pruned files
+		records, hasMore, err := audit.Query(schema.AuditQuery{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(hasMore).To(BeFalse())
+		Expect(len(records)).To(BeNumerically(">", 600))
+		Expect(len(records)).To(BeNumerically("<", 1100))
+	})
+
+	It("redacts the prompts and the responses", func() {
+		audit = newAuditService(config.WithAuditLog(true, []string{"prompts", "responses"}, 100, 10))
+
+		request := audit.SanitizeRequest([]byte(`{"model": "a", "temperature": 0.5, "messages": [{"role": "user", "content": "secret"}]}`))
+		Expect(string(request)).ToNot(ContainSubstring("secret"))
+		var parsed map[string]interface{}
+		Expect(json.Unmarshal(request, &parsed)).To(Succeed())
+		Expect(parsed["temperature"]).To(Equal(0.5))
+		Expect(parsed["messages"]).To(Equal("[redacted]"))
+
+		Expect(audit.SanitizeResponse([]byte(`{"choices": []}`))).To(BeNil())
+	})
+
+	It("shortens long values", func() {
+		audit = newAuditService(config.WithAuditLog(true, nil, 100, 10))
+
+		embedding := make([]float32, 1024)
+		response, err := json.Marshal(map[string]interface{}{"data": []interface{}{map[string]interface{}{"embedding": embedding}}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(audit.SanitizeResponse(response))).To(Equal(`{"data":[{"embedding":"[1024 items]"}]}`))
+	})
+
+	It("refuses unknown redactions", func() {
+		appConfig := config.NewApplicationConfig(config.WithDataPath(tmpDir), config.WithAuditLog(true, []string{"everything"}, 100, 10))
+		_, err := services.NewAuditService(appConfig)
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -101,6 +101,20 @@ func (bms *BackendMonitorService) SampleLocalBackendProcess(model string) (*sche
 	}, nil
 }
 
+// ProcessMemory returns the resident memory of the backend process with the given PID, it is the memory
+// observer of the model loader
+func (bms *BackendMonitorService) ProcessMemory(pid int) (uint64, error) {
+	backendProcess, err := gopsutil.NewProcess(int32(pid))
+	if err != nil {
+		return 0, err
+	}
+	memInfo, err := backendProcess.MemoryInfo()
+	if err != nil {
+		return 0, err
+	}
+	return memInfo.RSS, nil
+}
+
 func (bms BackendMonitorService) CheckAndSample(modelName string) (*proto.StatusResponse, error) {
 	backendId, err := bms.getModelLoaderIDFromModelName(modelName)
 	if err != nil {
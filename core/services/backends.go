@@ -8,17 +8,22 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
-func (g *GalleryService) backendHandler(op *GalleryOp[gallery.GalleryBackend], systemState *system.SystemState) error {
+func (g *GalleryService) backendHandler(op *GalleryOp[gallery.GalleryBackend], systemState *system.SystemState) (err error) {
 	utils.ResetDownloadTimers()
+
+	install := g.measureInstall("backend")
+	if !op.Delete {
+		defer func() { install.done(err) }()
+	}
 	g.UpdateStatus(op.ID, &GalleryOpStatus{Message: "processing", Progress: 0})
 
 	// displayDownload displays the download progress
 	progressCallback := func(fileName string, current string, total string, percentage float64) {
 		g.UpdateStatus(op.ID, &GalleryOpStatus{Message: "processing", FileName: fileName, Progress: percentage, TotalFileSize: total, DownloadedFileSize: current})
+		install.progress(fileName, current)
 		utils.DisplayDownloadFunction(fileName, current, total, percentage)
 	}
 
-	var err error
 	if op.Delete {
 		err = gallery.DeleteBackendFromSystem(g.appConfig.BackendsPath, op.GalleryElementName)
 		g.modelLoader.DeleteExternalBackend(op.GalleryElementName)
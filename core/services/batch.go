@@ -0,0 +1,644 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/core/schema"
+	"github.com/rs/zerolog/log"
+	"github.com/valyala/fasthttp"
+)
+
+var ErrBatchNotFound = errors.New("batch not found")
+
+// BatchEndpoints are the endpoints whose requests can be batched
+var BatchEndpoints = []string{"/v1/chat/completions", "/v1/completions", "/v1/embeddings"}
+
+// maxBatchLineSize is the maximum size of a single line of a batch input file
+const maxBatchLineSize = 64 * 1024 * 1024
+
+// BatchRequestHandler serves a single request of a batch, on behalf of the API key that created the batch (nil when authentication is disabled)
+type BatchRequestHandler func(ctx *fasthttp.RequestCtx, policy *config.ApiKeyPolicy)
+
+// BatchService runs the batches created with the Batch API in the background.
+// Batches are processed one at a time, the requests of a batch are dispatched to the
+// API handlers by a bounded pool of workers. The state of every batch is persisted to disk,
+// so that unfinished batches are resumed after a restart.
+type BatchService struct {
+	appConfig *config.ApplicationConfig
+	files     *FileService
+	path      string
+	handler   BatchRequestHandler
+
+	batches map[string]*schema.Batch
+	// policies holds the policy of the API key that created each batch, the batch belongs to that key
+	policies map[string]*config.ApiKeyPolicy
+	pending  []string
+	notify   chan struct{}
+	sync.Mutex
+}
+
+func NewBatchService(appConfig *config.ApplicationConfig, files *FileService) (*BatchService, error) {
+	path := filepath.Join(appConfig.DataPath, "batches")
+	if err := os.MkdirAll(path, 0750); err != nil {
+		return nil, fmt.Errorf("unable to create batches path: %w", err)
+	}
+
+	bs := &BatchService{
+		appConfig: appConfig,
+		files:     files,
+		path:      path,
+		batches:   make(map[string]*schema.Batch),
+		policies:  make(map[string]*config.ApiKeyPolicy),
+		notify:    make(chan struct{}, 1),
+	}
+	return bs, bs.load()
+}
+
+// Start resumes the unfinished batches and processes new ones, dispatching their requests to handler
+func (bs *BatchService) Start(c context.Context, handler BatchRequestHandler) error {
+	bs.handler = handler
+
+	bs.Lock()
+	// the oldest batches are resumed first
+	batches := bs.sortedBatches()
+	slices.Reverse(batches)
+	for _, b := range batches {
+		switch b.Status {
+		case schema.BatchStatusValidating, schema.BatchStatusInProgress, schema.BatchStatusFinalizing:
+			log.Info().Str("id", b.ID).Msg("resuming batch")
+			b.Status = schema.BatchStatusValidating
+			b.RequestCounts = schema.BatchCounts{}
+			bs.pending = append(bs.pending, b.ID)
+		case schema.BatchStatusCancelling:
+			b.Status = schema.BatchStatusCancelled
+			b.CancelledAt = time.Now().Unix()
+		default:
+			continue
+		}
+		if err := bs.save(b); err != nil {
+			log.Error().Err(err).Str("id", b.ID).Msg("failed saving batch")
+		}
+	}
+	bs.Unlock()
+	bs.wake()
+
+	go func() {
+		for {
+			select {
+			case <-c.Done():
+				return
+			case <-bs.notify:
+				for id := bs.next(); id != ""; id = bs.next() {
+					bs.run(c, id)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Create queues a new batch. Its requests are subject to the policy of the API key that created it, if any.
+func (bs *BatchService) Create(req schema.BatchRequest, policy *config.ApiKeyPolicy) (schema.Batch, error) {
+	if !slices.Contains(BatchEndpoints, req.Endpoint) {
+		return schema.Batch{}, fmt.Errorf("unsupported endpoint %q, must be one of %s", req.Endpoint, strings.Join(BatchEndpoints, ", "))
+	}
+	if _, err := bs.files.Get(req.InputFileID, policy); err != nil {
+		return schema.Batch{}, fmt.Errorf("input file %q: %w", req.InputFileID, err)
+	}
+	if req.CompletionWindow == "" {
+		req.CompletionWindow = "24h"
+	}
+
+	b := &schema.Batch{
+		ID:               "batch_" + strings.ReplaceAll(uuid.New().String(), "-", ""),
+		Object:           "batch",
+		Endpoint:         req.Endpoint,
+		InputFileID:      req.InputFileID,
+		CompletionWindow: req.CompletionWindow,
+		Status:           schema.BatchStatusValidating,
+		CreatedAt:        time.Now().Unix(),
+		Metadata:         req.Metadata,
+	}
+
+	bs.Lock()
+	bs.policies[b.ID] = batchPolicy(policy)
+	if err := bs.save(b); err != nil {
+		delete(bs.policies, b.ID)
+		bs.Unlock()
+		return schema.Batch{}, err
+	}
+	bs.batches[b.ID] = b
+	bs.pending = append(bs.pending, b.ID)
+	res := *b
+	bs.Unlock()
+
+	bs.wake()
+	return res, nil
+}
+
+// Get returns a batch, the batches the key of the policy cannot access are not found
+func (bs *BatchService) Get(id string, policy *config.ApiKeyPolicy) (schema.Batch, error) {
+	bs.Lock()
+	defer bs.Unlock()
+
+	b, ok := bs.batches[id]
+	if !ok || !bs.canAccess(id, policy) {
+		return schema.Batch{}, ErrBatchNotFound
+	}
+	return *b, nil
+}
+
+// List returns up to limit batches the key of the policy can access, the most recent first,
+// created before the batch with the given ID (if any)
+func (bs *BatchService) List(after string, limit int, policy *config.ApiKeyPolicy) ([]schema.Batch, bool) {
+	bs.Lock()
+	defer bs.Unlock()
+
+	res := []schema.Batch{}
+	found := after == ""
+	for _, b := range bs.sortedBatches() {
+		if !bs.canAccess(b.ID, policy) {
+			continue
+		}
+		if !found {
+			found = b.ID == after
+			continue
+		}
+		if len(res) == limit {
+			return res, true
+		}
+		res = append(res, *b)
+	}
+	return res, false
+}
+
+// Cancel requests the cancellation of a batch, requests already dispatched are completed
+func (bs *BatchService) Cancel(id string, policy *config.ApiKeyPolicy) (schema.Batch, error) {
+	bs.Lock()
+	defer bs.Unlock()
+
+	b, ok := bs.batches[id]
+	if !ok || !bs.canAccess(id, policy) {
+		return schema.Batch{}, ErrBatchNotFound
+	}
+
+	switch b.Status {
+	case schema.BatchStatusValidating, schema.BatchStatusInProgress:
+	default:
+		return *b, fmt.Errorf("batch %s cannot be cancelled while %s", id, b.Status)
+	}
+
+	b.Status = schema.BatchStatusCancelling
+	b.CancellingAt = time.Now().Unix()
+
+	// batches that are still waiting in the queue are cancelled right away
+	if i := slices.Index(bs.pending, id); i >= 0 {
+		bs.pending = slices.Delete(bs.pending, i, i+1)
+		b.Status = schema.BatchStatusCancelled
+		b.CancelledAt = b.CancellingAt
+	}
+
+	return *b, bs.save(b)
+}
+
+// canAccess returns whether the key of the policy can access the batch, callers must hold the lock
+func (bs *BatchService) canAccess(id string, policy *config.ApiKeyPolicy) bool {
+	return canAccess(ownerOf(bs.policies[id]), policy)
+}
+
+func (bs *BatchService) wake() {
+	select {
+	case bs.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (bs *BatchService) next() string {
+	bs.Lock()
+	defer bs.Unlock()
+
+	if len(bs.pending) == 0 {
+		return ""
+	}
+	id := bs.pending[0]
+	bs.pending = bs.pending[1:]
+	return id
+}
+
+// update applies fn to the batch under lock and persists it
+func (bs *BatchService) update(id string, fn func(b *schema.Batch)) schema.Batch {
+	bs.Lock()
+	defer bs.Unlock()
+
+	b := bs.batches[id]
+	fn(b)
+	if err := bs.save(b); err != nil {
+		log.Error().Err(err).Str("id", id).Msg("failed saving batch")
+	}
+	return *b
+}
+
+// batchResult is the result of a request of a batch. The results are appended to a file while the batch runs,
+// so that the requests already done are not run again when the batch is resumed.
+type batchResult struct {
+	Line schema.BatchOutputLine `json:"line"`
+	OK   bool                   `json:"ok"`
+}
+
+func (bs *BatchService) run(c context.Context, id string) {
+	batch := bs.update(id, func(b *schema.Batch) {})
+	bs.Lock()
+	policy := bs.policies[id]
+	bs.Unlock()
+
+	fail := func(errs ...schema.BatchError) {
+		bs.update(id, func(b *schema.Batch) {
+			b.Status = schema.BatchStatusFailed
+			b.FailedAt = time.Now().Unix()
+			b.Errors = &schema.BatchErrors{Object: "list", Data: errs}
+		})
+		bs.removeResults(id)
+	}
+
+	lines, errs := bs.readInput(batch)
+	if len(errs) > 0 {
+		log.Error().Str("id", id).Msgf("batch failed validation with %d errors", len(errs))
+		fail(errs...)
+		return
+	}
+
+	results := make([]*batchResult, len(lines))
+	done := bs.loadResults(id)
+	counts := schema.BatchCounts{Total: len(lines)}
+	for i, line := range lines {
+		if r, ok := done[line.CustomID]; ok {
+			results[i] = r
+			if r.OK {
+				counts.Completed++
+			} else {
+				counts.Failed++
+			}
+		}
+	}
+	if n := counts.Completed + counts.Failed; n > 0 {
+		log.Info().Str("id", id).Msgf("skipping %d requests already done", n)
+	}
+
+	resultsFile, err := os.OpenFile(bs.resultsPath(id), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		fail(schema.BatchError{Code: "internal_error", Message: err.Error()})
+		return
+	}
+	defer resultsFile.Close()
+	resultsMu := sync.Mutex{}
+
+	cancelled := false
+	bs.update(id, func(b *schema.Batch) {
+		b.RequestCounts = counts
+		if b.Status == schema.BatchStatusCancelling {
+			cancelled = true
+			return
+		}
+		b.Status = schema.BatchStatusInProgress
+		b.InProgressAt = time.Now().Unix()
+	})
+
+	workers := bs.appConfig.BatchConcurrency
+	if workers < 1 {
+		workers = 1
+	}
+
+	jobs := make(chan int)
+	wg := sync.WaitGroup{}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				r := bs.dispatch(lines[i], policy)
+				results[i] = &r
+				if dat, err := json.Marshal(r); err == nil {
+					resultsMu.Lock()
+					_, err = resultsFile.Write(append(dat, '\n'))
+					resultsMu.Unlock()
+					if err != nil {
+						log.Error().Err(err).Str("id", id).Msg("failed saving batch result")
+					}
+				}
+				bs.update(id, func(b *schema.Batch) {
+					if r.OK {
+						b.RequestCounts.Completed++
+					} else {
+						b.RequestCounts.Failed++
+					}
+				})
+			}
+		}()
+	}
+
+	for i := range lines {
+		if cancelled {
+			break
+		}
+		if results[i] != nil {
+			continue
+		}
+		if c.Err() != nil {
+			// shutting down: the batch is resumed on the next start
+			close(jobs)
+			wg.Wait()
+			return
+		}
+		if b, _ := bs.Get(id, nil); b.Status == schema.BatchStatusCancelling {
+			cancelled = true
+			break
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	if !cancelled {
+		bs.update(id, func(b *schema.Batch) {
+			if b.Status == schema.BatchStatusCancelling {
+				cancelled = true
+				return
+			}
+			b.Status = schema.BatchStatusFinalizing
+			b.FinalizingAt = time.Now().Unix()
+		})
+	}
+
+	output, errorOutput := &bytes.Buffer{}, &bytes.Buffer{}
+	for _, r := range results {
+		if r == nil {
+			continue
+		}
+		dat, err := json.Marshal(r.Line)
+		if err != nil {
+			log.Error().Err(err).Str("id", id).Msg("failed marshalling batch result")
+			continue
+		}
+		if r.OK {
+			output.Write(append(dat, '\n'))
+		} else {
+			errorOutput.Write(append(dat, '\n'))
+		}
+	}
+
+	outputFileID, errorFileID := "", ""
+	if output.Len() > 0 {
+		f, err := bs.files.Create(id+"_output.jsonl", "batch_output", output, policy)
+		if err != nil {
+			fail(schema.BatchError{Code: "output_file_error", Message: err.Error()})
+			return
+		}
+		outputFileID = f.ID
+	}
+	if errorOutput.Len() > 0 {
+		f, err := bs.files.Create(id+"_error.jsonl", "batch_output", errorOutput, policy)
+		if err != nil {
+			fail(schema.BatchError{Code: "output_file_error", Message: err.Error()})
+			return
+		}
+		errorFileID = f.ID
+	}
+
+	bs.update(id, func(b *schema.Batch) {
+		b.OutputFileID = outputFileID
+		b.ErrorFileID = errorFileID
+		if cancelled {
+			b.Status = schema.BatchStatusCancelled
+			b.CancelledAt = time.Now().Unix()
+			return
+		}
+		b.Status = schema.BatchStatusCompleted
+		b.CompletedAt = time.Now().Unix()
+	})
+	bs.removeResults(id)
+	log.Info().Str("id", id).Msg("batch processed")
+}
+
+// readInput reads and validates the input file of the batch
+func (bs *BatchService) readInput(batch schema.Batch) ([]schema.BatchInputLine, []schema.BatchError) {
+	// the owner of the input file was checked when the batch was created
+	f, err := bs.files.Open(batch.InputFileID, nil)
+	if err != nil {
+		return nil, []schema.BatchError{{Code: "invalid_input_file", Message: err.Error()}}
+	}
+	defer f.Close()
+
+	lines := []schema.BatchInputLine{}
+	errs := []schema.BatchError{}
+	customIDs := map[string]bool{}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxBatchLineSize)
+	n := 0
+	for scanner.Scan() {
+		n++
+		lineNumber := n
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+
+		line := schema.BatchInputLine{}
+		switch err := json.Unmarshal(raw, &line); {
+		case err != nil:
+			errs = append(errs, schema.BatchError{Code: "invalid_json_line", Message: err.Error(), Line: &lineNumber})
+		case line.CustomID == "":
+			errs = append(errs, schema.BatchError{Code: "missing_required_parameter", Message: "custom_id is required", Line: &lineNumber})
+		case customIDs[line.CustomID]:
+			errs = append(errs, schema.BatchError{Code: "duplicate_custom_id", Message: fmt.Sprintf("custom_id %q is not unique", line.CustomID), Line: &lineNumber})
+		case line.Method != "" && line.Method != fasthttp.MethodPost:
+			errs = append(errs, schema.BatchError{Code: "invalid_method", Message: "only POST requests can be batched", Line: &lineNumber})
+		case line.URL != batch.Endpoint:
+			errs = append(errs, schema.BatchError{Code: "mismatched_endpoint", Message: fmt.Sprintf("url %q does not match the batch endpoint %q", line.URL, batch.Endpoint), Line: &lineNumber})
+		default:
+			customIDs[line.CustomID] = true
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, schema.BatchError{Code: "invalid_input_file", Message: err.Error()})
+	}
+	if len(lines) == 0 && len(errs) == 0 {
+		errs = append(errs, schema.BatchError{Code: "empty_file", Message: "the input file has no requests"})
+	}
+
+	return lines, errs
+}
+
+// dispatch runs a single request of a batch through the API handlers
+func (bs *BatchService) dispatch(line schema.BatchInputLine, policy *config.ApiKeyPolicy) batchResult {
+	res := batchResult{
+		Line: schema.BatchOutputLine{
+			ID:       "batch_req_" + strings.ReplaceAll(uuid.New().String(), "-", ""),
+			CustomID: line.CustomID,
+		},
+	}
+
+	body := line.Body
+	if body == nil {
+		body = map[string]interface{}{}
+	}
+	// results are written to the output file as a whole
+	delete(body, "stream")
+
+	dat, err := json.Marshal(body)
+	if err != nil {
+		res.Line.Error = &schema.BatchError{Code: "invalid_body", Message: err.Error()}
+		return res
+	}
+
+	requestID := uuid.New().String()
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.Header.SetMethod(fasthttp.MethodPost)
+	ctx.Request.SetRequestURI(line.URL)
+	ctx.Request.Header.SetContentType("application/json")
+	ctx.Request.Header.Set("X-Correlation-ID", requestID)
+	ctx.Request.SetBody(dat)
+
+	bs.handler(ctx, policy)
+
+	var responseBody interface{}
+	if err := json.Unmarshal(ctx.Response.Body(), &responseBody); err != nil {
+		responseBody = string(ctx.Response.Body())
+	}
+
+	status := ctx.Response.StatusCode()
+	res.Line.Response = &schema.BatchOutputResponse{
+		StatusCode: status,
+		RequestID:  requestID,
+		Body:       responseBody,
+	}
+	res.OK = status >= 200 && status < 300
+	if !res.OK {
+		res.Line.Error = &schema.BatchError{Code: fmt.Sprintf("%d", status), Message: fasthttp.StatusMessage(status)}
+	}
+	return res
+}
+
+func (bs *BatchService) resultsPath(id string) string {
+	return filepath.Join(bs.path, id+".results.jsonl")
+}
+
+// loadResults returns the results of the requests of a batch done before a restart, by custom ID
+func (bs *BatchService) loadResults(id string) map[string]*batchResult {
+	results := map[string]*batchResult{}
+	f, err := os.Open(bs.resultsPath(id))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Error().Err(err).Str("id", id).Msg("failed reading batch results")
+		}
+		return results
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxBatchLineSize)
+	for scanner.Scan() {
+		r := &batchResult{}
+		// the last line may be truncated if the server stopped while writing it, its request is run again
+		if err := json.Unmarshal(scanner.Bytes(), r); err != nil {
+			continue
+		}
+		results[r.Line.CustomID] = r
+	}
+	return results
+}
+
+func (bs *BatchService) removeResults(id string) {
+	if err := os.Remove(bs.resultsPath(id)); err != nil && !os.IsNotExist(err) {
+		log.Error().Err(err).Str("id", id).Msg("failed removing batch results")
+	}
+}
+
+// sortedBatches returns the batches, the most recent first. Callers must hold the lock.
+func (bs *BatchService) sortedBatches() []*schema.Batch {
+	batches := make([]*schema.Batch, 0, len(bs.batches))
+	for _, b := range bs.batches {
+		batches = append(batches, b)
+	}
+	sort.Slice(batches, func(i, j int) bool {
+		if batches[i].CreatedAt == batches[j].CreatedAt {
+			return batches[i].ID > batches[j].ID
+		}
+		return batches[i].CreatedAt > batches[j].CreatedAt
+	})
+	return batches
+}
+
+// load reads the persisted batches
+func (bs *BatchService) load() error {
+	entries, err := os.ReadDir(bs.path)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+		dat, err := os.ReadFile(filepath.Join(bs.path, e.Name()))
+		if err != nil {
+			return err
+		}
+		r := batchRecord{}
+		if err := json.Unmarshal(dat, &r); err != nil {
+			log.Error().Err(err).Str("file", e.Name()).Msg("skipping invalid batch file")
+			continue
+		}
+		bs.batches[r.ID] = &r.Batch
+		bs.policies[r.ID] = r.ApiKeyPolicy
+	}
+	return nil
+}
+
+// batchRecord is the persisted state of a batch, along with the policy of the key owning it
+type batchRecord struct {
+	schema.Batch
+	ApiKeyPolicy *config.ApiKeyPolicy `json:"api_key_policy,omitempty"`
+}
+
+// batchPolicy returns the copy of the policy stored with a batch. The key itself is not persisted,
+// its ID and display name are kept instead so that the usage is still accounted to the same key.
+func batchPolicy(policy *config.ApiKeyPolicy) *config.ApiKeyPolicy {
+	if policy == nil {
+		return nil
+	}
+	p := *policy
+	p.Name = policy.DisplayName()
+	p.KeyID = policy.ID()
+	p.Key = ""
+	return &p
+}
+
+// save persists a batch, callers must hold the lock
+func (bs *BatchService) save(b *schema.Batch) error {
+	dat, err := json.Marshal(batchRecord{Batch: *b, ApiKeyPolicy: bs.policies[b.ID]})
+	if err != nil {
+		return err
+	}
+	f := filepath.Join(bs.path, b.ID+".json")
+	tmp := f + ".tmp"
+	if err := os.WriteFile(tmp, dat, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f)
+}
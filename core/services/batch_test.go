@@ -0,0 +1,304 @@
+package services_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/valyala/fasthttp"
+
+	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/core/services"
+)
+
+var _ = Describe("BatchService", func() {
+	var (
+		tmpDir    string
+		appConfig *config.ApplicationConfig
+		files     *services.FileService
+		app       *fiber.App
+		handler   services.BatchRequestHandler
+		policies  chan *config.ApiKeyPolicy
+		ctx       context.Context
+		cancel    context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = os.MkdirTemp("", "batches")
+		Expect(err).ToNot(HaveOccurred())
+
+		appConfig = config.NewApplicationConfig(config.WithDataPath(tmpDir))
+		files, err = services.NewFileService(tmpDir + "/files")
+		Expect(err).ToNot(HaveOccurred())
+
+		app = fiber.New()
+		app.Post("/v1/embeddings", func(c *fiber.Ctx) error {
+			body := map[string]interface{}{}
+			if err := json.Unmarshal(c.Body(), &body); err != nil {
+				return err
+			}
+			if body["model"] == "missing" {
+				return fiber.NewError(fiber.StatusNotFound, "model not found")
+			}
+			return c.JSON(schema.OpenAIResponse{Model: body["model"].(string), Object: "list"})
+		})
+
+		policies = make(chan *config.ApiKeyPolicy, 10)
+		handler = func(c *fasthttp.RequestCtx, policy *config.ApiKeyPolicy) {
+			policies <- policy
+			app.Handler()(c)
+		}
+
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+		os.RemoveAll(tmpDir)
+	})
+
+	uploadAs := func(policy *config.ApiKeyPolicy, lines ...string) schema.File {
+		f, err := files.Create("input.jsonl", "batch", strings.NewReader(strings.Join(lines, "\n")), policy)
+		Expect(err).ToNot(HaveOccurred())
+		return f
+	}
+	upload := func(lines ...string) schema.File {
+		return uploadAs(nil, lines...)
+	}
+
+	readLines := func(id string) []schema.BatchOutputLine {
+		r, err := files.Open(id, nil)
+		Expect(err).ToNot(HaveOccurred())
+		defer r.Close()
+
+		res := []schema.BatchOutputLine{}
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			l := schema.BatchOutputLine{}
+			Expect(json.Unmarshal(scanner.Bytes(), &l)).To(Succeed())
+			res = append(res, l)
+		}
+		return res
+	}
+
+	It("runs the requests and writes the output and error files", func() {
+		bs, err := services.NewBatchService(appConfig, files)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(bs.Start(ctx, handler)).To(Succeed())
+
+		input := upload(
+			`{"custom_id": "a", "method": "POST", "url": "/v1/embeddings", "body": {"model": "m1", "input": "hello"}}`,
+			`{"custom_id": "b", "method": "POST", "url": "/v1/embeddings", "body": {"model": "missing", "input": "hello"}}`,
+			`{"custom_id": "c", "method": "POST", "url": "/v1/embeddings", "body": {"model": "m2", "input": "hello"}}`,
+		)
+
+		batch, err := bs.Create(schema.BatchRequest{InputFileID: input.ID, Endpoint: "/v1/embeddings"}, nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		Eventually(func() string {
+			b, _ := bs.Get(batch.ID, nil)
+			return b.Status
+		}).Should(Equal(schema.BatchStatusCompleted))
+
+		batch, err = bs.Get(batch.ID, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(batch.RequestCounts).To(Equal(schema.BatchCounts{Total: 3, Completed: 2, Failed: 1}))
+
+		output := readLines(batch.OutputFileID)
+		Expect(output).To(HaveLen(2))
+		Expect(output[0].CustomID).To(Equal("a"))
+		Expect(output[0].Response.StatusCode).To(Equal(200))
+		Expect(output[1].CustomID).To(Equal("c"))
+
+		errors := readLines(batch.ErrorFileID)
+		Expect(errors).To(HaveLen(1))
+		Expect(errors[0].CustomID).To(Equal("b"))
+		Expect(errors[0].Response.StatusCode).To(Equal(404))
+	})
+
+	It("fails batches with invalid lines", func() {
+		bs, err := services.NewBatchService(appConfig, files)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(bs.Start(ctx, handler)).To(Succeed())
+
+		input := upload(
+			`{"custom_id": "a", "method": "POST", "url": "/v1/chat/completions", "body": {}}`,
+			`not json`,
+		)
+
+		batch, err := bs.Create(schema.BatchRequest{InputFileID: input.ID, Endpoint: "/v1/embeddings"}, nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		Eventually(func() string {
+			b, _ := bs.Get(batch.ID, nil)
+			return b.Status
+		}).Should(Equal(schema.BatchStatusFailed))
+
+		batch, _ = bs.Get(batch.ID, nil)
+		Expect(batch.Errors.Data).To(HaveLen(2))
+		Expect(*batch.Errors.Data[1].Line).To(Equal(2))
+	})
+
+	It("resumes unfinished batches after a restart", func() {
+		bs, err := services.NewBatchService(appConfig, files)
+		Expect(err).ToNot(HaveOccurred())
+
+		input := upload(`{"custom_id": "a", "method": "POST", "url": "/v1/embeddings", "body": {"model": "m1"}}`)
+		batch, err := bs.Create(schema.BatchRequest{InputFileID: input.ID, Endpoint: "/v1/embeddings"}, nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		// the first service was never started, a new one picks up the batch from disk
+		restarted, err := services.NewBatchService(appConfig, files)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(restarted.Start(ctx, handler)).To(Succeed())
+
+		Eventually(func() string {
+			b, _ := restarted.Get(batch.ID, nil)
+			return b.Status
+		}).Should(Equal(schema.BatchStatusCompleted))
+	})
+
+	It("does not run again the requests done before a restart", func() {
+		bs, err := services.NewBatchService(appConfig, files)
+		Expect(err).ToNot(HaveOccurred())
+
+		// the server stops while the second request runs
+		firstCtx, stop := context.WithCancel(ctx)
+		release := make(chan struct{})
+		defer close(release)
+		serve := app.Handler()
+		Expect(bs.Start(firstCtx, func(c *fasthttp.RequestCtx, _ *config.ApiKeyPolicy) {
+			if strings.Contains(string(c.Request.Body()), `"m2"`) {
+				stop()
+				<-release
+			}
+			serve(c)
+		})).To(Succeed())
+
+		input := upload(
+			`{"custom_id": "a", "method": "POST", "url": "/v1/embeddings", "body": {"model": "m1"}}`,
+			`{"custom_id": "b", "method": "POST", "url": "/v1/embeddings", "body": {"model": "m2"}}`,
+			`{"custom_id": "c", "method": "POST", "url": "/v1/embeddings", "body": {"model": "m3"}}`,
+		)
+		batch, err := bs.Create(schema.BatchRequest{InputFileID: input.ID, Endpoint: "/v1/embeddings"}, nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		Eventually(func() int {
+			b, _ := bs.Get(batch.ID, nil)
+			return b.RequestCounts.Completed
+		}).Should(Equal(1))
+
+		models := make(chan string, 10)
+		restarted, err := services.NewBatchService(appConfig, files)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(restarted.Start(ctx, func(c *fasthttp.RequestCtx, _ *config.ApiKeyPolicy) {
+			body := map[string]interface{}{}
+			Expect(json.Unmarshal(c.Request.Body(), &body)).To(Succeed())
+			models <- body["model"].(string)
+			app.Handler()(c)
+		})).To(Succeed())
+
+		Eventually(func() string {
+			b, _ := restarted.Get(batch.ID, nil)
+			return b.Status
+		}).Should(Equal(schema.BatchStatusCompleted))
+		Expect(models).To(HaveLen(2))
+		Expect(<-models).To(Equal("m2"))
+		Expect(<-models).To(Equal("m3"))
+
+		batch, _ = restarted.Get(batch.ID, nil)
+		Expect(batch.RequestCounts).To(Equal(schema.BatchCounts{Total: 3, Completed: 3}))
+		output := readLines(batch.OutputFileID)
+		Expect(output).To(HaveLen(3))
+		Expect(output[0].CustomID).To(Equal("a"))
+		Expect(output[2].CustomID).To(Equal("c"))
+	})
+
+	It("dispatches the requests on behalf of the key that created the batch, across restarts", func() {
+		bs, err := services.NewBatchService(appConfig, files)
+		Expect(err).ToNot(HaveOccurred())
+
+		key := &config.ApiKeyPolicy{Key: "sk-secret-1234", AllowedModels: []string{"m1"}, TokensPerDay: 100}
+		input := uploadAs(key, `{"custom_id": "a", "method": "POST", "url": "/v1/embeddings", "body": {"model": "m1"}}`)
+		batch, err := bs.Create(schema.BatchRequest{InputFileID: input.ID, Endpoint: "/v1/embeddings"}, key)
+		Expect(err).ToNot(HaveOccurred())
+
+		restarted, err := services.NewBatchService(appConfig, files)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(restarted.Start(ctx, handler)).To(Succeed())
+
+		var policy *config.ApiKeyPolicy
+		Eventually(policies).Should(Receive(&policy))
+		Expect(policy).ToNot(BeNil())
+		Expect(policy.Key).To(BeEmpty())
+		Expect(policy.DisplayName()).To(Equal("key-****1234"))
+		Expect(policy.AllowedModels).To(Equal([]string{"m1"}))
+		Expect(policy.TokensPerDay).To(Equal(100))
+
+		Eventually(func() string {
+			b, _ := restarted.Get(batch.ID, key)
+			return b.Status
+		}).Should(Equal(schema.BatchStatusCompleted))
+	})
+
+	It("hides the batches and their files from the other keys", func() {
+		bs, err := services.NewBatchService(appConfig, files)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(bs.Start(ctx, handler)).To(Succeed())
+
+		owner := &config.ApiKeyPolicy{Key: "sk-owner"}
+		other := &config.ApiKeyPolicy{Key: "sk-other"}
+		admin := &config.ApiKeyPolicy{Key: "sk-admin", Admin: true}
+
+		input := uploadAs(owner, `{"custom_id": "a", "method": "POST", "url": "/v1/embeddings", "body": {"model": "m1"}}`)
+		_, err = bs.Create(schema.BatchRequest{InputFileID: input.ID, Endpoint: "/v1/embeddings"}, other)
+		Expect(err).To(MatchError(services.ErrFileNotFound))
+
+		batch, err := bs.Create(schema.BatchRequest{InputFileID: input.ID, Endpoint: "/v1/embeddings"}, owner)
+		Expect(err).ToNot(HaveOccurred())
+		Eventually(func() string {
+			b, _ := bs.Get(batch.ID, owner)
+			return b.Status
+		}).Should(Equal(schema.BatchStatusCompleted))
+		batch, err = bs.Get(batch.ID, owner)
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = bs.Get(batch.ID, other)
+		Expect(err).To(MatchError(services.ErrBatchNotFound))
+		_, err = bs.Cancel(batch.ID, other)
+		Expect(err).To(MatchError(services.ErrBatchNotFound))
+		batches, _ := bs.List("", 10, other)
+		Expect(batches).To(BeEmpty())
+		batches, _ = bs.List("", 10, owner)
+		Expect(batches).To(HaveLen(1))
+		_, err = bs.Get(batch.ID, admin)
+		Expect(err).ToNot(HaveOccurred())
+
+		// the output file belongs to the owner of the batch
+		_, err = files.Get(batch.OutputFileID, owner)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = files.Open(batch.OutputFileID, other)
+		Expect(err).To(MatchError(services.ErrFileNotFound))
+		Expect(files.Delete(input.ID, other)).To(MatchError(services.ErrFileNotFound))
+		Expect(files.List("", other)).To(BeEmpty())
+		Expect(files.List("", owner)).To(HaveLen(2))
+		Expect(files.List("", admin)).To(HaveLen(2))
+		Expect(files.Delete(input.ID, owner)).To(Succeed())
+	})
+
+	It("rejects unsupported endpoints", func() {
+		bs, err := services.NewBatchService(appConfig, files)
+		Expect(err).ToNot(HaveOccurred())
+
+		input := upload(`{}`)
+		_, err = bs.Create(schema.BatchRequest{InputFileID: input.ID, Endpoint: "/v1/images/generations"}, nil)
+		Expect(err).To(HaveOccurred())
+	})
+})
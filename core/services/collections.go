@@ -0,0 +1,309 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/mudler/LocalAI/core/schema"
+)
+
+// DefaultCollectionChunkSize is the chunk size of the collections, their chunk overlap defaults to a fifth of it
+const DefaultCollectionChunkSize = 1000
+
+var (
+	ErrCollectionNotFound = errors.New("collection not found")
+	ErrCollectionExists   = errors.New("collection already exists")
+	ErrInvalidCollection  = errors.New("invalid collection")
+)
+
+// CollectionService keeps the definitions of the RAG collections. The chunks themselves live in a local-store
+// per collection, see CollectionStoreName.
+type CollectionService struct {
+	path        string
+	collections map[string]schema.Collection
+	sync.Mutex
+}
+
+func NewCollectionService(dataPath string) (*CollectionService, error) {
+	if err := os.MkdirAll(dataPath, 0750); err != nil {
+		return nil, fmt.Errorf("unable to create data path: %w", err)
+	}
+	cs := &CollectionService{
+		path:        filepath.Join(dataPath, "collections.json"),
+		collections: make(map[string]schema.Collection),
+	}
+	return cs, cs.load()
+}
+
+// CollectionStoreName returns the name of the local-store holding the chunks of a collection
+func CollectionStoreName(name string) string {
+	return "collection-" + name
+}
+
+func (cs *CollectionService) Create(request schema.CollectionCreateRequest) (schema.Collection, error) {
+	if !validObjectID.MatchString(request.Name) {
+		return schema.Collection{}, fmt.Errorf("%w: the name %q must only contain letters, digits, '-' and '_'", ErrInvalidCollection, request.Name)
+	}
+	if request.EmbeddingsModel == "" {
+		return schema.Collection{}, fmt.Errorf("%w: embeddings_model is required", ErrInvalidCollection)
+	}
+	collection := schema.Collection{
+		Name:            request.Name,
+		Object:          "collection",
+		EmbeddingsModel: request.EmbeddingsModel,
+		ChunkSize:       request.ChunkSize,
+		ChunkOverlap:    request.ChunkOverlap,
+		CreatedAt:       time.Now().Unix(),
+	}
+	if collection.ChunkSize <= 0 {
+		collection.ChunkSize = DefaultCollectionChunkSize
+	}
+	if collection.ChunkOverlap <= 0 {
+		collection.ChunkOverlap = collection.ChunkSize / 5
+	}
+	if err := validateChunking(collection.ChunkSize, collection.ChunkOverlap); err != nil {
+		return schema.Collection{}, fmt.Errorf("%w: %s", ErrInvalidCollection, err)
+	}
+
+	cs.Lock()
+	defer cs.Unlock()
+	if _, ok := cs.collections[collection.Name]; ok {
+		return schema.Collection{}, ErrCollectionExists
+	}
+	cs.collections[collection.Name] = collection
+	if err := cs.save(); err != nil {
+		delete(cs.collections, collection.Name)
+		return schema.Collection{}, err
+	}
+	return collection, nil
+}
+
+func (cs *CollectionService) Get(name string) (schema.Collection, error) {
+	cs.Lock()
+	defer cs.Unlock()
+	collection, ok := cs.collections[name]
+	if !ok {
+		return schema.Collection{}, ErrCollectionNotFound
+	}
+	return collection, nil
+}
+
+// List returns the collections sorted by name
+func (cs *CollectionService) List() []schema.Collection {
+	cs.Lock()
+	defer cs.Unlock()
+	collections := []schema.Collection{}
+	for _, c := range cs.collections {
+		collections = append(collections, c)
+	}
+	sort.Slice(collections, func(i, j int) bool {
+		return collections[i].Name < collections[j].Name
+	})
+	return collections
+}
+
+func (cs *CollectionService) Delete(name string) error {
+	cs.Lock()
+	defer cs.Unlock()
+	collection, ok := cs.collections[name]
+	if !ok {
+		return ErrCollectionNotFound
+	}
+	delete(cs.collections, name)
+	if err := cs.save(); err != nil {
+		cs.collections[name] = collection
+		return err
+	}
+	return nil
+}
+
+// AddDocuments accounts documents ingested in the collection
+func (cs *CollectionService) AddDocuments(name string, documents, chunks int) (schema.Collection, error) {
+	cs.Lock()
+	defer cs.Unlock()
+	collection, ok := cs.collections[name]
+	if !ok {
+		return schema.Collection{}, ErrCollectionNotFound
+	}
+	collection.Documents += documents
+	collection.Chunks += chunks
+	cs.collections[name] = collection
+	return collection, cs.save()
+}
+
+func (cs *CollectionService) load() error {
+	dat, err := os.ReadFile(cs.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return json.Unmarshal(dat, &cs.collections)
+}
+
+// save writes the collections to disk, callers must hold the lock
+func (cs *CollectionService) save() error {
+	dat, err := json.Marshal(cs.collections)
+	if err != nil {
+		return err
+	}
+	tmp := cs.path + ".tmp"
+	if err := os.WriteFile(tmp, dat, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, cs.path)
+}
+
+func validateChunking(size, overlap int) error {
+	if size <= 0 {
+		return fmt.Errorf("chunk_size must be positive")
+	}
+	if overlap < 0 || overlap*2 > size {
+		return fmt.Errorf("chunk_overlap must be between 0 and half the chunk_size")
+	}
+	return nil
+}
+
+// ChunkDocument splits a document in chunks of at most size bytes, overlapping by about overlap bytes.
+// Chunks end at paragraph, line, sentence or word boundaries when possible. Markdown documents are split
+// by section first, and PDF text by page; the section or page is added to the metadata of the chunks.
+func ChunkDocument(document schema.CollectionDocument, size, overlap int) ([]schema.CollectionChunk, error) {
+	if err := validateChunking(size, overlap); err != nil {
+		return nil, err
+	}
+	if document.ID == "" {
+		document.ID = "doc-" + strings.ReplaceAll(uuid.New().String(), "-", "")
+	}
+
+	type section struct {
+		text     string
+		metadata map[string]string
+	}
+	var sections []section
+	switch document.Format {
+	case "", "text":
+		sections = []section{{text: document.Text}}
+	case "markdown":
+		for _, s := range markdownSections(document.Text) {
+			sections = append(sections, section{text: s.text, metadata: map[string]string{"section": s.heading}})
+		}
+	case "pdf":
+		for i, page := range strings.Split(document.Text, "\f") {
+			sections = append(sections, section{text: page, metadata: map[string]string{"page": strconv.Itoa(i + 1)}})
+		}
+	default:
+		return nil, fmt.Errorf("unsupported document format %q, expected text, markdown or pdf", document.Format)
+	}
+
+	chunks := []schema.CollectionChunk{}
+	for _, s := range sections {
+		for _, text := range chunkText(s.text, size, overlap) {
+			metadata := map[string]string{}
+			for k, v := range document.Metadata {
+				metadata[k] = v
+			}
+			for k, v := range s.metadata {
+				if v != "" {
+					metadata[k] = v
+				}
+			}
+			chunks = append(chunks, schema.CollectionChunk{
+				DocumentID: document.ID,
+				Index:      len(chunks),
+				Text:       text,
+				Metadata:   metadata,
+			})
+		}
+	}
+	return chunks, nil
+}
+
+type markdownSection struct {
+	heading string
+	text    string
+}
+
+// markdownSections splits a Markdown document at its headings, ignoring the ones in code blocks
+func markdownSections(text string) []markdownSection {
+	sections := []markdownSection{{}}
+	var current strings.Builder
+	inCode := false
+	for _, line := range strings.SplitAfter(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			inCode = !inCode
+		}
+		if !inCode && strings.HasPrefix(trimmed, "#") && current.Len() > 0 {
+			sections[len(sections)-1].text = current.String()
+			current.Reset()
+			sections = append(sections, markdownSection{})
+		}
+		if !inCode && strings.HasPrefix(trimmed, "#") {
+			sections[len(sections)-1].heading = strings.TrimSpace(strings.TrimLeft(trimmed, "#"))
+		}
+		current.WriteString(line)
+	}
+	sections[len(sections)-1].text = current.String()
+	return sections
+}
+
+// chunkText splits text in chunks of at most size bytes, see ChunkDocument
+func chunkText(text string, size, overlap int) []string {
+	text = strings.TrimSpace(text)
+	chunks := []string{}
+	for start := 0; start < len(text); {
+		end := start + size
+		if end >= len(text) {
+			if chunk := strings.TrimSpace(text[start:]); chunk != "" {
+				chunks = append(chunks, chunk)
+			}
+			break
+		}
+		end = chunkBoundary(text, start, end)
+		if chunk := strings.TrimSpace(text[start:end]); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+
+		next := end - overlap
+		if next <= start {
+			next = end
+		}
+		// Start the overlap at a word
+		if next < end {
+			if i := strings.IndexAny(text[next:end], " \n"); i >= 0 {
+				next += i + 1
+			}
+		}
+		for next < len(text) && !utf8.RuneStart(text[next]) {
+			next++
+		}
+		start = next
+	}
+	return chunks
+}
+
+// chunkBoundary returns where to end the chunk starting at start, at most at end, preferring the
+// last paragraph, line, sentence or word boundary in the second half of the chunk
+func chunkBoundary(text string, start, end int) int {
+	half := start + (end-start)/2
+	for _, sep := range []string{"\n\n", "\n", ". ", " "} {
+		if i := strings.LastIndex(text[half:end], sep); i >= 0 {
+			return half + i + len(sep)
+		}
+	}
+	for end > start+1 && !utf8.RuneStart(text[end]) {
+		end--
+	}
+	return end
+}
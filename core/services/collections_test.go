@@ -0,0 +1,129 @@
+package services_test
+
+import (
+	"os"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/core/services"
+)
+
+var _ = Describe("CollectionService", func() {
+	var (
+		tmpDir      string
+		collections *services.CollectionService
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = os.MkdirTemp("", "collections")
+		Expect(err).ToNot(HaveOccurred())
+		collections, err = services.NewCollectionService(tmpDir)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	It("creates and persists collections", func() {
+		collection, err := collections.Create(schema.CollectionCreateRequest{Name: "docs", EmbeddingsModel: "bert"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(collection.ChunkSize).To(Equal(services.DefaultCollectionChunkSize))
+		Expect(collection.ChunkOverlap).To(Equal(services.DefaultCollectionChunkSize / 5))
+
+		_, err = collections.Create(schema.CollectionCreateRequest{Name: "docs", EmbeddingsModel: "bert"})
+		Expect(err).To(MatchError(services.ErrCollectionExists))
+
+		_, err = collections.AddDocuments("docs", 2, 10)
+		Expect(err).ToNot(HaveOccurred())
+
+		reloaded, err := services.NewCollectionService(tmpDir)
+		Expect(err).ToNot(HaveOccurred())
+		collection, err = reloaded.Get("docs")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(collection.Documents).To(Equal(2))
+		Expect(collection.Chunks).To(Equal(10))
+		Expect(reloaded.List()).To(HaveLen(1))
+
+		Expect(reloaded.Delete("docs")).To(Succeed())
+		_, err = reloaded.Get("docs")
+		Expect(err).To(MatchError(services.ErrCollectionNotFound))
+	})
+
+	It("refuses invalid collections", func() {
+		for _, request := range []schema.CollectionCreateRequest{
+			{Name: "../docs", EmbeddingsModel: "bert"},
+			{Name: "docs"},
+			{Name: "docs", EmbeddingsModel: "bert", ChunkSize: 100, ChunkOverlap: 80},
+		} {
+			_, err := collections.Create(request)
+			Expect(err).To(MatchError(services.ErrInvalidCollection))
+		}
+	})
+})
+
+var _ = Describe("ChunkDocument", func() {
+	It("splits text at word boundaries, with overlap", func() {
+		text := strings.Repeat("lorem ipsum dolor sit amet ", 40)
+		chunks, err := services.ChunkDocument(schema.CollectionDocument{ID: "doc", Text: text, Metadata: map[string]string{"source": "test"}}, 100, 20)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(len(chunks)).To(BeNumerically(">", 10))
+		for i, c := range chunks {
+			Expect(c.DocumentID).To(Equal("doc"))
+			Expect(c.Index).To(Equal(i))
+			Expect(c.Metadata).To(HaveKeyWithValue("source", "test"))
+			Expect(len(c.Text)).To(BeNumerically("<=", 100))
+			Expect(strings.Fields(c.Text)[0]).To(BeElementOf("lorem", "ipsum", "dolor", "sit", "amet"))
+		}
+		// consecutive chunks overlap
+		tail := chunks[0].Text[len(chunks[0].Text)-20:]
+		Expect(tail).To(ContainSubstring(strings.Fields(chunks[1].Text)[0]))
+		Expect(strings.Join(strings.Fields(text), " ")).To(HaveSuffix(chunks[len(chunks)-1].Text))
+	})
+
+	It("prefers paragraph boundaries", func() {
+		text := strings.Repeat("a", 60) + "\n\n" + strings.Repeat("b", 60)
+		chunks, err := services.ChunkDocument(schema.CollectionDocument{Text: text}, 100, 0)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(chunks).To(HaveLen(2))
+		Expect(chunks[0].Text).To(Equal(strings.Repeat("a", 60)))
+		Expect(chunks[1].Text).To(Equal(strings.Repeat("b", 60)))
+		Expect(chunks[0].DocumentID).ToNot(BeEmpty())
+	})
+
+	It("does not split runes", func() {
+		chunks, err := services.ChunkDocument(schema.CollectionDocument{Text: strings.Repeat("é", 200)}, 51, 10)
+		Expect(err).ToNot(HaveOccurred())
+		for _, c := range chunks {
+			Expect(strings.Trim(c.Text, "é")).To(BeEmpty())
+		}
+	})
+
+	It("splits Markdown by section", func() {
+		text := "Intro\n\n# Install\nRun the binary.\n\n```\n# not a heading\n```\n## Usage\nCall the API.\n"
+		chunks, err := services.ChunkDocument(schema.CollectionDocument{Format: "markdown", Text: text}, 1000, 100)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(chunks).To(HaveLen(3))
+		Expect(chunks[0].Metadata).ToNot(HaveKey("section"))
+		Expect(chunks[1].Metadata).To(HaveKeyWithValue("section", "Install"))
+		Expect(chunks[1].Text).To(ContainSubstring("# not a heading"))
+		Expect(chunks[2].Metadata).To(HaveKeyWithValue("section", "Usage"))
+	})
+
+	It("splits PDF text by page", func() {
+		chunks, err := services.ChunkDocument(schema.CollectionDocument{Format: "pdf", Text: "first page\fsecond page"}, 1000, 100)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(chunks).To(HaveLen(2))
+		Expect(chunks[1].Metadata).To(HaveKeyWithValue("page", "2"))
+		Expect(chunks[1].Text).To(Equal("second page"))
+	})
+
+	It("refuses unknown formats", func() {
+		_, err := services.ChunkDocument(schema.CollectionDocument{Format: "docx", Text: "text"}, 1000, 100)
+		Expect(err).To(HaveOccurred())
+	})
+})
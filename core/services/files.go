@@ -0,0 +1,191 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/core/schema"
+)
+
+var ErrFileNotFound = errors.New("file not found")
+
+// FileService stores the files uploaded with the Files API (and the files produced by batches).
+// Contents are kept as-is in the directory, along with a JSON index holding the metadata.
+// The files belong to the API key which created them, see canAccess.
+type FileService struct {
+	path  string
+	files map[string]fileRecord
+	sync.Mutex
+}
+
+// fileRecord is a file as stored in the index, along with the ID of the key owning it
+type fileRecord struct {
+	schema.File
+	Owner string `json:"owner,omitempty"`
+}
+
+func NewFileService(path string) (*FileService, error) {
+	if err := os.MkdirAll(path, 0750); err != nil {
+		return nil, fmt.Errorf("unable to create files path: %w", err)
+	}
+
+	fs := &FileService{
+		path:  path,
+		files: make(map[string]fileRecord),
+	}
+	return fs, fs.load()
+}
+
+func (fs *FileService) indexFile() string {
+	return filepath.Join(fs.path, "files.json")
+}
+
+func (fs *FileService) contentFile(id string) (string, error) {
+	if !validObjectID.MatchString(id) {
+		return "", fmt.Errorf("invalid file id %q", id)
+	}
+	return filepath.Join(fs.path, id), nil
+}
+
+// Create stores the content read from r as a new file, owned by the key of the policy
+func (fs *FileService) Create(filename, purpose string, r io.Reader, policy *config.ApiKeyPolicy) (schema.File, error) {
+	id := "file-" + strings.ReplaceAll(uuid.New().String(), "-", "")
+	p, err := fs.contentFile(id)
+	if err != nil {
+		return schema.File{}, err
+	}
+
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return schema.File{}, err
+	}
+	n, err := io.Copy(f, r)
+	f.Close()
+	if err != nil {
+		os.Remove(p)
+		return schema.File{}, err
+	}
+
+	file := schema.File{
+		ID:        id,
+		Object:    "file",
+		Bytes:     n,
+		CreatedAt: time.Now().Unix(),
+		Filename:  filepath.Base(filename),
+		Purpose:   purpose,
+		Status:    "processed",
+	}
+
+	fs.Lock()
+	defer fs.Unlock()
+	fs.files[id] = fileRecord{File: file, Owner: ownerOf(policy)}
+	if err := fs.save(); err != nil {
+		delete(fs.files, id)
+		os.Remove(p)
+		return schema.File{}, err
+	}
+
+	return file, nil
+}
+
+// Get returns a file, the files the key of the policy cannot access are not found
+func (fs *FileService) Get(id string, policy *config.ApiKeyPolicy) (schema.File, error) {
+	fs.Lock()
+	defer fs.Unlock()
+
+	file, ok := fs.files[id]
+	if !ok || !canAccess(file.Owner, policy) {
+		return schema.File{}, ErrFileNotFound
+	}
+	return file.File, nil
+}
+
+// List returns the files the key of the policy can access, the most recent first. An empty purpose returns all of them.
+func (fs *FileService) List(purpose string, policy *config.ApiKeyPolicy) []schema.File {
+	fs.Lock()
+	defer fs.Unlock()
+
+	files := []schema.File{}
+	for _, f := range fs.files {
+		if (purpose == "" || f.Purpose == purpose) && canAccess(f.Owner, policy) {
+			files = append(files, f.File)
+		}
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].CreatedAt == files[j].CreatedAt {
+			return files[i].ID < files[j].ID
+		}
+		return files[i].CreatedAt > files[j].CreatedAt
+	})
+	return files
+}
+
+// Open returns a reader over the content of a file, the caller has to close it
+func (fs *FileService) Open(id string, policy *config.ApiKeyPolicy) (io.ReadCloser, error) {
+	if _, err := fs.Get(id, policy); err != nil {
+		return nil, err
+	}
+	p, err := fs.contentFile(id)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(p)
+}
+
+func (fs *FileService) Delete(id string, policy *config.ApiKeyPolicy) error {
+	p, err := fs.contentFile(id)
+	if err != nil {
+		return err
+	}
+
+	fs.Lock()
+	defer fs.Unlock()
+
+	if f, ok := fs.files[id]; !ok || !canAccess(f.Owner, policy) {
+		return ErrFileNotFound
+	}
+	delete(fs.files, id)
+	if err := fs.save(); err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// load reads the index from disk
+func (fs *FileService) load() error {
+	dat, err := os.ReadFile(fs.indexFile())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return json.Unmarshal(dat, &fs.files)
+}
+
+// save writes the index to disk, callers must hold the lock
+func (fs *FileService) save() error {
+	dat, err := json.Marshal(fs.files)
+	if err != nil {
+		return err
+	}
+	tmp := fs.indexFile() + ".tmp"
+	if err := os.WriteFile(tmp, dat, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, fs.indexFile())
+}
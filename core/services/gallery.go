@@ -4,6 +4,9 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
 
 	"github.com/mudler/LocalAI/core/config"
 	"github.com/mudler/LocalAI/core/gallery"
@@ -20,16 +23,60 @@ type GalleryService struct {
 
 	modelLoader *model.ModelLoader
 	statuses    map[string]*GalleryOpStatus
+	metrics     *MaxGPTMetricsService
 }
 
-func NewGalleryService(appConfig *config.ApplicationConfig, ml *model.ModelLoader) *GalleryService {
+// NewGalleryService creates the service processing the gallery operations. metrics can be nil.
+func NewGalleryService(appConfig *config.ApplicationConfig, ml *model.ModelLoader, metrics *MaxGPTMetricsService) *GalleryService {
 	return &GalleryService{
 		appConfig:             appConfig,
 		ModelGalleryChannel:   make(chan GalleryOp[gallery.GalleryModel]),
 		BackendGalleryChannel: make(chan GalleryOp[gallery.GalleryBackend]),
 		modelLoader:           ml,
 		statuses:              make(map[string]*GalleryOpStatus),
+		metrics:               metrics,
+	}
+}
+
+// installMetrics measures an installation from the galleries: how long it takes and the bytes it downloads
+type installMetrics struct {
+	metrics *MaxGPTMetricsService
+	kind    string
+	start   time.Time
+	// files holds the bytes downloaded so far for each file, as reported by the progress updates
+	files map[string]uint64
+	sync.Mutex
+}
+
+func (g *GalleryService) measureInstall(kind string) *installMetrics {
+	return &installMetrics{metrics: g.metrics, kind: kind, start: time.Now(), files: make(map[string]uint64)}
+}
+
+// progress records a progress update of the download of a file, whose size is in human readable form (e.g. "1.2 GiB")
+func (i *installMetrics) progress(fileName string, current string) {
+	if i.metrics == nil {
+		return
+	}
+	written, err := humanize.ParseBytes(current)
+	if err != nil {
+		return
+	}
+	i.Lock()
+	defer i.Unlock()
+	i.files[fileName] = written
+}
+
+func (i *installMetrics) done(err error) {
+	if i.metrics == nil {
+		return
+	}
+	i.Lock()
+	defer i.Unlock()
+	var downloaded uint64
+	for _, written := range i.files {
+		downloaded += written
 	}
+	i.metrics.ObserveGalleryOperation(i.kind, int64(downloaded), time.Since(i.start), err)
 }
 
 func (g *GalleryService) UpdateStatus(s string, op *GalleryOpStatus) {
@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"time"
 
 	"github.com/rs/zerolog/log"
 	"go.opentelemetry.io/otel/attribute"
@@ -13,6 +14,46 @@ import (
 type MaxGPTMetricsService struct {
 	Meter         metric.Meter
 	ApiTimeMetric metric.Float64Histogram
+	// ResponseCacheMetric counts the lookups of the response cache, by model and result (hit, miss or bypass)
+	ResponseCacheMetric metric.Int64Counter
+	// QueueWaitMetric is the time the requests waited in the admission queue of the models, by model, priority and
+	// result (admitted, full, timeout or canceled)
+	QueueWaitMetric metric.Float64Histogram
+	// TokensMetric counts the prompt and completion tokens, by model and type
+	TokensMetric metric.Int64Counter
+	// TimeToFirstTokenMetric and TokensPerSecondMetric are the latency and the generation speed of the predictions, by model
+	TimeToFirstTokenMetric metric.Float64Histogram
+	TokensPerSecondMetric  metric.Float64Histogram
+	// ModelLoadMetric is the time taken to start the backends, by model, backend and result (success or error)
+	ModelLoadMetric metric.Float64Histogram
+	// WatchdogKillsMetric counts the backends stopped by the watchdog, by model and reason (busy or idle)
+	WatchdogKillsMetric metric.Int64Counter
+	// GalleryOperationMetric is the time taken by the installations from the galleries, by kind (model or backend)
+	// and result, and GalleryDownloadMetric the bytes they downloaded, by kind
+	GalleryOperationMetric metric.Float64Histogram
+	GalleryDownloadMetric  metric.Int64Counter
+}
+
+// QueueStats are the requests running on a model and the ones waiting for it, see RegisterQueueStats
+type QueueStats struct {
+	Model    string
+	InFlight int
+	Queued   int
+}
+
+// BackendStats are the backends running, see RegisterBackendStats
+type BackendStats struct {
+	Loaded int
+	Busy   int
+	// Memory is the memory used by the backends, in bytes
+	Memory uint64
+}
+
+func metricResult(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
 }
 
 func (m *MaxGPTMetricsService) ObserveAPICall(method string, path string, duration float64) {
@@ -23,6 +64,115 @@ func (m *MaxGPTMetricsService) ObserveAPICall(method string, path string, durati
 	m.ApiTimeMetric.Record(context.Background(), duration, opts)
 }
 
+func (m *MaxGPTMetricsService) ObserveResponseCache(model string, result string) {
+	opts := metric.WithAttributes(
+		attribute.String("model", model),
+		attribute.String("result", result),
+	)
+	m.ResponseCacheMetric.Add(context.Background(), 1, opts)
+}
+
+func (m *MaxGPTMetricsService) ObserveQueueWait(model string, priority string, result string, duration float64) {
+	opts := metric.WithAttributes(
+		attribute.String("model", model),
+		attribute.String("priority", priority),
+		attribute.String("result", result),
+	)
+	m.QueueWaitMetric.Record(context.Background(), duration, opts)
+}
+
+// RegisterQueueStats exports the in flight and queued requests of the models returned by stats
+func (m *MaxGPTMetricsService) RegisterQueueStats(stats func() []QueueStats) error {
+	inFlight, err := m.Meter.Int64ObservableGauge("queue_in_flight_requests", metric.WithDescription("requests running on the model"))
+	if err != nil {
+		return err
+	}
+	queued, err := m.Meter.Int64ObservableGauge("queue_waiting_requests", metric.WithDescription("requests waiting for the model"))
+	if err != nil {
+		return err
+	}
+	_, err = m.Meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		for _, s := range stats() {
+			opts := metric.WithAttributes(attribute.String("model", s.Model))
+			o.ObserveInt64(inFlight, int64(s.InFlight), opts)
+			o.ObserveInt64(queued, int64(s.Queued), opts)
+		}
+		return nil
+	}, inFlight, queued)
+	return err
+}
+
+// ObserveInference records the token usage of a prediction. timeToFirstToken (in seconds) and tokensPerSecond are
+// only recorded when known.
+func (m *MaxGPTMetricsService) ObserveInference(model string, promptTokens, completionTokens int, timeToFirstToken, tokensPerSecond float64) {
+	ctx := context.Background()
+	if promptTokens > 0 {
+		m.TokensMetric.Add(ctx, int64(promptTokens), metric.WithAttributes(attribute.String("model", model), attribute.String("type", "prompt")))
+	}
+	if completionTokens > 0 {
+		m.TokensMetric.Add(ctx, int64(completionTokens), metric.WithAttributes(attribute.String("model", model), attribute.String("type", "completion")))
+	}
+	opts := metric.WithAttributes(attribute.String("model", model))
+	if timeToFirstToken > 0 {
+		m.TimeToFirstTokenMetric.Record(ctx, timeToFirstToken, opts)
+	}
+	if tokensPerSecond > 0 {
+		m.TokensPerSecondMetric.Record(ctx, tokensPerSecond, opts)
+	}
+}
+
+func (m *MaxGPTMetricsService) ObserveModelLoad(model string, backend string, duration time.Duration, err error) {
+	opts := metric.WithAttributes(
+		attribute.String("model", model),
+		attribute.String("backend", backend),
+		attribute.String("result", metricResult(err)),
+	)
+	m.ModelLoadMetric.Record(context.Background(), duration.Seconds(), opts)
+}
+
+func (m *MaxGPTMetricsService) ObserveWatchdogKill(model string, reason string) {
+	opts := metric.WithAttributes(
+		attribute.String("model", model),
+		attribute.String("reason", reason),
+	)
+	m.WatchdogKillsMetric.Add(context.Background(), 1, opts)
+}
+
+func (m *MaxGPTMetricsService) ObserveGalleryOperation(kind string, downloaded int64, duration time.Duration, err error) {
+	ctx := context.Background()
+	m.GalleryOperationMetric.Record(ctx, duration.Seconds(), metric.WithAttributes(
+		attribute.String("kind", kind),
+		attribute.String("result", metricResult(err)),
+	))
+	if downloaded > 0 {
+		m.GalleryDownloadMetric.Add(ctx, downloaded, metric.WithAttributes(attribute.String("kind", kind)))
+	}
+}
+
+// RegisterBackendStats exports the backends returned by stats
+func (m *MaxGPTMetricsService) RegisterBackendStats(stats func() BackendStats) error {
+	loaded, err := m.Meter.Int64ObservableGauge("backends_loaded", metric.WithDescription("backends running"))
+	if err != nil {
+		return err
+	}
+	busy, err := m.Meter.Int64ObservableGauge("backends_busy", metric.WithDescription("backends running a request"))
+	if err != nil {
+		return err
+	}
+	memory, err := m.Meter.Int64ObservableGauge("backends_memory", metric.WithDescription("memory used by the backends"), metric.WithUnit("By"))
+	if err != nil {
+		return err
+	}
+	_, err = m.Meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		s := stats()
+		o.ObserveInt64(loaded, int64(s.Loaded))
+		o.ObserveInt64(busy, int64(s.Busy))
+		o.ObserveInt64(memory, int64(s.Memory))
+		return nil
+	}, loaded, busy, memory)
+	return err
+}
+
 // setupOTelSDK bootstraps the OpenTelemetry pipeline.
 // If it does not return an error, make sure to call shutdown for proper cleanup.
 func NewMaxGPTMetricsService() (*MaxGPTMetricsService, error) {
@@ -38,9 +188,66 @@ func NewMaxGPTMetricsService() (*MaxGPTMetricsService, error) {
 		return nil, err
 	}
 
+	responseCacheMetric, err := meter.Int64Counter("response_cache_requests", metric.WithDescription("response cache lookups, by result"))
+	if err != nil {
+		return nil, err
+	}
+
+	queueWaitMetric, err := meter.Float64Histogram("queue_wait", metric.WithDescription("time spent waiting in the queue of the models"), metric.WithUnit("s"))
+	if err != nil {
+		return nil, err
+	}
+
+	tokensMetric, err := meter.Int64Counter("inference_tokens", metric.WithDescription("prompt and completion tokens, by type"))
+	if err != nil {
+		return nil, err
+	}
+
+	timeToFirstTokenMetric, err := meter.Float64Histogram("inference_time_to_first_token", metric.WithDescription("time until the first token of the predictions"), metric.WithUnit("s"))
+	if err != nil {
+		return nil, err
+	}
+
+	tokensPerSecondMetric, err := meter.Float64Histogram("inference_tokens_per_second", metric.WithDescription("generation speed of the predictions"),
+		metric.WithExplicitBucketBoundaries(1, 2.5, 5, 10, 20, 40, 80, 160, 320, 640))
+	if err != nil {
+		return nil, err
+	}
+
+	modelLoadMetric, err := meter.Float64Histogram("model_load", metric.WithDescription("time taken to start the backends, by result"), metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.5, 1, 2.5, 5, 10, 30, 60, 120, 300))
+	if err != nil {
+		return nil, err
+	}
+
+	watchdogKillsMetric, err := meter.Int64Counter("watchdog_kills", metric.WithDescription("backends stopped by the watchdog, by reason"))
+	if err != nil {
+		return nil, err
+	}
+
+	galleryOperationMetric, err := meter.Float64Histogram("gallery_operation", metric.WithDescription("time taken by the installations from the galleries, by result"), metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(1, 5, 15, 30, 60, 120, 300, 600, 1800, 3600))
+	if err != nil {
+		return nil, err
+	}
+
+	galleryDownloadMetric, err := meter.Int64Counter("gallery_download", metric.WithDescription("bytes downloaded by the installations from the galleries"), metric.WithUnit("By"))
+	if err != nil {
+		return nil, err
+	}
+
 	return &MaxGPTMetricsService{
-		Meter:         meter,
-		ApiTimeMetric: apiTimeMetric,
+		Meter:                  meter,
+		ApiTimeMetric:          apiTimeMetric,
+		ResponseCacheMetric:    responseCacheMetric,
+		QueueWaitMetric:        queueWaitMetric,
+		TokensMetric:           tokensMetric,
+		TimeToFirstTokenMetric: timeToFirstTokenMetric,
+		TokensPerSecondMetric:  tokensPerSecondMetric,
+		ModelLoadMetric:        modelLoadMetric,
+		WatchdogKillsMetric:    watchdogKillsMetric,
+		GalleryOperationMetric: galleryOperationMetric,
+		GalleryDownloadMetric:  galleryDownloadMetric,
 	}, nil
 }
 
@@ -0,0 +1,49 @@
+package services_test
+
+import (
+	"errors"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/mudler/LocalAI/core/services"
+)
+
+var _ = Describe("MaxGPTMetricsService", func() {
+	It("exports the inference, backend and gallery metrics", func() {
+		// The exporter registers on the default Prometheus registry, so the service is created only once
+		metrics, err := services.NewMaxGPTMetricsService()
+		Expect(err).ToNot(HaveOccurred())
+
+		metrics.ObserveInference("llama", 12, 30, 0.25, 42)
+		metrics.ObserveModelLoad("llama", "llama-cpp", 3*time.Second, nil)
+		metrics.ObserveModelLoad("whisper", "whisper", time.Second, errors.New("boom"))
+		metrics.ObserveWatchdogKill("llama", "idle")
+		metrics.ObserveGalleryOperation("model", 2048, time.Minute, nil)
+		Expect(metrics.RegisterBackendStats(func() services.BackendStats {
+			return services.BackendStats{Loaded: 2, Busy: 1, Memory: 1024}
+		})).To(Succeed())
+		Expect(metrics.RegisterQueueStats(func() []services.QueueStats {
+			return []services.QueueStats{{Model: "llama", InFlight: 1, Queued: 3}}
+		})).To(Succeed())
+
+		recorder := httptest.NewRecorder()
+		promhttp.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+		body := recorder.Body.String()
+
+		Expect(body).To(ContainSubstring(`inference_tokens_total{model="llama",otel_scope_name="github.com/mudler/LocalAI",otel_scope_version="",type="completion"} 30`))
+		Expect(body).To(ContainSubstring(`inference_tokens_total{model="llama",otel_scope_name="github.com/mudler/LocalAI",otel_scope_version="",type="prompt"} 12`))
+		Expect(body).To(ContainSubstring(`inference_time_to_first_token_seconds_count{model="llama"`))
+		Expect(body).To(ContainSubstring(`inference_tokens_per_second_sum{model="llama",otel_scope_name="github.com/mudler/LocalAI",otel_scope_version=""} 42`))
+		Expect(body).To(ContainSubstring(`model_load_seconds_count{backend="whisper",model="whisper",otel_scope_name="github.com/mudler/LocalAI",otel_scope_version="",result="error"} 1`))
+		Expect(body).To(ContainSubstring(`watchdog_kills_total{model="llama",otel_scope_name="github.com/mudler/LocalAI",otel_scope_version="",reason="idle"} 1`))
+		Expect(body).To(ContainSubstring(`gallery_download_bytes_total{kind="model",otel_scope_name="github.com/mudler/LocalAI",otel_scope_version=""} 2048`))
+		Expect(body).To(ContainSubstring(`gallery_operation_seconds_count{kind="model"`))
+		Expect(body).To(ContainSubstring(`backends_loaded{otel_scope_name="github.com/mudler/LocalAI",otel_scope_version=""} 2`))
+		Expect(body).To(ContainSubstring(`backends_memory_bytes{otel_scope_name="github.com/mudler/LocalAI",otel_scope_version=""} 1024`))
+		Expect(body).To(ContainSubstring(`queue_waiting_requests{model="llama",otel_scope_name="github.com/mudler/LocalAI",otel_scope_version=""} 3`))
+	})
+})
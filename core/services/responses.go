@@ -0,0 +1,133 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+
+	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/core/schema"
+)
+
+var ErrResponseNotFound = errors.New("response not found")
+var ErrInvalidResponseID = errors.New("invalid response id")
+
+var validObjectID = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// StoredResponse is a response of the Responses API along with the conversation
+// that produced it, so that later requests can chain to it with previous_response_id
+type StoredResponse struct {
+	Response schema.OpenResponsesResponse `json:"response"`
+	// Messages is the conversation (inputs and outputs, without instructions) in chat format
+	Messages []schema.Message `json:"messages"`
+	// Owner is the ID of the API key that created the response
+	Owner string `json:"owner,omitempty"`
+}
+
+// ResponseStore persists responses created through the Responses API.
+// The responses belong to the API key that created them, the other keys cannot get or delete them.
+type ResponseStore interface {
+	Get(id string, policy *config.ApiKeyPolicy) (*StoredResponse, error)
+	Set(r *StoredResponse, policy *config.ApiKeyPolicy) error
+	Delete(id string, policy *config.ApiKeyPolicy) error
+}
+
+// FileResponseStore is a ResponseStore which keeps every response in its own JSON file
+type FileResponseStore struct {
+	path string
+	sync.RWMutex
+}
+
+func NewFileResponseStore(path string) (*FileResponseStore, error) {
+	if err := os.MkdirAll(path, 0750); err != nil {
+		return nil, fmt.Errorf("unable to create responses path: %w", err)
+	}
+	return &FileResponseStore{path: path}, nil
+}
+
+func (s *FileResponseStore) file(id string) (string, error) {
+	if !validObjectID.MatchString(id) {
+		return "", fmt.Errorf("%w %q", ErrInvalidResponseID, id)
+	}
+	return filepath.Join(s.path, id+".json"), nil
+}
+
+func (s *FileResponseStore) Get(id string, policy *config.ApiKeyPolicy) (*StoredResponse, error) {
+	s.RLock()
+	defer s.RUnlock()
+	return s.get(id, policy)
+}
+
+// get reads a response, callers must hold the lock
+func (s *FileResponseStore) get(id string, policy *config.ApiKeyPolicy) (*StoredResponse, error) {
+	f, err := s.file(id)
+	if err != nil {
+		return nil, err
+	}
+
+	dat, err := os.ReadFile(f)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrResponseNotFound
+		}
+		return nil, err
+	}
+
+	r := &StoredResponse{}
+	if err := json.Unmarshal(dat, r); err != nil {
+		return nil, err
+	}
+	if !canAccess(r.Owner, policy) {
+		return nil, ErrResponseNotFound
+	}
+	return r, nil
+}
+
+// Set stores a response, owned by the key of the policy
+func (s *FileResponseStore) Set(r *StoredResponse, policy *config.ApiKeyPolicy) error {
+	f, err := s.file(r.Response.ID)
+	if err != nil {
+		return err
+	}
+
+	r.Owner = ownerOf(policy)
+	dat, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	// write to a temporary file first, so a crash never leaves a truncated response behind
+	tmp := f + ".tmp"
+	if err := os.WriteFile(tmp, dat, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f)
+}
+
+func (s *FileResponseStore) Delete(id string, policy *config.ApiKeyPolicy) error {
+	f, err := s.file(id)
+	if err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if _, err := s.get(id, policy); err != nil {
+		return err
+	}
+	if err := os.Remove(f); err != nil {
+		if os.IsNotExist(err) {
+			return ErrResponseNotFound
+		}
+		return err
+	}
+	return nil
+}
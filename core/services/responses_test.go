@@ -0,0 +1,53 @@
+package services_test
+
+import (
+	"os"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/core/services"
+)
+
+var _ = Describe("FileResponseStore", func() {
+	var (
+		tmpDir string
+		store  *services.FileResponseStore
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = os.MkdirTemp("", "responses")
+		Expect(err).ToNot(HaveOccurred())
+		store, err = services.NewFileResponseStore(tmpDir)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	It("hides the responses from the other keys", func() {
+		owner := &config.ApiKeyPolicy{Key: "sk-owner"}
+		other := &config.ApiKeyPolicy{Key: "sk-other"}
+		admin := &config.ApiKeyPolicy{Key: "sk-admin", Admin: true}
+
+		Expect(store.Set(&services.StoredResponse{Response: schema.OpenResponsesResponse{ID: "resp_1"}}, owner)).To(Succeed())
+
+		r, err := store.Get("resp_1", owner)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(r.Response.ID).To(Equal("resp_1"))
+		_, err = store.Get("resp_1", admin)
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = store.Get("resp_1", other)
+		Expect(err).To(MatchError(services.ErrResponseNotFound))
+		Expect(store.Delete("resp_1", other)).To(MatchError(services.ErrResponseNotFound))
+
+		Expect(store.Delete("resp_1", owner)).To(Succeed())
+		_, err = store.Get("resp_1", owner)
+		Expect(err).To(MatchError(services.ErrResponseNotFound))
+	})
+})
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/internal"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+const tracingServiceName = "maxgpt"
+
+// TracingService exports the spans of the requests, from the HTTP handlers down to the gRPC calls to the backends,
+// to an OTLP endpoint and/or a local file. It is installed as the global OpenTelemetry tracer provider.
+type TracingService struct {
+	provider *sdktrace.TracerProvider
+	file     *os.File
+}
+
+// NewTracingService configures the tracing from the application config, it returns nil if tracing is disabled
+func NewTracingService(appConfig *config.ApplicationConfig) (*TracingService, error) {
+	if !appConfig.TracingEnabled() {
+		return nil, nil
+	}
+
+	t := &TracingService{}
+	opts := []sdktrace.TracerProviderOption{}
+
+	if appConfig.TracingEndpoint != "" {
+		exporter, err := newOTLPExporter(appConfig.TracingEndpoint, appConfig.TracingProtocol)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	}
+
+	if appConfig.TracingFile != "" {
+		file, err := os.OpenFile(appConfig.TracingFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open the tracing file: %w", err)
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		t.file = file
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(tracingServiceName),
+		semconv.ServiceVersion(internal.PrintableVersion()),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	ratio := appConfig.TracingSampleRatio
+	if ratio <= 0 || ratio > 1 {
+		ratio = 1
+	}
+	opts = append(opts,
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	)
+
+	t.provider = sdktrace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(t.provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	log.Info().Str("endpoint", appConfig.TracingEndpoint).Str("file", appConfig.TracingFile).Float64("sample_ratio", ratio).Msg("Tracing enabled")
+	return t, nil
+}
+
+// newOTLPExporter creates the exporter to the OTLP endpoint, e.g. "http://otel-collector:4317", using the grpc or http protocol
+func newOTLPExporter(endpoint, protocol string) (sdktrace.SpanExporter, error) {
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "http://" + endpoint
+	}
+	switch protocol {
+	case "", "grpc":
+		return otlptracegrpc.New(context.Background(), otlptracegrpc.WithEndpointURL(endpoint))
+	case "http", "http/protobuf":
+		return otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(endpoint))
+	}
+	return nil, fmt.Errorf("unknown tracing protocol %q, expected grpc or http", protocol)
+}
+
+// Shutdown exports the pending spans and stops the exporters
+func (t *TracingService) Shutdown(ctx context.Context) error {
+	err := t.provider.Shutdown(ctx)
+	if t.file != nil {
+		err = errors.Join(err, t.file.Close())
+	}
+	return err
+}
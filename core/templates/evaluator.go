@@ -28,6 +28,8 @@ type ChatMessageTemplateData struct {
 	Role         string
 	RoleName     string
 	FunctionName string
+	// ToolCallID is the ID of the tool call the message is the result of
+	ToolCallID   string
 	Content      string
 	MessageIndex int
 	Function     bool
@@ -35,14 +37,32 @@ type ChatMessageTemplateData struct {
 	LastMessage  bool
 }
 
+// RetrievalTemplateData is the data of the template rendering the chunks retrieved from a collection for a chat request
+type RetrievalTemplateData struct {
+	Collection string
+	Query      string
+	Chunks     []schema.CollectionChunk
+}
+
 const (
 	ChatPromptTemplate TemplateType = iota
 	ChatMessageTemplate
 	CompletionPromptTemplate
 	EditPromptTemplate
 	FunctionsPromptTemplate
+	RetrievalTemplate
 )
 
+// DefaultRetrievalTemplate renders the retrieved chunks as the context of the conversation
+const DefaultRetrievalTemplate = `Use the following context to answer the user. If the context does not contain the answer, say so.
+
+Context:
+{{- range .Chunks }}
+---
+{{ .Text }}
+{{- end }}
+---`
+
 type Evaluator struct {
 	cache *templateCache
 }
@@ -91,6 +111,15 @@ func (e *Evaluator) EvaluateTemplateForPrompt(templateType TemplateType, config
 	return e.cache.evaluateTemplate(templateType, template, in)
 }
 
+// TemplateRetrieval renders the chunks retrieved for a chat request, to be injected as a system message
+func (e *Evaluator) TemplateRetrieval(config config.BackendConfig, in RetrievalTemplateData) (string, error) {
+	template := config.TemplateConfig.Retrieval
+	if template == "" {
+		template = DefaultRetrievalTemplate
+	}
+	return e.cache.evaluateTemplate(RetrievalTemplate, template, in)
+}
+
 func (e *Evaluator) evaluateTemplateForChatMessage(templateName string, messageData ChatMessageTemplateData) (string, error) {
 	return e.cache.evaluateTemplate(ChatMessageTemplate, templateName, messageData)
 }
@@ -107,9 +136,10 @@ func (e *Evaluator) templateJinjaChat(templateName string, messageData []ChatMes
 		var data []byte
 		data, _ = json.Marshal(message.FunctionCall)
 		messages = append(messages, map[string]interface{}{
-			"role":      message.RoleName,
-			"content":   message.Content,
-			"tool_call": string(data),
+			"role":         message.RoleName,
+			"content":      message.Content,
+			"tool_call":    string(data),
+			"tool_call_id": message.ToolCallID,
 		})
 	}
 
@@ -149,6 +179,7 @@ func (e *Evaluator) TemplateMessages(messages []schema.Message, config *config.B
 				Content:      i.StringContent,
 				FunctionCall: fcall,
 				FunctionName: i.Name,
+				ToolCallID:   i.ToolCallID,
 				LastMessage:  messageIndex == (len(messages) - 1),
 				Function:     config.Grammar != "" && (messageIndex == (len(messages) - 1)),
 				MessageIndex: messageIndex,
@@ -194,6 +225,7 @@ func (e *Evaluator) TemplateMessages(messages []schema.Message, config *config.B
 				Content:      i.StringContent,
 				FunctionCall: fcall,
 				FunctionName: i.Name,
+				ToolCallID:   i.ToolCallID,
 				LastMessage:  messageIndex == (len(messages) - 1),
 				Function:     config.Grammar != "" && (messageIndex == (len(messages) - 1)),
 				MessageIndex: messageIndex,
@@ -250,4 +250,23 @@ var _ = Describe("Templates", func() {
 			})
 		}
 	})
+	Context("retrieval", func() {
+		var evaluator *Evaluator
+		BeforeEach(func() {
+			evaluator = NewEvaluator("")
+		})
+		chunks := []schema.CollectionChunk{{Text: "LocalAI is a drop-in replacement for OpenAI."}, {Text: "It runs on CPUs."}}
+		It("renders the chunks with the default template", func() {
+			templated, err := evaluator.TemplateRetrieval(config.BackendConfig{}, RetrievalTemplateData{Query: "What is LocalAI?", Chunks: chunks})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(templated).To(HavePrefix("Use the following context"))
+			Expect(templated).To(HaveSuffix("---\nLocalAI is a drop-in replacement for OpenAI.\n---\nIt runs on CPUs.\n---"))
+		})
+		It("renders the chunks with the template of the model", func() {
+			cfg := config.BackendConfig{TemplateConfig: config.TemplateConfig{Retrieval: `{{.Query}}:{{range .Chunks}} [{{.Text}}]{{end}}`}}
+			templated, err := evaluator.TemplateRetrieval(cfg, RetrievalTemplateData{Query: "What is LocalAI?", Chunks: chunks})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(templated).To(Equal("What is LocalAI?: [LocalAI is a drop-in replacement for OpenAI.] [It runs on CPUs.]"))
+		})
+	})
 })
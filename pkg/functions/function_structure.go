@@ -9,6 +9,34 @@ import (
 type Item struct {
 	Type       string                 `json:"type"`
 	Properties map[string]interface{} `json:"properties"`
+	// Keywords are the other keywords of the schema, e.g. required, items or $defs
+	Keywords map[string]interface{} `json:"-"`
+}
+
+func (i Item) MarshalJSON() ([]byte, error) {
+	item := map[string]interface{}{}
+	for k, v := range i.Keywords {
+		item[k] = v
+	}
+	item["type"] = i.Type
+	item["properties"] = i.Properties
+	return json.Marshal(item)
+}
+
+func (i *Item) UnmarshalJSON(data []byte) error {
+	var item map[string]interface{}
+	if err := json.Unmarshal(data, &item); err != nil {
+		return err
+	}
+	i.Type, _ = item["type"].(string)
+	i.Properties, _ = item["properties"].(map[string]interface{})
+	delete(item, "type")
+	delete(item, "properties")
+	i.Keywords = nil
+	if len(item) > 0 {
+		i.Keywords = item
+	}
+	return nil
 }
 
 type JSONFunctionStructure struct {
@@ -26,6 +26,9 @@ type FunctionName struct {
 type Argument struct {
 	Type       string                 `json:"type"`
 	Properties map[string]interface{} `json:"properties"`
+	// Required are the required properties, all of them if unset. An empty list makes them all optional.
+	Required             *[]string   `json:"required,omitempty"`
+	AdditionalProperties interface{} `json:"additionalProperties,omitempty"`
 }
 
 type Tool struct {
@@ -68,12 +71,22 @@ func (f Functions) ToJSONStructure(name, args string) JSONFunctionStructure {
 		if js.Defs == nil {
 			js.Defs = defsD
 		}
+		var required *[]string
+		if r, exists := function.Parameters["required"]; exists {
+			required = &[]string{}
+			dat, _ := json.Marshal(r)
+			if err := json.Unmarshal(dat, required); err != nil {
+				log.Error().Err(err).Msg("error unmarshalling the required properties")
+			}
+		}
 
 		property := map[string]interface{}{}
 		property[nameKey] = FunctionName{Const: function.Name}
 		property[argsKey] = Argument{
-			Type:       "object",
-			Properties: prop,
+			Type:                 "object",
+			Properties:           prop,
+			Required:             required,
+			AdditionalProperties: function.Parameters["additionalProperties"],
 		}
 		js.OneOf = append(js.OneOf, Item{
 			Type:       "object",
@@ -1,6 +1,8 @@
 package functions_test
 
 import (
+	"encoding/json"
+
 	. "github.com/mudler/LocalAI/pkg/functions"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -65,6 +67,56 @@ var _ = Describe("MaxGPT grammar functions", func() {
 			Expect(fnName.Const).To(Equal("search"))
 			Expect(fnArgs.Properties["query"].(map[string]interface{})["type"]).To(Equal("string"))
 		})
+
+		It("keeps the required properties of the arguments", func() {
+			var functions Functions = []Function{
+				{
+					Name: "search",
+					Parameters: map[string]interface{}{
+						"properties": map[string]interface{}{
+							"query": map[string]interface{}{"type": "string"},
+							"limit": map[string]interface{}{"type": "integer"},
+						},
+						"required":             []interface{}{"query"},
+						"additionalProperties": false,
+					},
+				},
+			}
+
+			fnArgs := functions.ToJSONStructure("name", "arguments").OneOf[0].Properties["arguments"].(Argument)
+			Expect(*fnArgs.Required).To(Equal([]string{"query"}))
+			Expect(fnArgs.AdditionalProperties).To(Equal(false))
+		})
+
+		It("keeps an empty list of required properties", func() {
+			var functions Functions = []Function{
+				{
+					Name: "search",
+					Parameters: map[string]interface{}{
+						"properties": map[string]interface{}{
+							"query": map[string]interface{}{"type": "string"},
+						},
+						"required": []interface{}{},
+					},
+				},
+			}
+
+			dat, err := json.Marshal(functions.ToJSONStructure("name", "arguments").OneOf[0].Properties["arguments"])
+			Expect(err).ToNot(HaveOccurred())
+			Expect(dat).To(MatchJSON(`{"type": "object", "properties": {"query": {"type": "string"}}, "required": []}`))
+		})
+	})
+	Describe("Item", func() {
+		It("keeps the keywords of the schema", func() {
+			var item Item
+			Expect(json.Unmarshal([]byte(`{"type": "array", "items": {"type": "string"}, "maxItems": 2}`), &item)).To(Succeed())
+			Expect(item.Type).To(Equal("array"))
+			Expect(item.Keywords).To(HaveKeyWithValue("maxItems", float64(2)))
+
+			dat, err := json.Marshal(item)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(dat).To(MatchJSON(`{"type": "array", "properties": null, "items": {"type": "string"}, "maxItems": 2}`))
+		})
 	})
 	Context("Select()", func() {
 		It("selects one of the functions and returns a list containing only the selected one", func() {
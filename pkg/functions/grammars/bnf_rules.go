@@ -24,6 +24,29 @@ var (
 		"null": `"null" space`,
 	}
 
+	// SCHEMA_RULES are the rules the keywords of the JSON schemas use: the characters of the strings, the values of
+	// any type, and the string formats
+	SCHEMA_RULES = map[string]string{
+		"char":   `[^"\\\x00-\x1F] | "\\" (["\\/bfnrt] | "u" [0-9a-fA-F]{4})`,
+		"value":  `object | array | string | number | boolean | null`,
+		"object": `"{" space (string ":" space value ("," space string ":" space value)*)? "}" space`,
+		"array":  `"[" space (value ("," space value)*)? "]" space`,
+		// February has 28 days, the leap years aren't known
+		"date":      `[0-9]{4} "-" (("0" [13578] | "1" [02]) "-" ("0" [1-9] | [12] [0-9] | "3" [01]) | ("0" [469] | "11") "-" ("0" [1-9] | [12] [0-9] | "30") | "02" "-" ("0" [1-9] | "1" [0-9] | "2" [0-8]))`,
+		"time":      `([01] [0-9] | "2" [0-3]) ":" [0-5] [0-9] ":" [0-5] [0-9] ("." [0-9]+)? ("Z" | [+-] ([01] [0-9] | "2" [0-3]) ":" [0-5] [0-9])`,
+		"date-time": `date "T" time`,
+		"uuid":      `[0-9a-fA-F]{8} "-" [0-9a-fA-F]{4} "-" [0-9a-fA-F]{4} "-" [0-9a-fA-F]{4} "-" [0-9a-fA-F]{12}`,
+		"email":     `[a-zA-Z0-9_%+-]+ ("." [a-zA-Z0-9_%+-]+)* "@" [a-zA-Z0-9]+ ("-" [a-zA-Z0-9]+)* ("." [a-zA-Z0-9]+ ("-" [a-zA-Z0-9]+)*)* "." [a-zA-Z]{2,}`,
+	}
+
+	// schemaRuleDependencies are the rules each rule of SCHEMA_RULES refers to
+	schemaRuleDependencies = map[string][]string{
+		"value":     {"object", "array", "string", "number", "boolean", "null"},
+		"object":    {"string", "value"},
+		"array":     {"value"},
+		"date-time": {"date", "time"},
+	}
+
 	INVALID_RULE_CHARS_RE     = regexp.MustCompile(`[^a-zA-Z0-9-]+`)
 	GRAMMAR_LITERAL_ESCAPE_RE = regexp.MustCompile(`[\r\n"]`)
 	GRAMMAR_LITERAL_ESCAPES   = map[string]string{
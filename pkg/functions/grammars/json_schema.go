@@ -62,12 +62,21 @@ func (sc *JSONSchemaConverter) visit(schema map[string]interface{}, name string,
 	st, existType := schema["type"]
 	var schemaType string
 	if existType {
-		schemaType = st.(string)
+		schemaType, _ = st.(string)
 	}
 	ruleName := name
 	if name == "" {
 		ruleName = "root"
 	}
+	if _, allOfExists := schema["allOf"]; allOfExists {
+		merged, err := mergeAllOf(schema, func(ref string) (map[string]interface{}, error) {
+			return sc.resolveReference(ref, rootSchema)
+		})
+		if err != nil {
+			return "", err
+		}
+		return sc.visit(merged, name, rootSchema)
+	}
 	_, oneOfExists := schema["oneOf"]
 	_, anyOfExists := schema["anyOf"]
 	if oneOfExists || anyOfExists {
@@ -118,59 +127,8 @@ func (sc *JSONSchemaConverter) visit(schema map[string]interface{}, name string,
 		}
 		rule := strings.Join(enumRules, " | ")
 		return sc.addRule(ruleName, rule), nil
-	} else if properties, exists := schema["properties"].(map[string]interface{}); schemaType == "object" && exists {
-		propOrder := sc.propOrder
-		var propPairs []struct {
-			propName   string
-			propSchema map[string]interface{}
-		}
-
-		for propName, propSchema := range properties {
-			propPairs = append(propPairs, struct {
-				propName   string
-				propSchema map[string]interface{}
-			}{propName: propName, propSchema: propSchema.(map[string]interface{})})
-		}
-
-		sort.Slice(propPairs, func(i, j int) bool {
-			iOrder := propOrder[propPairs[i].propName]
-			jOrder := propOrder[propPairs[j].propName]
-			if iOrder != 0 && jOrder != 0 {
-				return iOrder < jOrder
-			}
-			return propPairs[i].propName < propPairs[j].propName
-		})
-
-		var rule strings.Builder
-		rule.WriteString(`"{" space`)
-
-		for i, propPair := range propPairs {
-			propName := propPair.propName
-			propSchema := propPair.propSchema
-			propRuleName, err := sc.visit(propSchema, fmt.Sprintf("%s-%s", ruleName, propName), rootSchema)
-			if err != nil {
-				return "", err
-			}
-			lPropName, err := sc.formatLiteral(propName)
-			if err != nil {
-				return "", err
-			}
-			if i > 0 {
-				rule.WriteString(` "," space`)
-			}
-
-			rule.WriteString(fmt.Sprintf(` %s space ":" space %s`, lPropName, propRuleName))
-		}
-
-		rule.WriteString(` "}" space`)
-		return sc.addRule(ruleName, rule.String()), nil
-	} else if items, exists := schema["items"].(map[string]interface{}); schemaType == "array" && exists {
-		itemRuleName, err := sc.visit(items, fmt.Sprintf("%s-item", ruleName), rootSchema)
-		if err != nil {
-			return "", err
-		}
-		rule := fmt.Sprintf(`"[" space (%s ("," space %s)*)? "]" space`, itemRuleName, itemRuleName)
-		return sc.addRule(ruleName, rule), nil
+	} else if rule, handled, err := sc.schemaRules(rootSchema).visitKeywords(schema, ruleName); handled {
+		return rule, err
 	} else {
 		primitiveRule, exists := PRIMITIVE_RULES[schemaType]
 		if !exists {
@@ -182,6 +140,27 @@ func (sc *JSONSchemaConverter) visit(schema map[string]interface{}, name string,
 		return sc.addRule(schemaType, primitiveRule), nil
 	}
 }
+
+func (sc *JSONSchemaConverter) schemaRules(rootSchema map[string]interface{}) schemaRules {
+	return schemaRules{
+		addRule:       sc.addRule,
+		formatLiteral: sc.formatLiteral,
+		visit: func(schema map[string]interface{}, name string) (string, error) {
+			return sc.visit(schema, name, rootSchema)
+		},
+		sortProperties: func(names []string) {
+			sort.Slice(names, func(i, j int) bool {
+				iOrder := sc.propOrder[names[i]]
+				jOrder := sc.propOrder[names[j]]
+				if iOrder != 0 && jOrder != 0 {
+					return iOrder < jOrder
+				}
+				return names[i] < names[j]
+			})
+		},
+	}
+}
+
 func (sc *JSONSchemaConverter) resolveReference(ref string, rootSchema map[string]interface{}) (map[string]interface{}, error) {
 	if !strings.HasPrefix(ref, "#/$defs/") {
 		return nil, fmt.Errorf("invalid reference format: %s", ref)
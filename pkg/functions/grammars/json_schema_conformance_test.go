@@ -0,0 +1,659 @@
+package grammars_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	. "github.com/mudler/LocalAI/pkg/functions/grammars"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// The conformance tests sample strings from the grammars of the schemas, and validate them against the schemas
+
+const samplesPerSchema = 200
+
+var conformanceSchemas = map[string]string{
+	"required and optional properties": `{
+		"type": "object",
+		"properties": {
+			"name": {"type": "string", "minLength": 2, "maxLength": 5},
+			"age": {"type": "integer", "minimum": 18, "maximum": 120},
+			"email": {"type": "string", "format": "email"}
+		},
+		"required": ["name"],
+		"additionalProperties": false
+	}`,
+	"additional properties": `{
+		"type": "object",
+		"properties": {
+			"id": {"type": "string", "format": "uuid"},
+			"i": {"type": "boolean"}
+		},
+		"required": ["id"],
+		"additionalProperties": {"type": "number", "exclusiveMinimum": 0, "maximum": 1}
+	}`,
+	"patterns": `{
+		"type": "object",
+		"properties": {
+			"code": {"type": "string", "pattern": "^[A-Z]{3}-\\d{2,4}$"},
+			"tag": {"type": "string", "pattern": "(?i)ab+c"},
+			"quoted": {"type": "string", "pattern": "^[a-z\"\\\\]+(\\.|\\n)?$"}
+		}
+	}`,
+	"bounded arrays": `{
+		"type": "array",
+		"items": {"type": "integer", "minimum": -50, "exclusiveMaximum": 7},
+		"minItems": 2,
+		"maxItems": 4
+	}`,
+	"tuples": `{
+		"type": "array",
+		"prefixItems": [
+			{"type": "string", "format": "date"},
+			{"type": "string", "format": "time"}
+		],
+		"items": false
+	}`,
+	"formats and type unions": `{
+		"type": "object",
+		"properties": {
+			"when": {"type": "string", "format": "date-time"},
+			"note": {"type": ["string", "null"], "maxLength": 3}
+		},
+		"required": ["when", "note"]
+	}`,
+	"allOf and references": `{
+		"$defs": {
+			"named": {"type": "object", "properties": {"name": {"type": "string"}}, "required": ["name"]}
+		},
+		"allOf": [
+			{"$ref": "#/$defs/named"},
+			{"properties": {"score": {"type": "number", "minimum": -2.5, "maximum": 10}}, "required": ["score"]}
+		]
+	}`,
+	"anyOf with ranges": `{
+		"anyOf": [
+			{"type": "integer", "minimum": 1000},
+			{"type": "integer", "maximum": -1000},
+			{"type": "number", "minimum": -3.5, "exclusiveMaximum": -1}
+		]
+	}`,
+	"free-form values": `{
+		"type": "object",
+		"properties": {
+			"anything": {},
+			"map": {"type": "object"},
+			"list": {"type": "array"}
+		}
+	}`,
+}
+
+var _ = Describe("JSON schema grammar conformance", func() {
+	for name, schemaJSON := range conformanceSchemas {
+		It("generates values of the schema with "+name, func() {
+			var schema map[string]interface{}
+			Expect(json.Unmarshal([]byte(schemaJSON), &schema)).To(Succeed())
+
+			grammar, err := NewJSONSchemaConverter("").GrammarFromBytes([]byte(schemaJSON))
+			Expect(err).ToNot(HaveOccurred())
+			g := parseGBNF(grammar)
+			r := rand.New(rand.NewSource(1))
+			for i := 0; i < samplesPerSchema; i++ {
+				sample := g.sample(r)
+				Expect(validateSample(schema, sample)).To(Succeed(), "sample %q of grammar\n%s", sample, grammar)
+			}
+		})
+
+		It("generates arguments of the schema with "+name+" in the llama 3.1 format", func() {
+			var schema map[string]interface{}
+			Expect(json.Unmarshal([]byte(schemaJSON), &schema)).To(Succeed())
+			function := map[string]interface{}{
+				"oneOf": []interface{}{map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"function":  map[string]interface{}{"const": "f"},
+						"arguments": schema,
+					},
+				}},
+				"$defs": schema["$defs"],
+			}
+
+			grammar, err := NewLLama31SchemaConverter("function").Grammar(function)
+			Expect(err).ToNot(HaveOccurred())
+			g := parseGBNF(grammar)
+			r := rand.New(rand.NewSource(1))
+			for i := 0; i < samplesPerSchema; i++ {
+				sample := g.sample(r)
+				Expect(sample).To(HavePrefix("<function=f>{"))
+				Expect(sample).To(HaveSuffix("}</function>"))
+				arguments := strings.TrimSuffix(strings.TrimPrefix(sample, "<function=f>{"), "}</function>")
+				Expect(validateSample(schema, arguments)).To(Succeed(), "sample %q of grammar\n%s", sample, grammar)
+			}
+		})
+	}
+
+	It("generates objects with and without the optional properties", func() {
+		grammar, err := NewJSONSchemaConverter("").GrammarFromBytes([]byte(conformanceSchemas["required and optional properties"]))
+		Expect(err).ToNot(HaveOccurred())
+		g := parseGBNF(grammar)
+		r := rand.New(rand.NewSource(1))
+
+		withAge, withoutAge := false, false
+		for i := 0; i < samplesPerSchema; i++ {
+			var object map[string]interface{}
+			Expect(json.Unmarshal([]byte(g.sample(r)), &object)).To(Succeed())
+			Expect(object).To(HaveKey("name"))
+			_, hasAge := object["age"]
+			withAge = withAge || hasAge
+			withoutAge = withoutAge || !hasAge
+		}
+		Expect(withAge).To(BeTrue())
+		Expect(withoutAge).To(BeTrue())
+	})
+
+	It("keeps all the properties required without the required keyword", func() {
+		grammar, err := NewJSONSchemaConverter("").GrammarFromBytes([]byte(`{"type": "object", "properties": {"a": {"type": "string"}, "b": {"type": "integer"}}}`))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(grammar).To(ContainSubstring(`root ::= "{" space "\"a\"" space ":" space string "," space "\"b\"" space ":" space integer "}" space`))
+	})
+
+	It("refuses the bounds no number is within", func() {
+		_, err := NewJSONSchemaConverter("").GrammarFromBytes([]byte(`{"type": "integer", "minimum": 5, "maximum": 4}`))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("leaves out the patterns with anchors in the middle", func() {
+		grammar, err := NewJSONSchemaConverter("").GrammarFromBytes([]byte(`{"type": "string", "pattern": "^a|b$", "maxLength": 3}`))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(grammar).To(ContainSubstring(`root ::= "\"" char{0,3} "\"" space`))
+	})
+})
+
+// gbnfNode is a node of a parsed GBNF rule
+type gbnfNode struct {
+	op       byte // '|' alternatives, ' ' sequence, '"' literal, '[' class, 'r' rule reference, '*' repetition
+	children []*gbnfNode
+	text     string
+	ranges   []rune
+	negated  bool
+	min, max int
+}
+
+type gbnf struct {
+	rules map[string]*gbnfNode
+}
+
+var gbnfRuleRE = regexp.MustCompile(`(?m)^([a-zA-Z0-9-]+)\s*::=`)
+
+func parseGBNF(grammar string) *gbnf {
+	g := &gbnf{rules: map[string]*gbnfNode{}}
+	matches := gbnfRuleRE.FindAllStringSubmatchIndex(grammar, -1)
+	for i, m := range matches {
+		end := len(grammar)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+		p := &gbnfParser{s: []rune(grammar[m[1]:end])}
+		g.rules[grammar[m[2]:m[3]]] = p.alternatives()
+		p.skipSpaces()
+		ExpectWithOffset(1, p.pos).To(Equal(len(p.s)), "rule %s", grammar[m[2]:m[3]])
+	}
+	ExpectWithOffset(1, g.rules).To(HaveKey("root"))
+	return g
+}
+
+type gbnfParser struct {
+	s   []rune
+	pos int
+}
+
+func (p *gbnfParser) skipSpaces() {
+	for p.pos < len(p.s) && strings.ContainsRune(" \t\r\n", p.s[p.pos]) {
+		p.pos++
+	}
+}
+
+func (p *gbnfParser) alternatives() *gbnfNode {
+	node := &gbnfNode{op: '|', children: []*gbnfNode{p.sequence()}}
+	for p.skipSpaces(); p.pos < len(p.s) && p.s[p.pos] == '|'; p.skipSpaces() {
+		p.pos++
+		node.children = append(node.children, p.sequence())
+	}
+	return node
+}
+
+func (p *gbnfParser) sequence() *gbnfNode {
+	node := &gbnfNode{op: ' '}
+	for p.skipSpaces(); p.pos < len(p.s) && p.s[p.pos] != '|' && p.s[p.pos] != ')'; p.skipSpaces() {
+		item := p.primary()
+		for p.pos < len(p.s) && strings.ContainsRune("*+?{", p.s[p.pos]) {
+			repeat := &gbnfNode{op: '*', children: []*gbnfNode{item}, max: -1}
+			switch p.s[p.pos] {
+			case '+':
+				repeat.min = 1
+			case '?':
+				repeat.max = 1
+			case '{':
+				end := p.pos + strings.IndexRune(string(p.s[p.pos:]), '}')
+				bounds := strings.Split(string(p.s[p.pos+1:end]), ",")
+				repeat.min, _ = strconv.Atoi(bounds[0])
+				repeat.max = repeat.min
+				if len(bounds) == 2 {
+					repeat.max = -1
+					if bounds[1] != "" {
+						repeat.max, _ = strconv.Atoi(bounds[1])
+					}
+				}
+				p.pos = end
+			}
+			p.pos++
+			item = repeat
+		}
+		node.children = append(node.children, item)
+	}
+	return node
+}
+
+func (p *gbnfParser) primary() *gbnfNode {
+	switch c := p.s[p.pos]; {
+	case c == '"':
+		p.pos++
+		var literal strings.Builder
+		for p.s[p.pos] != '"' {
+			literal.WriteRune(p.char())
+		}
+		p.pos++
+		return &gbnfNode{op: '"', text: literal.String()}
+	case c == '[':
+		p.pos++
+		node := &gbnfNode{op: '['}
+		if p.s[p.pos] == '^' {
+			node.negated = true
+			p.pos++
+		}
+		for p.s[p.pos] != ']' {
+			lo := p.char()
+			hi := lo
+			if p.s[p.pos] == '-' && p.s[p.pos+1] != ']' {
+				p.pos++
+				hi = p.char()
+			}
+			node.ranges = append(node.ranges, lo, hi)
+		}
+		p.pos++
+		return node
+	case c == '(':
+		p.pos++
+		node := p.alternatives()
+		Expect(p.s[p.pos]).To(Equal(')'))
+		p.pos++
+		return node
+	default:
+		start := p.pos
+		for p.pos < len(p.s) && (p.s[p.pos] == '-' || p.s[p.pos] >= '0' && p.s[p.pos] <= '9' || p.s[p.pos] >= 'a' && p.s[p.pos] <= 'z' || p.s[p.pos] >= 'A' && p.s[p.pos] <= 'Z') {
+			p.pos++
+		}
+		Expect(p.pos).To(BeNumerically(">", start), "unexpected %q", string(p.s[p.pos:]))
+		return &gbnfNode{op: 'r', text: string(p.s[start:p.pos])}
+	}
+}
+
+// char reads a character of a literal or of a class, with its escapes
+func (p *gbnfParser) char() rune {
+	c := p.s[p.pos]
+	p.pos++
+	if c != '\\' {
+		return c
+	}
+	c = p.s[p.pos]
+	p.pos++
+	hexDigits := map[rune]int{'x': 2, 'u': 4, 'U': 8}[c]
+	if hexDigits > 0 {
+		v, err := strconv.ParseUint(string(p.s[p.pos:p.pos+hexDigits]), 16, 32)
+		Expect(err).ToNot(HaveOccurred())
+		p.pos += hexDigits
+		return rune(v)
+	}
+	switch c {
+	case 'n':
+		return '\n'
+	case 'r':
+		return '\r'
+	case 't':
+		return '\t'
+	}
+	return c
+}
+
+// sampleCharacters are the characters the classes are sampled from. The control characters are left out, as the
+// string primitive doesn't escape them.
+var sampleCharacters = []rune(" !#$%&'()*+,-./0123456789:;<=>?@ABCDEFGHIJKLMNOPQRSTUVWXYZ[]^_`abcdefghijklmnopqrstuvwxyz{|}~é日\"\\")
+
+func (g *gbnf) sample(r *rand.Rand) string {
+	var out strings.Builder
+	g.sampleNode(r, g.rules["root"], 0, &out)
+	return out.String()
+}
+
+func (g *gbnf) sampleNode(r *rand.Rand, node *gbnfNode, depth int, out *strings.Builder) {
+	// Past some depth, the values are the simplest ones so that the samples end
+	deep := depth > 40
+	switch node.op {
+	case '|':
+		child := node.children[r.Intn(len(node.children))]
+		if deep {
+			child = node.children[len(node.children)-1]
+		}
+		g.sampleNode(r, child, depth, out)
+	case ' ':
+		for _, child := range node.children {
+			g.sampleNode(r, child, depth, out)
+		}
+	case '"':
+		out.WriteString(node.text)
+	case '[':
+		var candidates []rune
+		for _, c := range sampleCharacters {
+			in := false
+			for i := 0; i < len(node.ranges); i += 2 {
+				in = in || node.ranges[i] <= c && c <= node.ranges[i+1]
+			}
+			if in != node.negated {
+				candidates = append(candidates, c)
+			}
+		}
+		Expect(candidates).ToNot(BeEmpty(), "class %v", node.ranges)
+		out.WriteRune(candidates[r.Intn(len(candidates))])
+	case 'r':
+		rule, exists := g.rules[node.text]
+		Expect(exists).To(BeTrue(), "rule %s", node.text)
+		g.sampleNode(r, rule, depth+1, out)
+	case '*':
+		count := node.min
+		switch {
+		case deep:
+		case node.max >= 0 && r.Intn(4) == 0:
+			count = node.max
+		case node.max >= 0:
+			count += r.Intn(min(node.max-node.min, 4) + 1)
+		default:
+			count += r.Intn(4)
+		}
+		for i := 0; i < count; i++ {
+			g.sampleNode(r, node.children[0], depth+1, out)
+		}
+	}
+}
+
+// validateSample decodes the sample and validates it against the schema. As with encoding/json, the last of the
+// duplicated keys wins: the grammars can't tell the additional properties apart.
+func validateSample(schema map[string]interface{}, sample string) error {
+	decoder := json.NewDecoder(strings.NewReader(sample))
+	decoder.UseNumber()
+	value, err := decodeValue(decoder)
+	if err != nil {
+		return err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return errors.New("the sample has trailing data")
+	}
+	return validate(schema, schema, value)
+}
+
+func decodeValue(decoder *json.Decoder) (interface{}, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch token {
+	case json.Delim('{'):
+		object := map[string]interface{}{}
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			if object[key.(string)], err = decodeValue(decoder); err != nil {
+				return nil, err
+			}
+		}
+		_, err = decoder.Token()
+		return object, err
+	case json.Delim('['):
+		array := []interface{}{}
+		for decoder.More() {
+			item, err := decodeValue(decoder)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, item)
+		}
+		_, err = decoder.Token()
+		return array, err
+	}
+	return token, nil
+}
+
+var uuidRE = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// validate validates the value against the keywords of the schema the converters support
+func validate(schema, root map[string]interface{}, value interface{}) error {
+	if ref, exists := schema["$ref"].(string); exists {
+		return validate(root["$defs"].(map[string]interface{})[strings.TrimPrefix(ref, "#/$defs/")].(map[string]interface{}), root, value)
+	}
+	if allOf, exists := schema["allOf"].([]interface{}); exists {
+		for _, s := range allOf {
+			if err := validate(s.(map[string]interface{}), root, value); err != nil {
+				return err
+			}
+		}
+	}
+	for _, keyword := range []string{"anyOf", "oneOf"} {
+		alternatives, exists := schema[keyword].([]interface{})
+		if !exists {
+			continue
+		}
+		valid := 0
+		for _, s := range alternatives {
+			if validate(s.(map[string]interface{}), root, value) == nil {
+				valid++
+			}
+		}
+		if valid == 0 || (keyword == "oneOf" && valid > 1) {
+			return fmt.Errorf("%v is valid against %d schemas of %s", value, valid, keyword)
+		}
+	}
+	if constValue, exists := schema["const"]; exists && !sameJSON(constValue, value) {
+		return fmt.Errorf("%v is not %v", value, constValue)
+	}
+	if enum, exists := schema["enum"].([]interface{}); exists {
+		found := false
+		for _, e := range enum {
+			found = found || sameJSON(e, value)
+		}
+		if !found {
+			return fmt.Errorf("%v is not one of %v", value, enum)
+		}
+	}
+
+	if t, exists := schema["type"]; exists {
+		types, ok := t.([]interface{})
+		if !ok {
+			types = []interface{}{t}
+		}
+		found := false
+		for _, t := range types {
+			found = found || hasType(value, t.(string))
+		}
+		if !found {
+			return fmt.Errorf("%v is not of type %v", value, t)
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		return validateString(schema, v)
+	case json.Number:
+		return validateNumber(schema, v)
+	case []interface{}:
+		return validateArray(schema, root, v)
+	case map[string]interface{}:
+		return validateObject(schema, root, v)
+	}
+	return nil
+}
+
+func hasType(value interface{}, t string) bool {
+	switch v := value.(type) {
+	case nil:
+		return t == "null"
+	case bool:
+		return t == "boolean"
+	case string:
+		return t == "string"
+	case json.Number:
+		return t == "number" || (t == "integer" && !strings.ContainsAny(v.String(), ".eE"))
+	case []interface{}:
+		return t == "array"
+	case map[string]interface{}:
+		return t == "object"
+	}
+	return false
+}
+
+func sameJSON(a, b interface{}) bool {
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	return string(ja) == string(jb)
+}
+
+func validateString(schema map[string]interface{}, s string) error {
+	length := utf8.RuneCountInString(s)
+	if minLength, exists := schema["minLength"].(float64); exists && length < int(minLength) {
+		return fmt.Errorf("%q is shorter than %v", s, minLength)
+	}
+	if maxLength, exists := schema["maxLength"].(float64); exists && length > int(maxLength) {
+		return fmt.Errorf("%q is longer than %v", s, maxLength)
+	}
+	if pattern, exists := schema["pattern"].(string); exists && !regexp.MustCompile(pattern).MatchString(s) {
+		return fmt.Errorf("%q does not match %s", s, pattern)
+	}
+
+	var err error
+	switch schema["format"] {
+	case "date":
+		_, err = time.Parse(time.DateOnly, s)
+	case "time":
+		_, err = time.Parse("15:04:05Z07:00", s)
+	case "date-time":
+		_, err = time.Parse(time.RFC3339, s)
+	case "uuid":
+		if !uuidRE.MatchString(s) {
+			err = fmt.Errorf("%q is not a UUID", s)
+		}
+	case "email":
+		var address *mail.Address
+		if address, err = mail.ParseAddress(s); err == nil && address.Address != s {
+			err = fmt.Errorf("%q is not an email address", s)
+		}
+	}
+	return err
+}
+
+func validateNumber(schema map[string]interface{}, n json.Number) error {
+	// The numbers without bounds can have any exponent
+	bounded := false
+	for _, keyword := range []string{"minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum"} {
+		_, exists := schema[keyword]
+		bounded = bounded || exists
+	}
+	if !bounded {
+		return nil
+	}
+	v, err := n.Float64()
+	if err != nil {
+		return err
+	}
+	if minimum, exists := schema["minimum"].(float64); exists && v < minimum {
+		return fmt.Errorf("%v is less than %v", v, minimum)
+	}
+	if maximum, exists := schema["maximum"].(float64); exists && v > maximum {
+		return fmt.Errorf("%v is greater than %v", v, maximum)
+	}
+	if minimum, exists := schema["exclusiveMinimum"].(float64); exists && v <= minimum {
+		return fmt.Errorf("%v is not greater than %v", v, minimum)
+	}
+	if maximum, exists := schema["exclusiveMaximum"].(float64); exists && v >= maximum {
+		return fmt.Errorf("%v is not less than %v", v, maximum)
+	}
+	return nil
+}
+
+func validateArray(schema, root map[string]interface{}, array []interface{}) error {
+	if minItems, exists := schema["minItems"].(float64); exists && len(array) < int(minItems) {
+		return fmt.Errorf("%v has less than %v items", array, minItems)
+	}
+	if maxItems, exists := schema["maxItems"].(float64); exists && len(array) > int(maxItems) {
+		return fmt.Errorf("%v has more than %v items", array, maxItems)
+	}
+	prefixItems, _ := schema["prefixItems"].([]interface{})
+	for i, item := range array {
+		if i < len(prefixItems) {
+			if err := validate(prefixItems[i].(map[string]interface{}), root, item); err != nil {
+				return err
+			}
+			continue
+		}
+		switch items := schema["items"].(type) {
+		case bool:
+			if !items {
+				return fmt.Errorf("%v has more than %d items", array, len(prefixItems))
+			}
+		case map[string]interface{}:
+			if err := validate(items, root, item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func validateObject(schema, root map[string]interface{}, object map[string]interface{}) error {
+	if required, exists := schema["required"].([]interface{}); exists {
+		for _, name := range required {
+			if _, exists := object[name.(string)]; !exists {
+				return fmt.Errorf("%v has no property %s", object, name)
+			}
+		}
+	}
+	properties, _ := schema["properties"].(map[string]interface{})
+	for name, value := range object {
+		if propSchema, exists := properties[name]; exists {
+			if err := validate(propSchema.(map[string]interface{}), root, value); err != nil {
+				return err
+			}
+			continue
+		}
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				return fmt.Errorf("%v has the additional property %s", object, name)
+			}
+		case map[string]interface{}:
+			if err := validate(additional, root, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
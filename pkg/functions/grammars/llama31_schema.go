@@ -76,12 +76,21 @@ func (sc *LLama31SchemaConverter) visit(schema map[string]interface{}, name stri
 	st, existType := schema["type"]
 	var schemaType string
 	if existType {
-		schemaType = st.(string)
+		schemaType, _ = st.(string)
 	}
 	ruleName := name
 	if name == "" {
 		ruleName = "root"
 	}
+	if _, allOfExists := schema["allOf"]; allOfExists {
+		merged, err := mergeAllOf(schema, func(ref string) (map[string]interface{}, error) {
+			return sc.resolveReference(ref, rootSchema)
+		})
+		if err != nil {
+			return "", err
+		}
+		return sc.visit(merged, name, rootSchema)
+	}
 	_, oneOfExists := schema["oneOf"]
 	_, anyOfExists := schema["anyOf"]
 	if oneOfExists || anyOfExists {
@@ -139,6 +148,9 @@ func (sc *LLama31SchemaConverter) visit(schema map[string]interface{}, name stri
 		if len(depth) == 2 {
 			baseProperty = true
 		}
+		if !baseProperty {
+			return sc.schemaRules(rootSchema).object(schema, ruleName)
+		}
 		type propData []struct {
 			propName   string
 			propSchema map[string]interface{}
@@ -157,11 +169,7 @@ func (sc *LLama31SchemaConverter) visit(schema map[string]interface{}, name stri
 		})
 
 		var rule strings.Builder
-		if baseProperty {
-			rule.WriteString(`"<function="`)
-		} else {
-			rule.WriteString(`"{" space`)
-		}
+		rule.WriteString(`"<function="`)
 
 		if baseProperty {
 
@@ -199,39 +207,11 @@ func (sc *LLama31SchemaConverter) visit(schema map[string]interface{}, name stri
 
 			rule.WriteString(` "}</function>"`)
 
-		} else {
-			for i, propPair := range propPairs {
-				propName := propPair.propName
-				propSchema := propPair.propSchema
-				propRuleName, err := sc.visit(propSchema, fmt.Sprintf("%s-%s", ruleName, propName), rootSchema)
-				if err != nil {
-					return "", err
-				}
-				lPropName, err := sc.formatLiteralQuoted(propName)
-				if err != nil {
-					return "", err
-				}
-				if i > 0 {
-					rule.WriteString(` "," space`)
-				}
-
-				rule.WriteString(fmt.Sprintf(` %s space ":" space %s`, lPropName, propRuleName))
-			}
-
-		}
-
-		if !baseProperty {
-			rule.WriteString(` "}" space`)
 		}
 
 		return sc.addRule(ruleName, rule.String()), nil
-	} else if items, exists := schema["items"].(map[string]interface{}); schemaType == "array" && exists {
-		itemRuleName, err := sc.visit(items, fmt.Sprintf("%s-item", ruleName), rootSchema)
-		if err != nil {
-			return "", err
-		}
-		rule := fmt.Sprintf(`"[" space (%s ("," space %s)*)? "]" space`, itemRuleName, itemRuleName)
-		return sc.addRule(ruleName, rule), nil
+	} else if rule, handled, err := sc.schemaRules(rootSchema).visitKeywords(schema, ruleName); handled {
+		return rule, err
 	} else {
 		primitiveRule, exists := PRIMITIVE_RULES[schemaType]
 		if !exists {
@@ -243,6 +223,18 @@ func (sc *LLama31SchemaConverter) visit(schema map[string]interface{}, name stri
 		return sc.addRule(schemaType, primitiveRule), nil
 	}
 }
+
+func (sc *LLama31SchemaConverter) schemaRules(rootSchema map[string]interface{}) schemaRules {
+	return schemaRules{
+		addRule:       sc.addRule,
+		formatLiteral: sc.formatLiteralQuoted,
+		visit: func(schema map[string]interface{}, name string) (string, error) {
+			return sc.visit(schema, name, rootSchema)
+		},
+		sortProperties: sort.Strings,
+	}
+}
+
 func (sc *LLama31SchemaConverter) resolveReference(ref string, rootSchema map[string]interface{}) (map[string]interface{}, error) {
 	if !strings.HasPrefix(ref, "#/$defs/") {
 		return nil, fmt.Errorf("invalid reference format: %s", ref)
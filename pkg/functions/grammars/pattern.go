@@ -0,0 +1,206 @@
+package grammars
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp/syntax"
+	"strings"
+	"unicode"
+)
+
+// patternRule returns the rule of the characters of a string matching the regular expression. As in JSON schema, the
+// pattern isn't anchored: the string can start and end with any characters unless it starts with ^ and ends with $.
+func (k schemaRules) patternRule(pattern string) (string, error) {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return "", err
+	}
+
+	subs := []*syntax.Regexp{re}
+	if re.Op == syntax.OpConcat {
+		subs = re.Sub
+	}
+	anchoredStart := len(subs) > 0 && (subs[0].Op == syntax.OpBeginText || subs[0].Op == syntax.OpBeginLine)
+	if anchoredStart {
+		subs = subs[1:]
+	}
+	anchoredEnd := len(subs) > 0 && (subs[len(subs)-1].Op == syntax.OpEndText || subs[len(subs)-1].Op == syntax.OpEndLine)
+	if anchoredEnd {
+		subs = subs[:len(subs)-1]
+	}
+
+	var parts []string
+	if !anchoredStart {
+		parts = append(parts, k.addSchemaRule("char")+"*")
+	}
+	for _, sub := range subs {
+		part, err := regexpRule(sub)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, part)
+	}
+	if !anchoredEnd {
+		parts = append(parts, k.addSchemaRule("char")+"*")
+	}
+	if len(parts) == 0 {
+		return `""`, nil
+	}
+	return strings.Join(parts, " "), nil
+}
+
+// regexpRule returns the rule of the JSON characters of the strings the regular expression matches
+func regexpRule(re *syntax.Regexp) (string, error) {
+	switch re.Op {
+	case syntax.OpEmptyMatch:
+		return `""`, nil
+	case syntax.OpLiteral:
+		return literalRule(re.Rune, re.Flags&syntax.FoldCase != 0), nil
+	case syntax.OpCharClass:
+		return classRule(re.Rune)
+	case syntax.OpAnyCharNotNL, syntax.OpAnyChar:
+		return `[^"\\\x00-\x1F]`, nil
+	case syntax.OpCapture:
+		sub, err := regexpRule(re.Sub[0])
+		if err != nil {
+			return "", err
+		}
+		return "(" + sub + ")", nil
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest, syntax.OpRepeat:
+		sub, err := regexpRule(re.Sub[0])
+		if err != nil {
+			return "", err
+		}
+		switch re.Op {
+		case syntax.OpStar:
+			return "(" + sub + ")*", nil
+		case syntax.OpPlus:
+			return "(" + sub + ")+", nil
+		case syntax.OpQuest:
+			return "(" + sub + ")?", nil
+		}
+		return "(" + sub + ")" + repetition(re.Min, re.Max), nil
+	case syntax.OpConcat, syntax.OpAlternate:
+		var parts []string
+		for _, sub := range re.Sub {
+			part, err := regexpRule(sub)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, part)
+		}
+		if re.Op == syntax.OpAlternate {
+			return "(" + strings.Join(parts, " | ") + ")", nil
+		}
+		return strings.Join(parts, " "), nil
+	case syntax.OpBeginLine, syntax.OpEndLine, syntax.OpBeginText, syntax.OpEndText:
+		return "", errors.New("only anchors at the start and the end of the pattern are supported")
+	}
+	return "", fmt.Errorf("unsupported regular expression %s", re)
+}
+
+// literalRule returns the rule of the literal runes, matching either case of the letters if foldCase is set
+func literalRule(runes []rune, foldCase bool) string {
+	if !foldCase {
+		return jsonCharsLiteral(string(runes))
+	}
+
+	var parts []string
+	for _, r := range runes {
+		folds := []rune{r}
+		for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+			folds = append(folds, f)
+		}
+		if len(folds) == 1 {
+			parts = append(parts, jsonCharsLiteral(string(r)))
+			continue
+		}
+		var class strings.Builder
+		for _, f := range folds {
+			class.WriteString(classChar(f))
+		}
+		parts = append(parts, "["+class.String()+"]")
+	}
+	return strings.Join(parts, " ")
+}
+
+// classRule returns the rule of the character class of the ranges. The quotes, the backslashes and the line breaks
+// are escaped in JSON, and the other control characters are left out.
+func classRule(ranges []rune) (string, error) {
+	var class strings.Builder
+	var escaped []string
+	for i := 0; i+1 < len(ranges); i += 2 {
+		lo, hi := ranges[i], ranges[i+1]
+		for _, r := range []rune{'\t', '\n', '\r', '"', '\\'} {
+			if lo <= r && r <= hi {
+				escaped = append(escaped, jsonCharsLiteral(string(r)))
+			}
+		}
+
+		// Split the range around the characters which are escaped in JSON
+		for _, excluded := range [][2]rune{{0, 0x1F}, {'"', '"'}, {'\\', '\\'}} {
+			if lo > hi {
+				break
+			}
+			if lo >= excluded[0] && lo <= excluded[1] {
+				lo = excluded[1] + 1
+				continue
+			}
+			if excluded[0] > lo && excluded[0] <= hi {
+				writeClassRange(&class, lo, excluded[0]-1)
+				lo = excluded[1] + 1
+			}
+		}
+		if lo <= hi {
+			writeClassRange(&class, lo, hi)
+		}
+	}
+
+	alternatives := escaped
+	if class.Len() > 0 {
+		alternatives = append([]string{"[" + class.String() + "]"}, escaped...)
+	}
+	switch len(alternatives) {
+	case 0:
+		return "", errors.New("the pattern has a character class which no character of a JSON string matches")
+	case 1:
+		return alternatives[0], nil
+	}
+	return "(" + strings.Join(alternatives, " | ") + ")", nil
+}
+
+func writeClassRange(class *strings.Builder, lo, hi rune) {
+	class.WriteString(classChar(lo))
+	if hi > lo {
+		class.WriteString("-" + classChar(hi))
+	}
+}
+
+// classChar returns the character of a character class, escaped if need be
+func classChar(r rune) string {
+	switch {
+	case r == '\\' || r == ']' || r == '[' || r == '-' || r == '^':
+		return `\` + string(r)
+	case r < 0x20 || r == 0x7F:
+		return fmt.Sprintf(`\x%02X`, r)
+	case r > 0xFFFF:
+		return fmt.Sprintf(`\U%08X`, r)
+	}
+	return string(r)
+}
+
+// jsonCharsLiteral returns the literal of the characters of the string, as they are written in a JSON string
+func jsonCharsLiteral(s string) string {
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	// Strings are always encoded
+	_ = encoder.Encode(s)
+	chars := strings.TrimSuffix(b.String(), "\n")
+	chars = chars[1 : len(chars)-1]
+
+	escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(chars)
+	return `"` + escaped + `"`
+}
@@ -0,0 +1,149 @@
+package grammars
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// intRangeRule returns the rule of the integers from lo to hi, either of them being unbounded if nil, and false if
+// there is no such integer
+func intRangeRule(lo, hi *int64) (string, bool) {
+	if lo != nil && hi != nil && *lo > *hi {
+		return "", false
+	}
+
+	var alternatives []string
+	// The negative integers are a minus sign followed by the natural numbers from -min(hi, -1) to -lo
+	if lo == nil || *lo < 0 {
+		negativeLo := int64(1)
+		if hi != nil && *hi < -1 {
+			negativeLo = -*hi
+		}
+		var negativeHi *int64
+		if lo != nil {
+			v := -*lo
+			negativeHi = &v
+		}
+		if negatives, ok := naturalRangeRule(negativeLo, negativeHi); ok {
+			alternatives = append(alternatives, `"-" `+negatives)
+		}
+	}
+	if hi == nil || *hi >= 0 {
+		naturalLo := int64(0)
+		if lo != nil && *lo > 0 {
+			naturalLo = *lo
+		}
+		if naturals, ok := naturalRangeRule(naturalLo, hi); ok {
+			alternatives = append(alternatives, naturals)
+		}
+	}
+
+	switch len(alternatives) {
+	case 0:
+		return "", false
+	case 1:
+		return alternatives[0], true
+	}
+	return "(" + strings.Join(alternatives, " | ") + ")", true
+}
+
+// naturalRangeRule returns the rule of the natural numbers from lo to hi, unbounded if nil, and false if there is
+// no such number. The numbers have no leading zeros.
+func naturalRangeRule(lo int64, hi *int64) (string, bool) {
+	if lo < 0 {
+		lo = 0
+	}
+	if hi != nil && *hi < lo {
+		return "", false
+	}
+
+	from := strconv.FormatInt(lo, 10)
+	var alternatives []string
+	if hi == nil {
+		// The numbers with more digits than lo are all in the range
+		alternatives = digitRanges(from, strings.Repeat("9", len(from)))
+		alternatives = append(alternatives, fmt.Sprintf("[1-9] [0-9]{%d,}", len(from)))
+	} else {
+		alternatives = digitRanges(from, strconv.FormatInt(*hi, 10))
+	}
+
+	if len(alternatives) == 1 {
+		return alternatives[0], true
+	}
+	return "(" + strings.Join(alternatives, " | ") + ")", true
+}
+
+// digitRanges returns the rules of the numbers from lo to hi, one for each number of digits
+func digitRanges(lo, hi string) []string {
+	var alternatives []string
+	for digits := len(lo); digits <= len(hi); digits++ {
+		from, to := lo, hi
+		if digits > len(lo) {
+			from = "1" + strings.Repeat("0", digits-1)
+		}
+		if digits < len(hi) {
+			to = strings.Repeat("9", digits)
+		}
+		alternatives = append(alternatives, sameLengthRange(from, to))
+	}
+	return alternatives
+}
+
+// sameLengthRange returns the rule of the numbers from lo to hi, which have the same number of digits
+func sameLengthRange(lo, hi string) string {
+	if lo == hi {
+		return `"` + lo + `"`
+	}
+
+	prefix := 0
+	for lo[prefix] == hi[prefix] {
+		prefix++
+	}
+	common := lo[:prefix]
+	lo, hi = lo[prefix:], hi[prefix:]
+
+	rest := len(lo) - 1
+	loIsRound := strings.Trim(lo[1:], "0") == ""
+	hiIsRound := strings.Trim(hi[1:], "9") == ""
+	first, last := lo[0], hi[0]
+
+	var alternatives []string
+	if !loIsRound {
+		alternatives = append(alternatives, fmt.Sprintf(`"%c" %s`, lo[0], sameLengthRange(lo[1:], strings.Repeat("9", rest))))
+		first++
+	}
+	if !hiIsRound {
+		last--
+	}
+	if first <= last {
+		digit := fmt.Sprintf(`"%c"`, first)
+		if first < last {
+			digit = fmt.Sprintf("[%c-%c]", first, last)
+		}
+		alternatives = append(alternatives, digit+anyDigits(rest))
+	}
+	if !hiIsRound {
+		alternatives = append(alternatives, fmt.Sprintf(`"%c" %s`, hi[0], sameLengthRange(strings.Repeat("0", rest), hi[1:])))
+	}
+
+	rule := alternatives[0]
+	if len(alternatives) > 1 {
+		rule = "(" + strings.Join(alternatives, " | ") + ")"
+	}
+	if common != "" {
+		rule = fmt.Sprintf(`"%s" %s`, common, rule)
+	}
+	return rule
+}
+
+// anyDigits returns the rule of n digits, preceded by a space
+func anyDigits(n int) string {
+	switch n {
+	case 0:
+		return ""
+	case 1:
+		return " [0-9]"
+	}
+	return fmt.Sprintf(" [0-9]{%d}", n)
+}
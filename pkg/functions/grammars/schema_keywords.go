@@ -0,0 +1,519 @@
+package grammars
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// schemaRules builds the rules of the JSON schema keywords both schema converters have in common: the objects and
+// their required properties, the arrays and their lengths, the constraints of the strings and the ranges of the numbers
+type schemaRules struct {
+	addRule       func(name, rule string) string
+	formatLiteral func(literal interface{}) (string, error)
+	// visit returns the rule of a schema of the converter
+	visit func(schema map[string]interface{}, name string) (string, error)
+	// sortProperties orders the properties of the objects
+	sortProperties func(names []string)
+}
+
+// addSchemaRule adds the rule of SCHEMA_RULES or PRIMITIVE_RULES with the given name, along with the rules it refers to
+func (k schemaRules) addSchemaRule(name string) string {
+	added := map[string]bool{}
+	var add func(name string)
+	add = func(name string) {
+		if added[name] {
+			return
+		}
+		added[name] = true
+		rule, exists := SCHEMA_RULES[name]
+		if !exists {
+			rule = PRIMITIVE_RULES[name]
+		}
+		k.addRule(name, rule)
+		for _, dependency := range schemaRuleDependencies[name] {
+			add(dependency)
+		}
+	}
+	add(name)
+	return name
+}
+
+// mergeAllOf returns the schema with the schemas of its allOf merged into it: their properties and required
+// properties add up, and the first schema setting another keyword wins
+func mergeAllOf(schema map[string]interface{}, resolve func(ref string) (map[string]interface{}, error)) (map[string]interface{}, error) {
+	merged := map[string]interface{}{}
+	properties := map[string]interface{}{}
+	var required []interface{}
+	merge := func(s map[string]interface{}) {
+		for key, value := range s {
+			switch key {
+			case "allOf":
+			case "properties":
+				if p, ok := value.(map[string]interface{}); ok {
+					for name, propSchema := range p {
+						properties[name] = propSchema
+					}
+				}
+			case "required":
+				if r, ok := value.([]interface{}); ok {
+					required = append(required, r...)
+				}
+			default:
+				if _, exists := merged[key]; !exists {
+					merged[key] = value
+				}
+			}
+		}
+	}
+
+	merge(schema)
+	allOf, _ := schema["allOf"].([]interface{})
+	for _, s := range allOf {
+		subSchema, ok := s.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid allOf schema: %v", s)
+		}
+		if ref, exists := subSchema["$ref"].(string); exists {
+			referencedSchema, err := resolve(ref)
+			if err != nil {
+				return nil, err
+			}
+			subSchema = referencedSchema
+		}
+		if _, exists := subSchema["allOf"]; exists {
+			var err error
+			if subSchema, err = mergeAllOf(subSchema, resolve); err != nil {
+				return nil, err
+			}
+		}
+		merge(subSchema)
+	}
+
+	if len(properties) > 0 {
+		merged["properties"] = properties
+		if _, exists := merged["type"]; !exists {
+			merged["type"] = "object"
+		}
+	}
+	if required != nil {
+		merged["required"] = required
+	}
+	return merged, nil
+}
+
+// visitKeywords returns the rule of the schema if its keywords are ones of the schemaRules, and false if the schema
+// is a plain primitive
+func (k schemaRules) visitKeywords(schema map[string]interface{}, ruleName string) (string, bool, error) {
+	if types, exists := schema["type"].([]interface{}); exists {
+		rule, err := k.typeUnion(schema, types, ruleName)
+		return rule, true, err
+	}
+
+	schemaType, _ := schema["type"].(string)
+	if schemaType == "" {
+		if _, exists := schema["properties"]; exists {
+			schemaType = "object"
+		} else if _, exists := schema["items"]; exists {
+			schemaType = "array"
+		}
+	}
+	switch schemaType {
+	case "object":
+		rule, err := k.object(schema, ruleName)
+		return rule, true, err
+	case "array":
+		rule, err := k.array(schema, ruleName)
+		return rule, true, err
+	case "string":
+		return k.string(schema, ruleName)
+	case "integer", "number":
+		return k.number(schema, ruleName, schemaType == "integer")
+	case "":
+		// A schema without a type accepts any value
+		value := k.addSchemaRule("value")
+		if ruleName == "root" {
+			return k.addRule(ruleName, value), true, nil
+		}
+		return value, true, nil
+	}
+	return "", false, nil
+}
+
+func (k schemaRules) typeUnion(schema map[string]interface{}, types []interface{}, ruleName string) (string, error) {
+	var alternatives []string
+	for i, t := range types {
+		typeSchema := map[string]interface{}{}
+		for key, value := range schema {
+			typeSchema[key] = value
+		}
+		typeSchema["type"] = t
+		alternative, err := k.visit(typeSchema, fmt.Sprintf("%s-%d", ruleName, i))
+		if err != nil {
+			return "", err
+		}
+		alternatives = append(alternatives, alternative)
+	}
+	return k.addRule(ruleName, strings.Join(alternatives, " | ")), nil
+}
+
+// objectProperty is a property of an object with the rule of its key and value
+type objectProperty struct {
+	name string
+	kv   string
+	// additional stands for the additional properties, which can repeat
+	additional bool
+}
+
+// object returns the rule of an object. Without required properties, all the properties are required. The optional
+// properties come after the required ones, in order, and the additional properties last.
+func (k schemaRules) object(schema map[string]interface{}, ruleName string) (string, error) {
+	properties, _ := schema["properties"].(map[string]interface{})
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	k.sortProperties(names)
+
+	requiredList, hasRequired := schema["required"].([]interface{})
+	var required, optional []objectProperty
+	for _, name := range names {
+		propSchema, ok := properties[name].(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("invalid schema of property %s: %v", name, properties[name])
+		}
+		propRuleName, err := k.visit(propSchema, fmt.Sprintf("%s-%s", ruleName, name))
+		if err != nil {
+			return "", err
+		}
+		lPropName, err := k.formatLiteral(name)
+		if err != nil {
+			return "", err
+		}
+		kv := fmt.Sprintf(`%s space ":" space %s`, lPropName, propRuleName)
+
+		if !hasRequired || slices.Contains(requiredList, interface{}(name)) {
+			required = append(required, objectProperty{name: name, kv: kv})
+		} else {
+			optional = append(optional, objectProperty{name: name, kv: k.addRule(fmt.Sprintf("%s-%s-kv", ruleName, name), kv)})
+		}
+	}
+
+	var additionalRule string
+	switch additional := schema["additionalProperties"].(type) {
+	case bool:
+		if additional {
+			additionalRule = k.addSchemaRule("value")
+		}
+	case map[string]interface{}:
+		var err error
+		if additionalRule, err = k.visit(additional, fmt.Sprintf("%s-additional-value", ruleName)); err != nil {
+			return "", err
+		}
+	}
+	if additionalRule == "" && properties == nil && !hasRequired {
+		// An object without properties accepts any property, unless additionalProperties is false
+		if _, exists := schema["additionalProperties"]; !exists {
+			additionalRule = k.addSchemaRule("value")
+		}
+	}
+	if additionalRule != "" {
+		keyRule := k.addRule(fmt.Sprintf("%s-additional-key", ruleName), k.notStrings(names))
+		optional = append(optional, objectProperty{
+			name:       "additional",
+			kv:         k.addRule(fmt.Sprintf("%s-additional-kv", ruleName), fmt.Sprintf(`%s ":" space %s`, keyRule, additionalRule)),
+			additional: true,
+		})
+	}
+
+	var rule strings.Builder
+	rule.WriteString(`"{" space`)
+	for i, property := range required {
+		if i > 0 {
+			rule.WriteString(` "," space`)
+		}
+		rule.WriteString(" " + property.kv)
+	}
+	if len(optional) > 0 {
+		var alternatives []string
+		for i := range optional {
+			alternatives = append(alternatives, k.optionalProperties(ruleName, optional[i:], false))
+		}
+		if len(required) > 0 {
+			rule.WriteString(fmt.Sprintf(` ("," space (%s))?`, strings.Join(alternatives, " | ")))
+		} else {
+			rule.WriteString(fmt.Sprintf(` (%s)?`, strings.Join(alternatives, " | ")))
+		}
+	}
+	rule.WriteString(` "}" space`)
+	return k.addRule(ruleName, rule.String()), nil
+}
+
+// optionalProperties returns the rule of the first of the optional properties followed by any of the others, in order
+func (k schemaRules) optionalProperties(ruleName string, properties []objectProperty, firstIsOptional bool) string {
+	property := properties[0]
+	var rule string
+	switch {
+	case firstIsOptional && property.additional:
+		rule = fmt.Sprintf(`("," space %s)*`, property.kv)
+	case firstIsOptional:
+		rule = fmt.Sprintf(`("," space %s)?`, property.kv)
+	case property.additional:
+		rule = fmt.Sprintf(`%s ("," space %s)*`, property.kv, property.kv)
+	default:
+		rule = property.kv
+	}
+	if len(properties) > 1 {
+		rest := k.addRule(fmt.Sprintf("%s-%s-rest", ruleName, property.name), k.optionalProperties(ruleName, properties[1:], true))
+		rule += " " + rest
+	}
+	return rule
+}
+
+// notStrings returns the rule of the strings other than the given ones, e.g. the keys of the additional properties
+func (k schemaRules) notStrings(strs []string) string {
+	if len(strs) == 0 {
+		return k.addSchemaRule("string")
+	}
+	char := k.addSchemaRule("char")
+
+	type trie struct {
+		children map[rune]*trie
+		end      bool
+	}
+	root := &trie{children: map[rune]*trie{}}
+	for _, s := range strs {
+		node := root
+		for _, r := range s {
+			child, exists := node.children[r]
+			if !exists {
+				child = &trie{children: map[rune]*trie{}}
+				node.children[r] = child
+			}
+			node = child
+		}
+		node.end = true
+	}
+
+	var visit func(node *trie) string
+	visit = func(node *trie) string {
+		runes := make([]rune, 0, len(node.children))
+		for r := range node.children {
+			runes = append(runes, r)
+		}
+		slices.Sort(runes)
+
+		var alternatives []string
+		var rejected strings.Builder
+		for _, r := range runes {
+			child := node.children[r]
+			rejected.WriteString(classChar(r))
+			alternative := "[" + classChar(r) + "]"
+			switch {
+			case len(child.children) == 0:
+				alternative += fmt.Sprintf(" %s+", char)
+			case child.end:
+				alternative += fmt.Sprintf(" (%s)", visit(child))
+			default:
+				alternative += fmt.Sprintf(" (%s)?", visit(child))
+			}
+			alternatives = append(alternatives, alternative)
+		}
+		alternatives = append(alternatives, fmt.Sprintf(`[^"\\%s] %s*`, rejected.String(), char))
+		return strings.Join(alternatives, " | ")
+	}
+
+	optional := "?"
+	if root.end {
+		optional = ""
+	}
+	return fmt.Sprintf(`"\"" (%s)%s "\"" space`, visit(root), optional)
+}
+
+// array returns the rule of an array of items, of a tuple with prefixItems, bounded by minItems and maxItems
+func (k schemaRules) array(schema map[string]interface{}, ruleName string) (string, error) {
+	var itemRuleName string
+	switch items := schema["items"].(type) {
+	case map[string]interface{}:
+		var err error
+		if itemRuleName, err = k.visit(items, fmt.Sprintf("%s-item", ruleName)); err != nil {
+			return "", err
+		}
+	case bool:
+		if items {
+			itemRuleName = k.addSchemaRule("value")
+		}
+	case nil:
+		if _, exists := schema["prefixItems"]; !exists {
+			itemRuleName = k.addSchemaRule("value")
+		}
+	}
+
+	if prefixItems, exists := schema["prefixItems"].([]interface{}); exists {
+		var rule strings.Builder
+		rule.WriteString(`"[" space`)
+		for i, item := range prefixItems {
+			itemSchema, ok := item.(map[string]interface{})
+			if !ok {
+				return "", fmt.Errorf("invalid schema of item %d: %v", i, item)
+			}
+			prefixRuleName, err := k.visit(itemSchema, fmt.Sprintf("%s-%d", ruleName, i))
+			if err != nil {
+				return "", err
+			}
+			if i > 0 {
+				rule.WriteString(` "," space`)
+			}
+			rule.WriteString(" " + prefixRuleName)
+		}
+		if itemRuleName != "" {
+			rule.WriteString(fmt.Sprintf(` ("," space %s)*`, itemRuleName))
+		}
+		rule.WriteString(` "]" space`)
+		return k.addRule(ruleName, rule.String()), nil
+	}
+
+	if itemRuleName == "" {
+		return k.addRule(ruleName, `"[" space "]" space`), nil
+	}
+	minItems, maxItems := intKeyword(schema, "minItems", 0), intKeyword(schema, "maxItems", -1)
+	if maxItems == 0 {
+		return k.addRule(ruleName, `"[" space "]" space`), nil
+	}
+	maxOthers := -1
+	if maxItems > 0 {
+		maxOthers = maxItems - 1
+	}
+	items := fmt.Sprintf(`%s ("," space %s)%s`, itemRuleName, itemRuleName, repetition(max(minItems-1, 0), maxOthers))
+	if minItems == 0 {
+		items = "(" + items + ")?"
+	}
+	return k.addRule(ruleName, fmt.Sprintf(`"[" space %s "]" space`, items)), nil
+}
+
+// string returns the rule of a string with a pattern, a format, or a minLength or maxLength.
+// The patterns which can't be turned into a grammar are left out.
+func (k schemaRules) string(schema map[string]interface{}, ruleName string) (string, bool, error) {
+	if pattern, exists := schema["pattern"].(string); exists {
+		chars, err := k.patternRule(pattern)
+		if err == nil {
+			return k.addRule(ruleName, fmt.Sprintf(`"\"" %s "\"" space`, chars)), true, nil
+		}
+		log.Warn().Err(err).Str("pattern", pattern).Msg("unsupported pattern in the JSON schema, the grammar doesn't enforce it")
+	}
+
+	if format, exists := schema["format"].(string); exists {
+		if _, known := SCHEMA_RULES[format]; known && format != "char" && format != "value" && format != "object" && format != "array" {
+			formatRule := k.addSchemaRule(format)
+			return k.addRule(ruleName, fmt.Sprintf(`"\"" %s "\"" space`, formatRule)), true, nil
+		}
+	}
+
+	minLength, maxLength := intKeyword(schema, "minLength", 0), intKeyword(schema, "maxLength", -1)
+	if minLength == 0 && maxLength < 0 {
+		return "", false, nil
+	}
+	char := k.addSchemaRule("char")
+	return k.addRule(ruleName, fmt.Sprintf(`"\"" %s%s "\"" space`, char, repetition(minLength, maxLength))), true, nil
+}
+
+// number returns the rule of an integer or a number within minimum, maximum, exclusiveMinimum or exclusiveMaximum.
+// The fractional numbers are those whose integer part is within the bounds, so that the grammar only has to deal
+// with integers.
+func (k schemaRules) number(schema map[string]interface{}, ruleName string, integer bool) (string, bool, error) {
+	minimum, exclusiveMinimum := numberBound(schema, "minimum", "exclusiveMinimum")
+	maximum, exclusiveMaximum := numberBound(schema, "maximum", "exclusiveMaximum")
+	if minimum == nil && maximum == nil {
+		return "", false, nil
+	}
+
+	// The integers within the bounds
+	var lo, hi *int64
+	if minimum != nil {
+		v := int64(math.Ceil(*minimum))
+		if exclusiveMinimum && float64(v) == *minimum {
+			v++
+		}
+		lo = &v
+	}
+	if maximum != nil {
+		v := int64(math.Floor(*maximum))
+		if exclusiveMaximum && float64(v) == *maximum {
+			v--
+		}
+		hi = &v
+	}
+	var alternatives []string
+	if integers, ok := intRangeRule(lo, hi); ok {
+		alternatives = append(alternatives, integers)
+	}
+
+	if !integer {
+		// A fraction of a positive integer part I is within ]I, I+1[, and within ]-(I+1), -I[ for a negative one
+		fraction := `"." [0-9]* [1-9]`
+		positiveLo, negativeLo := int64(0), int64(0)
+		var positiveHi, negativeHi *int64
+		if minimum != nil {
+			positiveLo = max(int64(math.Ceil(*minimum)), 0)
+			v := int64(math.Floor(-*minimum)) - 1
+			negativeHi = &v
+		}
+		if maximum != nil {
+			negativeLo = max(int64(math.Ceil(-*maximum)), 0)
+			v := int64(math.Floor(*maximum)) - 1
+			positiveHi = &v
+		}
+		if positives, ok := naturalRangeRule(positiveLo, positiveHi); ok {
+			alternatives = append(alternatives, fmt.Sprintf("%s %s", positives, fraction))
+		}
+		if negatives, ok := naturalRangeRule(negativeLo, negativeHi); ok {
+			alternatives = append(alternatives, fmt.Sprintf(`"-" %s %s`, negatives, fraction))
+		}
+	}
+
+	if len(alternatives) == 0 {
+		return "", true, fmt.Errorf("no number is within the bounds of %v", schema)
+	}
+	return k.addRule(ruleName, fmt.Sprintf("(%s) space", strings.Join(alternatives, " | "))), true, nil
+}
+
+// numberBound returns the bound of the keyword, or of its exclusive keyword, and whether the bound is exclusive. The
+// exclusive keyword can also be a boolean applying to the bound, as in the draft 4.
+func numberBound(schema map[string]interface{}, keyword, exclusiveKeyword string) (*float64, bool) {
+	if v, exists := schema[exclusiveKeyword].(float64); exists {
+		return &v, true
+	}
+	exclusive, _ := schema[exclusiveKeyword].(bool)
+	if v, exists := schema[keyword].(float64); exists {
+		return &v, exclusive
+	}
+	return nil, false
+}
+
+// intKeyword returns the integer of the keyword, or the default value if unset
+func intKeyword(schema map[string]interface{}, keyword string, defaultValue int) int {
+	if v, exists := schema[keyword].(float64); exists {
+		return int(v)
+	}
+	return defaultValue
+}
+
+// repetition returns the repetition operator of min to max occurrences, max being unbounded if negative
+func repetition(min, max int) string {
+	switch {
+	case min == 0 && max < 0:
+		return "*"
+	case min == 1 && max < 0:
+		return "+"
+	case min == 0 && max == 1:
+		return "?"
+	case max < 0:
+		return fmt.Sprintf("{%d,}", min)
+	case min == max:
+		return fmt.Sprintf("{%d}", min)
+	}
+	return fmt.Sprintf("{%d,%d}", min, max)
+}
@@ -0,0 +1,504 @@
+package functions
+
+import (
+	"encoding/json"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ToolCallDelta is a fragment of a tool call, parsed while the LLM generates it. The first delta of a call has its
+// name, and the next ones the following fragments of its arguments.
+type ToolCallDelta struct {
+	// Index is the position of the call among the calls of the result
+	Index     int
+	Name      string
+	Arguments string
+}
+
+// ToolCallParser parses the tool calls of an LLM result token by token, see ParseFunctionCall for the whole result
+type ToolCallParser struct {
+	scanner callScanner
+}
+
+type callScanner interface {
+	write(token string) []ToolCallDelta
+	flush() []ToolCallDelta
+}
+
+// NewToolCallParser returns a parser of the tool calls of the LLM results, nil if the configuration needs the whole
+// result to parse them: the replacements, the JSON regexes and the argument regexes apply to the whole result, and a
+// response regex must be a sequence with the name of the function before its arguments.
+func NewToolCallParser(functionConfig FunctionsConfig) *ToolCallParser {
+	if len(functionConfig.ReplaceFunctionResults) > 0 || len(functionConfig.ReplaceLLMResult) > 0 ||
+		len(functionConfig.JSONRegexMatch) > 0 || len(functionConfig.ArgumentRegex) > 0 {
+		return nil
+	}
+
+	functionNameKey := defaultFunctionNameKey
+	functionArgumentsKey := defaultFunctionArgumentsKey
+	if functionConfig.FunctionNameKey != "" {
+		functionNameKey = functionConfig.FunctionNameKey
+	}
+	if functionConfig.FunctionArgumentsKey != "" {
+		functionArgumentsKey = functionConfig.FunctionArgumentsKey
+	}
+
+	if len(functionConfig.ResponseRegex) == 0 {
+		return &ToolCallParser{scanner: &jsonCallScanner{nameKey: functionNameKey, argumentsKey: functionArgumentsKey}}
+	}
+
+	scanner := &regexCallScanner{}
+	for _, r := range functionConfig.ResponseRegex {
+		call, ok := newRegexCall(r, functionNameKey, functionArgumentsKey)
+		if !ok {
+			log.Debug().Str("regex", r).Msg("the response regex can't be matched incrementally, not streaming the tool calls")
+			return nil
+		}
+		scanner.calls = append(scanner.calls, call)
+	}
+	return &ToolCallParser{scanner: scanner}
+}
+
+// Write parses the next token of the result, and returns the fragments of the tool calls it completes
+func (p *ToolCallParser) Write(token string) []ToolCallDelta {
+	return p.scanner.write(token)
+}
+
+// Flush returns the fragments of the tool calls left once the result is complete
+func (p *ToolCallParser) Flush() []ToolCallDelta {
+	return p.scanner.flush()
+}
+
+// The value of the call object being read
+const (
+	valueOther = iota
+	valueName
+	valueArguments
+)
+
+// jsonCallScanner finds the calls in the JSON objects of the result, as generated with the grammars. The objects
+// can be in arrays (parallel calls) or among free text (mixed mode). The arguments are streamed as they are generated,
+// once the name of the function is known.
+type jsonCallScanner struct {
+	nameKey, argumentsKey string
+
+	// stack has the objects and arrays open
+	stack    []byte
+	inString bool
+	escaped  bool
+	// str is the raw content of the key or the string value being read in the call object
+	str strings.Builder
+
+	// The call object being read
+	call      bool
+	callDepth int
+	key       string
+	// afterColon is set between a key and the end of its value
+	afterColon bool
+	value      int
+	// argsStarted and argsDone are set once the first and the last character of the arguments are read
+	argsStarted, argsDone bool
+	name                  string
+	named                 bool
+	// args are the fragments of the arguments not emitted yet
+	args strings.Builder
+
+	calls  int
+	deltas []ToolCallDelta
+}
+
+func (s *jsonCallScanner) write(token string) []ToolCallDelta {
+	for i := 0; i < len(token); i++ {
+		s.scan(token[i])
+	}
+	s.emitArgs()
+	deltas := s.deltas
+	s.deltas = nil
+	return deltas
+}
+
+func (s *jsonCallScanner) flush() []ToolCallDelta {
+	return s.write("")
+}
+
+// capturing returns if the character read is part of the arguments
+func (s *jsonCallScanner) capturing() bool {
+	return s.call && s.value == valueArguments && !s.argsDone
+}
+
+// scan reads the next byte of the result. The structural characters of JSON are all ASCII, so they are never part of
+// a multi-byte character.
+func (s *jsonCallScanner) scan(c byte) {
+	if s.inString {
+		s.scanString(c)
+		return
+	}
+
+	top := s.call && len(s.stack) == s.callDepth
+	switch c {
+	case '"':
+		// The quotes of the free text around the objects do not start strings
+		if len(s.stack) == 0 {
+			return
+		}
+		s.inString = true
+		s.str.Reset()
+		s.captureValue(c)
+	case '{', '[':
+		s.captureValue(c)
+		if c == '{' && !s.call && s.onlyArrays() {
+			s.stack = append(s.stack, c)
+			s.startCall()
+			return
+		}
+		s.stack = append(s.stack, c)
+	case '}', ']':
+		if len(s.stack) == 0 {
+			return
+		}
+		s.stack = s.stack[:len(s.stack)-1]
+		switch {
+		case !s.call:
+		case len(s.stack) < s.callDepth:
+			// A scalar argument ends with the object
+			s.endCall()
+		case s.capturing():
+			s.args.WriteByte(c)
+			if len(s.stack) == s.callDepth {
+				s.argsDone = true
+			}
+		}
+	case ':':
+		if top && !s.afterColon {
+			s.afterColon = true
+			switch s.key {
+			case s.nameKey:
+				s.value = valueName
+			case s.argumentsKey:
+				s.value = valueArguments
+			default:
+				s.value = valueOther
+			}
+			return
+		}
+		s.captureValue(c)
+	case ',':
+		if top {
+			if s.capturing() {
+				s.argsDone = true
+			}
+			s.afterColon = false
+			s.value = valueOther
+			return
+		}
+		s.captureValue(c)
+	case ' ', '\t', '\n', '\r':
+		if s.capturing() && s.argsStarted && !top {
+			s.args.WriteByte(c)
+		}
+	default:
+		s.captureValue(c)
+	}
+}
+
+// captureValue adds the character outside of strings to the arguments, if they are being read
+func (s *jsonCallScanner) captureValue(c byte) {
+	if s.capturing() {
+		s.argsStarted = true
+		s.args.WriteByte(c)
+	}
+}
+
+func (s *jsonCallScanner) scanString(c byte) {
+	top := s.call && len(s.stack) == s.callDepth
+	end := false
+	switch {
+	case s.escaped:
+		s.escaped = false
+	case c == '\\':
+		s.escaped = true
+	case c == '"':
+		end = true
+	}
+
+	if s.capturing() {
+		// The LLMs can write new lines in the strings, which is not valid JSON (see utils.EscapeNewLines)
+		if c == '\n' {
+			s.args.WriteString(`\n`)
+		} else {
+			s.args.WriteByte(c)
+		}
+	} else if top && !end {
+		s.str.WriteByte(c)
+	}
+	if !end {
+		return
+	}
+
+	s.inString = false
+	if !top {
+		return
+	}
+	switch {
+	case s.capturing():
+		// The arguments are a string
+		s.argsDone = true
+	case !s.afterColon:
+		s.key = decodeJSONString(s.str.String())
+	case s.value == valueName && !s.named:
+		s.name = decodeJSONString(s.str.String())
+		s.named = true
+		s.deltas = append(s.deltas, ToolCallDelta{Index: s.calls, Name: s.name, Arguments: s.args.String()})
+		s.args.Reset()
+	}
+}
+
+// onlyArrays returns if all the brackets open are arrays: an object opened there can be a call
+func (s *jsonCallScanner) onlyArrays() bool {
+	for _, b := range s.stack {
+		if b != '[' {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *jsonCallScanner) startCall() {
+	s.call = true
+	s.callDepth = len(s.stack)
+	s.key = ""
+	s.afterColon = false
+	s.value = valueOther
+	s.argsStarted, s.argsDone = false, false
+	s.name, s.named = "", false
+	s.args.Reset()
+}
+
+func (s *jsonCallScanner) endCall() {
+	s.emitArgs()
+	if s.named {
+		s.calls++
+	}
+	s.call = false
+	s.args.Reset()
+}
+
+// emitArgs emits the fragment of the arguments read since the last one, once the name of the function is known
+func (s *jsonCallScanner) emitArgs() {
+	if !s.call || !s.named || s.args.Len() == 0 {
+		return
+	}
+	if n := len(s.deltas); n > 0 && s.deltas[n-1].Index == s.calls {
+		s.deltas[n-1].Arguments += s.args.String()
+	} else {
+		s.deltas = append(s.deltas, ToolCallDelta{Index: s.calls, Arguments: s.args.String()})
+	}
+	s.args.Reset()
+}
+
+// decodeJSONString returns the value of the raw content of a JSON string
+func decodeJSONString(raw string) string {
+	var value string
+	if err := json.Unmarshal([]byte(`"`+raw+`"`), &value); err != nil {
+		return raw
+	}
+	return value
+}
+
+// regexCall is a response regex split around its arguments group. The call starts where prefix matches, which also
+// has the name of the function, and its arguments follow.
+type regexCall struct {
+	full      *regexp.Regexp
+	prefix    *regexp.Regexp
+	nameIndex int
+	argsIndex int
+	// suffix is what follows the arguments, if it is a literal
+	suffix        string
+	literalSuffix bool
+}
+
+func newRegexCall(expr, nameKey, argumentsKey string) (*regexCall, bool) {
+	full, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, false
+	}
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil || re.Op != syntax.OpConcat {
+		return nil, false
+	}
+
+	args := -1
+	for i, sub := range re.Sub {
+		if sub.Op == syntax.OpCapture && sub.Name == argumentsKey {
+			args = i
+			break
+		}
+	}
+	if args <= 0 {
+		return nil, false
+	}
+
+	prefix, err := regexp.Compile((&syntax.Regexp{Op: syntax.OpConcat, Flags: re.Flags, Sub: re.Sub[:args]}).String())
+	if err != nil || prefix.SubexpIndex(nameKey) < 0 {
+		return nil, false
+	}
+
+	call := &regexCall{
+		full:          full,
+		prefix:        prefix,
+		nameIndex:     prefix.SubexpIndex(nameKey),
+		argsIndex:     full.SubexpIndex(argumentsKey),
+		literalSuffix: true,
+	}
+	for _, sub := range re.Sub[args+1:] {
+		if sub.Op != syntax.OpLiteral || sub.Flags&syntax.FoldCase != 0 {
+			call.suffix, call.literalSuffix = "", false
+			break
+		}
+		call.suffix += string(sub.Rune)
+	}
+	return call, true
+}
+
+// streamable returns how much of the arguments read so far surely are part of them
+func (c *regexCall) streamable(args string) int {
+	switch {
+	case !c.literalSuffix:
+		return 0
+	case c.suffix == "":
+		return len(args)
+	}
+	if i := strings.Index(args, c.suffix); i >= 0 {
+		return i
+	}
+	// The end of the arguments can be the start of the suffix
+	for n := min(len(c.suffix)-1, len(args)); n > 0; n-- {
+		if strings.HasSuffix(args, c.suffix[:n]) {
+			return len(args) - n
+		}
+	}
+	return len(args)
+}
+
+// regexCallScanner finds the calls with the response regexes. The name is emitted as soon as the part of the regex
+// before the arguments matches, and the arguments are streamed up to the literal which follows them in the regex.
+// The call ends where the next one starts, or with the result: its arguments are then those matched by the whole
+// regex.
+type regexCallScanner struct {
+	calls []*regexCall
+	buf   string
+	// pos is where to look for the next call
+	pos int
+
+	// The call being read
+	current              *regexCall
+	callStart, argsStart int
+	emitted              int
+
+	count int
+}
+
+func (s *regexCallScanner) write(token string) []ToolCallDelta {
+	s.buf += token
+	var deltas []ToolCallDelta
+	for {
+		if s.current == nil {
+			if !s.startCall(&deltas) {
+				return deltas
+			}
+		}
+
+		if end := s.callEnd(); end >= 0 {
+			if next, start, _, _ := s.nextCall(end); next != nil {
+				s.endCall(start, &deltas)
+				s.pos = start
+				continue
+			}
+		}
+
+		args := s.buf[s.argsStart:]
+		if n := s.current.streamable(args); n > s.emitted {
+			deltas = append(deltas, ToolCallDelta{Index: s.count - 1, Arguments: args[s.emitted:n]})
+			s.emitted = n
+		}
+		return deltas
+	}
+}
+
+func (s *regexCallScanner) flush() []ToolCallDelta {
+	var deltas []ToolCallDelta
+	if s.current != nil {
+		s.endCall(len(s.buf), &deltas)
+	}
+	return deltas
+}
+
+// nextCall returns the first call starting from pos, whose prefix is followed by at least one character so that it
+// is not matched partially
+func (s *regexCallScanner) nextCall(pos int) (call *regexCall, start, argsStart int, name string) {
+	text := s.buf[pos:]
+	for _, c := range s.calls {
+		loc := c.prefix.FindStringSubmatchIndex(text)
+		if loc == nil || loc[1] >= len(text) || (call != nil && pos+loc[0] >= start) {
+			continue
+		}
+		call, start, argsStart = c, pos+loc[0], pos+loc[1]
+		name = ""
+		if loc[2*c.nameIndex] >= 0 {
+			name = text[loc[2*c.nameIndex]:loc[2*c.nameIndex+1]]
+		}
+	}
+	return call, start, argsStart, name
+}
+
+func (s *regexCallScanner) startCall(deltas *[]ToolCallDelta) bool {
+	call, start, argsStart, name := s.nextCall(s.pos)
+	if call == nil {
+		return false
+	}
+	s.current, s.callStart, s.argsStart, s.emitted = call, start, argsStart, 0
+	*deltas = append(*deltas, ToolCallDelta{Index: s.count, Name: name})
+	s.count++
+	return true
+}
+
+// callEnd returns where the current call surely ended, -1 if it is not known yet
+func (s *regexCallScanner) callEnd() int {
+	c := s.current
+	switch {
+	case !c.literalSuffix:
+		if loc := c.full.FindStringIndex(s.buf[s.callStart:]); loc != nil {
+			return s.callStart + loc[1]
+		}
+	case c.suffix != "":
+		if i := strings.Index(s.buf[s.argsStart:], c.suffix); i >= 0 {
+			return s.argsStart + i + len(c.suffix)
+		}
+	}
+	return -1
+}
+
+// endCall emits the rest of the arguments of the current call, which ends at end
+func (s *regexCallScanner) endCall(end int, deltas *[]ToolCallDelta) {
+	c := s.current
+	s.current = nil
+
+	args := s.buf[s.argsStart:end]
+	if match := c.full.FindStringSubmatch(s.buf[s.callStart:end]); match != nil {
+		args = match[c.argsIndex]
+	} else if c.literalSuffix {
+		args = args[:c.streamable(args)]
+	}
+
+	emitted := s.buf[s.argsStart : s.argsStart+s.emitted]
+	if !strings.HasPrefix(args, emitted) {
+		log.Debug().Str("arguments", args).Str("emitted", emitted).Msg("the arguments matched differ from the ones streamed")
+		return
+	}
+	if rest := args[s.emitted:]; rest != "" {
+		*deltas = append(*deltas, ToolCallDelta{Index: s.count - 1, Arguments: rest})
+	}
+}
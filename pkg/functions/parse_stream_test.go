@@ -0,0 +1,110 @@
+package functions_test
+
+import (
+	. "github.com/mudler/LocalAI/pkg/functions"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// streamCalls parses the result written by chunks of n bytes, and assembles the calls from their deltas
+func streamCalls(parser *ToolCallParser, result string, n int) []FuncCallResults {
+	var deltas []ToolCallDelta
+	for i := 0; i < len(result); i += n {
+		deltas = append(deltas, parser.Write(result[i:min(i+n, len(result))])...)
+	}
+	deltas = append(deltas, parser.Flush()...)
+
+	var calls []FuncCallResults
+	for _, delta := range deltas {
+		if delta.Index == len(calls) {
+			Expect(delta.Name).ToNot(BeEmpty())
+			calls = append(calls, FuncCallResults{Name: delta.Name})
+		}
+		Expect(delta.Index).To(Equal(len(calls) - 1))
+		calls[delta.Index].Arguments += delta.Arguments
+	}
+	return calls
+}
+
+var _ = Describe("MaxGPT function stream parse tests", func() {
+	var functionConfig FunctionsConfig
+
+	BeforeEach(func() {
+		functionConfig = FunctionsConfig{}
+	})
+
+	Context("when using grammars", func() {
+		It("emits the name as soon as it is generated and streams the arguments", func() {
+			parser := NewToolCallParser(functionConfig)
+			Expect(parser).ToNot(BeNil())
+
+			Expect(parser.Write(`{"name": "ad`)).To(BeEmpty())
+			Expect(parser.Write(`d", "argu`)).To(Equal([]ToolCallDelta{{Index: 0, Name: "add"}}))
+			Expect(parser.Write(`ments": {"x": 5,`)).To(Equal([]ToolCallDelta{{Index: 0, Arguments: `{"x": 5,`}}))
+			Expect(parser.Write(` "y": 3}}`)).To(Equal([]ToolCallDelta{{Index: 0, Arguments: ` "y": 3}`}}))
+			Expect(parser.Flush()).To(BeEmpty())
+		})
+
+		It("holds the arguments generated before the name", func() {
+			parser := NewToolCallParser(functionConfig)
+			Expect(parser.Write(`{"arguments": {"x": 5}, `)).To(BeEmpty())
+			Expect(parser.Write(`"name": "add"}`)).To(Equal([]ToolCallDelta{{Index: 0, Name: "add", Arguments: `{"x": 5}`}}))
+		})
+
+		It("parses the parallel calls among free text byte by byte", func() {
+			input := `Sure, "here": [{"name": "add", "arguments": {"x": 5, "y": 3}}, {"name": "subtract", "arguments": {"x": 10, "y": "}"}}] done`
+			calls := streamCalls(NewToolCallParser(functionConfig), input, 1)
+			Expect(calls).To(Equal([]FuncCallResults{
+				{Name: "add", Arguments: `{"x": 5, "y": 3}`},
+				{Name: "subtract", Arguments: `{"x": 10, "y": "}"}`},
+			}))
+		})
+
+		It("uses the configured keys and escapes the new lines of the strings", func() {
+			functionConfig.FunctionNameKey = "function"
+			input := "{\"function\": \"echo\", \"name\": \"other\", \"arguments\": {\"text\": \"a\nb\"}}"
+			calls := streamCalls(NewToolCallParser(functionConfig), input, 4)
+			Expect(calls).To(Equal([]FuncCallResults{{Name: "echo", Arguments: `{"text": "a\nb"}`}}))
+		})
+
+		It("needs the whole result with replacements", func() {
+			functionConfig.JSONRegexMatch = []string{`(?s)<tool_call>(.*?)</tool_call>`}
+			Expect(NewToolCallParser(functionConfig)).To(BeNil())
+		})
+	})
+
+	Context("when using response regexes", func() {
+		It("emits the name once the regex matches up to the arguments", func() {
+			functionConfig.ResponseRegex = []string{`(?P<name>\w+)\s*\((?P<arguments>.*)\)`}
+			parser := NewToolCallParser(functionConfig)
+			Expect(parser).ToNot(BeNil())
+
+			Expect(parser.Write(`add`)).To(BeEmpty())
+			Expect(parser.Write(`({"x":5`)).To(Equal([]ToolCallDelta{{Index: 0, Name: "add"}, {Index: 0, Arguments: `{"x":5`}}))
+			Expect(parser.Write(`,"y":3})`)).To(Equal([]ToolCallDelta{{Index: 0, Arguments: `,"y":3}`}}))
+			Expect(parser.Flush()).To(BeEmpty())
+		})
+
+		It("streams the same calls as the whole result gives", func() {
+			functionConfig.ResponseRegex = []string{`<function=(?P<name>\w+)>(?P<arguments>.*?)</function>`}
+			input := `<function=add>{"x":5,"y":3}</function><function=subtract>{"x":10,"y":7}</function>`
+
+			calls := streamCalls(NewToolCallParser(functionConfig), input, 1)
+			Expect(calls).To(Equal(ParseFunctionCall(input, functionConfig)))
+			Expect(calls).To(HaveLen(2))
+		})
+
+		It("streams the arguments of the whole regex when they contain its suffix", func() {
+			functionConfig.ResponseRegex = []string{`(?P<name>\w+)\s*\((?P<arguments>.*)\)`}
+			input := `say({"text":"(hi)"})`
+
+			calls := streamCalls(NewToolCallParser(functionConfig), input, 3)
+			Expect(calls).To(Equal([]FuncCallResults{{Name: "say", Arguments: `{"text":"(hi)"}`}}))
+		})
+
+		It("needs the whole result when the regex is not a sequence", func() {
+			functionConfig.ResponseRegex = []string{`(?P<name>\w+)|(?P<arguments>.*)`}
+			Expect(NewToolCallParser(functionConfig)).To(BeNil())
+		})
+	})
+})
@@ -0,0 +1,431 @@
+package functions
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ValidationError is the first mismatch of a JSON document with its schema
+type ValidationError struct {
+	// Function is the name of the function of the arguments, if the document is the arguments of a function call
+	Function string
+	// Path is the JSON pointer of the mismatching value, empty for the document itself
+	Path    string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	subject := "the JSON"
+	if e.Function != "" {
+		subject = "the arguments of " + e.Function
+	}
+	if e.Path != "" {
+		subject += " at " + e.Path
+	}
+	return subject + ": " + e.Message
+}
+
+var (
+	timeFormatRE  = regexp.MustCompile(`^([01][0-9]|2[0-3]):[0-5][0-9]:[0-5][0-9](\.[0-9]+)?(Z|[+-]([01][0-9]|2[0-3]):[0-5][0-9])$`)
+	uuidFormatRE  = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	emailFormatRE = regexp.MustCompile(`^[a-zA-Z0-9_%+-]+(\.[a-zA-Z0-9_%+-]+)*@[a-zA-Z0-9]+(-[a-zA-Z0-9]+)*(\.[a-zA-Z0-9]+(-[a-zA-Z0-9]+)*)*\.[a-zA-Z]{2,}$`)
+)
+
+// ValidateJSON checks that the JSON document matches the schema, and returns a *ValidationError describing the first
+// mismatch if it doesn't. It checks the keywords the grammars support: type, const, enum, anyOf, oneOf, allOf, $ref,
+// properties, required, additionalProperties, items, prefixItems, minItems, maxItems, minLength, maxLength, pattern,
+// format, minimum, maximum, exclusiveMinimum and exclusiveMaximum. The other keywords are ignored.
+func ValidateJSON(schema map[string]interface{}, document string) error {
+	decoder := json.NewDecoder(strings.NewReader(document))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return &ValidationError{Message: fmt.Sprintf("is not valid JSON: %s", err)}
+	}
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return &ValidationError{Message: "is followed by other data"}
+	}
+
+	v := validator{root: schema}
+	if err := v.validate(schema, value, ""); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ValidateCall checks that the arguments of the call match the parameters of the function of its name
+func (f Functions) ValidateCall(call FuncCallResults) error {
+	i := slices.IndexFunc(f, func(function Function) bool { return function.Name == call.Name })
+	if i < 0 {
+		return &ValidationError{Function: call.Name, Message: "the function doesn't exist"}
+	}
+	if f[i].Parameters == nil {
+		return nil
+	}
+
+	var verr *ValidationError
+	if err := ValidateJSON(f[i].Parameters, call.Arguments); errors.As(err, &verr) {
+		verr.Function = call.Name
+		return verr
+	}
+	return nil
+}
+
+type validator struct {
+	root map[string]interface{}
+}
+
+func (v validator) validate(schema interface{}, value interface{}, path string) *ValidationError {
+	mismatch := func(format string, args ...interface{}) *ValidationError {
+		return &ValidationError{Path: path, Message: fmt.Sprintf(format, args...)}
+	}
+
+	switch s := schema.(type) {
+	case bool:
+		if !s {
+			return mismatch("no value is allowed")
+		}
+		return nil
+	case map[string]interface{}:
+		schema := s
+		if ref, ok := schema["$ref"].(string); ok {
+			resolved, err := v.resolve(ref)
+			if err != nil {
+				return mismatch("%s", err)
+			}
+			if err := v.validate(resolved, value, path); err != nil {
+				return err
+			}
+		}
+
+		if err := v.validateCombinations(schema, value, path); err != nil {
+			return err
+		}
+
+		if c, exists := schema["const"]; exists && !jsonEqual(c, value) {
+			return mismatch("must be %s", jsonString(c))
+		}
+		if enum, ok := schema["enum"].([]interface{}); ok && !slices.ContainsFunc(enum, func(e interface{}) bool { return jsonEqual(e, value) }) {
+			return mismatch("must be one of %s", jsonString(enum))
+		}
+		if types := schemaTypes(schema["type"]); len(types) > 0 && !slices.ContainsFunc(types, func(t string) bool { return hasType(value, t) }) {
+			return mismatch("must be of type %s", strings.Join(types, " or "))
+		}
+
+		switch value := value.(type) {
+		case map[string]interface{}:
+			return v.validateObject(schema, value, path)
+		case []interface{}:
+			return v.validateArray(schema, value, path)
+		case string:
+			return validateString(schema, value, path)
+		case json.Number:
+			return validateNumber(schema, value, path)
+		}
+	}
+	return nil
+}
+
+// validateCombinations validates the value against the schemas of allOf, anyOf and oneOf
+func (v validator) validateCombinations(schema map[string]interface{}, value interface{}, path string) *ValidationError {
+	if all, ok := schema["allOf"].([]interface{}); ok {
+		for _, s := range all {
+			if err := v.validate(s, value, path); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, keyword := range []string{"anyOf", "oneOf"} {
+		alternatives, ok := schema[keyword].([]interface{})
+		if !ok {
+			continue
+		}
+		var mismatches []string
+		for _, s := range alternatives {
+			if err := v.validate(s, value, path); err != nil {
+				mismatches = append(mismatches, err.Error())
+			}
+		}
+		matches := len(alternatives) - len(mismatches)
+		switch {
+		case matches == 0:
+			return &ValidationError{Path: path, Message: fmt.Sprintf("must match one of the schemas of %s (%s)", keyword, strings.Join(mismatches, "; "))}
+		case matches > 1 && keyword == "oneOf":
+			return &ValidationError{Path: path, Message: "must match only one of the schemas of oneOf"}
+		}
+	}
+	return nil
+}
+
+func (v validator) validateObject(schema map[string]interface{}, object map[string]interface{}, path string) *ValidationError {
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, r := range required {
+			if name, ok := r.(string); ok {
+				if _, exists := object[name]; !exists {
+					return &ValidationError{Path: path, Message: fmt.Sprintf("is missing the required property %q", name)}
+				}
+			}
+		}
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		propertyPath := path + "/" + pointerToken(key)
+		if property, declared := properties[key]; declared {
+			if err := v.validate(property, object[key], propertyPath); err != nil {
+				return err
+			}
+			continue
+		}
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				return &ValidationError{Path: path, Message: fmt.Sprintf("has the property %q, which isn't allowed", key)}
+			}
+		case map[string]interface{}:
+			if err := v.validate(additional, object[key], propertyPath); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (v validator) validateArray(schema map[string]interface{}, array []interface{}, path string) *ValidationError {
+	if minItems, ok := schemaNumber(schema["minItems"]); ok && big.NewFloat(float64(len(array))).Cmp(minItems) < 0 {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("must have at least %s items", minItems.Text('f', -1))}
+	}
+	if maxItems, ok := schemaNumber(schema["maxItems"]); ok && big.NewFloat(float64(len(array))).Cmp(maxItems) > 0 {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("must have at most %s items", maxItems.Text('f', -1))}
+	}
+
+	prefixItems, _ := schema["prefixItems"].([]interface{})
+	items := schema["items"]
+	// Before the 2020-12 draft, an array of items was the schemas of the first items
+	if tuple, ok := items.([]interface{}); ok {
+		prefixItems, items = tuple, nil
+	}
+	for i, item := range array {
+		itemSchema := items
+		if i < len(prefixItems) {
+			itemSchema = prefixItems[i]
+		}
+		if itemSchema == nil {
+			continue
+		}
+		if err := v.validate(itemSchema, item, fmt.Sprintf("%s/%d", path, i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateString(schema map[string]interface{}, s string, path string) *ValidationError {
+	length := big.NewFloat(float64(utf8.RuneCountInString(s)))
+	if minLength, ok := schemaNumber(schema["minLength"]); ok && length.Cmp(minLength) < 0 {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("must have at least %s characters", minLength.Text('f', -1))}
+	}
+	if maxLength, ok := schemaNumber(schema["maxLength"]); ok && length.Cmp(maxLength) > 0 {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("must have at most %s characters", maxLength.Text('f', -1))}
+	}
+
+	if pattern, ok := schema["pattern"].(string); ok {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return &ValidationError{Path: path, Message: fmt.Sprintf("can't be checked against the pattern %q: %s", pattern, err)}
+		}
+		if !re.MatchString(s) {
+			return &ValidationError{Path: path, Message: fmt.Sprintf("must match the pattern %q", pattern)}
+		}
+	}
+
+	if format, ok := schema["format"].(string); ok {
+		valid := true
+		switch format {
+		case "date":
+			_, err := time.Parse(time.DateOnly, s)
+			valid = err == nil
+		case "time":
+			valid = timeFormatRE.MatchString(s)
+		case "date-time":
+			date, t, found := strings.Cut(s, "T")
+			_, err := time.Parse(time.DateOnly, date)
+			valid = found && err == nil && timeFormatRE.MatchString(t)
+		case "uuid":
+			valid = uuidFormatRE.MatchString(s)
+		case "email":
+			valid = emailFormatRE.MatchString(s)
+		}
+		if !valid {
+			return &ValidationError{Path: path, Message: fmt.Sprintf("must be in the %s format", format)}
+		}
+	}
+	return nil
+}
+
+func validateNumber(schema map[string]interface{}, n json.Number, path string) *ValidationError {
+	value, ok := new(big.Float).SetString(n.String())
+	if !ok {
+		return &ValidationError{Path: path, Message: "must be a number"}
+	}
+
+	if minimum, ok := schemaNumber(schema["exclusiveMinimum"]); ok && value.Cmp(minimum) <= 0 {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("must be greater than %s", minimum.Text('g', -1))}
+	}
+	if maximum, ok := schemaNumber(schema["exclusiveMaximum"]); ok && value.Cmp(maximum) >= 0 {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("must be less than %s", maximum.Text('g', -1))}
+	}
+	// Before the 6th draft, exclusiveMinimum and exclusiveMaximum were booleans making minimum and maximum exclusive
+	exclusiveMinimum, _ := schema["exclusiveMinimum"].(bool)
+	exclusiveMaximum, _ := schema["exclusiveMaximum"].(bool)
+	if minimum, ok := schemaNumber(schema["minimum"]); ok {
+		if cmp := value.Cmp(minimum); cmp < 0 || cmp == 0 && exclusiveMinimum {
+			return &ValidationError{Path: path, Message: fmt.Sprintf("must be at least %s", minimum.Text('g', -1))}
+		}
+	}
+	if maximum, ok := schemaNumber(schema["maximum"]); ok {
+		if cmp := value.Cmp(maximum); cmp > 0 || cmp == 0 && exclusiveMaximum {
+			return &ValidationError{Path: path, Message: fmt.Sprintf("must be at most %s", maximum.Text('g', -1))}
+		}
+	}
+	return nil
+}
+
+// resolve returns the schema of a reference to a part of the root schema, e.g. #/$defs/address
+func (v validator) resolve(ref string) (interface{}, error) {
+	pointer, ok := strings.CutPrefix(ref, "#")
+	if !ok {
+		return nil, fmt.Errorf("can't be checked against the external schema %s", ref)
+	}
+
+	var schema interface{} = v.root
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		if token == "" {
+			continue
+		}
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		object, ok := schema.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("can't be checked against the missing schema %s", ref)
+		}
+		if schema, ok = object[token]; !ok {
+			return nil, fmt.Errorf("can't be checked against the missing schema %s", ref)
+		}
+	}
+	return schema, nil
+}
+
+// schemaTypes returns the types of the type keyword, which is either a type or a list of types
+func schemaTypes(t interface{}) []string {
+	switch t := t.(type) {
+	case string:
+		if t != "" {
+			return []string{t}
+		}
+	case []interface{}:
+		types := []string{}
+		for _, e := range t {
+			if s, ok := e.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+// hasType returns whether the decoded JSON value is of the JSON schema type
+func hasType(value interface{}, t string) bool {
+	switch value := value.(type) {
+	case nil:
+		return t == "null"
+	case bool:
+		return t == "boolean"
+	case string:
+		return t == "string"
+	case []interface{}:
+		return t == "array"
+	case map[string]interface{}:
+		return t == "object"
+	case json.Number:
+		if t == "number" {
+			return true
+		}
+		if t == "integer" {
+			n, ok := new(big.Float).SetString(value.String())
+			return ok && n.IsInt()
+		}
+	}
+	return false
+}
+
+// schemaNumber returns the number of a keyword of the schema, which is decoded from either JSON or YAML
+func schemaNumber(v interface{}) (*big.Float, bool) {
+	switch v := v.(type) {
+	case float64:
+		return big.NewFloat(v), true
+	case int:
+		return new(big.Float).SetInt64(int64(v)), true
+	case int64:
+		return new(big.Float).SetInt64(v), true
+	case uint64:
+		return new(big.Float).SetUint64(v), true
+	case json.Number:
+		return new(big.Float).SetString(v.String())
+	}
+	return nil, false
+}
+
+// jsonEqual returns whether two JSON values are equal, whichever way they were decoded
+func jsonEqual(a, b interface{}) bool {
+	return reflect.DeepEqual(normalizeJSON(a), normalizeJSON(b))
+}
+
+func normalizeJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		normalized := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			normalized[key] = normalizeJSON(value)
+		}
+		return normalized
+	case []interface{}:
+		normalized := make([]interface{}, len(v))
+		for i, value := range v {
+			normalized[i] = normalizeJSON(value)
+		}
+		return normalized
+	}
+	if n, ok := schemaNumber(v); ok {
+		return n.Text('g', -1)
+	}
+	return v
+}
+
+func jsonString(v interface{}) string {
+	dat, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(dat)
+}
+
+// pointerToken escapes a key of an object as a token of a JSON pointer
+func pointerToken(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
@@ -0,0 +1,121 @@
+package functions_test
+
+import (
+	"encoding/json"
+	"errors"
+
+	. "github.com/mudler/LocalAI/pkg/functions"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Structured output validation", func() {
+	parseSchema := func(s string) map[string]interface{} {
+		schema := map[string]interface{}{}
+		Expect(json.Unmarshal([]byte(s), &schema)).To(Succeed())
+		return schema
+	}
+
+	Describe("ValidateJSON()", func() {
+		person := parseSchema(`{
+			"type": "object",
+			"properties": {
+				"name": {"type": "string", "minLength": 1, "maxLength": 10},
+				"age": {"type": "integer", "minimum": 0, "exclusiveMaximum": 150},
+				"email": {"type": "string", "format": "email"},
+				"role": {"enum": ["admin", "user"]},
+				"tags": {"type": "array", "items": {"type": "string", "pattern": "^[a-z]+$"}, "maxItems": 2},
+				"address": {"$ref": "#/$defs/address"}
+			},
+			"required": ["name", "age"],
+			"additionalProperties": false,
+			"$defs": {
+				"address": {"type": "object", "properties": {"city": {"type": "string"}}, "required": ["city"]}
+			}
+		}`)
+
+		DescribeTable("accepts the documents matching the schema",
+			func(document string) {
+				Expect(ValidateJSON(person, document)).To(Succeed())
+			},
+			Entry("with the required properties", `{"name": "Ada", "age": 36}`),
+			Entry("with the optional properties", `{"name": "Ada", "age": 36, "email": "ada@example.com", "role": "admin", "tags": ["math"], "address": {"city": "London"}}`),
+			Entry("with an integer written as a float", `{"name": "Ada", "age": 36.0}`),
+		)
+
+		DescribeTable("rejects the documents which don't match the schema",
+			func(document, path, message string) {
+				err := ValidateJSON(person, document)
+				var verr *ValidationError
+				Expect(errors.As(err, &verr)).To(BeTrue())
+				Expect(verr.Path).To(Equal(path))
+				Expect(verr.Message).To(ContainSubstring(message))
+			},
+			Entry("invalid JSON", `{"name": "Ada",`, "", "is not valid JSON"),
+			Entry("trailing data", `{"name": "Ada", "age": 36} {}`, "", "is followed by other data"),
+			Entry("wrong type", `["Ada"]`, "", "must be of type object"),
+			Entry("missing property", `{"name": "Ada"}`, "", `is missing the required property "age"`),
+			Entry("additional property", `{"name": "Ada", "age": 36, "nickname": "A"}`, "", `has the property "nickname"`),
+			Entry("fraction for an integer", `{"name": "Ada", "age": 36.5}`, "/age", "must be of type integer"),
+			Entry("exclusive maximum", `{"name": "Ada", "age": 150}`, "/age", "must be less than 150"),
+			Entry("minimum", `{"name": "Ada", "age": -1}`, "/age", "must be at least 0"),
+			Entry("too short string", `{"name": "", "age": 36}`, "/name", "at least 1 characters"),
+			Entry("too long string", `{"name": "Ada Lovelace King", "age": 36}`, "/name", "at most 10 characters"),
+			Entry("format", `{"name": "Ada", "age": 36, "email": "ada"}`, "/email", "must be in the email format"),
+			Entry("enum", `{"name": "Ada", "age": 36, "role": "guest"}`, "/role", `must be one of ["admin","user"]`),
+			Entry("pattern", `{"name": "Ada", "age": 36, "tags": ["Math"]}`, "/tags/0", "must match the pattern"),
+			Entry("too many items", `{"name": "Ada", "age": 36, "tags": ["a", "b", "c"]}`, "/tags", "at most 2 items"),
+			Entry("reference", `{"name": "Ada", "age": 36, "address": {}}`, "/address", `is missing the required property "city"`),
+		)
+
+		It("checks the alternatives of anyOf and oneOf", func() {
+			schema := parseSchema(`{"oneOf": [{"type": "integer"}, {"type": "number", "minimum": 10}]}`)
+			Expect(ValidateJSON(schema, `1`)).To(Succeed())
+			Expect(ValidateJSON(schema, `10.5`)).To(Succeed())
+			Expect(ValidateJSON(schema, `12`)).To(MatchError(ContainSubstring("only one of the schemas of oneOf")))
+			Expect(ValidateJSON(schema, `"12"`)).To(MatchError(ContainSubstring("must match one of the schemas of oneOf")))
+		})
+
+		It("checks the items of tuples", func() {
+			schema := parseSchema(`{"type": "array", "prefixItems": [{"type": "string"}, {"type": "boolean"}], "items": {"type": "null"}}`)
+			Expect(ValidateJSON(schema, `["a", true, null]`)).To(Succeed())
+			Expect(ValidateJSON(schema, `["a", 1]`)).To(MatchError("the JSON at /1: must be of type boolean"))
+			Expect(ValidateJSON(schema, `["a", true, 1]`)).To(MatchError("the JSON at /2: must be of type null"))
+		})
+
+		It("compares the constants regardless of how the numbers are written", func() {
+			schema := parseSchema(`{"const": {"a": [1, "b"]}}`)
+			Expect(ValidateJSON(schema, `{"a": [1.0, "b"]}`)).To(Succeed())
+			Expect(ValidateJSON(schema, `{"a": [2, "b"]}`)).To(MatchError(ContainSubstring(`must be {"a":[1,"b"]}`)))
+		})
+	})
+
+	Describe("ValidateCall()", func() {
+		functions := Functions{
+			{
+				Name: "search",
+				Parameters: map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"query": map[string]interface{}{"type": "string"},
+						"limit": map[string]interface{}{"type": "integer", "maximum": 10},
+					},
+					"required": []interface{}{"query"},
+				},
+			},
+		}
+
+		It("validates the arguments against the parameters of the function", func() {
+			Expect(functions.ValidateCall(FuncCallResults{Name: "search", Arguments: `{"query": "go", "limit": 5}`})).To(Succeed())
+			Expect(functions.ValidateCall(FuncCallResults{Name: "search", Arguments: `{"query": "go", "limit": 50}`})).
+				To(MatchError("the arguments of search at /limit: must be at most 10"))
+			Expect(functions.ValidateCall(FuncCallResults{Name: "search", Arguments: `{}`})).
+				To(MatchError(`the arguments of search: is missing the required property "query"`))
+		})
+
+		It("rejects the calls of unknown functions", func() {
+			Expect(functions.ValidateCall(FuncCallResults{Name: "browse", Arguments: `{}`})).
+				To(MatchError("the arguments of browse: the function doesn't exist"))
+		})
+	})
+})
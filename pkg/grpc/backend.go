@@ -51,6 +51,8 @@ type Backend interface {
 	StoresDelete(ctx context.Context, in *pb.StoresDeleteOptions, opts ...grpc.CallOption) (*pb.Result, error)
 	StoresGet(ctx context.Context, in *pb.StoresGetOptions, opts ...grpc.CallOption) (*pb.StoresGetResult, error)
 	StoresFind(ctx context.Context, in *pb.StoresFindOptions, opts ...grpc.CallOption) (*pb.StoresFindResult, error)
+	StoresSnapshot(ctx context.Context, in *pb.StoresSnapshotOptions, opts ...grpc.CallOption) (*pb.StoresSnapshotResult, error)
+	StoresRestore(ctx context.Context, in *pb.StoresSnapshotOptions, opts ...grpc.CallOption) (*pb.StoresSnapshotResult, error)
 
 	Rerank(ctx context.Context, in *pb.RerankRequest, opts ...grpc.CallOption) (*pb.RerankResult, error)
 
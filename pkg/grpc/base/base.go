@@ -100,6 +100,14 @@ func (llm *Base) StoresFind(*pb.StoresFindOptions) (pb.StoresFindResult, error)
 	return pb.StoresFindResult{}, fmt.Errorf("unimplemented")
 }
 
+func (llm *Base) StoresSnapshot(*pb.StoresSnapshotOptions) (pb.StoresSnapshotResult, error) {
+	return pb.StoresSnapshotResult{}, fmt.Errorf("unimplemented")
+}
+
+func (llm *Base) StoresRestore(*pb.StoresSnapshotOptions) (pb.StoresSnapshotResult, error) {
+	return pb.StoresSnapshotResult{}, fmt.Errorf("unimplemented")
+}
+
 func (llm *Base) VAD(*pb.VADRequest) (pb.VADResponse, error) {
 	return pb.VADResponse{}, fmt.Errorf("unimplemented")
 }
@@ -91,6 +91,14 @@ func (e *embedBackend) StoresFind(ctx context.Context, in *pb.StoresFindOptions,
 	return e.s.StoresFind(ctx, in)
 }
 
+func (e *embedBackend) StoresSnapshot(ctx context.Context, in *pb.StoresSnapshotOptions, opts ...grpc.CallOption) (*pb.StoresSnapshotResult, error) {
+	return e.s.StoresSnapshot(ctx, in)
+}
+
+func (e *embedBackend) StoresRestore(ctx context.Context, in *pb.StoresSnapshotOptions, opts ...grpc.CallOption) (*pb.StoresSnapshotResult, error) {
+	return e.s.StoresRestore(ctx, in)
+}
+
 func (e *embedBackend) Rerank(ctx context.Context, in *pb.RerankRequest, opts ...grpc.CallOption) (*pb.RerankResult, error) {
 	return e.s.Rerank(ctx, in)
 }
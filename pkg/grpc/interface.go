@@ -26,6 +26,8 @@ type AIModel interface {
 	StoresDelete(*pb.StoresDeleteOptions) error
 	StoresGet(*pb.StoresGetOptions) (pb.StoresGetResult, error)
 	StoresFind(*pb.StoresFindOptions) (pb.StoresFindResult, error)
+	StoresSnapshot(*pb.StoresSnapshotOptions) (pb.StoresSnapshotResult, error)
+	StoresRestore(*pb.StoresSnapshotOptions) (pb.StoresSnapshotResult, error)
 
 	VAD(*pb.VADRequest) (pb.VADResponse, error)
 }
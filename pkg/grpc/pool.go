@@ -0,0 +1,388 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pb "github.com/mudler/LocalAI/pkg/grpc/proto"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+var _ Backend = new(Pool)
+
+// poolCheckInterval is how often the endpoints of a pool are checked
+const poolCheckInterval = 10 * time.Second
+
+// ErrNoHealthyEndpoint is returned by the calls to a pool whose endpoints are all down
+var ErrNoHealthyEndpoint = errors.New("no healthy backend endpoint")
+
+// Pool is a Backend spreading the requests over several identical remote backends. Each request goes to the least
+// busy healthy endpoint, and fails over to the next one if the endpoint is unreachable. The endpoints are checked
+// in the background: the ones which are down are left out until they are back, and the model is loaded again on them.
+type Pool struct {
+	endpoints []*poolEndpoint
+	cancel    context.CancelFunc
+
+	mu sync.Mutex
+	// next is where the search of an endpoint starts, so that the requests go round the equally busy endpoints
+	next int
+	// loadOpts are the options the model is loaded with on the endpoints coming back
+	loadOpts *pb.ModelOptions
+}
+
+type poolEndpoint struct {
+	address  string
+	client   Backend
+	inFlight atomic.Int32
+
+	// Set under the lock of the pool
+	healthy         bool
+	tokensPerSecond float32
+}
+
+// NewPool returns a pool of the backends at the addresses. No endpoint is used before the model is loaded on it
+// with LoadModel. Close stops checking the endpoints.
+func NewPool(addresses []string, parallel bool) *Pool {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Pool{cancel: cancel}
+	for _, address := range addresses {
+		p.endpoints = append(p.endpoints, &poolEndpoint{
+			address: address,
+			client:  NewClient(address, parallel, nil, false),
+		})
+	}
+	go p.monitor(ctx)
+	return p
+}
+
+// Close stops checking the endpoints of the pool
+func (p *Pool) Close() {
+	p.cancel()
+}
+
+// better returns if the endpoint should get the next request rather than the other one
+func (e *poolEndpoint) better(other *poolEndpoint) bool {
+	if busy, otherBusy := e.client.IsBusy(), other.client.IsBusy(); busy != otherBusy {
+		return !busy
+	}
+	if inFlight, otherInFlight := e.inFlight.Load(), other.inFlight.Load(); inFlight != otherInFlight {
+		return inFlight < otherInFlight
+	}
+	return e.tokensPerSecond > other.tokensPerSecond
+}
+
+// pick returns the least busy healthy endpoint which was not tried yet, nil if there is none
+func (p *Pool) pick(tried map[*poolEndpoint]bool) *poolEndpoint {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.endpoints) == 0 {
+		return nil
+	}
+
+	var best *poolEndpoint
+	for i := range p.endpoints {
+		e := p.endpoints[(p.next+i)%len(p.endpoints)]
+		if !e.healthy || tried[e] {
+			continue
+		}
+		if best == nil || e.better(best) {
+			best = e
+		}
+	}
+	p.next = (p.next + 1) % len(p.endpoints)
+	return best
+}
+
+func (p *Pool) setHealthy(e *poolEndpoint, healthy bool, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if e.healthy == healthy {
+		return
+	}
+	e.healthy = healthy
+	if healthy {
+		log.Info().Str("endpoint", e.address).Msg("Backend endpoint is up")
+	} else {
+		log.Warn().Err(err).Str("endpoint", e.address).Msg("Backend endpoint is down")
+	}
+}
+
+// unreachable returns if the error of a call is caused by the endpoint being down
+func unreachable(err error) bool {
+	return status.Code(err) == codes.Unavailable
+}
+
+// call runs the request on the least busy endpoint, failing over to the next ones while they are unreachable
+func call[T any](p *Pool, request func(Backend) (T, error)) (T, error) {
+	tried := map[*poolEndpoint]bool{}
+	var lastErr error
+	for {
+		e := p.pick(tried)
+		if e == nil {
+			var zero T
+			if lastErr != nil {
+				return zero, fmt.Errorf("%w: %w", ErrNoHealthyEndpoint, lastErr)
+			}
+			return zero, ErrNoHealthyEndpoint
+		}
+		tried[e] = true
+
+		e.inFlight.Add(1)
+		res, err := request(e.client)
+		e.inFlight.Add(-1)
+		if err != nil && unreachable(err) {
+			p.setHealthy(e, false, err)
+			lastErr = err
+			continue
+		}
+		return res, err
+	}
+}
+
+// monitor checks the endpoints until the context is canceled
+func (p *Pool) monitor(ctx context.Context) {
+	ticker := time.NewTicker(poolCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		var wg sync.WaitGroup
+		for _, e := range p.endpoints {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				p.check(ctx, e)
+			}()
+		}
+		wg.Wait()
+	}
+}
+
+// check checks the health of the endpoint, and loads the model on it when it is back
+func (p *Pool) check(ctx context.Context, e *poolEndpoint) {
+	p.mu.Lock()
+	healthy, loadOpts := e.healthy, p.loadOpts
+	p.mu.Unlock()
+	if loadOpts == nil {
+		// The model is not loaded yet
+		return
+	}
+	// An endpoint running a request is up, and would make the check wait for it
+	if healthy && e.client.IsBusy() {
+		return
+	}
+
+	if alive, err := e.client.HealthCheck(ctx); !alive {
+		p.setHealthy(e, false, err)
+		return
+	}
+	// Not all the backends report their status
+	if res, err := e.client.Status(ctx); err == nil && res.State == pb.StatusResponse_ERROR {
+		p.setHealthy(e, false, errors.New("the backend is in error"))
+		return
+	}
+
+	if !healthy {
+		if err := loadModel(ctx, e, loadOpts); err != nil {
+			log.Warn().Err(err).Str("endpoint", e.address).Msg("Backend endpoint is back but could not load the model")
+			return
+		}
+		p.setHealthy(e, true, nil)
+	}
+
+	if metrics, err := e.client.GetTokenMetrics(ctx, &pb.MetricsRequest{}); err == nil {
+		p.mu.Lock()
+		e.tokensPerSecond = metrics.TokensPerSecond
+		p.mu.Unlock()
+	}
+}
+
+func loadModel(ctx context.Context, e *poolEndpoint, in *pb.ModelOptions) error {
+	res, err := e.client.LoadModel(ctx, in)
+	if err != nil {
+		return err
+	}
+	if !res.Success {
+		return errors.New(res.Message)
+	}
+	return nil
+}
+
+func (p *Pool) IsBusy() bool {
+	for _, e := range p.endpoints {
+		if e.inFlight.Load() > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// HealthCheck reports the pool healthy while one of its endpoints is
+func (p *Pool) HealthCheck(ctx context.Context) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, e := range p.endpoints {
+		if e.healthy {
+			return true, nil
+		}
+	}
+	return false, ErrNoHealthyEndpoint
+}
+
+// LoadModel loads the model on all the endpoints, and succeeds if it is loaded on one of them at least. It is
+// loaded on the others once they are healthy.
+func (p *Pool) LoadModel(ctx context.Context, in *pb.ModelOptions, opts ...grpc.CallOption) (*pb.Result, error) {
+	errs := make([]error, len(p.endpoints))
+	var wg sync.WaitGroup
+	for i, e := range p.endpoints {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if alive, err := e.client.HealthCheck(ctx); !alive {
+				errs[i] = fmt.Errorf("%s: %w", e.address, err)
+				return
+			}
+			if err := loadModel(ctx, e, in); err != nil {
+				errs[i] = fmt.Errorf("%s: %w", e.address, err)
+				return
+			}
+			p.setHealthy(e, true, nil)
+		}()
+	}
+	wg.Wait()
+
+	// The endpoints which failed are checked from now on
+	p.mu.Lock()
+	p.loadOpts = proto.Clone(in).(*pb.ModelOptions)
+	p.mu.Unlock()
+
+	if ok, _ := p.HealthCheck(ctx); !ok {
+		return nil, fmt.Errorf("could not load the model on any backend endpoint: %w", errors.Join(errs...))
+	}
+	for _, err := range errs {
+		if err != nil {
+			log.Warn().Err(err).Msg("Could not load the model on a backend endpoint, it is loaded once the endpoint is healthy")
+		}
+	}
+	return &pb.Result{Success: true, Message: "model loaded"}, nil
+}
+
+// PredictStream fails over to the next endpoint only until the first token is received
+func (p *Pool) PredictStream(ctx context.Context, in *pb.PredictOptions, f func(reply *pb.Reply), opts ...grpc.CallOption) error {
+	tried := map[*poolEndpoint]bool{}
+	var lastErr error
+	for {
+		e := p.pick(tried)
+		if e == nil {
+			if lastErr != nil {
+				return fmt.Errorf("%w: %w", ErrNoHealthyEndpoint, lastErr)
+			}
+			return ErrNoHealthyEndpoint
+		}
+		tried[e] = true
+
+		streamed := false
+		e.inFlight.Add(1)
+		err := e.client.PredictStream(ctx, in, func(reply *pb.Reply) {
+			streamed = true
+			f(reply)
+		}, opts...)
+		e.inFlight.Add(-1)
+		if err != nil && unreachable(err) {
+			p.setHealthy(e, false, err)
+			if !streamed {
+				lastErr = err
+				continue
+			}
+		}
+		return err
+	}
+}
+
+func (p *Pool) Embeddings(ctx context.Context, in *pb.PredictOptions, opts ...grpc.CallOption) (*pb.EmbeddingResult, error) {
+	return call(p, func(b Backend) (*pb.EmbeddingResult, error) { return b.Embeddings(ctx, in, opts...) })
+}
+
+func (p *Pool) Predict(ctx context.Context, in *pb.PredictOptions, opts ...grpc.CallOption) (*pb.Reply, error) {
+	return call(p, func(b Backend) (*pb.Reply, error) { return b.Predict(ctx, in, opts...) })
+}
+
+func (p *Pool) GenerateImage(ctx context.Context, in *pb.GenerateImageRequest, opts ...grpc.CallOption) (*pb.Result, error) {
+	return call(p, func(b Backend) (*pb.Result, error) { return b.GenerateImage(ctx, in, opts...) })
+}
+
+func (p *Pool) GenerateVideo(ctx context.Context, in *pb.GenerateVideoRequest, opts ...grpc.CallOption) (*pb.Result, error) {
+	return call(p, func(b Backend) (*pb.Result, error) { return b.GenerateVideo(ctx, in, opts...) })
+}
+
+func (p *Pool) TTS(ctx context.Context, in *pb.TTSRequest, opts ...grpc.CallOption) (*pb.Result, error) {
+	return call(p, func(b Backend) (*pb.Result, error) { return b.TTS(ctx, in, opts...) })
+}
+
+func (p *Pool) SoundGeneration(ctx context.Context, in *pb.SoundGenerationRequest, opts ...grpc.CallOption) (*pb.Result, error) {
+	return call(p, func(b Backend) (*pb.Result, error) { return b.SoundGeneration(ctx, in, opts...) })
+}
+
+func (p *Pool) Detect(ctx context.Context, in *pb.DetectOptions, opts ...grpc.CallOption) (*pb.DetectResponse, error) {
+	return call(p, func(b Backend) (*pb.DetectResponse, error) { return b.Detect(ctx, in, opts...) })
+}
+
+func (p *Pool) AudioTranscription(ctx context.Context, in *pb.TranscriptRequest, opts ...grpc.CallOption) (*pb.TranscriptResult, error) {
+	return call(p, func(b Backend) (*pb.TranscriptResult, error) { return b.AudioTranscription(ctx, in, opts...) })
+}
+
+func (p *Pool) TokenizeString(ctx context.Context, in *pb.PredictOptions, opts ...grpc.CallOption) (*pb.TokenizationResponse, error) {
+	return call(p, func(b Backend) (*pb.TokenizationResponse, error) { return b.TokenizeString(ctx, in, opts...) })
+}
+
+func (p *Pool) Status(ctx context.Context) (*pb.StatusResponse, error) {
+	return call(p, func(b Backend) (*pb.StatusResponse, error) { return b.Status(ctx) })
+}
+
+func (p *Pool) StoresSet(ctx context.Context, in *pb.StoresSetOptions, opts ...grpc.CallOption) (*pb.Result, error) {
+	return call(p, func(b Backend) (*pb.Result, error) { return b.StoresSet(ctx, in, opts...) })
+}
+
+func (p *Pool) StoresDelete(ctx context.Context, in *pb.StoresDeleteOptions, opts ...grpc.CallOption) (*pb.Result, error) {
+	return call(p, func(b Backend) (*pb.Result, error) { return b.StoresDelete(ctx, in, opts...) })
+}
+
+func (p *Pool) StoresGet(ctx context.Context, in *pb.StoresGetOptions, opts ...grpc.CallOption) (*pb.StoresGetResult, error) {
+	return call(p, func(b Backend) (*pb.StoresGetResult, error) { return b.StoresGet(ctx, in, opts...) })
+}
+
+func (p *Pool) StoresFind(ctx context.Context, in *pb.StoresFindOptions, opts ...grpc.CallOption) (*pb.StoresFindResult, error) {
+	return call(p, func(b Backend) (*pb.StoresFindResult, error) { return b.StoresFind(ctx, in, opts...) })
+}
+
+func (p *Pool) StoresSnapshot(ctx context.Context, in *pb.StoresSnapshotOptions, opts ...grpc.CallOption) (*pb.StoresSnapshotResult, error) {
+	return call(p, func(b Backend) (*pb.StoresSnapshotResult, error) { return b.StoresSnapshot(ctx, in, opts...) })
+}
+
+func (p *Pool) StoresRestore(ctx context.Context, in *pb.StoresSnapshotOptions, opts ...grpc.CallOption) (*pb.StoresSnapshotResult, error) {
+	return call(p, func(b Backend) (*pb.StoresSnapshotResult, error) { return b.StoresRestore(ctx, in, opts...) })
+}
+
+func (p *Pool) Rerank(ctx context.Context, in *pb.RerankRequest, opts ...grpc.CallOption) (*pb.RerankResult, error) {
+	return call(p, func(b Backend) (*pb.RerankResult, error) { return b.Rerank(ctx, in, opts...) })
+}
+
+func (p *Pool) GetTokenMetrics(ctx context.Context, in *pb.MetricsRequest, opts ...grpc.CallOption) (*pb.MetricsResponse, error) {
+	return call(p, func(b Backend) (*pb.MetricsResponse, error) { return b.GetTokenMetrics(ctx, in, opts...) })
+}
+
+func (p *Pool) VAD(ctx context.Context, in *pb.VADRequest, opts ...grpc.CallOption) (*pb.VADResponse, error) {
+	return call(p, func(b Backend) (*pb.VADResponse, error) { return b.VAD(ctx, in, opts...) })
+}
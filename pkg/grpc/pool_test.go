@@ -0,0 +1,148 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+
+	pb "github.com/mudler/LocalAI/pkg/grpc/proto"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeBackend is a remote backend answering the calls of the pool with its name
+type fakeBackend struct {
+	Backend
+	name  string
+	busy  bool
+	down  bool
+	loads int
+}
+
+func (f *fakeBackend) IsBusy() bool {
+	return f.busy
+}
+
+func (f *fakeBackend) HealthCheck(context.Context) (bool, error) {
+	if f.down {
+		return false, status.Error(codes.Unavailable, "connection refused")
+	}
+	return true, nil
+}
+
+func (f *fakeBackend) Status(context.Context) (*pb.StatusResponse, error) {
+	return &pb.StatusResponse{State: pb.StatusResponse_READY}, nil
+}
+
+func (f *fakeBackend) GetTokenMetrics(context.Context, *pb.MetricsRequest, ...grpc.CallOption) (*pb.MetricsResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (f *fakeBackend) LoadModel(context.Context, *pb.ModelOptions, ...grpc.CallOption) (*pb.Result, error) {
+	if f.down {
+		return nil, status.Error(codes.Unavailable, "connection refused")
+	}
+	f.loads++
+	return &pb.Result{Success: true}, nil
+}
+
+func (f *fakeBackend) Predict(context.Context, *pb.PredictOptions, ...grpc.CallOption) (*pb.Reply, error) {
+	if f.down {
+		return nil, status.Error(codes.Unavailable, "connection refused")
+	}
+	return &pb.Reply{Message: []byte(f.name)}, nil
+}
+
+func (f *fakeBackend) PredictStream(_ context.Context, _ *pb.PredictOptions, cb func(*pb.Reply), _ ...grpc.CallOption) error {
+	if f.down {
+		return status.Error(codes.Unavailable, "connection refused")
+	}
+	cb(&pb.Reply{Message: []byte(f.name)})
+	return nil
+}
+
+var _ = Describe("Pool", func() {
+	var (
+		a, b *fakeBackend
+		pool *Pool
+	)
+
+	predict := func() (string, error) {
+		reply, err := pool.Predict(context.Background(), &pb.PredictOptions{})
+		if err != nil {
+			return "", err
+		}
+		return string(reply.Message), nil
+	}
+
+	BeforeEach(func() {
+		a, b = &fakeBackend{name: "a"}, &fakeBackend{name: "b"}
+		pool = &Pool{
+			endpoints: []*poolEndpoint{{address: "a", client: a}, {address: "b", client: b}},
+			cancel:    func() {},
+		}
+	})
+
+	It("loads the model on all the endpoints", func() {
+		res, err := pool.LoadModel(context.Background(), &pb.ModelOptions{Model: "model"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.Success).To(BeTrue())
+		Expect(a.loads).To(Equal(1))
+		Expect(b.loads).To(Equal(1))
+	})
+
+	It("fails to load if no endpoint is up", func() {
+		a.down, b.down = true, true
+		_, err := pool.LoadModel(context.Background(), &pb.ModelOptions{Model: "model"})
+		Expect(err).To(MatchError(ContainSubstring("could not load the model on any backend endpoint")))
+	})
+
+	It("sends the requests to the least busy endpoint", func() {
+		Expect(pool.LoadModel(context.Background(), &pb.ModelOptions{})).ToNot(BeNil())
+
+		a.busy = true
+		Expect(predict()).To(Equal("b"))
+		Expect(predict()).To(Equal("b"))
+
+		// The requests go round the endpoints equally busy
+		a.busy = false
+		first, _ := predict()
+		second, _ := predict()
+		Expect([]string{first, second}).To(ConsistOf("a", "b"))
+	})
+
+	It("fails over to the next endpoint and loads the model again once the endpoint is back", func() {
+		Expect(pool.LoadModel(context.Background(), &pb.ModelOptions{})).ToNot(BeNil())
+
+		a.down = true
+		b.busy = true
+		Expect(predict()).To(Equal("b"))
+		Expect(pool.endpoints[0].healthy).To(BeFalse())
+
+		b.down = true
+		_, err := predict()
+		Expect(err).To(MatchError(ErrNoHealthyEndpoint))
+		healthy, _ := pool.HealthCheck(context.Background())
+		Expect(healthy).To(BeFalse())
+
+		a.down = false
+		pool.check(context.Background(), pool.endpoints[0])
+		Expect(a.loads).To(Equal(2))
+		Expect(predict()).To(Equal("a"))
+	})
+
+	It("fails over a stream until its first token", func() {
+		Expect(pool.LoadModel(context.Background(), &pb.ModelOptions{})).ToNot(BeNil())
+
+		a.down = true
+		b.busy = true
+		var replies []string
+		err := pool.PredictStream(context.Background(), &pb.PredictOptions{}, func(reply *pb.Reply) {
+			replies = append(replies, string(reply.Message))
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(replies).To(Equal([]string{"b"}))
+	})
+})
@@ -251,6 +251,30 @@ func (s *server) StoresFind(ctx context.Context, in *pb.StoresFindOptions) (*pb.
 	return &res, nil
 }
 
+func (s *server) StoresSnapshot(ctx context.Context, in *pb.StoresSnapshotOptions) (*pb.StoresSnapshotResult, error) {
+	if s.llm.Locking() {
+		s.llm.Lock()
+		defer s.llm.Unlock()
+	}
+	res, err := s.llm.StoresSnapshot(in)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (s *server) StoresRestore(ctx context.Context, in *pb.StoresSnapshotOptions) (*pb.StoresSnapshotResult, error) {
+	if s.llm.Locking() {
+		s.llm.Lock()
+		defer s.llm.Unlock()
+	}
+	res, err := s.llm.StoresRestore(in)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
 func (s *server) VAD(ctx context.Context, in *pb.VADRequest) (*pb.VADResponse, error) {
 	if s.llm.Locking() {
 		s.llm.Lock()
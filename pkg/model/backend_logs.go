@@ -0,0 +1,107 @@
+package model
+
+import (
+	"time"
+)
+
+const (
+	// backendLogLines is how many of the last lines written by the backends of each model are kept
+	backendLogLines = 1000
+
+	// A follower missing more than backendLogFollowBuffer lines behind the backend loses the next ones
+	backendLogFollowBuffer = 256
+)
+
+// BackendLogLine is a line written by the process of a backend on its stdout or stderr
+type BackendLogLine struct {
+	Time   time.Time `json:"time" yaml:"time"`
+	Stream string    `json:"stream" yaml:"stream"`
+	Text   string    `json:"text" yaml:"text"`
+}
+
+// backendLog keeps the last lines written by the backends of a model, across their restarts
+type backendLog struct {
+	// lines is a ring buffer, next is where the next line goes
+	lines     []BackendLogLine
+	next      int
+	followers map[chan BackendLogLine]struct{}
+}
+
+func (l *backendLog) append(line BackendLogLine) {
+	if len(l.lines) < backendLogLines {
+		l.lines = append(l.lines, line)
+	} else {
+		l.lines[l.next] = line
+	}
+	l.next = (l.next + 1) % backendLogLines
+
+	for follower := range l.followers {
+		select {
+		case follower <- line:
+		default:
+			// The backend is never slowed down by a follower
+		}
+	}
+}
+
+// tail returns the last n lines, all of them if n <= 0
+func (l *backendLog) tail(n int) []BackendLogLine {
+	lines := make([]BackendLogLine, 0, len(l.lines))
+	if len(l.lines) < backendLogLines {
+		lines = append(lines, l.lines...)
+	} else {
+		lines = append(lines, l.lines[l.next:]...)
+		lines = append(lines, l.lines[:l.next]...)
+	}
+	if n > 0 && len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines
+}
+
+// appendBackendLog keeps a line written by the backend of the model
+func (ml *ModelLoader) appendBackendLog(modelID, stream, text string) {
+	ml.logsMu.Lock()
+	defer ml.logsMu.Unlock()
+
+	l, ok := ml.logs[modelID]
+	if !ok {
+		l = &backendLog{followers: make(map[chan BackendLogLine]struct{})}
+		ml.logs[modelID] = l
+	}
+	l.append(BackendLogLine{Time: time.Now(), Stream: stream, Text: text})
+}
+
+// BackendLogs returns the last n lines written by the backends of the model, all the kept ones if n <= 0
+func (ml *ModelLoader) BackendLogs(modelID string, n int) []BackendLogLine {
+	ml.logsMu.Lock()
+	defer ml.logsMu.Unlock()
+
+	l, ok := ml.logs[modelID]
+	if !ok {
+		return []BackendLogLine{}
+	}
+	return l.tail(n)
+}
+
+// FollowBackendLogs returns the last n lines written by the backends of the model like BackendLogs, and a channel
+// receiving the next ones until stop is called
+func (ml *ModelLoader) FollowBackendLogs(modelID string, n int) (lines []BackendLogLine, next <-chan BackendLogLine, stop func()) {
+	ml.logsMu.Lock()
+	defer ml.logsMu.Unlock()
+
+	l, ok := ml.logs[modelID]
+	if !ok {
+		// Follow the backend which is not started yet
+		l = &backendLog{followers: make(map[chan BackendLogLine]struct{})}
+		ml.logs[modelID] = l
+	}
+
+	follower := make(chan BackendLogLine, backendLogFollowBuffer)
+	l.followers[follower] = struct{}{}
+	return l.tail(n), follower, func() {
+		ml.logsMu.Lock()
+		defer ml.logsMu.Unlock()
+		delete(l.followers, follower)
+	}
+}
@@ -0,0 +1,53 @@
+package model
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Backend logs", func() {
+	var ml *ModelLoader
+
+	texts := func(lines []BackendLogLine) []string {
+		out := []string{}
+		for _, l := range lines {
+			out = append(out, l.Text)
+		}
+		return out
+	}
+
+	BeforeEach(func() {
+		ml = NewModelLoader("", false)
+	})
+
+	It("keeps the last lines of each model", func() {
+		for i := range backendLogLines + 5 {
+			ml.appendBackendLog("a", "stderr", fmt.Sprint(i))
+		}
+		ml.appendBackendLog("b", "stdout", "other model")
+
+		lines := ml.BackendLogs("a", 0)
+		Expect(lines).To(HaveLen(backendLogLines))
+		Expect(lines[0].Text).To(Equal("5"))
+		Expect(lines[0].Stream).To(Equal("stderr"))
+		Expect(texts(ml.BackendLogs("a", 2))).To(Equal([]string{fmt.Sprint(backendLogLines + 3), fmt.Sprint(backendLogLines + 4)}))
+		Expect(texts(ml.BackendLogs("b", 10))).To(Equal([]string{"other model"}))
+		Expect(ml.BackendLogs("c", 10)).To(BeEmpty())
+	})
+
+	It("sends the next lines to the followers", func() {
+		ml.appendBackendLog("a", "stdout", "loading")
+
+		lines, next, stop := ml.FollowBackendLogs("a", 10)
+		Expect(texts(lines)).To(Equal([]string{"loading"}))
+
+		ml.appendBackendLog("a", "stdout", "loaded")
+		Expect((<-next).Text).To(Equal("loaded"))
+
+		stop()
+		ml.appendBackendLog("a", "stdout", "unloaded")
+		Consistently(next).ShouldNot(Receive())
+	})
+})
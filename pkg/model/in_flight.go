@@ -0,0 +1,118 @@
+package model
+
+import (
+	"context"
+
+	grpc "github.com/mudler/LocalAI/pkg/grpc"
+	pb "github.com/mudler/LocalAI/pkg/grpc/proto"
+	ggrpc "google.golang.org/grpc"
+)
+
+// inFlightBackend is the client handed out for a model by Load and CheckIsLoaded. It counts the requests running on
+// the backend of the model, so that the backend is only stopped once they are all done, see stopModel.
+// Streams are counted until they end.
+type inFlightBackend struct {
+	grpc.Backend
+	model *Model
+}
+
+// track counts a request on the backend until the returned function is called
+func (b *inFlightBackend) track() func() {
+	b.model.inFlight.Add(1)
+	return func() { b.model.inFlight.Add(-1) }
+}
+
+func (b *inFlightBackend) Embeddings(ctx context.Context, in *pb.PredictOptions, opts ...ggrpc.CallOption) (*pb.EmbeddingResult, error) {
+	defer b.track()()
+	return b.Backend.Embeddings(ctx, in, opts...)
+}
+
+func (b *inFlightBackend) LoadModel(ctx context.Context, in *pb.ModelOptions, opts ...ggrpc.CallOption) (*pb.Result, error) {
+	defer b.track()()
+	return b.Backend.LoadModel(ctx, in, opts...)
+}
+
+func (b *inFlightBackend) PredictStream(ctx context.Context, in *pb.PredictOptions, f func(reply *pb.Reply), opts ...ggrpc.CallOption) error {
+	defer b.track()()
+	return b.Backend.PredictStream(ctx, in, f, opts...)
+}
+
+func (b *inFlightBackend) Predict(ctx context.Context, in *pb.PredictOptions, opts ...ggrpc.CallOption) (*pb.Reply, error) {
+	defer b.track()()
+	return b.Backend.Predict(ctx, in, opts...)
+}
+
+func (b *inFlightBackend) GenerateImage(ctx context.Context, in *pb.GenerateImageRequest, opts ...ggrpc.CallOption) (*pb.Result, error) {
+	defer b.track()()
+	return b.Backend.GenerateImage(ctx, in, opts...)
+}
+
+func (b *inFlightBackend) GenerateVideo(ctx context.Context, in *pb.GenerateVideoRequest, opts ...ggrpc.CallOption) (*pb.Result, error) {
+	defer b.track()()
+	return b.Backend.GenerateVideo(ctx, in, opts...)
+}
+
+func (b *inFlightBackend) TTS(ctx context.Context, in *pb.TTSRequest, opts ...ggrpc.CallOption) (*pb.Result, error) {
+	defer b.track()()
+	return b.Backend.TTS(ctx, in, opts...)
+}
+
+func (b *inFlightBackend) SoundGeneration(ctx context.Context, in *pb.SoundGenerationRequest, opts ...ggrpc.CallOption) (*pb.Result, error) {
+	defer b.track()()
+	return b.Backend.SoundGeneration(ctx, in, opts...)
+}
+
+func (b *inFlightBackend) Detect(ctx context.Context, in *pb.DetectOptions, opts ...ggrpc.CallOption) (*pb.DetectResponse, error) {
+	defer b.track()()
+	return b.Backend.Detect(ctx, in, opts...)
+}
+
+func (b *inFlightBackend) AudioTranscription(ctx context.Context, in *pb.TranscriptRequest, opts ...ggrpc.CallOption) (*pb.TranscriptResult, error) {
+	defer b.track()()
+	return b.Backend.AudioTranscription(ctx, in, opts...)
+}
+
+func (b *inFlightBackend) TokenizeString(ctx context.Context, in *pb.PredictOptions, opts ...ggrpc.CallOption) (*pb.TokenizationResponse, error) {
+	defer b.track()()
+	return b.Backend.TokenizeString(ctx, in, opts...)
+}
+
+func (b *inFlightBackend) StoresSet(ctx context.Context, in *pb.StoresSetOptions, opts ...ggrpc.CallOption) (*pb.Result, error) {
+	defer b.track()()
+	return b.Backend.StoresSet(ctx, in, opts...)
+}
+
+func (b *inFlightBackend) StoresDelete(ctx context.Context, in *pb.StoresDeleteOptions, opts ...ggrpc.CallOption) (*pb.Result, error) {
+	defer b.track()()
+	return b.Backend.StoresDelete(ctx, in, opts...)
+}
+
+func (b *inFlightBackend) StoresGet(ctx context.Context, in *pb.StoresGetOptions, opts ...ggrpc.CallOption) (*pb.StoresGetResult, error) {
+	defer b.track()()
+	return b.Backend.StoresGet(ctx, in, opts...)
+}
+
+func (b *inFlightBackend) StoresFind(ctx context.Context, in *pb.StoresFindOptions, opts ...ggrpc.CallOption) (*pb.StoresFindResult, error) {
+	defer b.track()()
+	return b.Backend.StoresFind(ctx, in, opts...)
+}
+
+func (b *inFlightBackend) StoresSnapshot(ctx context.Context, in *pb.StoresSnapshotOptions, opts ...ggrpc.CallOption) (*pb.StoresSnapshotResult, error) {
+	defer b.track()()
+	return b.Backend.StoresSnapshot(ctx, in, opts...)
+}
+
+func (b *inFlightBackend) StoresRestore(ctx context.Context, in *pb.StoresSnapshotOptions, opts ...ggrpc.CallOption) (*pb.StoresSnapshotResult, error) {
+	defer b.track()()
+	return b.Backend.StoresRestore(ctx, in, opts...)
+}
+
+func (b *inFlightBackend) Rerank(ctx context.Context, in *pb.RerankRequest, opts ...ggrpc.CallOption) (*pb.RerankResult, error) {
+	defer b.track()()
+	return b.Backend.Rerank(ctx, in, opts...)
+}
+
+func (b *inFlightBackend) VAD(ctx context.Context, in *pb.VADRequest, opts ...ggrpc.CallOption) (*pb.VADResponse, error) {
+	defer b.track()()
+	return b.Backend.VAD(ctx, in, opts...)
+}
@@ -9,10 +9,18 @@ import (
 	"time"
 
 	grpc "github.com/mudler/LocalAI/pkg/grpc"
+	pb "github.com/mudler/LocalAI/pkg/grpc/proto"
 	"github.com/phayes/freeport"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/protobuf/proto"
 )
 
+const tracerName = "github.com/mudler/LocalAI/pkg/model"
+
 const (
 	LLamaCPP = "llama-cpp"
 )
@@ -48,7 +56,7 @@ const (
 // starts the grpcModelProcess for the backend, and returns a grpc client
 // It also loads the model
 func (ml *ModelLoader) grpcModel(backend string, o *Options) func(string, string, string) (*Model, error) {
-	return func(modelID, modelName, modelFile string) (*Model, error) {
+	return func(modelID, modelName, modelFile string) (_ *Model, err error) {
 
 		log.Debug().Msgf("Loading Model %s with gRPC (file: %s) (backend: %s): %+v", modelID, modelFile, backend, *o)
 
@@ -83,7 +91,12 @@ func (ml *ModelLoader) grpcModel(backend string, o *Options) func(string, string
 					return nil, fmt.Errorf("failed allocating free ports: %s", err.Error())
 				}
 				// Make sure the process is executable
+				_, span := otel.Tracer(tracerName).Start(o.context, "ModelLoader.startProcess", trace.WithAttributes(
+					attribute.String("backend", backend),
+					attribute.String("address", serverAddress),
+				))
 				process, err := ml.startProcess(uri, modelID, serverAddress)
+				span.End()
 				if err != nil {
 					log.Error().Err(err).Str("path", uri).Msg("failed to launch ")
 					return nil, err
@@ -92,6 +105,14 @@ func (ml *ModelLoader) grpcModel(backend string, o *Options) func(string, string
 				log.Debug().Msgf("GRPC Service Started")
 
 				client = NewModel(modelID, serverAddress, process)
+				defer func() {
+					if err == nil {
+						go ml.supervise(o.context, client, func() error {
+							_, err := ml.loadModel(modelID, modelName, ml.memoryEstimator(backend, o), ml.observedLoader(backend, ml.grpcModel(backend, o)))
+							return err
+						})
+					}
+				}()
 			} else {
 				log.Debug().Msg("external backend is a uri")
 				// address
@@ -107,7 +128,7 @@ func (ml *ModelLoader) grpcModel(backend string, o *Options) func(string, string
 		// Wait for the service to start up
 		ready := false
 		for i := 0; i < o.grpcAttempts; i++ {
-			alive, err := client.GRPC(o.parallelRequests, ml.wd).HealthCheck(context.Background())
+			alive, err := client.GRPC(o.parallelRequests, ml.wd).HealthCheck(o.context)
 			if alive {
 				log.Debug().Msgf("GRPC Service Ready")
 				ready = true
@@ -148,6 +169,13 @@ func (ml *ModelLoader) grpcModel(backend string, o *Options) func(string, string
 			return nil, fmt.Errorf("could not load model (no success): %s", res.Message)
 		}
 
+		if o.warmUp != nil {
+			if err := o.warmUp(o.context, client.GRPC(o.parallelRequests, ml.wd)); err != nil {
+				log.Warn().Err(err).Str("model", modelID).Msg("failed to warm up the model")
+			}
+		}
+
+		client.keepAlive = o.keepAlive
 		return client, nil
 	}
 }
@@ -157,6 +185,64 @@ func (ml *ModelLoader) backendLoader(opts ...Option) (client grpc.Backend, err e
 
 	log.Info().Str("modelID", o.modelID).Str("backend", o.backendString).Str("o.model", o.model).Msg("BackendLoader starting")
 
+	backend := resolveBackend(o)
+	model, err := ml.loadModel(o.modelID, o.model, ml.memoryEstimator(backend, o), ml.observedLoader(backend, ml.grpcModel(backend, o)))
+	if err != nil {
+		return nil, err
+	}
+
+	return model.GRPC(o.parallelRequests, ml.wd), nil
+}
+
+// poolLoader loads the model on the remote backends of the options, which then share its requests
+func (ml *ModelLoader) poolLoader(opts ...Option) (grpc.Backend, error) {
+	o := NewOptions(opts...)
+
+	log.Info().Str("modelID", o.modelID).Strs("endpoints", o.grpcEndpoints).Msg("Loading the model on remote backends")
+
+	model, err := ml.loadModel(o.modelID, o.model, nil, ml.observedLoader(o.backendString, ml.poolModel(o)))
+	if err != nil {
+		return nil, err
+	}
+
+	return model.GRPC(o.parallelRequests, ml.wd), nil
+}
+
+// poolModel returns the loader of the model on the remote backends of the options
+func (ml *ModelLoader) poolModel(o *Options) func(string, string, string) (*Model, error) {
+	return func(modelID, modelName, modelFile string) (*Model, error) {
+		pool := grpc.NewPool(o.grpcEndpoints, o.parallelRequests)
+
+		options := proto.Clone(o.gRPCOptions).(*pb.ModelOptions)
+		options.Model = modelName
+		options.ModelFile = modelFile
+		options.ModelPath = ml.ModelPath
+
+		res, err := pool.LoadModel(o.context, options)
+		if err != nil {
+			pool.Close()
+			return nil, fmt.Errorf("could not load model: %w", err)
+		}
+		if !res.Success {
+			pool.Close()
+			return nil, fmt.Errorf("could not load model (no success): %s", res.Message)
+		}
+
+		if o.warmUp != nil {
+			if err := o.warmUp(o.context, pool); err != nil {
+				log.Warn().Err(err).Str("model", modelID).Msg("failed to warm up the model")
+			}
+		}
+
+		model := NewModel(modelID, strings.Join(o.grpcEndpoints, ","), nil)
+		model.client = pool
+		model.keepAlive = o.keepAlive
+		return model, nil
+	}
+}
+
+// resolveBackend returns the backend of the options, resolving its aliases
+func resolveBackend(o *Options) string {
 	backend := strings.ToLower(o.backendString)
 	if realBackend, exists := Aliases[backend]; exists {
 		typeAlias, exists := TypeAlias[backend]
@@ -169,13 +255,34 @@ func (ml *ModelLoader) backendLoader(opts ...Option) (client grpc.Backend, err e
 
 		backend = realBackend
 	}
+	return backend
+}
 
-	model, err := ml.LoadModel(o.modelID, o.model, ml.grpcModel(backend, o))
-	if err != nil {
-		return nil, err
+// memoryEstimator returns the estimator of the memory the model needs, nil for remote backends as they
+// do not use the memory of this host
+func (ml *ModelLoader) memoryEstimator(backend string, o *Options) func() uint64 {
+	if uri, ok := ml.GetAllExternalBackends(o)[backend]; ok {
+		if _, err := os.Stat(uri); err != nil {
+			return nil
+		}
 	}
+	return o.memoryEstimator
+}
 
-	return model.GRPC(o.parallelRequests, ml.wd), nil
+// observedLoader wraps the loader of the backend to notify the load observer of each attempt
+func (ml *ModelLoader) observedLoader(backend string, load func(string, string, string) (*Model, error)) func(string, string, string) (*Model, error) {
+	return func(modelID, modelName, modelFile string) (*Model, error) {
+		start := time.Now()
+		model, err := load(modelID, modelName, modelFile)
+		if model != nil {
+			model.backend = backend
+		}
+		// The observer is set at startup, before any load
+		if ml.loadObserver != nil {
+			ml.loadObserver(modelID, backend, time.Since(start), err)
+		}
+		return model, err
+	}
 }
 
 func (ml *ModelLoader) stopActiveBackends(modelID string, singleActiveBackend bool) {
@@ -208,6 +315,33 @@ func (ml *ModelLoader) lockBackend() {
 }
 
 func (ml *ModelLoader) Load(opts ...Option) (grpc.Backend, error) {
+	o := NewOptions(opts...)
+	ctx := o.context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "ModelLoader.Load", trace.WithAttributes(
+		attribute.String("model", o.modelID),
+		attribute.String("backend", o.backendString),
+	))
+	defer span.End()
+
+	if err := ml.crashLoop(o.modelID); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	// The context carries the span down to the gRPC calls of the loading
+	m, err := ml.load(append(opts, WithContext(ctx))...)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return m, err
+}
+
+func (ml *ModelLoader) load(opts ...Option) (grpc.Backend, error) {
 	ml.lockBackend() // grab the singleton lock if needed
 
 	o := NewOptions(opts...)
@@ -216,12 +350,17 @@ func (ml *ModelLoader) Load(opts ...Option) (grpc.Backend, error) {
 	// (avoid looping through all the backends)
 	if m := ml.CheckIsLoaded(o.modelID); m != nil {
 		log.Debug().Msgf("Model '%s' already loaded", o.modelID)
+		ml.setKeepAlive(m, o.keepAlive)
 
 		return m.GRPC(o.parallelRequests, ml.wd), nil
 	}
 
 	ml.stopActiveBackends(o.modelID, ml.singletonMode)
 
+	if len(o.grpcEndpoints) > 0 {
+		return ml.poolLoader(opts...)
+	}
+
 	// if a backend is defined, return the loader directly
 	if o.backendString != "" {
 		return ml.backendLoader(opts...)
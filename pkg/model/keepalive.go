@@ -0,0 +1,66 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// KeepAliveForever keeps a backend loaded until it is unloaded explicitly: it is not stopped by the watchdog idle
+// check nor to make room within the memory budget
+const KeepAliveForever time.Duration = -1
+
+// keepAliveInterval is how often the backends are checked for their keep alive
+const keepAliveInterval = 10 * time.Second
+
+// KeepAlive returns the keep alive of the loaded model, 0 if it has none or is not loaded
+func (ml *ModelLoader) KeepAlive(modelID string) time.Duration {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	if m, ok := ml.models[modelID]; ok {
+		return m.keepAlive
+	}
+	return 0
+}
+
+func (ml *ModelLoader) setKeepAlive(m *Model, keepAlive time.Duration) {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	m.keepAlive = keepAlive
+}
+
+// RunKeepAlive stops the backends idle for longer than their keep alive, until the context is canceled
+func (ml *ModelLoader) RunKeepAlive(ctx context.Context) {
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			ml.checkKeepAlive()
+		}
+	}
+}
+
+func (ml *ModelLoader) checkKeepAlive() {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	for id, m := range ml.models {
+		if m.keepAlive <= 0 {
+			continue
+		}
+		// A backend is idle from the end of its last request
+		if m.busy() {
+			m.lastUsed = time.Now()
+			continue
+		}
+		if time.Since(m.lastUsed) > m.keepAlive {
+			log.Info().Str("model", id).Dur("keep_alive", m.keepAlive).Msg("Keep alive expired, stopping the backend")
+			if err := ml.deleteProcess(id); err != nil {
+				log.Error().Err(err).Str("model", id).Msg("error while stopping the backend")
+			}
+		}
+	}
+}
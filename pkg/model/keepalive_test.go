@@ -0,0 +1,63 @@
+package model
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Keep alive", func() {
+	var ml *ModelLoader
+
+	load := func(id string, keepAlive time.Duration, estimate uint64) {
+		_, err := ml.loadModel(id, id, func() uint64 { return estimate }, func(modelID, _, _ string) (*Model, error) {
+			m := NewModel(modelID, id, nil)
+			m.keepAlive = keepAlive
+			return m, nil
+		})
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	idleSince := func(id string, d time.Duration) {
+		ml.mu.Lock()
+		defer ml.mu.Unlock()
+		ml.models[id].lastUsed = time.Now().Add(-d)
+	}
+
+	loaded := func() []string {
+		ids := []string{}
+		for _, m := range ml.ListModels() {
+			ids = append(ids, m.ID)
+		}
+		return ids
+	}
+
+	BeforeEach(func() {
+		ml = NewModelLoader("", false)
+	})
+
+	It("stops the models idle for longer than their keep alive", func() {
+		load("short", time.Minute, 0)
+		load("long", time.Hour, 0)
+		load("default", 0, 0)
+		load("forever", KeepAliveForever, 0)
+		for _, id := range []string{"short", "long", "default", "forever"} {
+			idleSince(id, 10*time.Minute)
+		}
+
+		ml.checkKeepAlive()
+		Expect(loaded()).To(ConsistOf("long", "default", "forever"))
+		Expect(ml.KeepAlive("long")).To(Equal(time.Hour))
+		Expect(ml.KeepAlive("short")).To(BeZero())
+	})
+
+	It("does not stop the models kept alive forever to make room", func() {
+		ml.SetMemoryBudget(10)
+		load("pinned", KeepAliveForever, 6)
+		load("a", 0, 4)
+		idleSince("pinned", time.Hour)
+		load("b", 0, 4)
+		Expect(loaded()).To(ConsistOf("pinned", "b"))
+	})
+})
@@ -0,0 +1,114 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// LoadStatus is where a model is in its loading
+type LoadStatus string
+
+const (
+	LoadStatusNotLoaded LoadStatus = "not_loaded"
+	LoadStatusLoading   LoadStatus = "loading"
+	LoadStatusReady     LoadStatus = "ready"
+	LoadStatusFailed    LoadStatus = "failed"
+)
+
+// defaultLoadingRetryAfter is when the clients are told to retry while a model loads for the first time, and its
+// load time is not known yet
+const defaultLoadingRetryAfter = 5 * time.Second
+
+// LoadState is the load status of a model, since when it is in it, and the error of the load if it failed
+type LoadState struct {
+	Status LoadStatus
+	Since  time.Time
+	Error  string
+
+	// loadDuration is how long the last successful load of the model took
+	loadDuration time.Duration
+}
+
+// ErrModelLoading is wrapped by the errors of the requests refused while their model loads
+var ErrModelLoading = errors.New("the model is loading")
+
+// ModelLoadingError is returned for the requests refused while their model loads, see LoadingError
+type ModelLoadingError struct {
+	Model string
+	// RetryAfter is how long the model is expected to still take to load
+	RetryAfter time.Duration
+}
+
+func (e *ModelLoadingError) Error() string {
+	return fmt.Sprintf("model %s is loading, retry in %s", e.Model, e.RetryAfter.Round(time.Second))
+}
+
+func (e *ModelLoadingError) Unwrap() error {
+	return ErrModelLoading
+}
+
+// LoadState returns the load state of the model
+func (ml *ModelLoader) LoadState(modelID string) LoadState {
+	ml.statesMu.Lock()
+	defer ml.statesMu.Unlock()
+	if state, ok := ml.states[modelID]; ok {
+		return state
+	}
+	return LoadState{Status: LoadStatusNotLoaded}
+}
+
+// LoadingError returns a *ModelLoadingError if the model is loading, nil otherwise
+func (ml *ModelLoader) LoadingError(modelID string) error {
+	state := ml.LoadState(modelID)
+	if state.Status != LoadStatusLoading {
+		return nil
+	}
+
+	retryAfter := defaultLoadingRetryAfter
+	if state.loadDuration > 0 {
+		// The model is expected to take as long as its last load
+		retryAfter = max(state.loadDuration-time.Since(state.Since), time.Second)
+	}
+	return &ModelLoadingError{Model: modelID, RetryAfter: retryAfter}
+}
+
+func (ml *ModelLoader) setLoading(modelID string) {
+	ml.statesMu.Lock()
+	defer ml.statesMu.Unlock()
+	state := ml.states[modelID]
+	if state.Status == LoadStatusLoading {
+		return
+	}
+	ml.states[modelID] = LoadState{Status: LoadStatusLoading, Since: time.Now(), loadDuration: state.loadDuration}
+}
+
+// setLoaded records the end of the loading of the model, with its error if it failed
+func (ml *ModelLoader) setLoaded(modelID string, err error) {
+	ml.statesMu.Lock()
+	defer ml.statesMu.Unlock()
+	state := ml.states[modelID]
+	now := time.Now()
+	if err != nil {
+		ml.states[modelID] = LoadState{Status: LoadStatusFailed, Since: now, Error: err.Error(), loadDuration: state.loadDuration}
+		return
+	}
+	loadDuration := state.loadDuration
+	if state.Status == LoadStatusLoading {
+		loadDuration = now.Sub(state.Since)
+	}
+	ml.states[modelID] = LoadState{Status: LoadStatusReady, Since: now, loadDuration: loadDuration}
+}
+
+// setUnloaded records that the backend of the model stopped, with the error if it crashed
+func (ml *ModelLoader) setUnloaded(modelID string, err error) {
+	ml.statesMu.Lock()
+	defer ml.statesMu.Unlock()
+	state := ml.states[modelID]
+	if err != nil {
+		ml.states[modelID] = LoadState{Status: LoadStatusFailed, Since: time.Now(), Error: err.Error(), loadDuration: state.loadDuration}
+		return
+	}
+	// The load time is kept for the next load
+	ml.states[modelID] = LoadState{Status: LoadStatusNotLoaded, loadDuration: state.loadDuration}
+}
@@ -0,0 +1,54 @@
+package model
+
+import (
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Load state", func() {
+	var ml *ModelLoader
+
+	BeforeEach(func() {
+		ml = NewModelLoader("", false)
+	})
+
+	It("follows the model from its load to its unload", func() {
+		Expect(ml.LoadState("a").Status).To(Equal(LoadStatusNotLoaded))
+		Expect(ml.LoadingError("a")).To(Succeed())
+
+		_, err := ml.loadModel("a", "a", nil, func(modelID, _, _ string) (*Model, error) {
+			Expect(ml.LoadState("a").Status).To(Equal(LoadStatusLoading))
+			var loading *ModelLoadingError
+			Expect(errors.As(ml.LoadingError("a"), &loading)).To(BeTrue())
+			Expect(loading.RetryAfter).To(Equal(defaultLoadingRetryAfter))
+			time.Sleep(10 * time.Millisecond)
+			return NewModel(modelID, "127.0.0.1:0", nil), nil
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ml.LoadState("a").Status).To(Equal(LoadStatusReady))
+
+		Expect(ml.ShutdownModel("a")).To(Succeed())
+		Expect(ml.LoadState("a").Status).To(Equal(LoadStatusNotLoaded))
+
+		// The next load is expected to take as long as the previous one
+		ml.setLoading("a")
+		var loading *ModelLoadingError
+		Expect(errors.As(ml.LoadingError("a"), &loading)).To(BeTrue())
+		Expect(loading.RetryAfter).To(Equal(time.Second))
+	})
+
+	It("records the error of a failed load", func() {
+		_, err := ml.loadModel("a", "a", nil, func(string, string, string) (*Model, error) {
+			return nil, errors.New("out of memory")
+		})
+		Expect(err).To(HaveOccurred())
+
+		state := ml.LoadState("a")
+		Expect(state.Status).To(Equal(LoadStatusFailed))
+		Expect(state.Error).To(Equal("out of memory"))
+		Expect(ml.LoadingError("a")).To(Succeed())
+	})
+})
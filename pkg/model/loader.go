@@ -26,14 +26,43 @@ type ModelLoader struct {
 	models           map[string]*Model
 	wd               *WatchDog
 	externalBackends map[string]string
+
+	// Loads are done one at a time, so that the ones evicting backends to fit in memoryBudget queue
+	loadMu         sync.Mutex
+	memoryBudget   uint64
+	memoryObserver MemoryObserver
+
+	loadObserver    LoadObserver
+	backendObserver BackendObserver
+
+	// The recent crashes of the backends of the models, see supervisor.go
+	crashes map[string]*crashHistory
+
+	// The last lines written by the backends of the models, see backend_logs.go
+	logsMu sync.Mutex
+	logs   map[string]*backendLog
+
+	// The load states of the models, see load_state.go. They are read while models load, under mu.
+	statesMu sync.Mutex
+	states   map[string]LoadState
 }
 
+// LoadObserver is notified of each attempt to start a backend: how long it took, and its error if it failed
+type LoadObserver func(modelID, backend string, duration time.Duration, err error)
+
+// BackendObserver is notified when the backend of a model changes: it is loaded, replaced by a reload, stopped or
+// crashed. The state held by the backend (e.g. its KV cache) is lost. It is called with the lock of the loader held.
+type BackendObserver func(modelID string)
+
 func NewModelLoader(modelPath string, singleActiveBackend bool) *ModelLoader {
 	nml := &ModelLoader{
 		ModelPath:        modelPath,
 		models:           make(map[string]*Model),
 		singletonMode:    singleActiveBackend,
 		externalBackends: make(map[string]string),
+		crashes:          make(map[string]*crashHistory),
+		logs:             make(map[string]*backendLog),
+		states:           make(map[string]LoadState),
 	}
 
 	return nml
@@ -43,6 +72,25 @@ func (ml *ModelLoader) SetWatchDog(wd *WatchDog) {
 	ml.wd = wd
 }
 
+func (ml *ModelLoader) SetLoadObserver(observer LoadObserver) {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	ml.loadObserver = observer
+}
+
+func (ml *ModelLoader) SetBackendObserver(observer BackendObserver) {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	ml.backendObserver = observer
+}
+
+// backendChanged notifies the backend observer. It must be called with the lock held.
+func (ml *ModelLoader) backendChanged(modelID string) {
+	if ml.backendObserver != nil {
+		ml.backendObserver(modelID)
+	}
+}
+
 func (ml *ModelLoader) ExistsInModelPath(s string) bool {
 	return utils.ExistsInPath(ml.ModelPath, s)
 }
@@ -146,28 +194,67 @@ func (ml *ModelLoader) ListModels() []*Model {
 	return models
 }
 
+// CountModels returns the number of loaded models, and how many of them are busy with a request
+func (ml *ModelLoader) CountModels() (loaded int, busy int) {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	for _, m := range ml.models {
+		loaded++
+		if m.busy() {
+			busy++
+		}
+	}
+	return loaded, busy
+}
+
 func (ml *ModelLoader) LoadModel(modelID, modelName string, loader func(string, string, string) (*Model, error)) (*Model, error) {
+	return ml.loadModel(modelID, modelName, nil, loader)
+}
+
+// loadModel loads the model, making room for the memory it is estimated to need first if there is a memory budget
+func (ml *ModelLoader) loadModel(modelID, modelName string, estimator func() uint64, loader func(string, string, string) (*Model, error)) (*Model, error) {
 	// Check if we already have a loaded model
 	if model := ml.CheckIsLoaded(modelID); model != nil {
 		return model, nil
 	}
 
+	ml.setLoading(modelID)
+
+	ml.loadMu.Lock()
+	defer ml.loadMu.Unlock()
+
+	// The model could have been loaded while waiting
+	if model := ml.CheckIsLoaded(modelID); model != nil {
+		ml.setLoaded(modelID, nil)
+		return model, nil
+	}
+
 	// Load the model and keep it in memory for later use
 	modelFile := filepath.Join(ml.ModelPath, modelName)
 	log.Debug().Msgf("Loading model in memory from file: %s", modelFile)
 
+	var estimate uint64
+	if estimator != nil && ml.memoryBudget > 0 {
+		estimate = estimator()
+	}
+
 	ml.mu.Lock()
 	defer ml.mu.Unlock()
+	ml.makeRoom(modelID, estimate)
+
 	model, err := loader(modelID, modelName, modelFile)
+	if err == nil && model == nil {
+		err = fmt.Errorf("loader didn't return a model")
+	}
+	ml.setLoaded(modelID, err)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load model with internal loader: %s", err)
 	}
 
-	if model == nil {
-		return nil, fmt.Errorf("loader didn't return a model")
-	}
-
+	model.memoryEstimate = estimate
+	model.lastUsed = time.Now()
 	ml.models[modelID] = model
+	ml.backendChanged(modelID)
 
 	return model, nil
 }
@@ -188,6 +275,7 @@ func (ml *ModelLoader) CheckIsLoaded(s string) *Model {
 	}
 
 	log.Debug().Msgf("Model already loaded in memory: %s", s)
+	m.lastUsed = time.Now()
 	client := m.GRPC(false, ml.wd)
 
 	log.Debug().Msgf("Checking model availability (%s)", s)
@@ -205,11 +293,8 @@ func (ml *ModelLoader) CheckIsLoaded(s string) *Model {
 		}
 		if !process.IsAlive() {
 			log.Debug().Msgf("GRPC Process is not responding: %s", s)
-			// stop and delete the process, this forces to re-load the model and re-create again the service
-			err := ml.deleteProcess(s)
-			if err != nil {
-				log.Error().Err(err).Str("process", s).Msg("error stopping process")
-			}
+			// the backend crashed: forget it, this forces to re-load the model and re-create again the service
+			ml.backendExited(m)
 			return nil
 		}
 	}
@@ -2,7 +2,9 @@ package model
 
 import (
 	"context"
+	"time"
 
+	"github.com/mudler/LocalAI/pkg/grpc"
 	pb "github.com/mudler/LocalAI/pkg/grpc/proto"
 )
 
@@ -19,6 +21,13 @@ type Options struct {
 	grpcAttempts      int
 	grpcAttemptsDelay int
 	parallelRequests  bool
+
+	memoryEstimator func() uint64
+
+	keepAlive time.Duration
+	warmUp    func(context.Context, grpc.Backend) error
+
+	grpcEndpoints []string
 }
 
 type Option func(*Options)
@@ -80,6 +89,37 @@ func WithContext(ctx context.Context) Option {
 	}
 }
 
+// WithMemoryEstimator sets how to estimate the memory needed by the model, in bytes, to schedule its load
+// within the memory budget of the loader. It is only called if the model is not loaded yet.
+func WithMemoryEstimator(estimator func() uint64) Option {
+	return func(o *Options) {
+		o.memoryEstimator = estimator
+	}
+}
+
+// WithKeepAlive sets how long the backend stays loaded once idle, see KeepAliveForever. The default, 0, leaves
+// it to the watchdog and to the memory budget.
+func WithKeepAlive(keepAlive time.Duration) Option {
+	return func(o *Options) {
+		o.keepAlive = keepAlive
+	}
+}
+
+// WithWarmUp sets a function run on the backend once it loaded the model, before it serves requests.
+// Its failure does not fail the load.
+func WithWarmUp(warmUp func(context.Context, grpc.Backend) error) Option {
+	return func(o *Options) {
+		o.warmUp = warmUp
+	}
+}
+
+// WithGRPCEndpoints serves the model with the remote backends at the addresses, see grpc.Pool
+func WithGRPCEndpoints(addresses ...string) Option {
+	return func(o *Options) {
+		o.grpcEndpoints = addresses
+	}
+}
+
 func WithModelID(id string) Option {
 	return func(o *Options) {
 		o.modelID = id
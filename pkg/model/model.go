@@ -1,7 +1,10 @@
 package model
 
 import (
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	grpc "github.com/mudler/LocalAI/pkg/grpc"
 	process "github.com/mudler/go-processmanager"
@@ -12,7 +15,22 @@ type Model struct {
 	address string
 	client  grpc.Backend
 	process *process.Process
+	// backend is the name of the backend running the model, set once it is loaded
+	backend string
 	sync.Mutex
+
+	// Set and read by the ModelLoader under its lock, see scheduler.go
+	memoryEstimate uint64
+	lastUsed       time.Time
+	keepAlive      time.Duration
+
+	// stopped is set before stopping the process on purpose, exited once the process exited by itself,
+	// see supervisor.go
+	stopped atomic.Bool
+	exited  atomic.Bool
+
+	// inFlight is the number of requests running on the backend, see inFlightBackend
+	inFlight atomic.Int64
 }
 
 func NewModel(ID, address string, process *process.Process) *Model {
@@ -27,7 +45,21 @@ func (m *Model) Process() *process.Process {
 	return m.process
 }
 
+func (m *Model) pid() (int, error) {
+	return strconv.Atoi(m.process.PID)
+}
+
+// GRPC returns the client of the backend of the model, which counts the requests running on it
 func (m *Model) GRPC(parallel bool, wd *WatchDog) grpc.Backend {
+	return &inFlightBackend{Backend: m.grpc(parallel, wd), model: m}
+}
+
+// busy returns whether requests are running on the backend of the model
+func (m *Model) busy() bool {
+	return m.inFlight.Load() > 0
+}
+
+func (m *Model) grpc(parallel bool, wd *WatchDog) grpc.Backend {
 	if m.client != nil {
 		return m.client
 	}
@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/hpcloud/tail"
+	"github.com/mudler/LocalAI/pkg/grpc"
 	process "github.com/mudler/go-processmanager"
 	"github.com/rs/zerolog/log"
 )
@@ -25,11 +26,19 @@ func (ml *ModelLoader) deleteProcess(s string) error {
 		return fmt.Errorf("model %s not found", s)
 	}
 
+	defer ml.backendChanged(s)
 	defer delete(ml.models, s)
+	defer ml.setUnloaded(s, nil)
 
+	return ml.stopModel(model)
+}
+
+// stopModel stops the backend of the model once the requests running on it are done, streams included
+func (ml *ModelLoader) stopModel(model *Model) error {
+	s := model.ID
 	retries := 1
-	for model.GRPC(false, ml.wd).IsBusy() {
-		log.Debug().Msgf("%s busy. Waiting.", s)
+	for model.busy() {
+		log.Debug().Int64("requests", model.inFlight.Load()).Msgf("%s busy. Waiting.", s)
 		dur := time.Duration(retries*2) * time.Second
 		if dur > retryTimeout {
 			dur = retryTimeout
@@ -45,6 +54,12 @@ func (ml *ModelLoader) deleteProcess(s string) error {
 
 	log.Debug().Msgf("Deleting process %s", s)
 
+	if pool, ok := model.client.(*grpc.Pool); ok {
+		// The remote backends keep running, only their checks are stopped
+		pool.Close()
+		return nil
+	}
+
 	process := model.Process()
 	if process == nil {
 		log.Error().Msgf("No process for %s", s)
@@ -52,6 +67,7 @@ func (ml *ModelLoader) deleteProcess(s string) error {
 		return nil
 	}
 
+	model.stopped.Store(true)
 	err := process.Stop()
 	if err != nil {
 		log.Error().Err(err).Msgf("(deleteProcess) error while deleting process %s", s)
@@ -141,7 +157,8 @@ func (ml *ModelLoader) startProcess(grpcProcess, id string, serverAddress string
 			log.Debug().Msgf("Could not tail stderr")
 		}
 		for line := range t.Lines {
-			log.Debug().Msgf("GRPC(%s): stderr %s", strings.Join([]string{id, serverAddress}, "-"), line.Text)
+			ml.appendBackendLog(id, "stderr", line.Text)
+			log.Debug().Str("model", id).Msgf("GRPC(%s): stderr %s", strings.Join([]string{id, serverAddress}, "-"), line.Text)
 		}
 	}()
 	go func() {
@@ -150,7 +167,8 @@ func (ml *ModelLoader) startProcess(grpcProcess, id string, serverAddress string
 			log.Debug().Msgf("Could not tail stdout")
 		}
 		for line := range t.Lines {
-			log.Debug().Msgf("GRPC(%s): stdout %s", strings.Join([]string{id, serverAddress}, "-"), line.Text)
+			ml.appendBackendLog(id, "stdout", line.Text)
+			log.Debug().Str("model", id).Msgf("GRPC(%s): stdout %s", strings.Join([]string{id, serverAddress}, "-"), line.Text)
 		}
 	}()
 
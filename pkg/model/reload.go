@@ -0,0 +1,114 @@
+package model
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Reload applies new options to a loaded model without downtime: a new backend is started with them next to the
+// running one, and once it is ready the requests go to it, while the ones already running on the old backend finish
+// before it is stopped. It does nothing if the model is not loaded, the next request loading it with the new options.
+func (ml *ModelLoader) Reload(opts ...Option) error {
+	o := NewOptions(opts...)
+
+	// The new options could fix the crashes of the backend
+	ml.resetCrashes(o.modelID)
+
+	ml.mu.Lock()
+	old, ok := ml.models[o.modelID]
+	ml.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	if ml.singletonMode {
+		// Only one backend can run at a time: the next request loads the new one
+		log.Info().Str("model", o.modelID).Msg("Stopping the backend to reload the model")
+		return ml.ShutdownModel(o.modelID)
+	}
+
+	backend := resolveBackend(o)
+	if backend == "" {
+		// The backend was detected when the model was loaded
+		backend = old.backend
+	}
+
+	load := ml.grpcModel(backend, o)
+	if len(o.grpcEndpoints) > 0 {
+		load = ml.poolModel(o)
+	}
+	return ml.replaceModel(o.modelID, o.model, ml.memoryEstimator(backend, o), ml.observedLoader(backend, func(modelID, modelName, modelFile string) (*Model, error) {
+		model, err := load(modelID, modelName, modelFile)
+		if err != nil {
+			return nil, err
+		}
+		if alive, err := model.GRPC(o.parallelRequests, ml.wd).HealthCheck(o.context); !alive {
+			if process := model.Process(); process != nil {
+				process.Stop()
+			}
+			return nil, fmt.Errorf("the new backend is not healthy: %v", err)
+		}
+		return model, nil
+	}))
+}
+
+// replaceModel loads the model again with the loader, next to its running backend, and switches to the new
+// backend once it is loaded. The old one is stopped in the background once its requests are done.
+func (ml *ModelLoader) replaceModel(modelID, modelName string, estimator func() uint64, loader func(string, string, string) (*Model, error)) error {
+	ml.loadMu.Lock()
+	defer ml.loadMu.Unlock()
+
+	// The backend running now, after the loads and reloads queued before this one
+	ml.mu.Lock()
+	old, ok := ml.models[modelID]
+	ml.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	var estimate uint64
+	if estimator != nil && ml.memoryBudget > 0 {
+		estimate = estimator()
+	}
+
+	// Both backends run until the switch, so the new one needs room next to the old one
+	ml.mu.Lock()
+	ml.makeRoom(old.ID, estimate)
+	ml.mu.Unlock()
+
+	log.Info().Str("model", old.ID).Msg("Starting a new backend to reload the model")
+	model, err := loader(old.ID, modelName, filepath.Join(ml.ModelPath, modelName))
+	if err != nil {
+		return fmt.Errorf("failed to reload model %s, keeping the running backend: %w", old.ID, err)
+	}
+	if model == nil {
+		return fmt.Errorf("failed to reload model %s, keeping the running backend: loader didn't return a model", old.ID)
+	}
+
+	ml.mu.Lock()
+	if ml.models[old.ID] != old {
+		// The backend was stopped or replaced while loading the new one
+		ml.mu.Unlock()
+		log.Info().Str("model", old.ID).Msg("The backend changed while reloading the model, stopping the new one")
+		return ml.stopModel(model)
+	}
+	model.memoryEstimate = estimate
+	model.lastUsed = old.lastUsed
+	ml.models[old.ID] = model
+	ml.backendChanged(old.ID)
+	ml.mu.Unlock()
+
+	log.Info().Str("model", old.ID).Msg("Switched to the new backend, stopping the old one once its requests are done")
+	go func() {
+		if err := ml.stopModel(old); err != nil {
+			log.Error().Err(err).Str("model", old.ID).Msg("error while stopping the old backend")
+		}
+		// The watchdog would stop the new backend of the model once the old one is idle for too long
+		if ml.wd != nil {
+			ml.wd.RemoveAddress(old.address)
+		}
+	}()
+	return nil
+}
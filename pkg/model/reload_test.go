@@ -0,0 +1,117 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mudler/LocalAI/pkg/grpc"
+	pb "github.com/mudler/LocalAI/pkg/grpc/proto"
+	process "github.com/mudler/go-processmanager"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	ggrpc "google.golang.org/grpc"
+)
+
+// streamingBackend is a backend whose streams run until done is closed
+type streamingBackend struct {
+	grpc.Backend
+	done chan struct{}
+}
+
+func (b *streamingBackend) PredictStream(ctx context.Context, in *pb.PredictOptions, f func(reply *pb.Reply), opts ...ggrpc.CallOption) error {
+	<-b.done
+	return nil
+}
+
+var _ = Describe("Reload", func() {
+	var ml *ModelLoader
+
+	// backend returns a loader of the model running at address, as a backend without process
+	backend := func(address string) func(string, string, string) (*Model, error) {
+		return func(modelID, _, _ string) (*Model, error) {
+			return NewModel(modelID, address, nil), nil
+		}
+	}
+
+	loaded := func(id string) *Model {
+		ml.mu.Lock()
+		defer ml.mu.Unlock()
+		return ml.models[id]
+	}
+
+	BeforeEach(func() {
+		ml = NewModelLoader("", false)
+		_, err := ml.loadModel("a", "a", nil, backend("old"))
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("switches to the new backend once it is loaded", func() {
+		Expect(ml.replaceModel("a", "a", nil, backend("new"))).To(Succeed())
+		Expect(loaded("a").address).To(Equal("new"))
+		Expect(ml.ListModels()).To(HaveLen(1))
+	})
+
+	It("keeps the running backend if the new one fails to load", func() {
+		old := loaded("a")
+		err := ml.replaceModel("a", "a", nil, func(string, string, string) (*Model, error) {
+			return nil, errors.New("out of memory")
+		})
+		Expect(err).To(MatchError(ContainSubstring("out of memory")))
+		Expect(loaded("a")).To(BeIdenticalTo(old))
+	})
+
+	It("drops the new backend if the model was stopped meanwhile", func() {
+		err := ml.replaceModel("a", "a", nil, func(modelID, modelName, modelFile string) (*Model, error) {
+			Expect(ml.ShutdownModel("a")).To(Succeed())
+			return backend("new")(modelID, modelName, modelFile)
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(loaded("a")).To(BeNil())
+	})
+
+	It("notifies the backend observer of the changes of backend", func() {
+		changes := []string{}
+		ml.SetBackendObserver(func(modelID string) { changes = append(changes, modelID) })
+
+		Expect(ml.replaceModel("a", "a", nil, backend("new"))).To(Succeed())
+		Expect(changes).To(Equal([]string{"a"}))
+		Expect(ml.ShutdownModel("a")).To(Succeed())
+		Expect(changes).To(Equal([]string{"a", "a"}))
+		_, err := ml.loadModel("b", "b", nil, backend("other"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(changes).To(Equal([]string{"a", "a", "b"}))
+	})
+
+	It("stops the old backend once the streams running on it are done", func() {
+		p := process.New(
+			process.WithTemporaryStateDir(),
+			process.WithName("/bin/sh"),
+			process.WithArgs("-c", "sleep 30"),
+		)
+		Expect(p.Run()).To(Succeed())
+		defer p.Stop()
+
+		old := NewModel("b", "old", p)
+		stream := &streamingBackend{done: make(chan struct{})}
+		old.client = stream
+		ml.mu.Lock()
+		ml.models["b"] = old
+		ml.mu.Unlock()
+
+		go old.GRPC(false, nil).PredictStream(context.Background(), &pb.PredictOptions{}, func(*pb.Reply) {})
+		Eventually(old.busy).Should(BeTrue())
+
+		Expect(ml.replaceModel("b", "b", nil, backend("new"))).To(Succeed())
+		Expect(loaded("b").address).To(Equal("new"))
+		Consistently(p.IsAlive, 500*time.Millisecond).Should(BeTrue())
+
+		close(stream.done)
+		Eventually(p.IsAlive, 10*time.Second).Should(BeFalse())
+	})
+
+	It("does nothing for a model which is not loaded", func() {
+		Expect(ml.Reload(WithModelID("b"), WithModel("b"))).To(Succeed())
+		Expect(loaded("b")).To(BeNil())
+	})
+})
@@ -0,0 +1,107 @@
+package model
+
+import (
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// The scheduler keeps as many backends loaded as fit in a memory budget. Before a model is loaded, the least recently
+// used backends are stopped until the memory it is estimated to need is available. Backends busy with a request are
+// not stopped: the load waits for them to finish, and the loads queued behind it wait their turn. The backends kept
+// alive forever are not stopped either.
+
+// MemoryObserver returns the memory used by the backend process with the given PID
+type MemoryObserver func(pid int) (uint64, error)
+
+// SetMemoryBudget sets the memory, in bytes, the loaded backends can use together. 0 disables the budget.
+func (ml *ModelLoader) SetMemoryBudget(budget uint64) {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	ml.memoryBudget = budget
+}
+
+// SetMemoryObserver sets how the memory used by the backends is measured, it is only estimated otherwise
+func (ml *ModelLoader) SetMemoryObserver(observer MemoryObserver) {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	ml.memoryObserver = observer
+}
+
+// MemoryUsage returns the memory used by the loaded backends and the memory budget, 0 if there is none
+func (ml *ModelLoader) MemoryUsage() (used uint64, budget uint64) {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	for _, m := range ml.models {
+		used += ml.modelMemory(m)
+	}
+	return used, ml.memoryBudget
+}
+
+// modelMemory returns the memory used by the backend of the model: the largest of its estimate and of
+// the memory observed for its process. ml.mu must be held.
+func (ml *ModelLoader) modelMemory(m *Model) uint64 {
+	used := m.memoryEstimate
+	if ml.memoryObserver == nil || m.Process() == nil {
+		return used
+	}
+	pid, err := m.pid()
+	if err != nil {
+		return used
+	}
+	observed, err := ml.memoryObserver(pid)
+	if err != nil {
+		log.Debug().Err(err).Str("model", m.ID).Msg("unable to measure the memory of the backend")
+		return used
+	}
+	return max(used, observed)
+}
+
+// makeRoom stops the least recently used backends until needed bytes are available in the budget, waiting for
+// the busy ones to finish if needed. The model is loaded over budget if it does not fit even with no other
+// backend loaded, or if the busy backends do not finish in time. ml.mu must be held, it is released while waiting.
+func (ml *ModelLoader) makeRoom(modelID string, needed uint64) {
+	if ml.memoryBudget == 0 || ml.singletonMode {
+		return
+	}
+
+	deadline := time.Now().Add(retryTimeout)
+	for {
+		var used uint64
+		var idle []*Model
+		for id, m := range ml.models {
+			memory := ml.modelMemory(m)
+			used += memory
+			if id != modelID && memory > 0 && m.keepAlive != KeepAliveForever && !m.busy() {
+				idle = append(idle, m)
+			}
+		}
+		if used+needed <= ml.memoryBudget {
+			return
+		}
+
+		if len(idle) > 0 {
+			sort.Slice(idle, func(i, j int) bool { return idle[i].lastUsed.Before(idle[j].lastUsed) })
+			victim := idle[0]
+			log.Info().Str("model", victim.ID).Str("loading", modelID).
+				Uint64("used", used).Uint64("needed", needed).Uint64("budget", ml.memoryBudget).
+				Msg("Memory budget exceeded, stopping the least recently used backend")
+			if err := ml.deleteProcess(victim.ID); err != nil {
+				log.Error().Err(err).Str("model", victim.ID).Msg("error while stopping the backend")
+			}
+			continue
+		}
+
+		if used == 0 || time.Now().After(deadline) {
+			log.Warn().Str("model", modelID).Uint64("used", used).Uint64("needed", needed).Uint64("budget", ml.memoryBudget).
+				Msg("Loading the model over the memory budget")
+			return
+		}
+
+		log.Debug().Str("model", modelID).Msg("Waiting for busy backends to finish to free memory")
+		ml.mu.Unlock()
+		time.Sleep(time.Second)
+		ml.mu.Lock()
+	}
+}
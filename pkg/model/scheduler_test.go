@@ -0,0 +1,90 @@
+package model
+
+import (
+	process "github.com/mudler/go-processmanager"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Memory budget", func() {
+	var ml *ModelLoader
+
+	load := func(id string, estimate uint64) {
+		_, err := ml.loadModel(id, id, func() uint64 { return estimate }, func(modelID, _, _ string) (*Model, error) {
+			return NewModel(modelID, id, nil), nil
+		})
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	loaded := func() []string {
+		ids := []string{}
+		for _, m := range ml.ListModels() {
+			ids = append(ids, m.ID)
+		}
+		return ids
+	}
+
+	BeforeEach(func() {
+		ml = NewModelLoader("", false)
+		ml.SetMemoryBudget(10)
+	})
+
+	It("keeps the models that fit", func() {
+		load("a", 6)
+		load("b", 4)
+		Expect(loaded()).To(ConsistOf("a", "b"))
+
+		used, budget := ml.MemoryUsage()
+		Expect(used).To(Equal(uint64(10)))
+		Expect(budget).To(Equal(uint64(10)))
+	})
+
+	It("stops the least recently used models to load a new one", func() {
+		load("a", 6)
+		load("b", 4)
+		load("c", 5)
+		Expect(loaded()).To(ConsistOf("b", "c"))
+
+		Expect(ml.CheckIsLoaded("b")).ToNot(BeNil())
+		load("d", 2)
+		Expect(loaded()).To(ConsistOf("b", "d"))
+	})
+
+	It("loads a model larger than the budget alone", func() {
+		load("a", 4)
+		load("b", 12)
+		Expect(loaded()).To(ConsistOf("b"))
+	})
+
+	It("uses the observed memory when larger than the estimate", func() {
+		_, err := ml.loadModel("a", "a", func() uint64 { return 2 }, func(modelID, _, _ string) (*Model, error) {
+			return NewModel(modelID, "a", &process.Process{PID: "42"}), nil
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		observed := uint64(1)
+		ml.SetMemoryObserver(func(pid int) (uint64, error) {
+			Expect(pid).To(Equal(42))
+			return observed, nil
+		})
+		used, _ := ml.MemoryUsage()
+		Expect(used).To(Equal(uint64(2)))
+
+		observed = 7
+		used, _ = ml.MemoryUsage()
+		Expect(used).To(Equal(uint64(7)))
+
+		// The model is not stopped, it does not run a real process
+		ml.mu.Lock()
+		delete(ml.models, "a")
+		ml.mu.Unlock()
+	})
+
+	It("does not evict anything without a budget", func() {
+		ml.SetMemoryBudget(0)
+		load("a", 8)
+		load("b", 8)
+		Expect(loaded()).To(ConsistOf("a", "b"))
+	})
+})
@@ -0,0 +1,221 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// superviseInterval is how often the processes of the backends are checked for an exit
+	superviseInterval = time.Second
+
+	// A model is in a crash loop once its backend crashed crashLoopThreshold times within crashLoopWindow: it is not
+	// restarted nor loaded again until the oldest of these crashes is older than the window
+	crashLoopThreshold = 3
+	crashLoopWindow    = 5 * time.Minute
+
+	// The backend is restarted after restartBackoff, doubled for each recent crash up to maxRestartBackoff
+	restartBackoff    = time.Second
+	maxRestartBackoff = 30 * time.Second
+
+	// crashStderrLines is how many of the last lines of the stderr of a crashed backend are kept
+	crashStderrLines = 20
+	crashStderrBytes = 64 * 1024
+)
+
+// ErrBackendCrashLoop is wrapped by the errors of the loads refused as the backend of the model keeps crashing
+var ErrBackendCrashLoop = errors.New("the backend keeps crashing")
+
+// CrashLoopError is returned when loading a model whose backend keeps crashing
+type CrashLoopError struct {
+	Model   string
+	Crashes int
+	// RetryAfter is how long until the model can be loaded again
+	RetryAfter time.Duration
+	// Stderr has the last lines the backend wrote on its stderr before its last crash
+	Stderr []string
+}
+
+func (e *CrashLoopError) Error() string {
+	msg := fmt.Sprintf("the backend of model %s crashed %d times in the last %s, retry in %s", e.Model, e.Crashes, crashLoopWindow, e.RetryAfter.Round(time.Second))
+	if len(e.Stderr) > 0 {
+		msg += ". Last lines of its stderr:\n" + strings.Join(e.Stderr, "\n")
+	}
+	return msg
+}
+
+func (e *CrashLoopError) Unwrap() error {
+	return ErrBackendCrashLoop
+}
+
+// crashHistory is the record of the recent crashes of the backend of a model
+type crashHistory struct {
+	times  []time.Time
+	stderr []string
+}
+
+// prune forgets the crashes older than the crash loop window
+func (h *crashHistory) prune(now time.Time) {
+	i := 0
+	for i < len(h.times) && now.Sub(h.times[i]) > crashLoopWindow {
+		i++
+	}
+	h.times = h.times[i:]
+}
+
+// supervise watches the process of the backend of the model, until it is stopped or the context is canceled. If the
+// process exits by itself, the model is unloaded and restarted with restart.
+func (ml *ModelLoader) supervise(ctx context.Context, m *Model, restart func() error) {
+	ticker := time.NewTicker(superviseInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if m.stopped.Load() {
+			return
+		}
+		if m.process.IsAlive() {
+			continue
+		}
+
+		ml.mu.Lock()
+		restarting := ml.backendExited(m)
+		ml.mu.Unlock()
+		if restarting {
+			ml.restartModel(ctx, m.ID, restart)
+		}
+		return
+	}
+}
+
+// backendExited unloads the model whose backend process exited while it was loaded, and records the crash.
+// It returns if the backend must be restarted. It must be called with the lock held.
+func (ml *ModelLoader) backendExited(m *Model) bool {
+	// A backend stopped or replaced on purpose did not crash
+	if m.stopped.Load() || ml.models[m.ID] != m || !m.exited.CompareAndSwap(false, true) {
+		return false
+	}
+	delete(ml.models, m.ID)
+	ml.backendChanged(m.ID)
+
+	exitCode, _ := m.process.ExitCode()
+	stderr := lastLines(m.process.StderrPath(), crashStderrLines)
+	log.Error().Str("model", m.ID).Str("exit_code", exitCode).Strs("stderr", stderr).Msg("The backend crashed")
+	ml.setUnloaded(m.ID, fmt.Errorf("the backend crashed (exit code %s)", exitCode))
+
+	// The watchdog must not stop the next backend of the model at this address. The watchdog calls the loader
+	// with its own lock held, so it is not called with the lock of the loader held.
+	if ml.wd != nil {
+		go ml.wd.RemoveAddress(m.address)
+	}
+
+	h, ok := ml.crashes[m.ID]
+	if !ok {
+		h = &crashHistory{}
+		ml.crashes[m.ID] = h
+	}
+	now := time.Now()
+	h.prune(now)
+	h.times = append(h.times, now)
+	h.stderr = stderr
+
+	if len(h.times) >= crashLoopThreshold {
+		log.Error().Str("model", m.ID).Int("crashes", len(h.times)).Msg("The backend keeps crashing, not restarting it")
+		return false
+	}
+	// Only one backend runs at a time in singleton mode: the next request loads it again
+	return !ml.singletonMode
+}
+
+// restartModel restarts the backend of the model after a delay growing with its recent crashes
+func (ml *ModelLoader) restartModel(ctx context.Context, modelID string, restart func() error) {
+	ml.mu.Lock()
+	crashes := len(ml.crashes[modelID].times)
+	ml.mu.Unlock()
+
+	delay := restartBackoff << (crashes - 1)
+	if delay > maxRestartBackoff {
+		delay = maxRestartBackoff
+	}
+	log.Info().Str("model", modelID).Dur("delay", delay).Msg("Restarting the backend")
+
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(delay):
+	}
+	if err := ml.crashLoop(modelID); err != nil {
+		return
+	}
+	if err := restart(); err != nil {
+		log.Error().Err(err).Str("model", modelID).Msg("error restarting the backend")
+	}
+}
+
+// crashLoop returns a *CrashLoopError if the backend of the model keeps crashing
+func (ml *ModelLoader) crashLoop(modelID string) error {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+
+	h, ok := ml.crashes[modelID]
+	if !ok {
+		return nil
+	}
+	now := time.Now()
+	h.prune(now)
+	if len(h.times) < crashLoopThreshold {
+		return nil
+	}
+	return &CrashLoopError{
+		Model:      modelID,
+		Crashes:    len(h.times),
+		RetryAfter: crashLoopWindow - now.Sub(h.times[0]),
+		Stderr:     h.stderr,
+	}
+}
+
+// resetCrashes forgets the crashes of the backend of the model, so that it can be loaded again
+func (ml *ModelLoader) resetCrashes(modelID string) {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	delete(ml.crashes, modelID)
+}
+
+// lastLines returns the last n lines of the file, nil if it can't be read
+func lastLines(path string, n int) []string {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	if info, err := f.Stat(); err == nil && info.Size() > crashStderrBytes {
+		if _, err := f.Seek(-crashStderrBytes, io.SeekEnd); err != nil {
+			return nil
+		}
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil
+	}
+
+	text := strings.TrimRight(string(data), "\n")
+	if text == "" {
+		return nil
+	}
+	lines := strings.Split(text, "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines
+}
@@ -0,0 +1,86 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	process "github.com/mudler/go-processmanager"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Supervisor", func() {
+	var ml *ModelLoader
+
+	// crashing returns a model whose backend process writes on its stderr and exits
+	crashing := func(id string) *Model {
+		p := process.New(
+			process.WithTemporaryStateDir(),
+			process.WithName("/bin/sh"),
+			process.WithArgs("-c", "sleep 0.2; echo 'loading model' >&2; echo 'out of memory' >&2; exit 1"),
+		)
+		Expect(p.Run()).To(Succeed())
+		m := NewModel(id, "127.0.0.1:0", p)
+		ml.mu.Lock()
+		ml.models[id] = m
+		ml.mu.Unlock()
+		return m
+	}
+
+	loaded := func(id string) *Model {
+		ml.mu.Lock()
+		defer ml.mu.Unlock()
+		return ml.models[id]
+	}
+
+	BeforeEach(func() {
+		ml = NewModelLoader("", false)
+	})
+
+	It("unloads and restarts a crashed backend", func() {
+		m := crashing("a")
+		restarted := false
+		ml.supervise(context.Background(), m, func() error {
+			restarted = true
+			return nil
+		})
+
+		Expect(restarted).To(BeTrue())
+		Expect(loaded("a")).To(BeNil())
+		Expect(ml.crashes["a"].times).To(HaveLen(1))
+		Expect(ml.crashes["a"].stderr).To(Equal([]string{"loading model", "out of memory"}))
+	})
+
+	It("does not restart a backend stopped on purpose", func() {
+		m := crashing("a")
+		m.stopped.Store(true)
+		ml.supervise(context.Background(), m, func() error {
+			Fail("the backend was restarted")
+			return nil
+		})
+		Expect(loaded("a")).To(BeIdenticalTo(m))
+	})
+
+	It("refuses to load a model whose backend keeps crashing", func() {
+		for range crashLoopThreshold {
+			m := crashing("a")
+			Eventually(m.process.IsAlive, 5*time.Second).Should(BeFalse())
+			ml.mu.Lock()
+			ml.backendExited(m)
+			ml.mu.Unlock()
+		}
+
+		_, err := ml.Load(WithModelID("a"), WithModel("a"), WithBackendString("llama-cpp"))
+		Expect(errors.Is(err, ErrBackendCrashLoop)).To(BeTrue())
+		var crashLoop *CrashLoopError
+		Expect(errors.As(err, &crashLoop)).To(BeTrue())
+		Expect(crashLoop.Crashes).To(Equal(crashLoopThreshold))
+		Expect(crashLoop.RetryAfter).To(BeNumerically("~", crashLoopWindow, time.Minute))
+		Expect(err.Error()).To(ContainSubstring("out of memory"))
+
+		// Reloading the model with new options gives it another chance
+		Expect(ml.Reload(WithModelID("a"), WithModel("a"))).To(Succeed())
+		Expect(ml.crashLoop("a")).To(Succeed())
+	})
+})
@@ -27,10 +27,17 @@ type WatchDog struct {
 	stop                 chan bool
 
 	busyCheck, idleCheck bool
+
+	killObserver KillObserver
 }
 
+// KillObserver is notified of each backend stopped by the watchdog, and why: "busy" or "idle"
+type KillObserver func(modelID, reason string)
+
 type ProcessManager interface {
 	ShutdownModel(modelName string) error
+	// KeepAlive returns the keep alive of the model, the models with one are not stopped by the idle check
+	KeepAlive(modelName string) time.Duration
 }
 
 func NewWatchDog(pm ProcessManager, timeoutBusy, timeoutIdle time.Duration, busy, idle bool) *WatchDog {
@@ -47,6 +54,12 @@ func NewWatchDog(pm ProcessManager, timeoutBusy, timeoutIdle time.Duration, busy
 	}
 }
 
+func (wd *WatchDog) SetKillObserver(observer KillObserver) {
+	wd.Lock()
+	defer wd.Unlock()
+	wd.killObserver = observer
+}
+
 func (wd *WatchDog) Shutdown() {
 	wd.Lock()
 	defer wd.Unlock()
@@ -65,6 +78,16 @@ func (wd *WatchDog) Add(address string, p *process.Process) {
 	wd.addressMap[address] = p
 }
 
+// RemoveAddress forgets a backend which was stopped
+func (wd *WatchDog) RemoveAddress(address string) {
+	wd.Lock()
+	defer wd.Unlock()
+	delete(wd.timetable, address)
+	delete(wd.idleTime, address)
+	delete(wd.addressMap, address)
+	delete(wd.addressModelMap, address)
+}
+
 func (wd *WatchDog) Mark(address string) {
 	wd.Lock()
 	defer wd.Unlock()
@@ -109,13 +132,20 @@ func (wd *WatchDog) checkIdle() {
 	for address, t := range wd.idleTime {
 		log.Debug().Msgf("[WatchDog] %s: idle connection", address)
 		if time.Since(t) > wd.idletimeout {
-			log.Warn().Msgf("[WatchDog] Address %s is idle for too long, killing it", address)
 			model, ok := wd.addressModelMap[address]
+			if ok && wd.pm.KeepAlive(model) != 0 {
+				// The keep alive of the model applies instead
+				continue
+			}
+			log.Warn().Msgf("[WatchDog] Address %s is idle for too long, killing it", address)
 			if ok {
 				if err := wd.pm.ShutdownModel(model); err != nil {
 					log.Error().Err(err).Str("model", model).Msg("[watchdog] error shutting down model")
 				}
 				log.Debug().Msgf("[WatchDog] model shut down: %s", address)
+				if wd.killObserver != nil {
+					wd.killObserver(model, "idle")
+				}
 				delete(wd.idleTime, address)
 				delete(wd.addressModelMap, address)
 				delete(wd.addressMap, address)
@@ -144,6 +174,9 @@ func (wd *WatchDog) checkBusy() {
 					log.Error().Err(err).Str("model", model).Msg("[watchdog] error shutting down model")
 				}
 				log.Debug().Msgf("[WatchDog] model shut down: %s", address)
+				if wd.killObserver != nil {
+					wd.killObserver(model, "busy")
+				}
 				delete(wd.timetable, address)
 				delete(wd.addressModelMap, address)
 				delete(wd.addressMap, address)
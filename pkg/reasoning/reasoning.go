@@ -0,0 +1,146 @@
+package reasoning
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	// DefaultStartTag opens the reasoning when the start tag is unset
+	DefaultStartTag = "<think>"
+	// DefaultEndTag closes the reasoning when the end tag is unset
+	DefaultEndTag = "</think>"
+)
+
+// Config extracts the reasoning of the models which think before they answer, e.g. between <think> and </think>, out
+// of the content of their outputs
+type Config struct {
+	// Enabled extracts the reasoning
+	Enabled  bool   `yaml:"enabled"`
+	StartTag string `yaml:"start_tag"`
+	EndTag   string `yaml:"end_tag"`
+	// StartOpen is set when the prompt opens the reasoning, e.g. when the template ends with the start tag: the output
+	// starts with the reasoning, and only has the end tag
+	StartOpen bool `yaml:"start_open"`
+	// Strip drops the reasoning, instead of returning it apart from the content
+	Strip bool `yaml:"strip"`
+}
+
+// Split returns the reasoning and the content of a whole output, see Parser
+func (c Config) Split(output string) (reasoning, content string) {
+	p := c.NewParser()
+	if p == nil {
+		return "", output
+	}
+	reasoning, content = p.Write(output)
+	r, rest := p.Flush()
+	return strings.TrimRightFunc(reasoning+r, unicode.IsSpace), content + rest
+}
+
+// The part of the output being parsed
+const (
+	partStart = iota
+	partReasoning
+	partContent
+)
+
+// Parser splits the reasoning out of the content of an output token by token. The reasoning is at the start of the
+// output, between the start and the end tags, and the tags elsewhere are content. An unterminated reasoning takes the
+// whole output.
+type Parser struct {
+	startTag, endTag string
+	part             int
+	// pending is the end of the output read which may be the start of a tag
+	pending string
+	// trim drops the spaces after a tag
+	trim bool
+}
+
+// NewParser returns a parser of the reasoning of the outputs, nil if the reasoning isn't extracted
+func (c Config) NewParser() *Parser {
+	if !c.Enabled {
+		return nil
+	}
+	p := &Parser{startTag: c.StartTag, endTag: c.EndTag, part: partStart}
+	if p.startTag == "" {
+		p.startTag = DefaultStartTag
+	}
+	if p.endTag == "" {
+		p.endTag = DefaultEndTag
+	}
+	if c.StartOpen {
+		p.part, p.trim = partReasoning, true
+	}
+	return p
+}
+
+// Write parses the next token of the output, and returns its reasoning and its content. The end of the token which
+// may be the start of a tag is returned along with the next tokens.
+func (p *Parser) Write(token string) (reasoning, content string) {
+	var r, c strings.Builder
+	s := p.pending + token
+	p.pending = ""
+	for {
+		switch p.part {
+		case partStart:
+			trimmed := strings.TrimLeftFunc(s, unicode.IsSpace)
+			switch {
+			case strings.HasPrefix(trimmed, p.startTag):
+				s = trimmed[len(p.startTag):]
+				p.part, p.trim = partReasoning, true
+				continue
+			case strings.HasPrefix(p.startTag, trimmed):
+				p.pending = s
+			default:
+				p.part = partContent
+				continue
+			}
+		case partReasoning:
+			if i := strings.Index(s, p.endTag); i >= 0 {
+				p.emit(&r, s[:i])
+				s = s[i+len(p.endTag):]
+				p.part, p.trim = partContent, true
+				continue
+			}
+			held := partialTag(s, p.endTag)
+			p.emit(&r, s[:len(s)-held])
+			p.pending = s[len(s)-held:]
+		case partContent:
+			p.emit(&c, s)
+		}
+		return r.String(), c.String()
+	}
+}
+
+// Flush returns the reasoning and the content left once the output is complete
+func (p *Parser) Flush() (reasoning, content string) {
+	s := p.pending
+	p.pending = ""
+	var b strings.Builder
+	p.emit(&b, s)
+	if p.part == partReasoning {
+		return b.String(), ""
+	}
+	return "", b.String()
+}
+
+func (p *Parser) emit(b *strings.Builder, s string) {
+	if p.trim {
+		s = strings.TrimLeftFunc(s, unicode.IsSpace)
+		if s == "" {
+			return
+		}
+		p.trim = false
+	}
+	b.WriteString(s)
+}
+
+// partialTag returns the length of the longest end of s which is the start of the tag
+func partialTag(s, tag string) int {
+	for n := min(len(s), len(tag)-1); n > 0; n-- {
+		if strings.HasSuffix(s, tag[:n]) {
+			return n
+		}
+	}
+	return 0
+}
@@ -0,0 +1,47 @@
+package reasoning_test
+
+import (
+	. "github.com/mudler/LocalAI/pkg/reasoning"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Reasoning", func() {
+	enabled := Config{Enabled: true}
+
+	DescribeTable("Split()",
+		func(cfg Config, output, reasoning, content string) {
+			r, c := cfg.Split(output)
+			Expect(r).To(Equal(reasoning))
+			Expect(c).To(Equal(content))
+		},
+		Entry("leaves the output untouched when disabled", Config{}, "<think>hmm</think>Hi", "", "<think>hmm</think>Hi"),
+		Entry("extracts the reasoning at the start", enabled, "<think>\nLet me see.\n</think>\n\nHi!", "Let me see.", "Hi!"),
+		Entry("skips the spaces before the start tag", enabled, "\n <think>hmm</think>Hi", "hmm", "Hi"),
+		Entry("leaves the output without reasoning untouched", enabled, " Hi <think>", "", " Hi <think>"),
+		Entry("leaves the tags after the reasoning in the content", enabled, "<think>a</think>b <think>c</think>", "a", "b <think>c</think>"),
+		Entry("takes the unterminated reasoning as a whole", enabled, "<think>still thinking", "still thinking", ""),
+		Entry("uses the tags of the configuration", Config{Enabled: true, StartTag: "[THINK]", EndTag: "[/THINK]"}, "[THINK]a[/THINK]b", "a", "b"),
+		Entry("starts in the reasoning when the prompt opens it", Config{Enabled: true, StartOpen: true}, "\nhmm\n</think>\nHi", "hmm", "Hi"),
+	)
+
+	It("splits the output token by token", func() {
+		parser := enabled.NewParser()
+		var reasoning, content []string
+		for _, token := range []string{"  <", "th", "ink>", "\n", "I", " think", "</", "thin", "k>", "\n\n", "The", " answer", " </"} {
+			r, c := parser.Write(token)
+			reasoning = append(reasoning, r)
+			content = append(content, c)
+		}
+		r, c := parser.Flush()
+		reasoning = append(reasoning, r)
+		content = append(content, c)
+
+		Expect(reasoning).To(Equal([]string{"", "", "", "", "I", " think", "", "", "", "", "", "", "", ""}))
+		Expect(content).To(Equal([]string{"", "", "", "", "", "", "", "", "", "", "The", " answer", " </", ""}))
+	})
+
+	It("returns no parser when disabled", func() {
+		Expect(Config{}.NewParser()).To(BeNil())
+	})
+})
@@ -10,9 +10,48 @@ import (
 
 // Wrapper for the GRPC client so that simple use cases are handled without verbosity
 
+// Option scopes or extends a call to the store
+type Option func(*options)
+
+type options struct {
+	namespace string
+	metadata  [][]byte
+	filter    []byte
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithNamespace runs the call in the namespace of the store, the default namespace is the empty one
+func WithNamespace(namespace string) Option {
+	return func(o *options) {
+		o.namespace = namespace
+	}
+}
+
+// WithMetadata sets the JSON metadata of the keys set, metadata[i] is the one of keys[i]
+func WithMetadata(metadata [][]byte) Option {
+	return func(o *options) {
+		o.metadata = metadata
+	}
+}
+
+// WithFilter only finds the keys whose metadata match the JSON filter
+func WithFilter(filter []byte) Option {
+	return func(o *options) {
+		o.filter = filter
+	}
+}
+
 // SetCols sets multiple key-value pairs in the store
 // It's in columnar format so that keys[i] is associated with values[i]
-func SetCols(ctx context.Context, c grpc.Backend, keys [][]float32, values [][]byte) error {
+func SetCols(ctx context.Context, c grpc.Backend, keys [][]float32, values [][]byte, opts ...Option) error {
+	o := newOptions(opts)
 	protoKeys := make([]*proto.StoresKey, len(keys))
 	for i, k := range keys {
 		protoKeys[i] = &proto.StoresKey{
@@ -26,8 +65,10 @@ func SetCols(ctx context.Context, c grpc.Backend, keys [][]float32, values [][]b
 		}
 	}
 	setOpts := &proto.StoresSetOptions{
-		Keys:   protoKeys,
-		Values: protoValues,
+		Keys:      protoKeys,
+		Values:    protoValues,
+		Metadata:  o.metadata,
+		Namespace: o.namespace,
 	}
 
 	res, err := c.StoresSet(ctx, setOpts)
@@ -44,13 +85,13 @@ func SetCols(ctx context.Context, c grpc.Backend, keys [][]float32, values [][]b
 
 // SetSingle sets a single key-value pair in the store
 // Don't call this in a tight loop, instead use SetCols
-func SetSingle(ctx context.Context, c grpc.Backend, key []float32, value []byte) error {
-	return SetCols(ctx, c, [][]float32{key}, [][]byte{value})
+func SetSingle(ctx context.Context, c grpc.Backend, key []float32, value []byte, opts ...Option) error {
+	return SetCols(ctx, c, [][]float32{key}, [][]byte{value}, opts...)
 }
 
 // DeleteCols deletes multiple key-value pairs from the store
 // It's in columnar format so that keys[i] is associated with values[i]
-func DeleteCols(ctx context.Context, c grpc.Backend, keys [][]float32) error {
+func DeleteCols(ctx context.Context, c grpc.Backend, keys [][]float32, opts ...Option) error {
 	protoKeys := make([]*proto.StoresKey, len(keys))
 	for i, k := range keys {
 		protoKeys[i] = &proto.StoresKey{
@@ -58,7 +99,8 @@ func DeleteCols(ctx context.Context, c grpc.Backend, keys [][]float32) error {
 		}
 	}
 	deleteOpts := &proto.StoresDeleteOptions{
-		Keys: protoKeys,
+		Keys:      protoKeys,
+		Namespace: newOptions(opts).namespace,
 	}
 
 	res, err := c.StoresDelete(ctx, deleteOpts)
@@ -75,15 +117,21 @@ func DeleteCols(ctx context.Context, c grpc.Backend, keys [][]float32) error {
 
 // DeleteSingle deletes a single key-value pair from the store
 // Don't call this in a tight loop, instead use DeleteCols
-func DeleteSingle(ctx context.Context, c grpc.Backend, key []float32) error {
-	return DeleteCols(ctx, c, [][]float32{key})
+func DeleteSingle(ctx context.Context, c grpc.Backend, key []float32, opts ...Option) error {
+	return DeleteCols(ctx, c, [][]float32{key}, opts...)
 }
 
 // GetCols gets multiple key-value pairs from the store
 // It's in columnar format so that keys[i] is associated with values[i]
 // Be warned the keys are sorted and will be returned in a different order than they were input
 // There is no guarantee as to how the keys are sorted
-func GetCols(ctx context.Context, c grpc.Backend, keys [][]float32) ([][]float32, [][]byte, error) {
+func GetCols(ctx context.Context, c grpc.Backend, keys [][]float32, opts ...Option) ([][]float32, [][]byte, error) {
+	ks, vs, _, err := GetColsWithMetadata(ctx, c, keys, opts...)
+	return ks, vs, err
+}
+
+// GetColsWithMetadata is GetCols also returning the metadata of the keys, empty for the keys without
+func GetColsWithMetadata(ctx context.Context, c grpc.Backend, keys [][]float32, opts ...Option) ([][]float32, [][]byte, [][]byte, error) {
 	protoKeys := make([]*proto.StoresKey, len(keys))
 	for i, k := range keys {
 		protoKeys[i] = &proto.StoresKey{
@@ -91,12 +139,13 @@ func GetCols(ctx context.Context, c grpc.Backend, keys [][]float32) ([][]float32
 		}
 	}
 	getOpts := &proto.StoresGetOptions{
-		Keys: protoKeys,
+		Keys:      protoKeys,
+		Namespace: newOptions(opts).namespace,
 	}
 
 	res, err := c.StoresGet(ctx, getOpts)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
 	ks := make([][]float32, len(res.Keys))
@@ -108,13 +157,13 @@ func GetCols(ctx context.Context, c grpc.Backend, keys [][]float32) ([][]float32
 		vs[i] = v.Bytes
 	}
 
-	return ks, vs, nil
+	return ks, vs, res.Metadata, nil
 }
 
 // GetSingle gets a single key-value pair from the store
 // Don't call this in a tight loop, instead use GetCols
-func GetSingle(ctx context.Context, c grpc.Backend, key []float32) ([]byte, error) {
-	_, values, err := GetCols(ctx, c, [][]float32{key})
+func GetSingle(ctx context.Context, c grpc.Backend, key []float32, opts ...Option) ([]byte, error) {
+	_, values, err := GetCols(ctx, c, [][]float32{key}, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -127,17 +176,26 @@ func GetSingle(ctx context.Context, c grpc.Backend, key []float32) ([]byte, erro
 }
 
 // Find similar keys to the given key. Returns the keys, values, and similarities
-func Find(ctx context.Context, c grpc.Backend, key []float32, topk int) ([][]float32, [][]byte, []float32, error) {
+func Find(ctx context.Context, c grpc.Backend, key []float32, topk int, opts ...Option) ([][]float32, [][]byte, []float32, error) {
+	ks, vs, sims, _, err := FindWithMetadata(ctx, c, key, topk, opts...)
+	return ks, vs, sims, err
+}
+
+// FindWithMetadata is Find also returning the metadata of the keys found
+func FindWithMetadata(ctx context.Context, c grpc.Backend, key []float32, topk int, opts ...Option) ([][]float32, [][]byte, []float32, [][]byte, error) {
+	o := newOptions(opts)
 	findOpts := &proto.StoresFindOptions{
 		Key: &proto.StoresKey{
 			Floats: key,
 		},
-		TopK: int32(topk),
+		TopK:      int32(topk),
+		Namespace: o.namespace,
+		Filter:    o.filter,
 	}
 
 	res, err := c.StoresFind(ctx, findOpts)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, nil, nil, nil, err
 	}
 
 	ks := make([][]float32, len(res.Keys))
@@ -151,5 +209,26 @@ func Find(ctx context.Context, c grpc.Backend, key []float32, topk int) ([][]flo
 		vs[i] = v.Bytes
 	}
 
-	return ks, vs, res.Similarities, nil
+	return ks, vs, res.Similarities, res.Metadata, nil
+}
+
+// Snapshot writes the content of the store to path, or to its persistence directory when path is empty.
+// Returns the path of the snapshot and the number of entries in it
+func Snapshot(ctx context.Context, c grpc.Backend, path string, opts ...Option) (string, int64, error) {
+	res, err := c.StoresSnapshot(ctx, &proto.StoresSnapshotOptions{Path: path, Namespace: newOptions(opts).namespace})
+	if err != nil {
+		return "", 0, err
+	}
+
+	return res.Path, res.Entries, nil
+}
+
+// Restore replaces the content of the store with the snapshot at path, or with its persisted state when path is empty
+func Restore(ctx context.Context, c grpc.Backend, path string, opts ...Option) (string, int64, error) {
+	res, err := c.StoresRestore(ctx, &proto.StoresSnapshotOptions{Path: path, Namespace: newOptions(opts).namespace})
+	if err != nil {
+		return "", 0, err
+	}
+
+	return res.Path, res.Entries, nil
 }
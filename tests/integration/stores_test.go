@@ -2,17 +2,22 @@ package integration_test
 
 import (
 	"context"
+	"fmt"
 	"math"
 	"math/rand"
 	"os"
+	"path/filepath"
+	"slices"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gmeasure"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
 	"github.com/mudler/LocalAI/core/config"
 	"github.com/mudler/LocalAI/pkg/grpc"
+	"github.com/mudler/LocalAI/pkg/grpc/proto"
 	"github.com/mudler/LocalAI/pkg/model"
 	"github.com/mudler/LocalAI/pkg/store"
 )
@@ -334,4 +339,426 @@ var _ = Describe("Integration tests for the stores backend(s) and internal APIs"
 			expectTriangleEq(keys, vals)
 		})
 	})
+
+	Context("Persisted store", func() {
+		var sl *model.ModelLoader
+		var sc grpc.Backend
+		var tmpdir string
+
+		load := func() {
+			var err error
+
+			storeOpts := []model.Option{
+				model.WithBackendString(model.LocalStoreBackend),
+				model.WithModel("test"),
+				model.WithModelID("test"),
+				model.WithLoadGRPCLoadModelOpts(&proto.ModelOptions{
+					Options: []string{"persistence_path:" + filepath.Join(tmpdir, "test")},
+				}),
+			}
+
+			sc, err = sl.Load(storeOpts...)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sc).ToNot(BeNil())
+		}
+
+		restart := func() {
+			Expect(sl.StopAllGRPC()).To(Succeed())
+			load()
+		}
+
+		BeforeEach(func() {
+			var err error
+
+			tmpdir, err = os.MkdirTemp("", "")
+			Expect(err).ToNot(HaveOccurred())
+
+			sl = model.NewModelLoader("", false)
+			load()
+		})
+
+		AfterEach(func() {
+			err := sl.StopAllGRPC()
+			Expect(err).ToNot(HaveOccurred())
+			err = os.RemoveAll(tmpdir)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("keeps the keys across restarts", func() {
+			err := store.SetCols(context.Background(), sc, [][]float32{{0.1, 0.2, 0.3}, {0.4, 0.5, 0.6}, {0.7, 0.8, 0.9}}, [][]byte{[]byte("test1"), []byte("test2"), []byte("test3")})
+			Expect(err).ToNot(HaveOccurred())
+			err = store.DeleteSingle(context.Background(), sc, []float32{0.4, 0.5, 0.6})
+			Expect(err).ToNot(HaveOccurred())
+
+			restart()
+
+			keys, vals, err := store.GetCols(context.Background(), sc, [][]float32{{0.1, 0.2, 0.3}, {0.4, 0.5, 0.6}, {0.7, 0.8, 0.9}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(keys).To(Equal([][]float32{{0.1, 0.2, 0.3}, {0.7, 0.8, 0.9}}))
+			Expect(vals).To(Equal([][]byte{[]byte("test1"), []byte("test3")}))
+		})
+
+		It("keeps the keys across compactions", func() {
+			err := store.SetCols(context.Background(), sc, [][]float32{{0.1, 0.2, 0.3}, {0.4, 0.5, 0.6}}, [][]byte{[]byte("test1"), []byte("test2")})
+			Expect(err).ToNot(HaveOccurred())
+
+			_, entries, err := store.Snapshot(context.Background(), sc, "")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entries).To(Equal(int64(2)))
+
+			err = store.SetSingle(context.Background(), sc, []float32{0.4, 0.5, 0.6}, []byte("updated"))
+			Expect(err).ToNot(HaveOccurred())
+
+			restart()
+
+			keys, vals, err := store.GetCols(context.Background(), sc, [][]float32{{0.1, 0.2, 0.3}, {0.4, 0.5, 0.6}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(keys).To(HaveLen(2))
+			Expect(vals).To(Equal([][]byte{[]byte("test1"), []byte("updated")}))
+		})
+
+		It("drops a torn write at the end of the log", func() {
+			err := store.SetSingle(context.Background(), sc, []float32{0.1, 0.2, 0.3}, []byte("test1"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sl.StopAllGRPC()).To(Succeed())
+
+			wal, err := os.OpenFile(filepath.Join(tmpdir, "test", "wal.log"), os.O_APPEND|os.O_WRONLY, 0600)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = wal.Write([]byte{42, 0, 0, 0, 1, 2})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(wal.Close()).To(Succeed())
+
+			load()
+
+			val, err := store.GetSingle(context.Background(), sc, []float32{0.1, 0.2, 0.3})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(val).To(Equal([]byte("test1")))
+
+			err = store.SetSingle(context.Background(), sc, []float32{0.4, 0.5, 0.6}, []byte("test2"))
+			Expect(err).ToNot(HaveOccurred())
+
+			restart()
+
+			_, vals, err := store.GetCols(context.Background(), sc, [][]float32{{0.1, 0.2, 0.3}, {0.4, 0.5, 0.6}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(vals).To(Equal([][]byte{[]byte("test1"), []byte("test2")}))
+		})
+
+		It("restores a snapshot", func() {
+			snapshot := filepath.Join(tmpdir, "snapshots", "backup.snapshot")
+
+			err := store.SetCols(context.Background(), sc, [][]float32{{0.1, 0.2, 0.3}, {0.4, 0.5, 0.6}}, [][]byte{[]byte("test1"), []byte("test2")})
+			Expect(err).ToNot(HaveOccurred())
+
+			_, entries, err := store.Snapshot(context.Background(), sc, snapshot)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entries).To(Equal(int64(2)))
+
+			err = store.DeleteSingle(context.Background(), sc, []float32{0.1, 0.2, 0.3})
+			Expect(err).ToNot(HaveOccurred())
+			err = store.SetSingle(context.Background(), sc, []float32{0.7, 0.8, 0.9}, []byte("test3"))
+			Expect(err).ToNot(HaveOccurred())
+
+			_, entries, err = store.Restore(context.Background(), sc, snapshot)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entries).To(Equal(int64(2)))
+
+			// The restored content is persisted
+			restart()
+
+			keys, vals, err := store.GetCols(context.Background(), sc, [][]float32{{0.1, 0.2, 0.3}, {0.4, 0.5, 0.6}, {0.7, 0.8, 0.9}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(keys).To(Equal([][]float32{{0.1, 0.2, 0.3}, {0.4, 0.5, 0.6}}))
+			Expect(vals).To(Equal([][]byte{[]byte("test1"), []byte("test2")}))
+		})
+
+		It("rejects an invalid snapshot", func() {
+			snapshot := filepath.Join(tmpdir, "invalid.snapshot")
+			Expect(os.WriteFile(snapshot, []byte("not a snapshot, but long enough"), 0600)).To(Succeed())
+
+			err := store.SetSingle(context.Background(), sc, []float32{0.1, 0.2, 0.3}, []byte("test1"))
+			Expect(err).ToNot(HaveOccurred())
+
+			_, _, err = store.Restore(context.Background(), sc, snapshot)
+			Expect(err).To(HaveOccurred())
+
+			val, err := store.GetSingle(context.Background(), sc, []float32{0.1, 0.2, 0.3})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(val).To(Equal([]byte("test1")))
+		})
+	})
+
+	Context("HNSW index", func() {
+		var sl *model.ModelLoader
+		var flat, hnsw grpc.Backend
+
+		load := func(name string, options ...string) (grpc.Backend, error) {
+			return sl.Load(
+				model.WithBackendString(model.LocalStoreBackend),
+				model.WithModel(name),
+				model.WithModelID(name),
+				model.WithLoadGRPCLoadModelOpts(&proto.ModelOptions{Options: options}),
+			)
+		}
+
+		randomKeys := func(rnd *rand.Rand, n, dim int) [][]float32 {
+			keys := make([][]float32, n)
+			for i := range keys {
+				keys[i] = make([]float32, dim)
+				for j := range keys[i] {
+					keys[i][j] = float32(rnd.NormFloat64())
+				}
+			}
+			normalize(keys)
+			return keys
+		}
+
+		BeforeEach(func() {
+			var err error
+
+			sl = model.NewModelLoader("", false)
+			flat, err = load("flat")
+			Expect(err).ToNot(HaveOccurred())
+			hnsw, err = load("hnsw", "index:hnsw", "hnsw_exact_below:100", "hnsw_ef_search:128")
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			err := sl.StopAllGRPC()
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("rejects an unknown index", func() {
+			_, err := load("unknown", "index:unknown")
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("finds similar keys and no deleted ones", func() {
+			rnd := rand.New(rand.NewSource(7))
+			keys := randomKeys(rnd, 500, 32)
+			vals := make([][]byte, len(keys))
+			for i := range vals {
+				vals[i] = []byte{byte(i)}
+			}
+
+			err := store.SetCols(context.Background(), hnsw, keys, vals)
+			Expect(err).ToNot(HaveOccurred())
+
+			ks, vs, sims, err := store.Find(context.Background(), hnsw, keys[42], 3)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ks).To(HaveLen(3))
+			Expect(ks[0]).To(Equal(keys[42]))
+			Expect(vs[0]).To(Equal(vals[42]))
+			Expect(sims[0]).To(BeNumerically("~", 1.0, 0.0001))
+			Expect(sims[1]).To(BeNumerically("<=", sims[0]))
+			Expect(sims[2]).To(BeNumerically("<=", sims[1]))
+
+			err = store.DeleteSingle(context.Background(), hnsw, keys[42])
+			Expect(err).ToNot(HaveOccurred())
+
+			ks, _, _, err = store.Find(context.Background(), hnsw, keys[42], 3)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ks).To(HaveLen(3))
+			Expect(ks).ToNot(ContainElement(keys[42]))
+		})
+
+		It("compares with the exact scan", func() {
+			rnd := rand.New(rand.NewSource(151))
+			keys := randomKeys(rnd, 5000, 64)
+			vals := make([][]byte, len(keys))
+			for i := range vals {
+				vals[i] = []byte(fmt.Sprint(i))
+			}
+
+			Expect(store.SetCols(context.Background(), flat, keys, vals)).To(Succeed())
+			Expect(store.SetCols(context.Background(), hnsw, keys, vals)).To(Succeed())
+
+			experiment := gmeasure.NewExperiment("local-store find: hnsw vs exact scan")
+			AddReportEntry(experiment.Name, experiment)
+
+			const topK = 10
+			experiment.Sample(func(idx int) {
+				// Queries close to the stored keys, like the embedding of a paraphrase
+				query := make([]float32, 64)
+				for j, v := range keys[rnd.Intn(len(keys))] {
+					query[j] = v + float32(rnd.NormFloat64())*0.05
+				}
+				normalize([][]float32{query})
+
+				var exact, approx []string
+				experiment.MeasureDuration("exact", func() {
+					_, vs, _, err := store.Find(context.Background(), flat, query, topK)
+					Expect(err).ToNot(HaveOccurred())
+					for _, v := range vs {
+						exact = append(exact, string(v))
+					}
+				})
+				experiment.MeasureDuration("hnsw", func() {
+					_, vs, _, err := store.Find(context.Background(), hnsw, query, topK)
+					Expect(err).ToNot(HaveOccurred())
+					for _, v := range vs {
+						approx = append(approx, string(v))
+					}
+				})
+
+				found := 0
+				for _, v := range approx {
+					if slices.Contains(exact, v) {
+						found++
+					}
+				}
+				experiment.RecordValue("recall", float64(found)/topK)
+			}, gmeasure.SamplingConfig{N: 100})
+
+			Expect(experiment.GetStats("recall").FloatFor(gmeasure.StatMean)).To(BeNumerically(">=", 0.9))
+		})
+
+		It("finds the keys matching a filter", func() {
+			rnd := rand.New(rand.NewSource(3))
+			keys := randomKeys(rnd, 500, 32)
+			vals := make([][]byte, len(keys))
+			metadata := make([][]byte, len(keys))
+			for i := range keys {
+				vals[i] = []byte(fmt.Sprint(i))
+				metadata[i] = []byte(fmt.Sprintf(`{"even": %t}`, i%2 == 0))
+			}
+			Expect(store.SetCols(context.Background(), hnsw, keys, vals, store.WithMetadata(metadata))).To(Succeed())
+
+			_, vs, _, ms, err := store.FindWithMetadata(context.Background(), hnsw, keys[1], 10, store.WithFilter([]byte(`{"even": true}`)))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(vs).To(HaveLen(10))
+			Expect(vs).ToNot(ContainElement([]byte("1")))
+			for _, m := range ms {
+				Expect(m).To(MatchJSON(`{"even": true}`))
+			}
+		})
+	})
+
+	Context("Metadata and namespaces", func() {
+		var sl *model.ModelLoader
+		var sc grpc.Backend
+		var tmpdir string
+
+		load := func() {
+			var err error
+
+			sc, err = sl.Load(
+				model.WithBackendString(model.LocalStoreBackend),
+				model.WithModel("test"),
+				model.WithModelID("test"),
+				model.WithLoadGRPCLoadModelOpts(&proto.ModelOptions{
+					Options: []string{"persistence_path:" + filepath.Join(tmpdir, "test")},
+				}),
+			)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sc).ToNot(BeNil())
+		}
+
+		keys := [][]float32{{0.1, 0.2, 0.3}, {0.4, 0.5, 0.6}, {0.7, 0.8, 0.9}}
+		vals := [][]byte{[]byte("test1"), []byte("test2"), []byte("test3")}
+		metadata := [][]byte{
+			[]byte(`{"type": "article", "year": 2019, "tags": ["go", "ai"]}`),
+			[]byte(`{"type": "article", "year": 2023, "author": {"name": "ada"}}`),
+			[]byte(`{"type": "note", "year": 2024}`),
+		}
+
+		findValues := func(filter string, opts ...store.Option) []string {
+			if filter != "" {
+				opts = append(opts, store.WithFilter([]byte(filter)))
+			}
+			_, vs, _, err := store.Find(context.Background(), sc, []float32{0.1, 0.2, 0.3}, 3, opts...)
+			Expect(err).ToNot(HaveOccurred())
+			found := make([]string, len(vs))
+			for i, v := range vs {
+				found[i] = string(v)
+			}
+			return found
+		}
+
+		BeforeEach(func() {
+			var err error
+
+			tmpdir, err = os.MkdirTemp("", "")
+			Expect(err).ToNot(HaveOccurred())
+
+			sl = model.NewModelLoader("", false)
+			load()
+
+			Expect(store.SetCols(context.Background(), sc, keys, vals, store.WithMetadata(metadata))).To(Succeed())
+		})
+
+		AfterEach(func() {
+			err := sl.StopAllGRPC()
+			Expect(err).ToNot(HaveOccurred())
+			err = os.RemoveAll(tmpdir)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("returns the metadata of the keys", func() {
+			_, _, ms, err := store.GetColsWithMetadata(context.Background(), sc, keys[:2])
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ms).To(HaveLen(2))
+			Expect(ms[0]).To(MatchJSON(metadata[0]))
+			Expect(ms[1]).To(MatchJSON(metadata[1]))
+		})
+
+		It("filters the keys found", func() {
+			Expect(findValues("")).To(ConsistOf("test1", "test2", "test3"))
+			Expect(findValues(`{"type": "article"}`)).To(ConsistOf("test1", "test2"))
+			Expect(findValues(`{"year": {"$gte": 2020, "$lt": 2024}}`)).To(ConsistOf("test2"))
+			Expect(findValues(`{"type": {"$in": ["note", "memo"]}}`)).To(ConsistOf("test3"))
+			Expect(findValues(`{"type": {"$ne": "note"}, "tags": "go"}`)).To(ConsistOf("test1"))
+			Expect(findValues(`{"author.name": "ada"}`)).To(ConsistOf("test2"))
+			Expect(findValues(`{"author": {"$exists": false}}`)).To(ConsistOf("test1", "test3"))
+			Expect(findValues(`{"$or": [{"year": 2019}, {"type": "note"}]}`)).To(ConsistOf("test1", "test3"))
+			Expect(findValues(`{"type": "video"}`)).To(BeEmpty())
+		})
+
+		It("rejects invalid filters and metadata", func() {
+			_, _, _, err := store.Find(context.Background(), sc, keys[0], 3, store.WithFilter([]byte(`{"year": {"$near": 2020}}`)))
+			Expect(err).To(HaveOccurred())
+			_, _, _, err = store.Find(context.Background(), sc, keys[0], 3, store.WithFilter([]byte(`[1, 2]`)))
+			Expect(err).To(HaveOccurred())
+
+			err = store.SetSingle(context.Background(), sc, []float32{0.3, 0.2, 0.1}, []byte("test4"), store.WithMetadata([][]byte{[]byte(`"article"`)}))
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("keeps the namespaces apart", func() {
+			tenant := store.WithNamespace("tenant-a")
+
+			Expect(findValues("", tenant)).To(BeEmpty())
+
+			err := store.SetSingle(context.Background(), sc, keys[0], []byte("tenant1"), tenant, store.WithMetadata([][]byte{[]byte(`{"type": "article"}`)}))
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(findValues(`{"type": "article"}`, tenant)).To(Equal([]string{"tenant1"}))
+			Expect(findValues(`{"type": "article"}`)).To(ConsistOf("test1", "test2"))
+
+			Expect(store.DeleteSingle(context.Background(), sc, keys[0], tenant)).To(Succeed())
+			Expect(findValues("", tenant)).To(BeEmpty())
+			Expect(findValues("")).To(ConsistOf("test1", "test2", "test3"))
+
+			err = store.SetSingle(context.Background(), sc, keys[0], []byte("invalid"), store.WithNamespace("../escape"))
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("keeps the metadata and the namespaces across restarts and compactions", func() {
+			tenant := store.WithNamespace("tenant-a")
+			err := store.SetSingle(context.Background(), sc, keys[1], []byte("tenant2"), tenant, store.WithMetadata([][]byte{[]byte(`{"year": 2025}`)}))
+			Expect(err).ToNot(HaveOccurred())
+
+			_, entries, err := store.Snapshot(context.Background(), sc, "")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entries).To(Equal(int64(3)))
+			err = store.SetSingle(context.Background(), sc, []float32{0.3, 0.2, 0.1}, []byte("test4"), store.WithMetadata([][]byte{[]byte(`{"type": "note"}`)}))
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(sl.StopAllGRPC()).To(Succeed())
+			load()
+
+			Expect(findValues(`{"type": "note"}`)).To(ConsistOf("test3", "test4"))
+			Expect(findValues(`{"year": {"$gt": 2024}}`, tenant)).To(Equal([]string{"tenant2"}))
+		})
+	})
 })